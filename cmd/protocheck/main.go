@@ -0,0 +1,41 @@
+// Command protocheck fails if the compiled todo.v1 API has breaking changes
+// compared to the checked-in baseline. Run it with -update after a release to
+// lock in what was added.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/fuzail/08-todosvc/internal/protocheck"
+	pb "github.com/fuzail/08-todosvc/proto/todo/v1"
+)
+
+func main() {
+	baseline := flag.String("baseline", "proto/todo/v1/baseline.json", "baseline descriptor to compare against")
+	update := flag.Bool("update", false, "overwrite the baseline with the current API")
+	flag.Parse()
+
+	cur := protocheck.Describe(pb.File_todo_v1_todo_proto)
+	if *update {
+		if err := protocheck.Save(*baseline, cur); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	base, err := protocheck.Load(*baseline)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	problems := protocheck.Breaking(base, cur)
+	for _, p := range problems {
+		fmt.Fprintln(os.Stderr, p)
+	}
+	if len(problems) > 0 {
+		fmt.Fprintf(os.Stderr, "%d breaking change(s) against %s\n", len(problems), *baseline)
+		os.Exit(1)
+	}
+}
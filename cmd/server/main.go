@@ -3,7 +3,7 @@ package main
 import (
 	"context"
 	"flag"
-	"log"
+	"log/slog"
 	"net"
 	"net/http"
 	"os"
@@ -12,100 +12,252 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/fuzail/08-todosvc/internal/auth"
+	"github.com/fuzail/08-todosvc/internal/caldav"
+	"github.com/fuzail/08-todosvc/internal/config"
+	"github.com/fuzail/08-todosvc/internal/graphql"
 	"github.com/fuzail/08-todosvc/internal/grpc"
+	"github.com/fuzail/08-todosvc/internal/grpcweb"
+	"github.com/fuzail/08-todosvc/internal/health"
+	"github.com/fuzail/08-todosvc/internal/logging"
+	"github.com/fuzail/08-todosvc/internal/metrics"
+	"github.com/fuzail/08-todosvc/internal/ratelimit"
 	"github.com/fuzail/08-todosvc/internal/rest"
+	"github.com/fuzail/08-todosvc/internal/tlsconfig"
 	"github.com/fuzail/08-todosvc/internal/todo"
+	"github.com/fuzail/08-todosvc/internal/tracing"
 	"github.com/fuzail/08-todosvc/pkg/db"
-	pb "github.com/fuzail/08-todosvc/proto"
+	"github.com/fuzail/08-todosvc/pkg/storage"
+	pb "github.com/fuzail/08-todosvc/proto/todo/v1"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 	grpcObj "google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 )
 
-func envInt(key string, defaultVal int) int {
-	v := os.Getenv(key)
-	if v == "" {
-		return defaultVal
-	}
-	i, err := strconv.Atoi(v)
-	if err != nil {
-		return defaultVal
-	}
-	return i
+// fatal logs err and exits; slog has no Fatal level.
+func fatal(msg string, err error) {
+	slog.Error(msg, "err", err)
+	os.Exit(1)
 }
 
 func main() {
-	var migrateOnly bool
-	flag.BoolVar(&migrateOnly, "migrate-only", false, "run migrations and exit")
+	loader := config.NewLoader(flag.CommandLine)
+	migrateOnly := flag.Bool("migrate-only", false, "run migrations and exit")
+	printConfig := flag.Bool("print-config", false, "print the effective config, secrets redacted, and exit")
 	flag.Parse()
 
-	// read env with sensible defaults
-	grpcPort := os.Getenv("GRPC_PORT")
-	if grpcPort == "" {
-		grpcPort = "50051"
+	cfg, err := loader.Load()
+	if err != nil {
+		fatal("config", err)
 	}
-	httpPort := os.Getenv("HTTP_PORT")
-	if httpPort == "" {
-		httpPort = "8080"
+	if *printConfig {
+		if err := cfg.Print(os.Stdout); err != nil {
+			fatal("print config", err)
+		}
+		return
+	}
+
+	if err := logging.Setup(cfg.Log.Level); err != nil {
+		fatal("logging", err)
+	}
+	slog.Info("config loaded", "env", cfg.Env)
+
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing.Exporter)
+	if err != nil {
+		fatal("tracing", err)
 	}
 
 	// create DB
-	dbConn, err := db.NewGormDBFromEnv()
+	dbConn, err := db.NewGormDB(cfg.DBConfig())
 	if err != nil {
-		log.Fatalf("db connect: %v", err)
+		fatal("db connect", err)
+	}
+	if err := db.RegisterTracing(dbConn); err != nil {
+		fatal("db tracing", err)
 	}
+	rateCfg := cfg.RateLimitConfig()
+
 	// run AutoMigrate (recommended for dev)
-	if err := dbConn.AutoMigrate(&todo.Task{}); err != nil {
-		log.Fatalf("auto migrate: %v", err)
+	models := []interface{}{&todo.Task{}, &todo.ChangeCounter{}, &todo.Dependency{}, &todo.Comment{}, &todo.Attachment{}, &todo.Quota{}}
+	if rateCfg.Store == "postgres" {
+		// even with limits off: a reload may turn them on
+		models = append(models, &ratelimit.Bucket{})
+	}
+	if err := dbConn.AutoMigrate(models...); err != nil {
+		fatal("auto migrate", err)
 	}
-	log.Println("migrations applied (AutoMigrate)")
+	slog.Info("migrations applied (AutoMigrate)")
 
-	if migrateOnly {
-		log.Println("migrate-only flag set; exiting")
+	if *migrateOnly {
+		slog.Info("migrate-only flag set; exiting")
 		return
 	}
 
-	// wire repository and service
-	repo := todo.NewGormRepository(dbConn)
-	service := todo.NewService(repo)
+	dbStats, err := db.StatsCollector(dbConn, "todo")
+	if err != nil {
+		fatal("db stats", err)
+	}
+	metrics.Registry.MustRegister(dbStats)
 
-	// Start gRPC server
-	lis, err := net.Listen("tcp", ":"+grpcPort)
+	// wire repository and service
+	// every write to tasks, whichever API it comes through, is published
+	// to GraphQL subscribers and counted
+	events := todo.NewBroker()
+	repo := metrics.InstrumentRepository(todo.PublishChanges(todo.NewGormRepository(dbConn), events))
+	limits := cfg.TodoLimits()
+	// quotas for tenants without their own; 0 = unlimited
+	quotas := todo.NewQuotaService(todo.NewGormQuotaRepository(dbConn), cfg.DefaultQuota())
+	service := todo.NewService(repo, limits, quotas)
+	comments := todo.NewCommentService(todo.NewGormCommentRepository(dbConn), repo, limits)
+	blobs, err := storage.New(cfg.BlobConfig())
 	if err != nil {
-		log.Fatalf("failed to listen: %v", err)
+		fatal("blob store", err)
+	}
+	attachments := todo.NewAttachmentService(todo.NewGormAttachmentRepository(dbConn), repo, blobs,
+		cfg.Limits.AttachmentMaxBytes, quotas)
+
+	// TLS for both listeners; certificates reload on SIGHUP
+	tlsCfg, tlsEnabled := cfg.TLSConfig()
+	var certs *tlsconfig.Reloader
+	if tlsEnabled {
+		if certs, err = tlsconfig.NewReloader(tlsCfg); err != nil {
+			fatal("tls", err)
+		}
+	}
+	policy := auth.NewPolicy(cfg.Auth.AllowedClients, cfg.Auth.AdminClients)
+	policy.SetTenants(cfg.AuthTenants())
+	rateStore := ratelimit.NewMemoryStore()
+	if rateCfg.Store == "postgres" {
+		rateStore = ratelimit.NewGormStore(dbConn)
+	}
+	limiter := ratelimit.New(rateStore, rateCfg)
+
+	// gRPC server
+	grpcOpts := []grpcObj.ServerOption{
+		grpcObj.StatsHandler(otelgrpc.NewServerHandler()),
+		grpcObj.ChainUnaryInterceptor(auth.UnaryServerInterceptor(), logging.UnaryServerInterceptor(),
+			metrics.UnaryServerInterceptor(), limiter.UnaryServerInterceptor(), policy.UnaryServerInterceptor()),
+		grpcObj.ChainStreamInterceptor(auth.StreamServerInterceptor(), logging.StreamServerInterceptor(),
+			metrics.StreamServerInterceptor(), limiter.StreamServerInterceptor(), policy.StreamServerInterceptor()),
 	}
-	grpcServer := grpcObj.NewServer()
-	pb.RegisterTodoServiceServer(grpcServer, grpc.NewHandler(service))
+	if certs != nil {
+		grpcOpts = append(grpcOpts, grpcObj.Creds(credentials.NewTLS(certs.ServerConfig("h2"))))
+	}
+	grpcServer := grpcObj.NewServer(grpcOpts...)
+	handler := grpc.NewHandler(service, comments, attachments)
+	pb.RegisterTodoServiceServer(grpcServer, handler)
+	grpc.RegisterLegacyService(grpcServer, handler)
+	admin := grpc.NewAdminHandler(quotas, todo.NewMaintenanceService(todo.NewGormMaintenanceRepository(dbConn), blobs))
+	pb.RegisterAdminServiceServer(grpcServer, admin)
+
+	// readiness backs both /readyz and grpc.health.v1.Health
+	checker := health.NewChecker(dbConn, models, pb.TodoService_ServiceDesc.ServiceName, grpc.LegacyServiceName,
+		pb.AdminService_ServiceDesc.ServiceName)
+	checker.Register(grpcServer)
+	watchCtx, stopWatch := context.WithCancel(context.Background())
+	defer stopWatch()
+	go checker.Watch(watchCtx, 5*time.Second)
 
-	// Start HTTP server (REST wrapper calling the service directly)
+	// Start HTTP server (REST gateway calling the gRPC handler in-process)
 	mux := http.NewServeMux()
-	rest.RegisterHandlers(mux, service)
+	if err := rest.RegisterHandlers(mux, handler, attachments); err != nil {
+		fatal("rest", err)
+	}
+	if err := rest.RegisterAdminHandlers(mux, admin); err != nil {
+		fatal("rest admin", err)
+	}
+	// CalDAV for calendar and reminder apps; the tasks as VTODOs
+	caldav.RegisterHandlers(mux, service)
+	mux.Handle(graphql.Path, graphql.NewHandler(service, comments, events, cfg.GraphQLLimits()))
+	mux.Handle("/metrics", metrics.Handler())
+	mux.Handle("/livez", checker.LiveHandler())
+	mux.Handle("/readyz", checker.ReadyHandler())
+	var restHandler http.Handler = limiter.HTTPMiddleware(rest.WriteError, policy.HTTPMiddleware(rest.WriteError, mux))
+	restHandler = auth.HTTPMiddleware(logging.HTTPMiddleware(metrics.HTTPMiddleware(rest.RoutePattern, restHandler)))
+	restHandler = otelhttp.NewHandler(restHandler, "http",
+		otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+			return r.Method + " " + rest.RoutePattern(r)
+		}))
+
+	// gRPC-Web (and, on a single port, gRPC) calls skip the HTTP middleware:
+	// the gRPC interceptors log, measure and authorize them
+	var nativeGRPC http.Handler
+	if cfg.Server.SinglePort {
+		nativeGRPC = grpcServer
+	}
+	grpcWeb := grpcweb.NewHandler(grpcServer, cfg.Server.GRPCWebAllowedOrigins)
+	httpHandler := grpcweb.Router(nativeGRPC, grpcWeb, restHandler)
+	if cfg.Server.SinglePort && certs == nil {
+		// plaintext HTTP/2 (h2c) for gRPC clients; TLS negotiates h2 via ALPN
+		httpHandler = h2c.NewHandler(httpHandler, &http2.Server{})
+	}
 	httpSrv := &http.Server{
-		Addr:    ":" + httpPort,
-		Handler: mux,
+		Addr:    ":" + strconv.Itoa(cfg.Server.HTTPPort),
+		Handler: httpHandler,
+	}
+	if certs != nil {
+		httpSrv.TLSConfig = certs.ServerConfig("h2", "http/1.1")
 	}
 
 	// run servers concurrently
 	serverErrCh := make(chan error, 2)
-	go func() {
-		log.Printf("gRPC listening on %s", lis.Addr())
-		serverErrCh <- grpcServer.Serve(lis)
-	}()
+	if !cfg.Server.SinglePort {
+		lis, err := net.Listen("tcp", ":"+strconv.Itoa(cfg.Server.GRPCPort))
+		if err != nil {
+			fatal("failed to listen", err)
+		}
+		go func() {
+			slog.Info("gRPC listening", "addr", lis.Addr().String(), "tls", certs != nil, "mtls", certs != nil && certs.MutualTLS())
+			serverErrCh <- grpcServer.Serve(lis)
+		}()
+	}
 
 	go func() {
-		log.Printf("HTTP server listening on %s", httpSrv.Addr)
+		slog.Info("HTTP server listening", "addr", httpSrv.Addr, "tls", certs != nil, "single_port", cfg.Server.SinglePort)
+		if certs != nil {
+			// the certificate comes from TLSConfig
+			serverErrCh <- httpSrv.ListenAndServeTLS("", "")
+			return
+		}
 		serverErrCh <- httpSrv.ListenAndServe()
 	}()
 
+	// SIGHUP reloads the config and the TLS certificates
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func(current config.Config) {
+		for range hup {
+			current = reloadConfig(loader, current, policy, limiter)
+			if certs == nil {
+				continue
+			}
+			if err := certs.Reload(); err != nil {
+				slog.Error("tls reload failed; keeping the current certificates", "err", err)
+				continue
+			}
+			slog.Info("tls certificates reloaded")
+		}
+	}(cfg)
+
 	// graceful shutdown on signal
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
 	select {
 	case <-stop:
-		log.Println("shutdown signal received")
+		slog.Info("shutdown signal received")
 	case err := <-serverErrCh:
-		log.Printf("server error: %v", err)
+		slog.Error("server error", "err", err)
 	}
 
-	// begin graceful shutdown
+	// begin graceful shutdown; fail readiness first so load balancers drain
+	checker.Shutdown()
+	stopWatch()
+	// give load balancers time to see NOT_SERVING before connections close
+	time.Sleep(time.Duration(cfg.Server.ShutdownDrainSeconds) * time.Second)
+
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
@@ -115,12 +267,45 @@ func main() {
 	}()
 
 	if err := httpSrv.Shutdown(ctx); err != nil {
-		log.Printf("http shutdown: %v", err)
+		slog.Error("http shutdown", "err", err)
 	}
 
 	// close DB
 	sqlDB, _ := dbConn.DB()
 	_ = sqlDB.Close()
 
-	log.Println("server stopped")
+	if err := shutdownTracing(ctx); err != nil {
+		slog.Error("tracing shutdown", "err", err)
+	}
+
+	slog.Info("server stopped")
+}
+
+// reloadConfig reads the config again, applies the settings that can change
+// at runtime and returns the config now in effect. A config that doesn't
+// load is logged and ignored.
+func reloadConfig(loader *config.Loader, cfg config.Config, policy *auth.Policy, limiter *ratelimit.Limiter) config.Config {
+	next, err := loader.Load()
+	if err != nil {
+		slog.Error("config reload failed; keeping the current config", "err", err)
+		return cfg
+	}
+	merged, applied, restart := config.Reload(cfg, next)
+	if len(restart) > 0 {
+		slog.Warn("config changes need a restart to take effect", "keys", restart)
+	}
+	if len(applied) == 0 {
+		return cfg
+	}
+	if err := logging.SetLevel(merged.Log.Level); err != nil {
+		// validated by Load
+		slog.Error("log level", "err", err)
+	}
+	policy.SetClients(merged.Auth.AllowedClients, merged.Auth.AdminClients)
+	policy.SetTenants(merged.AuthTenants())
+	rateCfg := merged.RateLimitConfig()
+	limiter.SetLimits(rateCfg.Read, rateCfg.Write)
+	limiter.SetAPIKeys(rateCfg.APIKeys)
+	slog.Info("config reloaded", "keys", applied)
+	return merged
 }
@@ -0,0 +1,140 @@
+// Command todoctl operates on tasks for on-call engineers: directly on the
+// database named by the server's config, or through a running server with
+// -server. See todoctl -h.
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/fuzail/08-todosvc/internal/config"
+	"github.com/fuzail/08-todosvc/internal/reqctx"
+	"github.com/fuzail/08-todosvc/internal/todo"
+	"github.com/fuzail/08-todosvc/internal/todoctl"
+	"github.com/fuzail/08-todosvc/pkg/db"
+	"github.com/fuzail/08-todosvc/pkg/storage"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+)
+
+func main() {
+	server := flag.String("server", "", "gRPC address of a running server; without it todoctl uses the database directly")
+	caFile := flag.String("ca", "", "CA bundle to verify the server with; enables TLS")
+	certFile := flag.String("cert", "", "client certificate for mutual TLS")
+	keyFile := flag.String("key", "", "client private key for mutual TLS")
+	apiKey := flag.String("api-key", "", "API key, for rate limiting")
+	configFile := flag.String("config", "", "server config file for the database settings (env "+config.FileEnv+")")
+	tenant := flag.String("tenant", "", "tenant to create tasks for and to count in stats (all tenants if empty)")
+	format := flag.String("o", todoctl.FormatTable, "output format: table, json or csv")
+	timeout := flag.Duration("timeout", time.Minute, "give up after this long")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: todoctl [flags] command [command flags] [args]")
+		flag.PrintDefaults()
+		todoctl.Usage(os.Stderr)
+	}
+	flag.Parse()
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	if *tenant != "" {
+		ctx = reqctx.WithTenant(ctx, *tenant)
+		ctx = metadata.AppendToOutgoingContext(ctx, reqctx.TenantHeader, *tenant)
+	}
+	if *apiKey != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, "x-api-key", *apiKey)
+	}
+
+	var backend todoctl.Backend
+	var err error
+	if *server != "" {
+		backend, err = dial(*server, *caFile, *certFile, *keyFile)
+	} else {
+		backend, err = openDB(*configFile)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "todoctl:", err)
+		os.Exit(1)
+	}
+
+	app := &todoctl.App{
+		Backend: backend,
+		Format:  *format,
+		Tenant:  *tenant,
+		In:      os.Stdin,
+		Out:     os.Stdout,
+		Err:     os.Stderr,
+		Open:    func(name string) (io.ReadCloser, error) { return os.Open(name) },
+	}
+	if err := app.Run(ctx, flag.Args()); err != nil {
+		if errors.Is(err, todoctl.ErrUsage) {
+			os.Exit(2)
+		}
+		fmt.Fprintln(os.Stderr, "todoctl:", err)
+		os.Exit(1)
+	}
+}
+
+// dial connects to a server, over TLS if any TLS flag is set.
+func dial(addr, caFile, certFile, keyFile string) (todoctl.Backend, error) {
+	creds := insecure.NewCredentials()
+	if caFile != "" || certFile != "" {
+		cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+		if caFile != "" {
+			pem, err := os.ReadFile(caFile)
+			if err != nil {
+				return nil, err
+			}
+			cfg.RootCAs = x509.NewCertPool()
+			if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("%s: no certificates found", caFile)
+			}
+		}
+		if certFile != "" {
+			cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+			if err != nil {
+				return nil, fmt.Errorf("client certificate: %w", err)
+			}
+			cfg.Certificates = []tls.Certificate{cert}
+		}
+		creds = credentials.NewTLS(cfg)
+	}
+	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, err
+	}
+	// the process exits when the command is done, closing the connection
+	return todoctl.NewGRPCBackend(conn), nil
+}
+
+// openDB wires the service to the database the way the server does, from the
+// same config sources, including quotas and validation limits.
+func openDB(configFile string) (todoctl.Backend, error) {
+	loader := config.NewLoader(flag.NewFlagSet("config", flag.ContinueOnError))
+	loader.File = configFile
+	cfg, err := loader.Load()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := db.NewGormDB(cfg.DBConfig())
+	if err != nil {
+		return nil, fmt.Errorf("db connect: %w", err)
+	}
+	blobs, err := storage.New(cfg.BlobConfig())
+	if err != nil {
+		return nil, fmt.Errorf("blob store: %w", err)
+	}
+	quotas := todo.NewQuotaService(todo.NewGormQuotaRepository(conn), cfg.DefaultQuota())
+	return todoctl.NewLocalBackend(
+		todo.NewService(todo.NewGormRepository(conn), cfg.TodoLimits(), quotas),
+		todo.NewMaintenanceService(todo.NewGormMaintenanceRepository(conn), blobs),
+	), nil
+}
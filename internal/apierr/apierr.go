@@ -0,0 +1,133 @@
+// Package apierr translates errors returned by the todo services into gRPC
+// statuses and HTTP status codes. It is the only place that mapping lives:
+// the gRPC handlers return Status(ctx, err) and the REST layer reads the
+// HTTP status back with HTTPStatus.
+package apierr
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/fuzail/08-todosvc/internal/todo"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/protoadapt"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// Domain is the ErrorInfo domain attached to every domain error.
+const Domain = "todosvc"
+
+// statusClientClosed is the non-standard code nginx and the gateway use for
+// requests the client gave up on.
+const statusClientClosed = 499
+
+type mapping struct {
+	code codes.Code
+	http int
+}
+
+// kinds maps each todo.Kind to its transport codes. Precondition failures are
+// 409 rather than the gateway's default 400: the request is well-formed, the
+// task's state is what conflicts. A used-up quota is 403, not 429: waiting
+// doesn't help until the tenant frees something up or gets a bigger quota.
+var kinds = map[todo.Kind]mapping{
+	todo.KindInvalid:      {codes.InvalidArgument, http.StatusBadRequest},
+	todo.KindNotFound:     {codes.NotFound, http.StatusNotFound},
+	todo.KindConflict:     {codes.AlreadyExists, http.StatusConflict},
+	todo.KindPrecondition: {codes.FailedPrecondition, http.StatusConflict},
+	todo.KindPermission:   {codes.PermissionDenied, http.StatusForbidden},
+	todo.KindTooLarge:     {codes.ResourceExhausted, http.StatusRequestEntityTooLarge},
+	todo.KindRateLimited:  {codes.ResourceExhausted, http.StatusTooManyRequests},
+	todo.KindQuota:        {codes.ResourceExhausted, http.StatusForbidden},
+}
+
+// Error is a gRPC status that also carries the HTTP status REST should answer
+// with. grpc-go and the gateway find the status through GRPCStatus.
+type Error struct {
+	st         *status.Status
+	httpStatus int
+}
+
+func (e *Error) Error() string {
+	return e.st.Message()
+}
+
+func (e *Error) GRPCStatus() *status.Status {
+	return e.st
+}
+
+func (e *Error) HTTPStatus() int {
+	return e.httpStatus
+}
+
+// Status converts err into a gRPC status error. A *todo.Error keeps its
+// message and gets an ErrorInfo detail with its reason, for validation
+// errors a BadRequest detail with the field violations, for quota errors a
+// QuotaFailure detail naming the quota, and a RetryInfo
+// detail when it has a RetryAfter. Errors that already
+// carry a status pass through. Anything else is logged and reported as an
+// opaque Internal error so storage details don't leak to clients.
+func Status(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+	var de *todo.Error
+	switch {
+	case errors.As(err, &de):
+		m, ok := kinds[de.Kind]
+		if !ok {
+			m = mapping{codes.Unknown, http.StatusInternalServerError}
+		}
+		details := []protoadapt.MessageV1{&errdetails.ErrorInfo{Reason: de.Reason, Domain: Domain}}
+		if de.Kind == todo.KindQuota {
+			qf := &errdetails.QuotaFailure{}
+			for _, v := range de.Violations {
+				qf.Violations = append(qf.Violations, &errdetails.QuotaFailure_Violation{Subject: v.Field, Description: v.Description})
+			}
+			details = append(details, qf)
+		} else if len(de.Violations) > 0 {
+			br := &errdetails.BadRequest{}
+			for _, v := range de.Violations {
+				desc := v.Description
+				if len(de.Violations) == 1 && err != error(de) {
+					// a wrapped sentinel, e.g. ErrInvalidRecurrence with the reason
+					desc = err.Error()
+				}
+				br.FieldViolations = append(br.FieldViolations, &errdetails.BadRequest_FieldViolation{Field: v.Field, Description: desc})
+			}
+			details = append(details, br)
+		}
+		if de.RetryAfter > 0 {
+			details = append(details, &errdetails.RetryInfo{RetryDelay: durationpb.New(de.RetryAfter)})
+		}
+		st := status.New(m.code, err.Error())
+		if withDetails, derr := st.WithDetails(details...); derr == nil {
+			st = withDetails
+		}
+		return &Error{st: st, httpStatus: m.http}
+	case errors.Is(err, context.Canceled):
+		return &Error{st: status.New(codes.Canceled, "request canceled"), httpStatus: statusClientClosed}
+	case errors.Is(err, context.DeadlineExceeded):
+		return &Error{st: status.New(codes.DeadlineExceeded, "deadline exceeded"), httpStatus: http.StatusGatewayTimeout}
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	slog.ErrorContext(ctx, "internal error", "err", err)
+	return &Error{st: status.New(codes.Internal, "internal error"), httpStatus: http.StatusInternalServerError}
+}
+
+// HTTPStatus returns the HTTP status code for err. Errors produced by Status
+// carry their own; other gRPC statuses use the gateway's code table.
+func HTTPStatus(err error) int {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.httpStatus
+	}
+	return runtime.HTTPStatusFromCode(status.Code(err))
+}
@@ -0,0 +1,297 @@
+// Package auth identifies callers by their verified TLS client certificate
+// and authorizes them against allowlists of identities: one for the API and
+// one for the admin API. It also decides which tenant a caller acts for.
+//
+// Identification and authorization are separate middleware so the access log
+// and metrics, which sit between them, see the client of denied requests too.
+package auth
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"sync/atomic"
+
+	"github.com/fuzail/08-todosvc/internal/apierr"
+	"github.com/fuzail/08-todosvc/internal/reqctx"
+	"github.com/fuzail/08-todosvc/internal/todo"
+	pb "github.com/fuzail/08-todosvc/proto/todo/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// Identify returns the identity in the leaf certificate of a verified client
+// chain. ok is false for plaintext connections and clients without a
+// certificate.
+func Identify(state *tls.ConnectionState) (c reqctx.Client, ok bool) {
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return c, false
+	}
+	cert := state.VerifiedChains[0][0]
+	for _, u := range cert.URIs {
+		c.Names = append(c.Names, u.String())
+	}
+	c.Names = append(c.Names, cert.DNSNames...)
+	c.Names = append(c.Names, cert.EmailAddresses...)
+	if cert.Subject.CommonName != "" {
+		c.Names = append(c.Names, cert.Subject.CommonName)
+	}
+	return c, true
+}
+
+func identifyPeer(ctx context.Context) context.Context {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ctx
+	}
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok {
+		return ctx
+	}
+	if c, ok := Identify(&info.State); ok {
+		return reqctx.WithClient(ctx, c)
+	}
+	return ctx
+}
+
+// HTTPMiddleware stores the verified client identity in the request context.
+func HTTPMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if c, ok := Identify(r.TLS); ok {
+			r = r.WithContext(reqctx.WithClient(r.Context(), c))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// UnaryServerInterceptor stores the verified client identity in the context.
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		return handler(identifyPeer(ctx), req)
+	}
+}
+
+// StreamServerInterceptor is UnaryServerInterceptor for streaming RPCs.
+func StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return handler(srv, &contextStream{ServerStream: ss, ctx: identifyPeer(ss.Context())})
+	}
+}
+
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextStream) Context() context.Context {
+	return s.ctx
+}
+
+// Probes must work without a client certificate, so they are never
+// authorized.
+var (
+	publicPaths        = map[string]bool{"/healthz": true, "/livez": true, "/readyz": true}
+	publicMethodPrefix = "/grpc.health.v1.Health/"
+)
+
+// The admin API, over gRPC and REST.
+var (
+	adminMethodPrefix = "/" + pb.AdminService_ServiceDesc.ServiceName + "/"
+	adminPathPrefix   = "/v1/admin/"
+)
+
+// Policy decides which clients may call the API and the admin API, and for
+// which tenants.
+type Policy struct {
+	names   atomic.Pointer[policyNames]
+	tenants atomic.Pointer[map[string][]string]
+}
+
+type policyNames struct {
+	allowed map[string]bool
+	admins  map[string]bool
+}
+
+// NewPolicy allows clients whose certificate carries any of the given names
+// (see reqctx.Client). With no allowed names, every caller may use the API;
+// whether a certificate is needed at all is then up to the TLS config.
+//
+// The admin API is only open to admins. With no admins it is closed; "*"
+// opens it to every caller, which is meant for development.
+func NewPolicy(allowed, admins []string) *Policy {
+	p := &Policy{}
+	p.SetClients(allowed, admins)
+	p.SetTenants(nil)
+	return p
+}
+
+// SetClients replaces the allowed and admin names; calls in flight keep the
+// names they were checked against.
+func (p *Policy) SetClients(allowed, admins []string) {
+	p.names.Store(&policyNames{allowed: nameSet(allowed), admins: nameSet(admins)})
+}
+
+// SetTenants replaces the tenants of each client, keyed by certificate name.
+// A client acts for its first tenant unless it asks for another of its
+// tenants with X-Tenant-ID.
+func (p *Policy) SetTenants(tenants map[string][]string) {
+	if tenants == nil {
+		tenants = map[string][]string{}
+	}
+	p.tenants.Store(&tenants)
+}
+
+// Tenant returns the tenant the client in ctx acts for: requested if it is
+// one of the client's tenants, else the client's first. Clients without
+// tenants, and callers without a certificate, act for todo.DefaultTenant.
+// Asking for any other tenant is an error matching todo.ErrPermissionDenied;
+// the tenant is never taken from the request alone.
+func (p *Policy) Tenant(ctx context.Context, requested string) (string, error) {
+	tenants := []string{todo.DefaultTenant}
+	if c, ok := reqctx.ClientFrom(ctx); ok {
+		byName := *p.tenants.Load()
+		for _, name := range c.Names {
+			if t := byName[name]; len(t) > 0 {
+				tenants = t
+				break
+			}
+		}
+	}
+	if requested == "" {
+		return tenants[0], nil
+	}
+	if !slices.Contains(tenants, requested) {
+		return "", fmt.Errorf("tenant %q: %w", requested, todo.ErrPermissionDenied)
+	}
+	return requested, nil
+}
+
+func nameSet(names []string) map[string]bool {
+	set := map[string]bool{}
+	for _, name := range names {
+		if name = strings.TrimSpace(name); name != "" {
+			set[name] = true
+		}
+	}
+	return set
+}
+
+// Authorize returns an error matching todo.ErrPermissionDenied unless the
+// client in ctx may use the API.
+func (p *Policy) Authorize(ctx context.Context) error {
+	allowed := p.names.Load().allowed
+	if len(allowed) == 0 {
+		return nil
+	}
+	return match(ctx, allowed)
+}
+
+// AuthorizeAdmin is Authorize for the admin API.
+func (p *Policy) AuthorizeAdmin(ctx context.Context) error {
+	admins := p.names.Load().admins
+	if admins["*"] {
+		return nil
+	}
+	if len(admins) == 0 {
+		return fmt.Errorf("admin API disabled: %w", todo.ErrPermissionDenied)
+	}
+	return match(ctx, admins)
+}
+
+func match(ctx context.Context, names map[string]bool) error {
+	c, ok := reqctx.ClientFrom(ctx)
+	if !ok {
+		return fmt.Errorf("no verified client certificate: %w", todo.ErrPermissionDenied)
+	}
+	for _, name := range c.Names {
+		if names[name] {
+			return nil
+		}
+	}
+	return fmt.Errorf("client %q: %w", c.String(), todo.ErrPermissionDenied)
+}
+
+// HTTPMiddleware rejects requests from clients the policy doesn't allow,
+// writing the error with deny, and stores the tenant of the others in the
+// request context. It must run inside the package-level HTTPMiddleware.
+func (p *Policy) HTTPMiddleware(deny func(http.ResponseWriter, *http.Request, error), next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorize := p.Authorize
+		if strings.HasPrefix(r.URL.Path, adminPathPrefix) {
+			authorize = p.AuthorizeAdmin
+		}
+		if !publicPaths[r.URL.Path] {
+			ctx, err := p.authorizeTenant(r.Context(), authorize, r.Header.Get(reqctx.TenantHeader))
+			if err != nil {
+				slog.WarnContext(r.Context(), "request denied", "err", err)
+				deny(w, r, apierr.Status(r.Context(), err))
+				return
+			}
+			r = r.WithContext(ctx)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// authorizeTenant authorizes the client in ctx and stores the tenant it acts
+// for, given the one it asked for.
+func (p *Policy) authorizeTenant(ctx context.Context, authorize func(context.Context) error, requested string) (context.Context, error) {
+	if err := authorize(ctx); err != nil {
+		return ctx, err
+	}
+	tenant, err := p.Tenant(ctx, requested)
+	if err != nil {
+		return ctx, err
+	}
+	return reqctx.WithTenant(ctx, tenant), nil
+}
+
+// UnaryServerInterceptor rejects calls from clients the policy doesn't allow
+// and stores the tenant of the others in the context, given the x-tenant-id
+// metadata. It must run after the package-level UnaryServerInterceptor.
+func (p *Policy) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := p.authorizeMethod(ctx, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor is UnaryServerInterceptor for streaming RPCs.
+func (p *Policy) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := p.authorizeMethod(ss.Context(), info.FullMethod)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &contextStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+func (p *Policy) authorizeMethod(ctx context.Context, method string) (context.Context, error) {
+	if strings.HasPrefix(method, publicMethodPrefix) {
+		return ctx, nil
+	}
+	authorize := p.Authorize
+	if strings.HasPrefix(method, adminMethodPrefix) {
+		authorize = p.AuthorizeAdmin
+	}
+	var requested string
+	if v := metadata.ValueFromIncomingContext(ctx, strings.ToLower(reqctx.TenantHeader)); len(v) > 0 {
+		requested = v[0]
+	}
+	ctx, err := p.authorizeTenant(ctx, authorize, requested)
+	if err != nil {
+		slog.WarnContext(ctx, "request denied", "method", method, "err", err)
+		return ctx, apierr.Status(ctx, err)
+	}
+	return ctx, nil
+}
@@ -0,0 +1,218 @@
+package caldav
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/emersion/go-ical"
+	"github.com/emersion/go-webdav"
+	"github.com/emersion/go-webdav/caldav"
+	"github.com/fuzail/08-todosvc/internal/taskio"
+	"github.com/fuzail/08-todosvc/internal/todo"
+)
+
+var calendar = caldav.Calendar{
+	Path:                  CalendarPath,
+	Name:                  "Tasks",
+	MaxResourceSize:       maxObjectSize,
+	SupportedComponentSet: []string{ical.CompToDo},
+}
+
+var (
+	errNotFound  = webdav.NewHTTPError(http.StatusNotFound, errors.New("caldav: no such resource"))
+	errNotObject = webdav.NewHTTPError(http.StatusMethodNotAllowed, errors.New("caldav: not a calendar object"))
+
+	errPreconditionFailed = webdav.NewHTTPError(http.StatusPreconditionFailed, errors.New("caldav: precondition failed"))
+)
+
+// backend is the caldav.Backend of the tasks calendar.
+type backend struct {
+	svc todo.Service
+}
+
+var _ caldav.Backend = (*backend)(nil)
+
+func (b *backend) CurrentUserPrincipal(context.Context) (string, error) {
+	return PrincipalPath, nil
+}
+
+func (b *backend) CalendarHomeSetPath(context.Context) (string, error) {
+	return homePath, nil
+}
+
+func (b *backend) CreateCalendar(context.Context, *caldav.Calendar) error {
+	return webdav.NewHTTPError(http.StatusForbidden, errors.New("caldav: the tasks calendar is the only one"))
+}
+
+func (b *backend) ListCalendars(context.Context) ([]caldav.Calendar, error) {
+	return []caldav.Calendar{calendar}, nil
+}
+
+func (b *backend) GetCalendar(_ context.Context, path string) (*caldav.Calendar, error) {
+	if tg, ok := parseTarget(path); !ok || tg.kind != kindCalendar {
+		return nil, errNotFound
+	}
+	cal := calendar
+	return &cal, nil
+}
+
+// GetCalendarObject answers under path, which may be a name other than
+// objectHref, so multiget responses name what the client asked for.
+func (b *backend) GetCalendarObject(ctx context.Context, path string, _ *caldav.CalendarCompRequest) (*caldav.CalendarObject, error) {
+	tg, ok := parseTarget(path)
+	if !ok || tg.kind != kindObject {
+		return nil, errNotFound
+	}
+	t, err := b.svc.GetTask(ctx, tg.id)
+	if err != nil {
+		return nil, httpError(ctx, err)
+	}
+	return object(t, path), nil
+}
+
+func (b *backend) ListCalendarObjects(ctx context.Context, path string, _ *caldav.CalendarCompRequest) ([]caldav.CalendarObject, error) {
+	return b.QueryCalendarObjects(ctx, path, nil)
+}
+
+// QueryCalendarObjects returns the tasks matching the filter of q, or all
+// of them if q is nil. Recurring tasks are matched as their open
+// occurrence; the rule isn't expanded.
+func (b *backend) QueryCalendarObjects(ctx context.Context, path string, q *caldav.CalendarQuery) ([]caldav.CalendarObject, error) {
+	tg, ok := parseTarget(path)
+	if !ok {
+		return nil, errNotFound
+	}
+	var f *filter
+	if q != nil {
+		var err error
+		if f, err = compileFilter(&q.CompFilter); err != nil {
+			return nil, err
+		}
+	}
+	var objects []caldav.CalendarObject
+	add := func(t *todo.Task) error {
+		if f != nil && !f.match(t) {
+			return nil
+		}
+		objects = append(objects, *object(t, objectHref(t.ID)))
+		return nil
+	}
+	if tg.kind == kindObject {
+		t, err := b.svc.GetTask(ctx, tg.id)
+		if err != nil {
+			return nil, httpError(ctx, err)
+		}
+		return objects, add(t)
+	}
+	if err := b.svc.ExportTasks(ctx, add); err != nil {
+		return nil, httpError(ctx, err)
+	}
+	return objects, nil
+}
+
+// PutCalendarObject creates or replaces a task. The task id comes from the
+// resource name, not from the UID, which is replaced by the id. Since the
+// stored task then differs from what was sent, no ETag is returned (RFC
+// 4791 section 5.3.4); clients fetch it again. A conditional PUT only writes
+// the version of the task its conditions were checked against, so a write
+// in between fails it with 412 rather than being lost.
+func (b *backend) PutCalendarObject(ctx context.Context, path string, cal *ical.Calendar, opts *caldav.PutCalendarObjectOptions) (*caldav.CalendarObject, error) {
+	tg, ok := parseTarget(path)
+	if !ok || tg.kind != kindObject {
+		return nil, errNotObject
+	}
+	t, err := decodeObject(cal)
+	if err != nil {
+		return nil, err
+	}
+	existing, err := b.svc.GetTask(ctx, tg.id)
+	if errors.Is(err, todo.ErrNotFound) {
+		existing, err = nil, nil
+	}
+	if err != nil {
+		return nil, httpError(ctx, err)
+	}
+	if !putConditionsMet(opts, existing) {
+		return nil, errPreconditionFailed
+	}
+	conditional := opts.IfMatch != "" || opts.IfNoneMatch != ""
+	t.ID = tg.id
+	if existing == nil {
+		_, err = b.svc.ImportTask(ctx, t, false)
+		if conditional && errors.Is(err, todo.ErrAlreadyExists) {
+			// created since it was found missing
+			return nil, errPreconditionFailed
+		}
+	} else {
+		if conditional {
+			t.ChangeSeq = existing.ChangeSeq
+		}
+		_, err = b.svc.ReplaceTask(ctx, t)
+		if errors.Is(err, todo.ErrTaskModified) {
+			return nil, errPreconditionFailed
+		}
+	}
+	if err != nil {
+		return nil, httpError(ctx, err)
+	}
+	return &caldav.CalendarObject{Path: objectHref(tg.id)}, nil
+}
+
+// putConditionsMet applies If-Match and If-None-Match to a write of the
+// resource holding t, which is nil if there is none. Clients send
+// If-None-Match: * to create without overwriting and If-Match with the ETag
+// they last saw to update without losing someone else's change.
+func putConditionsMet(opts *caldav.PutCalendarObjectOptions, t *todo.Task) bool {
+	if m := string(opts.IfMatch); m != "" && (t == nil || !etagListHas(m, etag(t))) {
+		return false
+	}
+	if m := string(opts.IfNoneMatch); m != "" && t != nil && etagListHas(m, etag(t)) {
+		return false
+	}
+	return true
+}
+
+func (b *backend) DeleteCalendarObject(ctx context.Context, path string) error {
+	tg, ok := parseTarget(path)
+	if !ok || tg.kind != kindObject {
+		return errNotObject
+	}
+	if err := b.svc.DeleteTask(ctx, tg.id); err != nil {
+		return httpError(ctx, err)
+	}
+	return nil
+}
+
+// object returns the calendar object resource of t, a VCALENDAR with one
+// VTODO, named path.
+func object(t *todo.Task, path string) *caldav.CalendarObject {
+	cal := ical.NewCalendar()
+	cal.Props.SetText(ical.PropVersion, "2.0")
+	cal.Props.SetText(ical.PropProductID, taskio.ProdID)
+	cal.Children = append(cal.Children, taskio.ToDo(t))
+	return &caldav.CalendarObject{Path: path, ModTime: t.UpdatedAt, ETag: etag(t), Data: cal}
+}
+
+// decodeObject reads the task from a calendar object resource. Further
+// VTODOs with the same UID override single occurrences of a recurring task;
+// they are accepted but not stored.
+func decodeObject(cal *ical.Calendar) (todo.Task, error) {
+	comp, _, err := caldav.ValidateCalendarObject(cal)
+	if err != nil {
+		return todo.Task{}, caldav.NewPreconditionError(caldav.PreconditionValidCalendarObjectResource)
+	}
+	if comp != ical.CompToDo {
+		return todo.Task{}, caldav.NewPreconditionError(caldav.PreconditionSupportedCalendarComponent)
+	}
+	for _, child := range cal.Children {
+		if child.Name == ical.CompToDo {
+			t, err := taskio.FromToDo(child)
+			if err != nil {
+				return todo.Task{}, caldav.NewPreconditionError(caldav.PreconditionValidCalendarData)
+			}
+			return t, nil
+		}
+	}
+	return todo.Task{}, caldav.NewPreconditionError(caldav.PreconditionSupportedCalendarComponent)
+}
@@ -0,0 +1,186 @@
+// Package caldav serves the tasks as a CalDAV (RFC 4791) calendar of VTODOs,
+// so calendar and reminder apps can list, create, edit and delete them. The
+// protocol is go-webdav's caldav.Handler; this package is its backend over
+// todo.Service, plus the request size limit and the conditional requests
+// the handler leaves to backends.
+//
+// The layout is fixed: one principal, PrincipalPath, whose calendar home
+// holds one calendar, CalendarPath, with a <task id>.ics resource per task.
+// ETags are the task's ChangeSeq, so every write changes them.
+package caldav
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/emersion/go-webdav"
+	"github.com/emersion/go-webdav/caldav"
+	"github.com/fuzail/08-todosvc/internal/apierr"
+	"github.com/fuzail/08-todosvc/internal/taskio"
+	"github.com/fuzail/08-todosvc/internal/todo"
+)
+
+const (
+	// Prefix is the path everything CalDAV is served under.
+	Prefix = "/dav/"
+	// WellKnownPath redirects to PrincipalPath (RFC 6764), so clients given
+	// only the server's address find the calendar.
+	WellKnownPath = "/.well-known/caldav"
+	// PrincipalPath is the principal every client is; it is the
+	// current-user-principal and names the calendar home.
+	PrincipalPath = Prefix + "me/"
+	// CalendarPath is the calendar of the tasks.
+	CalendarPath = homePath + "tasks/"
+
+	homePath  = PrincipalPath + "calendars/"
+	objectExt = ".ics"
+)
+
+// maxObjectSize bounds the body of a PUT and of a PROPFIND or REPORT
+// request.
+const maxObjectSize = 1 << 20
+
+type handler struct {
+	svc todo.Service
+	dav http.Handler
+}
+
+// RegisterHandlers serves CalDAV on mux under Prefix and WellKnownPath.
+// Service errors get the HTTP status the REST API gives them.
+func RegisterHandlers(mux *http.ServeMux, svc todo.Service) {
+	h := &handler{
+		svc: svc,
+		dav: &caldav.Handler{Backend: &backend{svc: svc}, Prefix: strings.TrimSuffix(Prefix, "/")},
+	}
+	mux.Handle(Prefix, h)
+	mux.Handle(WellKnownPath, h)
+}
+
+// RoutePattern returns the metrics label for a CalDAV path, and false for
+// other paths.
+func RoutePattern(path string) (string, bool) {
+	switch {
+	case path == WellKnownPath || path == Prefix || path == PrincipalPath || path == homePath || path == CalendarPath:
+		return path, true
+	case strings.HasPrefix(path, CalendarPath):
+		return CalendarPath + "{object}", true
+	case strings.HasPrefix(path, Prefix):
+		return "other", true
+	}
+	return "", false
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.ContentLength > maxObjectSize {
+		http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxObjectSize)
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodDelete:
+		if !h.conditionsMet(w, r) {
+			return
+		}
+	}
+	h.dav.ServeHTTP(w, r)
+}
+
+// conditionsMet applies If-Match and If-None-Match to a GET, HEAD or DELETE
+// of an object, which caldav.Handler leaves out; PUTs are checked by the
+// backend. It writes the response and returns false when they fail.
+func (h *handler) conditionsMet(w http.ResponseWriter, r *http.Request) bool {
+	ifMatch, ifNoneMatch := r.Header.Get("If-Match"), r.Header.Get("If-None-Match")
+	if ifMatch == "" && ifNoneMatch == "" {
+		return true
+	}
+	tg, ok := parseTarget(r.URL.Path)
+	if !ok || tg.kind != kindObject {
+		return true
+	}
+	t, err := h.svc.GetTask(r.Context(), tg.id)
+	if errors.Is(err, todo.ErrNotFound) {
+		t, err = nil, nil
+	}
+	if err != nil {
+		serveError(w, r, err)
+		return false
+	}
+	switch {
+	case ifMatch != "" && (t == nil || !etagListHas(ifMatch, etag(t))):
+		w.WriteHeader(http.StatusPreconditionFailed)
+	case ifNoneMatch != "" && t != nil && etagListHas(ifNoneMatch, etag(t)):
+		w.Header().Set("ETag", `"`+etag(t)+`"`)
+		if r.Method == http.MethodDelete {
+			w.WriteHeader(http.StatusPreconditionFailed)
+		} else {
+			w.WriteHeader(http.StatusNotModified)
+		}
+	default:
+		return true
+	}
+	return false
+}
+
+func serveError(w http.ResponseWriter, r *http.Request, err error) {
+	err = apierr.Status(r.Context(), err)
+	http.Error(w, err.Error(), apierr.HTTPStatus(err))
+}
+
+// httpError gives a service error the HTTP status the REST API gives it.
+func httpError(ctx context.Context, err error) error {
+	st := apierr.Status(ctx, err)
+	return webdav.NewHTTPError(apierr.HTTPStatus(st), st)
+}
+
+type kind int
+
+const (
+	kindCalendar kind = iota + 1 // CalendarPath
+	kindObject                   // a task in the calendar
+)
+
+// target is the resource a request path names.
+type target struct {
+	kind kind
+	id   string // task id of an object
+}
+
+// parseTarget maps a path in the calendar to a resource. Object names are
+// task ids with objectExt; other names map to ids as iCalendar UIDs do (see
+// taskio.TaskID), so a client that names a new task after its own UID can
+// find it again under that name.
+func parseTarget(path string) (target, bool) {
+	if path == CalendarPath || path == strings.TrimSuffix(CalendarPath, "/") {
+		return target{kind: kindCalendar}, true
+	}
+	name, ok := strings.CutPrefix(path, CalendarPath)
+	if !ok || name == "" || strings.Contains(name, "/") {
+		return target{}, false
+	}
+	return target{kind: kindObject, id: taskio.TaskID(strings.TrimSuffix(name, objectExt))}, true
+}
+
+func objectHref(id string) string {
+	return CalendarPath + id + objectExt
+}
+
+// etag changes with every write to t: it is its ChangeSeq, which each write
+// takes a new value of. It is unquoted, as go-webdav wants it.
+func etag(t *todo.Task) string {
+	return strconv.FormatInt(t.ChangeSeq, 36)
+}
+
+// etagListHas reports whether an If-Match or If-None-Match header names the
+// unquoted tag.
+func etagListHas(header, tag string) bool {
+	for _, v := range strings.Split(header, ",") {
+		v = strings.TrimSpace(v)
+		if v == "*" || strings.TrimPrefix(v, "W/") == `"`+tag+`"` {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,156 @@
+package caldav
+
+import (
+	"strings"
+	"time"
+
+	"github.com/emersion/go-ical"
+	"github.com/emersion/go-webdav/caldav"
+	"github.com/fuzail/08-todosvc/internal/taskio"
+	"github.com/fuzail/08-todosvc/internal/todo"
+)
+
+// filter is the filter of a calendar-query (RFC 4791 section 9.7), matched
+// against tasks rather than their iCalendar form. caldav.Filter can't be
+// used: it has no time-range rule for VTODOs and matches text by case.
+type filter struct {
+	caldav.CompFilter
+}
+
+const icalUTC = "20060102T150405Z"
+
+// compileFilter checks the outermost comp-filter, which must be VCALENDAR.
+// param-filters aren't supported.
+func compileFilter(cf *caldav.CompFilter) (*filter, error) {
+	if !strings.EqualFold(cf.Name, ical.CompCalendar) || !cf.Start.IsZero() || !cf.End.IsZero() {
+		return nil, caldav.NewPreconditionError("valid-filter")
+	}
+	if hasParamFilter(cf) {
+		return nil, caldav.NewPreconditionError("supported-filter")
+	}
+	return &filter{*cf}, nil
+}
+
+func hasParamFilter(cf *caldav.CompFilter) bool {
+	for _, pf := range cf.Props {
+		if len(pf.ParamFilter) > 0 {
+			return true
+		}
+	}
+	for i := range cf.Comps {
+		if hasParamFilter(&cf.Comps[i]) {
+			return true
+		}
+	}
+	return false
+}
+
+// match applies the VCALENDAR filter to the calendar object of t.
+func (f *filter) match(t *todo.Task) bool {
+	if f.IsNotDefined {
+		return false
+	}
+	props := map[string]string{"VERSION": "2.0", "PRODID": taskio.ProdID}
+	for i := range f.Props {
+		if !matchProp(&f.Props[i], props) {
+			return false
+		}
+	}
+	for i := range f.Comps {
+		if !matchTodo(&f.Comps[i], t) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchTodo applies a filter on the components of the calendar, which hold
+// only the VTODO of t.
+func matchTodo(cf *caldav.CompFilter, t *todo.Task) bool {
+	if !strings.EqualFold(cf.Name, ical.CompToDo) {
+		return cf.IsNotDefined
+	}
+	if cf.IsNotDefined {
+		return false
+	}
+	if (!cf.Start.IsZero() || !cf.End.IsZero()) && !matchTodoTime(cf.Start, cf.End, t) {
+		return false
+	}
+	props := todoProperties(t)
+	for i := range cf.Props {
+		if !matchProp(&cf.Props[i], props) {
+			return false
+		}
+	}
+	// tasks have no VALARMs or other subcomponents
+	for i := range cf.Comps {
+		if !cf.Comps[i].IsNotDefined {
+			return false
+		}
+	}
+	return true
+}
+
+// matchTodoTime follows the VTODO rules of RFC 4791 section 9.9 for the
+// properties tasks have: DUE, COMPLETED and CREATED. A zero end is
+// unbounded.
+func matchTodoTime(start, end time.Time, t *todo.Task) bool {
+	if end.IsZero() {
+		end = time.Date(9999, 12, 31, 0, 0, 0, 0, time.UTC)
+	}
+	created := t.CreatedAt.UTC()
+	completed := t.UpdatedAt.UTC()
+	switch {
+	case t.DueAt != nil:
+		return start.Before(*t.DueAt) && !end.Before(*t.DueAt)
+	case t.Completed:
+		return (!created.Before(start) || !completed.Before(start)) && (!end.Before(created) || !end.Before(completed))
+	}
+	return end.After(created)
+}
+
+func matchProp(pf *caldav.PropFilter, props map[string]string) bool {
+	v, ok := props[strings.ToUpper(pf.Name)]
+	if pf.IsNotDefined {
+		return !ok
+	}
+	if !ok {
+		return false
+	}
+	if !pf.Start.IsZero() || !pf.End.IsZero() {
+		t, err := time.Parse(icalUTC, v)
+		if err != nil || t.Before(pf.Start) || (!pf.End.IsZero() && !t.Before(pf.End)) {
+			return false
+		}
+	}
+	if pf.TextMatch == nil {
+		return true
+	}
+	// go-webdav passes on neither the collation nor negate-condition, so
+	// this is the default i;ascii-casemap substring match
+	ok = strings.Contains(asciiLower(v), asciiLower(pf.TextMatch.Text))
+	return ok != pf.TextMatch.NegateCondition
+}
+
+func asciiLower(s string) string {
+	return strings.Map(func(r rune) rune {
+		if 'A' <= r && r <= 'Z' {
+			return r + 'a' - 'A'
+		}
+		return r
+	}, s)
+}
+
+// todoProperties returns the properties of the VTODO of t, unescaped, for
+// prop-filters.
+func todoProperties(t *todo.Task) map[string]string {
+	props := map[string]string{}
+	for name, values := range taskio.ToDo(t).Props {
+		props[name] = values[0].Value
+	}
+	props[ical.PropSummary] = t.Title
+	if t.Description != "" {
+		props[ical.PropDescription] = t.Description
+	}
+	return props
+}
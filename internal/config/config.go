@@ -0,0 +1,362 @@
+// Package config holds the server's settings. They are read, lowest
+// precedence first, from built-in defaults, a YAML file, a .env file, the
+// environment and command-line flags, and validated as a whole before the
+// server starts. Settings tagged reload can change while it runs.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/fuzail/08-todosvc/internal/graphql"
+	"github.com/fuzail/08-todosvc/internal/logging"
+	"github.com/fuzail/08-todosvc/internal/ratelimit"
+	"github.com/fuzail/08-todosvc/internal/tlsconfig"
+	"github.com/fuzail/08-todosvc/internal/todo"
+	"github.com/fuzail/08-todosvc/pkg/db"
+	"github.com/fuzail/08-todosvc/pkg/storage"
+)
+
+// Each setting has a yaml key (dotted by section, which is also its flag
+// name), an env variable and a usage line. secret settings are redacted when
+// printed; reload settings are applied on SIGHUP without a restart.
+type Config struct {
+	// Env is "development" or "production"; production refuses settings
+	// that are only meant for development.
+	Env       string    `yaml:"env" env:"ENV" usage:"development or production"`
+	Server    Server    `yaml:"server"`
+	Log       Log       `yaml:"log"`
+	DB        DB        `yaml:"db"`
+	TLS       TLS       `yaml:"tls"`
+	Auth      Auth      `yaml:"auth"`
+	RateLimit RateLimit `yaml:"rate_limit"`
+	Limits    Limits    `yaml:"limits"`
+	Quota     Quota     `yaml:"quota"`
+	Blob      Blob      `yaml:"blob"`
+	GraphQL   GraphQL   `yaml:"graphql"`
+	Tracing   Tracing   `yaml:"tracing"`
+}
+
+type Server struct {
+	GRPCPort              int      `yaml:"grpc_port" env:"GRPC_PORT" usage:"gRPC port"`
+	HTTPPort              int      `yaml:"http_port" env:"HTTP_PORT" usage:"REST, gRPC-Web and metrics port"`
+	SinglePort            bool     `yaml:"single_port" env:"SINGLE_PORT" usage:"serve gRPC on the HTTP port too"`
+	GRPCWebAllowedOrigins []string `yaml:"grpc_web_allowed_origins" env:"GRPC_WEB_ALLOWED_ORIGINS" usage:"browser origins allowed to call gRPC-Web, or *"`
+	ShutdownDrainSeconds  int      `yaml:"shutdown_drain_seconds" env:"SHUTDOWN_DRAIN_SECONDS" usage:"seconds to wait after failing readiness before stopping"`
+}
+
+type Log struct {
+	Level string `yaml:"level" env:"LOG_LEVEL" reload:"true" usage:"debug, info, warn or error"`
+}
+
+type DB struct {
+	Host                   string `yaml:"host" env:"DB_HOST" usage:"Postgres host"`
+	Port                   int    `yaml:"port" env:"DB_PORT" usage:"Postgres port"`
+	User                   string `yaml:"user" env:"DB_USER" usage:"Postgres user"`
+	Password               string `yaml:"password" env:"DB_PASSWORD" secret:"true" usage:"Postgres password"`
+	Name                   string `yaml:"name" env:"DB_NAME" usage:"database name"`
+	SSLMode                string `yaml:"sslmode" env:"DB_SSLMODE" usage:"disable, allow, prefer, require, verify-ca or verify-full"`
+	MaxIdleConns           int    `yaml:"max_idle_conns" env:"DB_MAX_IDLE_CONNS" usage:"idle connections kept in the pool"`
+	MaxOpenConns           int    `yaml:"max_open_conns" env:"DB_MAX_OPEN_CONNS" usage:"connections in the pool; 0 = unlimited"`
+	ConnMaxLifetimeMinutes int    `yaml:"conn_max_lifetime_min" env:"DB_CONN_MAX_LIFETIME_MIN" usage:"minutes before a connection is replaced; 0 = never"`
+}
+
+type TLS struct {
+	CertFile     string `yaml:"cert_file" env:"TLS_CERT_FILE" usage:"server certificate (PEM); plaintext when unset"`
+	KeyFile      string `yaml:"key_file" env:"TLS_KEY_FILE" usage:"server private key (PEM)"`
+	ClientCAFile string `yaml:"client_ca_file" env:"TLS_CLIENT_CA_FILE" usage:"CA bundle for client certificates; enables mutual TLS"`
+	ClientAuth   string `yaml:"client_auth" env:"TLS_CLIENT_AUTH" usage:"require or optional"`
+}
+
+type Auth struct {
+	AllowedClients []string `yaml:"allowed_clients" env:"AUTH_ALLOWED_CLIENTS" reload:"true" usage:"client certificate names allowed to call the API; empty allows all"`
+	AdminClients   []string `yaml:"admin_clients" env:"AUTH_ADMIN_CLIENTS" reload:"true" usage:"client certificate names allowed to call the admin API, or *"`
+	// Tenants are name=tenant pairs; a name may have several tenants, the
+	// first being the one it acts for by default
+	Tenants []string `yaml:"tenants" env:"AUTH_TENANTS" reload:"true" usage:"client certificate names and the tenants they act for, as name=tenant; others act for the default tenant"`
+}
+
+type RateLimit struct {
+	Store      string  `yaml:"store" env:"RATE_LIMIT_STORE" usage:"memory or postgres"`
+	ReadRPS    float64 `yaml:"read_rps" env:"RATE_LIMIT_READ_RPS" reload:"true" usage:"read requests per second per caller; 0 = unlimited"`
+	ReadBurst  int     `yaml:"read_burst" env:"RATE_LIMIT_READ_BURST" reload:"true" usage:"read bucket size; 0 = the rate, rounded up"`
+	WriteRPS   float64 `yaml:"write_rps" env:"RATE_LIMIT_WRITE_RPS" reload:"true" usage:"write requests per second per caller; 0 = unlimited"`
+	WriteBurst int     `yaml:"write_burst" env:"RATE_LIMIT_WRITE_BURST" reload:"true" usage:"write bucket size; 0 = the rate, rounded up"`
+	// APIKeys are the X-API-Key values that get a bucket of their own; other
+	// keys are ignored
+	APIKeys []string `yaml:"api_keys" env:"RATE_LIMIT_API_KEYS" reload:"true" secret:"true" usage:"API keys that are rate limited on their own rather than by client or IP"`
+}
+
+type Limits struct {
+	TitleMaxLength       int   `yaml:"title_max_length" env:"TITLE_MAX_LENGTH" usage:"maximum task title length in characters"`
+	DescriptionMaxLength int   `yaml:"description_max_length" env:"DESCRIPTION_MAX_LENGTH" usage:"maximum task description length in characters"`
+	CommentMaxLength     int   `yaml:"comment_max_length" env:"COMMENT_MAX_LENGTH" usage:"maximum comment length in characters"`
+	PageSizeMax          int   `yaml:"page_size_max" env:"PAGE_SIZE_MAX" usage:"largest page size a list may ask for"`
+	AttachmentMaxBytes   int64 `yaml:"attachment_max_bytes" env:"ATTACHMENT_MAX_BYTES" usage:"largest attachment in bytes"`
+}
+
+type Quota struct {
+	MaxOpenTasks       int64 `yaml:"max_open_tasks" env:"QUOTA_MAX_OPEN_TASKS" usage:"default open tasks per tenant; 0 = unlimited"`
+	MaxTasksPerDay     int64 `yaml:"max_tasks_per_day" env:"QUOTA_MAX_TASKS_PER_DAY" usage:"default tasks created per tenant per day; 0 = unlimited"`
+	MaxAttachmentBytes int64 `yaml:"max_attachment_bytes" env:"QUOTA_MAX_ATTACHMENT_BYTES" usage:"default attachment bytes per tenant; 0 = unlimited"`
+}
+
+type Blob struct {
+	Store string `yaml:"store" env:"BLOB_STORE" usage:"fs or s3"`
+	FSDir string `yaml:"fs_dir" env:"BLOB_FS_DIR" usage:"directory for the fs store"`
+	S3    S3     `yaml:"s3"`
+}
+
+type S3 struct {
+	Endpoint        string `yaml:"endpoint" env:"S3_ENDPOINT" usage:"S3-compatible endpoint URL"`
+	Region          string `yaml:"region" env:"S3_REGION" usage:"S3 region"`
+	Bucket          string `yaml:"bucket" env:"S3_BUCKET" usage:"S3 bucket"`
+	AccessKeyID     string `yaml:"access_key_id" env:"S3_ACCESS_KEY_ID" usage:"S3 access key ID"`
+	SecretAccessKey string `yaml:"secret_access_key" env:"S3_SECRET_ACCESS_KEY" secret:"true" usage:"S3 secret access key"`
+	VirtualHost     bool   `yaml:"virtual_host" env:"S3_VIRTUAL_HOST" usage:"use virtual-hosted-style bucket URLs"`
+}
+
+type GraphQL struct {
+	MaxDepth      int `yaml:"max_depth" env:"GRAPHQL_MAX_DEPTH" usage:"deepest field nesting a GraphQL operation may have"`
+	MaxComplexity int `yaml:"max_complexity" env:"GRAPHQL_MAX_COMPLEXITY" usage:"most fields a GraphQL operation may resolve, lists counted at their size"`
+}
+
+type Tracing struct {
+	// the OTel SDK reads the rest of its settings (endpoint, service name,
+	// resource attributes) from the standard OTEL_* variables itself
+	Exporter string `yaml:"exporter" env:"OTEL_TRACES_EXPORTER" usage:"none, stdout or otlp"`
+}
+
+// Default returns the settings used when nothing else sets them.
+func Default() Config {
+	return Config{
+		Env: "development",
+		Server: Server{
+			GRPCPort: 50051,
+			HTTPPort: 8080,
+		},
+		Log: Log{Level: "info"},
+		DB: DB{
+			Host:                   "localhost",
+			Port:                   5432,
+			User:                   "todo",
+			Password:               "todo",
+			Name:                   "todo_db",
+			SSLMode:                "disable",
+			MaxIdleConns:           10,
+			MaxOpenConns:           100,
+			ConnMaxLifetimeMinutes: 30,
+		},
+		TLS:       TLS{ClientAuth: "require"},
+		RateLimit: RateLimit{Store: "memory"},
+		Limits: Limits{
+			TitleMaxLength:       todo.DefaultMaxTitleLength,
+			DescriptionMaxLength: todo.DefaultMaxDescriptionLength,
+			CommentMaxLength:     todo.DefaultMaxCommentLength,
+			PageSizeMax:          todo.DefaultMaxPageSize,
+			AttachmentMaxBytes:   todo.DefaultMaxAttachmentSize,
+		},
+		Blob: Blob{
+			Store: "fs",
+			FSDir: "data/blobs",
+			S3:    S3{Region: "us-east-1"},
+		},
+		GraphQL: GraphQL{
+			MaxDepth:      graphql.DefaultMaxDepth,
+			MaxComplexity: graphql.DefaultMaxComplexity,
+		},
+		Tracing: Tracing{Exporter: "none"},
+	}
+}
+
+// Validate checks every setting and returns all the problems it finds.
+func (c Config) Validate() error {
+	var errs []error
+	check := func(ok bool, key, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: "+format, append([]any{key}, args...)...))
+		}
+	}
+	oneOf := func(key, v string, allowed ...string) {
+		check(slices.Contains(allowed, v), key, "%q is not one of %s", v, strings.Join(allowed, ", "))
+	}
+	port := func(key string, p int) {
+		check(p > 0 && p < 65536, key, "%d is not a port", p)
+	}
+	notNegative := func(key string, n int64) {
+		check(n >= 0, key, "must not be negative")
+	}
+	positive := func(key string, n int64) {
+		check(n > 0, key, "must be positive")
+	}
+
+	oneOf("env", c.Env, "development", "production")
+
+	port("server.grpc_port", c.Server.GRPCPort)
+	port("server.http_port", c.Server.HTTPPort)
+	check(c.Server.SinglePort || c.Server.GRPCPort != c.Server.HTTPPort, "server.grpc_port",
+		"is the same as server.http_port; set server.single_port to share one port")
+	for _, o := range c.Server.GRPCWebAllowedOrigins {
+		u, err := url.Parse(o)
+		check(o == "*" || err == nil && u.Scheme != "" && u.Host != "" && u.Path == "",
+			"server.grpc_web_allowed_origins", "%q is not an origin like https://app.example", o)
+	}
+	notNegative("server.shutdown_drain_seconds", int64(c.Server.ShutdownDrainSeconds))
+
+	_, err := logging.ParseLevel(c.Log.Level)
+	check(err == nil, "log.level", "%q is not one of debug, info, warn, error", c.Log.Level)
+
+	check(c.DB.Host != "", "db.host", "must be set")
+	port("db.port", c.DB.Port)
+	check(c.DB.User != "", "db.user", "must be set")
+	check(c.DB.Name != "", "db.name", "must be set")
+	oneOf("db.sslmode", c.DB.SSLMode, "disable", "allow", "prefer", "require", "verify-ca", "verify-full")
+	notNegative("db.max_idle_conns", int64(c.DB.MaxIdleConns))
+	notNegative("db.max_open_conns", int64(c.DB.MaxOpenConns))
+	notNegative("db.conn_max_lifetime_min", int64(c.DB.ConnMaxLifetimeMinutes))
+
+	check((c.TLS.CertFile == "") == (c.TLS.KeyFile == ""), "tls.cert_file", "and tls.key_file must be set together")
+	check(c.TLS.ClientCAFile == "" || c.TLS.CertFile != "", "tls.client_ca_file", "needs tls.cert_file and tls.key_file")
+	oneOf("tls.client_auth", c.TLS.ClientAuth, "require", "optional")
+
+	check(c.Env != "production" || !slices.Contains(c.Auth.AdminClients, "*"), "auth.admin_clients",
+		"* opens the admin API to everyone and is not allowed in production")
+
+	for _, pair := range c.Auth.Tenants {
+		name, tenant, ok := strings.Cut(pair, "=")
+		check(ok && strings.TrimSpace(name) != "" && strings.TrimSpace(tenant) != "", "auth.tenants", "%q is not name=tenant", pair)
+	}
+
+	oneOf("rate_limit.store", c.RateLimit.Store, "memory", "postgres")
+	check(c.RateLimit.ReadRPS >= 0, "rate_limit.read_rps", "must not be negative")
+	notNegative("rate_limit.read_burst", int64(c.RateLimit.ReadBurst))
+	check(c.RateLimit.WriteRPS >= 0, "rate_limit.write_rps", "must not be negative")
+	notNegative("rate_limit.write_burst", int64(c.RateLimit.WriteBurst))
+	for _, k := range c.RateLimit.APIKeys {
+		check(k != "", "rate_limit.api_keys", "must not contain empty keys")
+	}
+
+	positive("limits.title_max_length", int64(c.Limits.TitleMaxLength))
+	positive("limits.description_max_length", int64(c.Limits.DescriptionMaxLength))
+	positive("limits.comment_max_length", int64(c.Limits.CommentMaxLength))
+	positive("limits.page_size_max", int64(c.Limits.PageSizeMax))
+	positive("limits.attachment_max_bytes", c.Limits.AttachmentMaxBytes)
+
+	notNegative("quota.max_open_tasks", c.Quota.MaxOpenTasks)
+	notNegative("quota.max_tasks_per_day", c.Quota.MaxTasksPerDay)
+	notNegative("quota.max_attachment_bytes", c.Quota.MaxAttachmentBytes)
+
+	positive("graphql.max_depth", int64(c.GraphQL.MaxDepth))
+	positive("graphql.max_complexity", int64(c.GraphQL.MaxComplexity))
+
+	oneOf("blob.store", c.Blob.Store, "fs", "s3")
+	switch c.Blob.Store {
+	case "fs":
+		check(c.Blob.FSDir != "", "blob.fs_dir", "must be set")
+	case "s3":
+		check(c.Blob.S3.Endpoint != "", "blob.s3.endpoint", "must be set")
+		check(c.Blob.S3.Bucket != "", "blob.s3.bucket", "must be set")
+	}
+
+	oneOf("tracing.exporter", c.Tracing.Exporter, "none", "stdout", "otlp")
+	return errors.Join(errs...)
+}
+
+// DBConfig is the database connection config.
+func (c Config) DBConfig() db.Config {
+	return db.Config{
+		Host:            c.DB.Host,
+		Port:            c.DB.Port,
+		User:            c.DB.User,
+		Password:        c.DB.Password,
+		Name:            c.DB.Name,
+		SSLMode:         c.DB.SSLMode,
+		MaxIdleConns:    c.DB.MaxIdleConns,
+		MaxOpenConns:    c.DB.MaxOpenConns,
+		ConnMaxLifetime: time.Duration(c.DB.ConnMaxLifetimeMinutes) * time.Minute,
+	}
+}
+
+// TLSConfig is the server certificate config; ok is false when TLS is off.
+func (c Config) TLSConfig() (cfg tlsconfig.Config, ok bool) {
+	return tlsconfig.Config{
+		CertFile:           c.TLS.CertFile,
+		KeyFile:            c.TLS.KeyFile,
+		ClientCAFile:       c.TLS.ClientCAFile,
+		ClientCertOptional: c.TLS.ClientAuth == "optional",
+	}, c.TLS.CertFile != ""
+}
+
+// AuthTenants maps client certificate names to their tenants, in the order
+// they are listed.
+func (c Config) AuthTenants() map[string][]string {
+	tenants := map[string][]string{}
+	for _, pair := range c.Auth.Tenants {
+		if name, tenant, ok := strings.Cut(pair, "="); ok {
+			name, tenant = strings.TrimSpace(name), strings.TrimSpace(tenant)
+			tenants[name] = append(tenants[name], tenant)
+		}
+	}
+	return tenants
+}
+
+// RateLimitConfig is the limiter config, with bursts defaulted.
+func (c Config) RateLimitConfig() ratelimit.Config {
+	limit := func(rps float64, burst int) ratelimit.Limit {
+		if burst == 0 {
+			burst = int(math.Ceil(rps))
+		}
+		return ratelimit.Limit{Rate: rps, Burst: burst}
+	}
+	return ratelimit.Config{
+		Store:   c.RateLimit.Store,
+		Read:    limit(c.RateLimit.ReadRPS, c.RateLimit.ReadBurst),
+		Write:   limit(c.RateLimit.WriteRPS, c.RateLimit.WriteBurst),
+		APIKeys: c.RateLimit.APIKeys,
+	}
+}
+
+// TodoLimits is the service's validation limits.
+func (c Config) TodoLimits() todo.Limits {
+	return todo.Limits{
+		MaxTitleLength:       c.Limits.TitleMaxLength,
+		MaxDescriptionLength: c.Limits.DescriptionMaxLength,
+		MaxCommentLength:     c.Limits.CommentMaxLength,
+		MaxPageSize:          c.Limits.PageSizeMax,
+	}
+}
+
+// GraphQLLimits bounds the cost of GraphQL operations.
+func (c Config) GraphQLLimits() graphql.Limits {
+	return graphql.Limits{MaxDepth: c.GraphQL.MaxDepth, MaxComplexity: c.GraphQL.MaxComplexity}
+}
+
+// DefaultQuota is the quota of tenants without their own.
+func (c Config) DefaultQuota() todo.Quota {
+	return todo.Quota{
+		MaxOpenTasks:       c.Quota.MaxOpenTasks,
+		MaxTasksPerDay:     c.Quota.MaxTasksPerDay,
+		MaxAttachmentBytes: c.Quota.MaxAttachmentBytes,
+	}
+}
+
+// BlobConfig is the attachment blob store config.
+func (c Config) BlobConfig() storage.Config {
+	return storage.Config{
+		Store: c.Blob.Store,
+		FSDir: c.Blob.FSDir,
+		S3: storage.S3Config{
+			Endpoint:        c.Blob.S3.Endpoint,
+			Region:          c.Blob.S3.Region,
+			Bucket:          c.Blob.S3.Bucket,
+			AccessKeyID:     c.Blob.S3.AccessKeyID,
+			SecretAccessKey: c.Blob.S3.SecretAccessKey,
+			VirtualHost:     c.Blob.S3.VirtualHost,
+		},
+	}
+}
@@ -0,0 +1,283 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// FileEnv names the config file when -config isn't given.
+const FileEnv = "CONFIG_FILE"
+
+// setting is one leaf of Config, found by walking its struct tags.
+type setting struct {
+	key    string // dotted yaml path, also the flag name
+	env    string
+	usage  string
+	secret bool
+	reload bool
+	index  []int
+}
+
+// settings lists every setting of Config in declaration order.
+var settings = walk(reflect.TypeOf(Config{}), "", nil)
+
+func walk(t reflect.Type, prefix string, index []int) []setting {
+	var out []setting
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		key := prefix + strings.Split(f.Tag.Get("yaml"), ",")[0]
+		// clone so sibling fields don't share a backing array
+		idx := append(slices.Clone(index), i)
+		if f.Type.Kind() == reflect.Struct {
+			out = append(out, walk(f.Type, key+".", idx)...)
+			continue
+		}
+		out = append(out, setting{
+			key:    key,
+			env:    f.Tag.Get("env"),
+			usage:  f.Tag.Get("usage"),
+			secret: f.Tag.Get("secret") == "true",
+			reload: f.Tag.Get("reload") == "true",
+			index:  idx,
+		})
+	}
+	return out
+}
+
+// set parses s into v. Lists are comma-separated.
+func set(v reflect.Value, s string) error {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return fmt.Errorf("%q is not true or false", s)
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not an integer", s)
+		}
+		v.SetInt(n)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", s)
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		var list []string
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		v.Set(reflect.ValueOf(list))
+	default:
+		return fmt.Errorf("unsupported setting type %s", v.Type())
+	}
+	return nil
+}
+
+// flagValue holds a setting given on the command line until Load applies it.
+type flagValue struct {
+	value  string
+	isBool bool
+	set    bool
+}
+
+func (f *flagValue) String() string   { return f.value }
+func (f *flagValue) IsBoolFlag() bool { return f.isBool }
+func (f *flagValue) Set(s string) error {
+	f.value, f.set = s, true
+	return nil
+}
+
+// Loader reads the config from its sources. Load can be called again to
+// pick up changes, e.g. on SIGHUP.
+type Loader struct {
+	// LookupEnv reads the environment; os.LookupEnv by default.
+	LookupEnv func(string) (string, bool)
+	// DotEnv is a file of KEY=value lines read as if they were in the
+	// environment, which takes precedence over it. A missing file is
+	// ignored. ".env" by default; empty to skip it.
+	DotEnv string
+	// File is the YAML config file, set by -config; CONFIG_FILE if empty.
+	File string
+
+	flags map[string]*flagValue
+}
+
+// NewLoader registers -config and a flag per setting, named by its yaml key,
+// on fs. Parse fs before calling Load.
+func NewLoader(fs *flag.FlagSet) *Loader {
+	l := &Loader{
+		LookupEnv: os.LookupEnv,
+		DotEnv:    ".env",
+		flags:     map[string]*flagValue{},
+	}
+	fs.StringVar(&l.File, "config", "", "YAML config file (env "+FileEnv+")")
+	defaults := reflect.ValueOf(Default())
+	for _, s := range settings {
+		v := defaults.FieldByIndex(s.index)
+		fv := &flagValue{value: display(v), isBool: v.Kind() == reflect.Bool}
+		l.flags[s.key] = fv
+		fs.Var(fv, s.key, s.usage+" (env "+s.env+")")
+	}
+	return l
+}
+
+func display(v reflect.Value) string {
+	if v.Kind() == reflect.Slice {
+		return strings.Join(v.Interface().([]string), ",")
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+// Load reads the defaults, then the config file, then .env, then the
+// environment, then flags, each overriding the ones before, and validates
+// the result. Empty environment variables count as unset.
+func (l *Loader) Load() (Config, error) {
+	cfg := Default()
+	dotenv := map[string]string{}
+	if l.DotEnv != "" {
+		var err error
+		if dotenv, err = godotenv.Read(l.DotEnv); err != nil {
+			if !errors.Is(err, os.ErrNotExist) {
+				return cfg, fmt.Errorf("config: %s: %w", l.DotEnv, err)
+			}
+			dotenv = map[string]string{}
+		}
+	}
+	lookup := func(key string) string {
+		if v, ok := l.LookupEnv(key); ok && v != "" {
+			return v
+		}
+		return dotenv[key]
+	}
+
+	file := l.File
+	if file == "" {
+		file = lookup(FileEnv)
+	}
+	if file != "" {
+		if err := readFile(file, &cfg); err != nil {
+			return cfg, fmt.Errorf("config: %w", err)
+		}
+	}
+
+	root := reflect.ValueOf(&cfg).Elem()
+	var errs []error
+	for _, s := range settings {
+		if v := lookup(s.env); v != "" {
+			if err := set(root.FieldByIndex(s.index), v); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", s.env, err))
+			}
+		}
+		if f := l.flags[s.key]; f != nil && f.set {
+			if err := set(root.FieldByIndex(s.index), f.value); err != nil {
+				errs = append(errs, fmt.Errorf("-%s: %w", s.key, err))
+			}
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return cfg, fmt.Errorf("config: %w", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return cfg, fmt.Errorf("config: %w", err)
+	}
+	return cfg, nil
+}
+
+// readFile decodes a YAML file over cfg. Unknown keys are an error, so a
+// typo doesn't silently leave a default in place.
+func readFile(path string, cfg *Config) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	dec.KnownFields(true)
+	if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// Redacted returns a copy of c with secrets that are set replaced.
+func (c Config) Redacted() Config {
+	root := reflect.ValueOf(&c).Elem()
+	for _, s := range settings {
+		if !s.secret {
+			continue
+		}
+		switch v := root.FieldByIndex(s.index); v.Kind() {
+		case reflect.String:
+			if v.String() != "" {
+				v.SetString("REDACTED")
+			}
+		case reflect.Slice:
+			// a new slice: the copy of c still shares the old one
+			redacted := make([]string, v.Len())
+			for i := range redacted {
+				redacted[i] = "REDACTED"
+			}
+			v.Set(reflect.ValueOf(redacted))
+		}
+	}
+	return c
+}
+
+// Print writes c as YAML, with secrets redacted. The output is a valid
+// config file.
+func (c Config) Print(w io.Writer) error {
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(c.Redacted()); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// Reload returns cur with the reloadable settings taken from next, and the
+// keys of the settings that changed: applied ones, and ones that only take
+// effect after a restart.
+func Reload(cur, next Config) (merged Config, applied, restart []string) {
+	merged = cur
+	from := reflect.ValueOf(next)
+	to := reflect.ValueOf(&merged).Elem()
+	for _, s := range settings {
+		nv, cv := from.FieldByIndex(s.index), to.FieldByIndex(s.index)
+		if equal(nv, cv) {
+			continue
+		}
+		if !s.reload {
+			restart = append(restart, s.key)
+			continue
+		}
+		cv.Set(nv)
+		applied = append(applied, s.key)
+	}
+	return merged, applied, restart
+}
+
+// equal is reflect.DeepEqual, except that nil and empty lists are equal.
+func equal(a, b reflect.Value) bool {
+	if a.Kind() == reflect.Slice && a.Len() == 0 && b.Len() == 0 {
+		return true
+	}
+	return reflect.DeepEqual(a.Interface(), b.Interface())
+}
@@ -0,0 +1,103 @@
+package graphql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/fuzail/08-todosvc/internal/apierr"
+	"github.com/fuzail/08-todosvc/internal/todo"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+	"google.golang.org/grpc/status"
+)
+
+// Codes in the extensions of errors the request itself caused.
+const (
+	codeParseFailed      = "GRAPHQL_PARSE_FAILED"
+	codeValidationFailed = "GRAPHQL_VALIDATION_FAILED"
+	codeBadRequest       = "BAD_REQUEST"
+	codeTooLarge         = "QUERY_TOO_LARGE"
+	codeTooDeep          = "QUERY_TOO_DEEP"
+	codeTooComplex       = "QUERY_TOO_COMPLEX"
+)
+
+func requestError(code, format string, args ...any) *gqlerror.Error {
+	return &gqlerror.Error{Message: fmt.Sprintf(format, args...), Extensions: map[string]any{"code": code}}
+}
+
+// requestErrors gives the errors of a request gqlgen refused the codes
+// the API documents. gqlgen codes parse and validation errors itself, but
+// variables with values of the wrong type, and a document whose operation
+// it can't pick, as validation errors; they are BAD_REQUEST, like other
+// errors of the request.
+func requestErrors(rc *graphql.OperationContext, errs gqlerror.List) gqlerror.List {
+	if rc.Doc != nil && rc.Operation == nil {
+		if _, err := operation(rc.Doc, rc.OperationName); err != nil {
+			return gqlerror.List{requestError(codeBadRequest, "%s", err)}
+		}
+	}
+	for _, e := range errs {
+		if len(e.Path) > 0 && e.Path[0] == ast.PathName("variable") {
+			e.Extensions["code"] = codeBadRequest
+		}
+	}
+	return errs
+}
+
+// operation picks the operation a request runs as gqlgen does, saying why
+// when there is none.
+func operation(doc *ast.QueryDocument, name string) (*ast.OperationDefinition, error) {
+	switch {
+	case len(doc.Operations) == 0:
+		return nil, errors.New("the document has no operation")
+	case name != "":
+		if op := doc.Operations.ForName(name); op != nil {
+			return op, nil
+		}
+		return nil, errors.New("unknown operation " + strconv.Quote(name))
+	case len(doc.Operations) > 1:
+		return nil, errors.New("the document has several operations; operationName must name one")
+	}
+	return doc.Operations[0], nil
+}
+
+// fieldError converts an error for a resolver to return; gqlgen adds the
+// path of the field. Service errors keep their message, as apierr.Status
+// gives it, and are coded by their reason; validation errors list the
+// fields at fault. Other errors are logged and reported as internal.
+func fieldError(ctx context.Context, err error) *gqlerror.Error {
+	st, _ := status.FromError(apierr.Status(ctx, err))
+	e := &gqlerror.Error{Message: st.Message(), Extensions: map[string]any{"code": upperSnake(st.Code().String())}}
+	var de *todo.Error
+	if errors.As(err, &de) {
+		e.Extensions["code"] = de.Reason
+		if len(de.Violations) > 0 {
+			var fields []map[string]string
+			for _, v := range de.Violations {
+				fields = append(fields, map[string]string{"field": v.Field, "description": v.Description})
+			}
+			e.Extensions["violations"] = fields
+		}
+		if de.RetryAfter > 0 {
+			e.Extensions["retryAfterSeconds"] = de.RetryAfter.Seconds()
+		}
+	}
+	return e
+}
+
+// upperSnake turns a gRPC code name such as NotFound into NOT_FOUND.
+func upperSnake(s string) string {
+	var b strings.Builder
+	for i, r := range s {
+		if i > 0 && unicode.IsUpper(r) {
+			b.WriteByte('_')
+		}
+		b.WriteRune(unicode.ToUpper(r))
+	}
+	return b.String()
+}
@@ -0,0 +1,290 @@
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/99designs/gqlgen/graphql/executor"
+	"github.com/99designs/gqlgen/graphql/handler/extension"
+	"github.com/fuzail/08-todosvc/internal/ratelimit"
+	"github.com/fuzail/08-todosvc/internal/todo"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+// Path is where the handler is served.
+const Path = "/graphql"
+
+const (
+	// maxRequestSize bounds the body of a POST request.
+	maxRequestSize = 1 << 20
+	// keepAliveInterval is how often an idle event stream gets a comment, so
+	// proxies don't time it out.
+	keepAliveInterval = 15 * time.Second
+)
+
+type handler struct {
+	exec *executor.Executor
+}
+
+// request is a GraphQL request as sent over HTTP.
+type request struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName"`
+	Variables     map[string]any `json:"variables"`
+}
+
+// NewHandler serves GraphQL over HTTP: queries by GET or POST, mutations by
+// POST, and subscriptions as server-sent events to requests that accept
+// text/event-stream, one "next" event per change and a "complete" event at
+// the end. Query and mutation results are also streamed that way when
+// asked for. Operations are run by gqlgen's executor, with Limits enforced
+// by limitsExtension.
+func NewHandler(svc todo.Service, comments todo.CommentService, events *todo.Broker, limits Limits) http.Handler {
+	exec := executor.New(NewExecutableSchema(Config{
+		Resolvers: &resolver{svc: svc, comments: comments, events: events},
+	}))
+	exec.Use(extension.Introspection{})
+	exec.Use(limitsExtension{limits: limits.withDefaults()})
+	exec.Use(loadersExtension{svc: svc, comments: comments})
+	return &handler{exec: exec}
+}
+
+// loadersExtension gives every response its own loaders: the result of a
+// query or mutation, or each event of a subscription, so nothing is cached
+// across requests or events.
+type loadersExtension struct {
+	svc      todo.Service
+	comments todo.CommentService
+}
+
+var _ graphql.ResponseInterceptor = loadersExtension{}
+
+func (loadersExtension) ExtensionName() string {
+	return "Loaders"
+}
+
+func (loadersExtension) Validate(graphql.ExecutableSchema) error {
+	return nil
+}
+
+func (e loadersExtension) InterceptResponse(ctx context.Context, next graphql.ResponseHandler) *graphql.Response {
+	return next(withLoaders(ctx, newLoaders(ctx, e.svc, e.comments)))
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		w.Header().Set("Allow", "GET, POST")
+		writeErrors(w, http.StatusMethodNotAllowed, requestError(codeBadRequest, "method %s not allowed", r.Method))
+		return
+	}
+	req, err := decodeRequest(w, r)
+	if err != nil {
+		writeErrors(w, http.StatusBadRequest, requestError(codeBadRequest, "%s", err))
+		return
+	}
+	ctx := graphql.StartOperationTrace(r.Context())
+	rc, errs := h.exec.CreateOperationContext(ctx, &graphql.RawParams{
+		Query:         req.Query,
+		OperationName: req.OperationName,
+		Variables:     req.Variables,
+		Headers:       r.Header,
+	})
+	if errs != nil {
+		writeErrors(w, http.StatusBadRequest, requestErrors(rc, errs)...)
+		return
+	}
+	op := rc.Operation.Operation
+	if op == ast.Mutation && r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		writeErrors(w, http.StatusMethodNotAllowed, requestError(codeBadRequest, "mutations must be sent by POST"))
+		return
+	}
+	stream := acceptsEventStream(r)
+	if op == ast.Subscription && !stream {
+		writeErrors(w, http.StatusBadRequest, requestError(codeBadRequest, "subscriptions are sent as server-sent events; accept text/event-stream"))
+		return
+	}
+	// the rate limiter leaves the request to be charged here, where it is
+	// known whether it reads or writes
+	if err := ratelimit.Charge(ctx, op == ast.Mutation); err != nil {
+		writeRateLimited(ctx, w, err)
+		return
+	}
+	responses, ctx := h.exec.DispatchOperation(ctx, rc)
+	if op == ast.Subscription {
+		subscribe(ctx, w, responses)
+		return
+	}
+	resp := responses(ctx)
+	if stream {
+		es := startEventStream(w)
+		_ = es.next(resp)
+		_ = es.complete()
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// subscribe streams the results of a subscription until the client goes
+// away. A subscriber that can't keep up is dropped by the broker; it is
+// told so before the stream completes, and should resubscribe and refetch.
+func subscribe(ctx context.Context, w http.ResponseWriter, responses graphql.ResponseHandler) {
+	// responses blocks until the next event, so it is read by a goroutine
+	// of its own while the stream is kept alive
+	results := make(chan *graphql.Response)
+	go func() {
+		defer close(results)
+		for {
+			resp := responses(ctx)
+			if resp == nil {
+				return
+			}
+			select {
+			case results <- resp:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	es := startEventStream(w)
+	keepAlive := time.NewTicker(keepAliveInterval)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case resp, ok := <-results:
+			if !ok {
+				if ctx.Err() == nil {
+					_ = es.next(&graphql.Response{Errors: gqlerror.List{requestError("SLOW_SUBSCRIBER", "the subscriber fell behind and missed changes")}})
+					_ = es.complete()
+				}
+				return
+			}
+			if es.next(resp) != nil {
+				return
+			}
+			if resp.Data == nil {
+				// the subscription failed, e.g. for an invalid id
+				_ = es.complete()
+				return
+			}
+		case <-keepAlive.C:
+			if es.write(":\n\n") != nil {
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// decodeRequest reads a request from the query string of a GET or the JSON
+// body of a POST.
+func decodeRequest(w http.ResponseWriter, r *http.Request) (request, error) {
+	var req request
+	if r.Method == http.MethodGet {
+		q := r.URL.Query()
+		req.Query, req.OperationName = q.Get("query"), q.Get("operationName")
+		if vars := q.Get("variables"); vars != "" {
+			dec := json.NewDecoder(strings.NewReader(vars))
+			dec.UseNumber()
+			if err := dec.Decode(&req.Variables); err != nil {
+				return req, fmt.Errorf("variables must be a JSON object: %w", err)
+			}
+		}
+	} else {
+		if mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mt != "application/json" {
+			return req, errors.New("the body must be application/json")
+		}
+		dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestSize))
+		dec.UseNumber()
+		if err := dec.Decode(&req); err != nil {
+			return req, fmt.Errorf("invalid request body: %w", err)
+		}
+		if dec.Decode(&struct{}{}) != io.EOF {
+			return req, errors.New("invalid request body: more than one JSON value")
+		}
+	}
+	if req.Query == "" {
+		return req, errors.New("query is required")
+	}
+	return req, nil
+}
+
+func acceptsEventStream(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		if mt, _, _ := mime.ParseMediaType(strings.TrimSpace(part)); mt == "text/event-stream" {
+			return true
+		}
+	}
+	return false
+}
+
+func writeErrors(w http.ResponseWriter, code int, errs ...*gqlerror.Error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(&graphql.Response{Errors: errs})
+}
+
+// writeRateLimited answers a request the rate limiter refused, with the
+// Retry-After header the REST API sends.
+func writeRateLimited(ctx context.Context, w http.ResponseWriter, err error) {
+	var de *todo.Error
+	if errors.As(err, &de) && de.RetryAfter > 0 {
+		// whole seconds, rounded up so clients don't retry too early
+		w.Header().Set("Retry-After", strconv.Itoa(int((de.RetryAfter+time.Second-1)/time.Second)))
+	}
+	writeErrors(w, http.StatusTooManyRequests, fieldError(ctx, err))
+}
+
+// eventStream writes server-sent events, flushing each.
+type eventStream struct {
+	w  http.ResponseWriter
+	rc *http.ResponseController
+}
+
+func startEventStream(w http.ResponseWriter) *eventStream {
+	h := w.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	// stop nginx from buffering the stream
+	h.Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	es := &eventStream{w: w, rc: http.NewResponseController(w)}
+	_ = es.rc.Flush()
+	return es
+}
+
+func (es *eventStream) next(resp *graphql.Response) error {
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return err
+	}
+	var b bytes.Buffer
+	b.WriteString("event: next\ndata: ")
+	b.Write(data)
+	b.WriteString("\n\n")
+	return es.write(b.String())
+}
+
+func (es *eventStream) complete() error {
+	return es.write("event: complete\ndata:\n\n")
+}
+
+func (es *eventStream) write(s string) error {
+	if _, err := io.WriteString(es.w, s); err != nil {
+		return err
+	}
+	return es.rc.Flush()
+}
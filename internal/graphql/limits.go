@@ -0,0 +1,260 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/99designs/gqlgen/graphql/errcode"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+	"github.com/vektah/gqlparser/v2/lexer"
+)
+
+// Limits bounds the cost of a single operation.
+type Limits struct {
+	// MaxDepth is how deeply fields may nest; a root field is at depth 1,
+	// and fragments count as a level of their own.
+	MaxDepth int
+	// MaxComplexity bounds the number of fields an operation may resolve:
+	// every field counts 1, and the fields under a list count once per item
+	// the list may hold, e.g. its page size.
+	MaxComplexity int
+}
+
+// Defaults for the zero fields of Limits. The depth leaves room for the
+// introspection query tools such as GraphiQL send.
+const (
+	DefaultMaxDepth      = 20
+	DefaultMaxComplexity = 5000
+)
+
+func (l Limits) withDefaults() Limits {
+	if l.MaxDepth <= 0 {
+		l.MaxDepth = DefaultMaxDepth
+	}
+	if l.MaxComplexity <= 0 {
+		l.MaxComplexity = DefaultMaxComplexity
+	}
+	return l
+}
+
+const (
+	// maxQueryLength bounds the query document, in bytes.
+	maxQueryLength = 64 << 10
+	// maxTokens bounds the number of tokens in the query document.
+	maxTokens = 10000
+	// maxValueNesting is how much deeper than MaxDepth brackets may nest, for
+	// lists and input objects in arguments.
+	maxValueNesting = 8
+)
+
+// assumedListSize is what complexity counts a list without a size argument
+// as holding, such as a task's blockers.
+const assumedListSize = 10
+
+// listSizes names the argument that bounds the number of items of the list
+// fields, as Type.field, or "" for lists without one.
+var listSizes = map[string]string{
+	"Query.tasks":   "pageSize",
+	"Task.comments": "first",
+	"Task.blockers": "",
+}
+
+// limitsExtension enforces Limits in the executor. gqlgen's own complexity
+// limit isn't used: it walks a fragment again for every spread of it, so a
+// document whose fragments each spread the next twice takes exponential
+// time to measure.
+type limitsExtension struct {
+	limits Limits
+}
+
+var _ interface {
+	graphql.OperationParameterMutator
+	graphql.OperationContextMutator
+} = limitsExtension{}
+
+func (limitsExtension) ExtensionName() string {
+	return "Limits"
+}
+
+func (limitsExtension) Validate(graphql.ExecutableSchema) error {
+	return nil
+}
+
+// MutateOperationParameters bounds the document's length, tokens and
+// nesting before gqlgen parses and validates it, since both recurse as
+// deeply as the document nests.
+func (e limitsExtension) MutateOperationParameters(_ context.Context, params *graphql.RawParams) *gqlerror.Error {
+	if len(params.Query) > maxQueryLength {
+		return requestError(codeTooLarge, "the query is longer than %d bytes", maxQueryLength)
+	}
+	return scan(&ast.Source{Input: params.Query}, e.limits.MaxDepth+maxValueNesting)
+}
+
+// MutateOperationContext measures the depth and complexity of the
+// operation once it is validated.
+func (e limitsExtension) MutateOperationContext(_ context.Context, rc *graphql.OperationContext) *gqlerror.Error {
+	m := &measure{limits: e.limits, vars: rc.Variables, fragments: map[string]cost{}}
+	c, err := m.selections(rc.Operation.SelectionSet)
+	if err != nil {
+		return err
+	}
+	if c.depth > e.limits.MaxDepth {
+		return tooDeep(e.limits)
+	}
+	return nil
+}
+
+// scan counts the tokens of src and how deeply its brackets nest without
+// building anything, so the parser is only given documents that are small
+// and shallow enough.
+func scan(src *ast.Source, maxNesting int) *gqlerror.Error {
+	lex := lexer.New(src)
+	nesting := 0
+	for n := 0; ; n++ {
+		tok, err := lex.ReadToken()
+		if err != nil {
+			return parseError(err)
+		}
+		if n > maxTokens {
+			return requestError(codeTooLarge, "the query has more than %d tokens", maxTokens)
+		}
+		switch tok.Kind {
+		case lexer.EOF:
+			return nil
+		case lexer.BraceL, lexer.BracketL, lexer.ParenL:
+			if nesting++; nesting > maxNesting {
+				return requestError(codeTooDeep, "the query nests brackets deeper than %d", maxNesting)
+			}
+		case lexer.BraceR, lexer.BracketR, lexer.ParenR:
+			nesting--
+		}
+	}
+}
+
+// parseError codes an error of the lexer as gqlgen codes those of the
+// parser.
+func parseError(err error) *gqlerror.Error {
+	var gerr *gqlerror.Error
+	if !errors.As(err, &gerr) {
+		gerr = gqlerror.Wrap(err)
+	}
+	errcode.Set(gerr, errcode.ParseFailed)
+	return gerr
+}
+
+// cost is the depth and complexity of a selection set.
+type cost struct {
+	depth, complexity int
+}
+
+// measure works out the cost of a validated operation. Fragments are
+// measured once each; validation has ruled out cycles.
+type measure struct {
+	limits    Limits
+	vars      map[string]any
+	fragments map[string]cost
+}
+
+// selections measures a selection set. It fails as soon as a limit is
+// exceeded.
+func (m *measure) selections(set ast.SelectionSet) (cost, *gqlerror.Error) {
+	var total cost
+	for _, sel := range set {
+		var c cost
+		var err *gqlerror.Error
+		switch sel := sel.(type) {
+		case *ast.Field:
+			c, err = m.field(sel)
+		case *ast.InlineFragment:
+			c, err = m.selections(sel.SelectionSet)
+			c.depth++
+		case *ast.FragmentSpread:
+			c, err = m.spread(sel.Definition)
+			c.depth++
+		}
+		if err != nil {
+			return cost{}, err
+		}
+		total.depth = max(total.depth, c.depth)
+		total.complexity += c.complexity
+		if total.depth > m.limits.MaxDepth {
+			return cost{}, tooDeep(m.limits)
+		}
+		if total.complexity > m.limits.MaxComplexity {
+			return cost{}, tooComplex(m.limits)
+		}
+	}
+	return total, nil
+}
+
+func (m *measure) field(f *ast.Field) (cost, *gqlerror.Error) {
+	if len(f.SelectionSet) == 0 {
+		return cost{depth: 1, complexity: 1}, nil
+	}
+	child, err := m.selections(f.SelectionSet)
+	if err != nil {
+		return cost{}, err
+	}
+	n := 1
+	if arg, ok := listSizes[f.ObjectDefinition.Name+"."+f.Name]; ok {
+		n = m.listSize(f, arg)
+	}
+	return cost{depth: child.depth + 1, complexity: 1 + n*child.complexity}, nil
+}
+
+func (m *measure) spread(def *ast.FragmentDefinition) (cost, *gqlerror.Error) {
+	if c, ok := m.fragments[def.Name]; ok {
+		return c, nil
+	}
+	c, err := m.selections(def.SelectionSet)
+	if err != nil {
+		return cost{}, err
+	}
+	m.fragments[def.Name] = c
+	return c, nil
+}
+
+// listSize returns the number of items list field f may hold, from its size
+// argument arg, as given, from a variable or by default. Sizes beyond
+// MaxComplexity exceed it either way.
+func (m *measure) listSize(f *ast.Field, arg string) int {
+	if arg == "" {
+		return assumedListSize
+	}
+	n, ok := intValue(f.ArgumentMap(m.vars)[arg])
+	if !ok {
+		return assumedListSize
+	}
+	return int(min(max(n, 0), int64(m.limits.MaxComplexity)+1))
+}
+
+// intValue returns an argument or variable value as an int64, if it is a
+// whole number.
+func intValue(v any) (int64, bool) {
+	switch v := v.(type) {
+	case int:
+		return int64(v), true
+	case int64:
+		return v, true
+	case json.Number:
+		n, err := v.Int64()
+		return n, err == nil
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < math.MaxInt64 {
+			return int64(v), true
+		}
+	}
+	return 0, false
+}
+
+func tooDeep(limits Limits) *gqlerror.Error {
+	return requestError(codeTooDeep, "the operation nests fields deeper than the limit of %d", limits.MaxDepth)
+}
+
+func tooComplex(limits Limits) *gqlerror.Error {
+	return requestError(codeTooComplex, "the operation's complexity exceeds the limit of %d", limits.MaxComplexity)
+}
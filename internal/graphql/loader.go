@@ -0,0 +1,190 @@
+package graphql
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/fuzail/08-todosvc/internal/todo"
+)
+
+// loader batches and caches lookups by key for one operation, in the
+// manner of DataLoader. Resolvers run concurrently, so rather than waiting
+// for a batch to fill, the resolver of a list queues the keys its items
+// will load (see queueRelated), and the first load fetches every key queued
+// so far in one call; loads of keys already being fetched wait for it.
+type loader[K comparable, V any] struct {
+	fetch func(ctx context.Context, keys []K) (map[K]V, error)
+	ctx   context.Context
+
+	mu      sync.Mutex
+	pending []K
+	calls   map[K]*call[V]
+}
+
+type call[V any] struct {
+	done    chan struct{}
+	started bool
+	v       V
+	err     error
+}
+
+// errLoadFailed is what loads waiting on a fetch that panicked get.
+var errLoadFailed = errors.New("graphql: batch load failed")
+
+func newLoader[K comparable, V any](ctx context.Context, fetch func(context.Context, []K) (map[K]V, error)) *loader[K, V] {
+	return &loader[K, V]{fetch: fetch, ctx: ctx, calls: map[K]*call[V]{}}
+}
+
+// queue registers keys for the next fetch.
+func (l *loader[K, V]) queue(keys ...K) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, k := range keys {
+		l.enqueue(k)
+	}
+}
+
+func (l *loader[K, V]) enqueue(key K) *call[V] {
+	c, ok := l.calls[key]
+	if !ok {
+		c = &call[V]{done: make(chan struct{})}
+		l.calls[key] = c
+		l.pending = append(l.pending, key)
+	}
+	return c
+}
+
+// load returns the value of key: the zero V if fetch didn't return one.
+func (l *loader[K, V]) load(key K) (V, error) {
+	l.mu.Lock()
+	c := l.enqueue(key)
+	var keys []K
+	var calls []*call[V]
+	if !c.started {
+		keys, l.pending = l.pending, nil
+		for _, k := range keys {
+			pc := l.calls[k]
+			pc.started = true
+			calls = append(calls, pc)
+		}
+	}
+	l.mu.Unlock()
+	if len(keys) > 0 {
+		l.dispatch(keys, calls)
+	}
+	<-c.done
+	return c.v, c.err
+}
+
+// prime caches a value already at hand, such as a task a list returned.
+func (l *loader[K, V]) prime(key K, v V) {
+	c := &call[V]{done: make(chan struct{}), started: true, v: v}
+	close(c.done)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.calls[key] = c
+}
+
+// clear forgets cached values, after a mutation may have changed them.
+// Fetches under way finish for the loads waiting on them.
+func (l *loader[K, V]) clear() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.calls = map[K]*call[V]{}
+	l.pending = nil
+}
+
+// dispatch fetches keys, at most todo.MaxBatchSize per call, and completes
+// their calls.
+func (l *loader[K, V]) dispatch(keys []K, calls []*call[V]) {
+	done := 0
+	defer func() {
+		// a fetch that panicked mustn't leave the other loads waiting
+		for _, c := range calls[done:] {
+			c.err = errLoadFailed
+			close(c.done)
+		}
+	}()
+	for len(keys) > 0 {
+		n := min(len(keys), todo.MaxBatchSize)
+		values, err := l.fetch(l.ctx, keys[:n])
+		for i, k := range keys[:n] {
+			c := calls[done+i]
+			if err != nil {
+				c.err = err
+			} else {
+				c.v = values[k]
+			}
+			close(c.done)
+		}
+		keys = keys[n:]
+		done += n
+	}
+}
+
+// loaders batch the reads of one operation, or of one subscription event,
+// so nothing is cached across requests or events.
+type loaders struct {
+	tasks    *loader[string, *todo.Task]
+	blockers *loader[string, []todo.Task]
+	comments *loader[commentKey, []todo.Comment]
+}
+
+type commentKey struct {
+	taskID string
+	first  int
+}
+
+func newLoaders(ctx context.Context, svc todo.Service, comments todo.CommentService) *loaders {
+	return &loaders{
+		tasks: newLoader(ctx, func(ctx context.Context, ids []string) (map[string]*todo.Task, error) {
+			tasks, err := svc.GetTasks(ctx, ids)
+			if err != nil {
+				return nil, err
+			}
+			byID := make(map[string]*todo.Task, len(tasks))
+			for i := range tasks {
+				byID[tasks[i].ID] = &tasks[i]
+			}
+			return byID, nil
+		}),
+		blockers: newLoader(ctx, svc.ListBlockersOf),
+		comments: newLoader(ctx, func(ctx context.Context, keys []commentKey) (map[commentKey][]todo.Comment, error) {
+			// one query per distinct page size, which is nearly always one
+			ids := map[int][]string{}
+			for _, k := range keys {
+				ids[k.first] = append(ids[k.first], k.taskID)
+			}
+			out := map[commentKey][]todo.Comment{}
+			for first, taskIDs := range ids {
+				byTask, err := comments.ListCommentsOf(ctx, taskIDs, first)
+				if err != nil {
+					return nil, err
+				}
+				for id, cs := range byTask {
+					out[commentKey{taskID: id, first: first}] = cs
+				}
+			}
+			return out, nil
+		}),
+	}
+}
+
+// clear drops what the loaders have cached; mutations call it before
+// writing so the fields they select read the new state.
+func (l *loaders) clear() {
+	l.tasks.clear()
+	l.blockers.clear()
+	l.comments.clear()
+}
+
+type loadersKey struct{}
+
+func withLoaders(ctx context.Context, l *loaders) context.Context {
+	return context.WithValue(ctx, loadersKey{}, l)
+}
+
+func loadersFrom(ctx context.Context) *loaders {
+	return ctx.Value(loadersKey{}).(*loaders)
+}
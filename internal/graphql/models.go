@@ -0,0 +1,39 @@
+package graphql
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/fuzail/08-todosvc/internal/todo"
+)
+
+// TaskPage is the result of the tasks query.
+type TaskPage struct {
+	Items      []todo.Task
+	TotalCount int
+	Page       int
+	PageSize   int
+}
+
+// MarshalDateTime writes the DateTime scalar, an RFC 3339 date-time in UTC.
+func MarshalDateTime(t time.Time) graphql.Marshaler {
+	return graphql.WriterFunc(func(w io.Writer) {
+		_, _ = io.WriteString(w, strconv.Quote(t.UTC().Format(time.RFC3339Nano)))
+	})
+}
+
+// UnmarshalDateTime reads the DateTime scalar.
+func UnmarshalDateTime(v any) (time.Time, error) {
+	s, ok := v.(string)
+	if !ok {
+		return time.Time{}, fmt.Errorf("DateTime must be a string, got %T", v)
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is not an RFC 3339 date-time", s)
+	}
+	return t, nil
+}
@@ -0,0 +1,147 @@
+// Code generated by github.com/99designs/gqlgen, DO NOT EDIT.
+
+package graphql
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+type CreateTaskInput struct {
+	// A UUID for the task; one is generated if unset.
+	ID          *string    `json:"id,omitempty"`
+	Title       string     `json:"title"`
+	Description *string    `json:"description,omitempty"`
+	DueAt       *time.Time `json:"dueAt,omitempty"`
+	// An RRULE; needs dueAt, the first occurrence.
+	Recurrence *string `json:"recurrence,omitempty"`
+}
+
+// Fields left out keep their value.
+type UpdateTaskInput struct {
+	ID          string  `json:"id"`
+	Title       *string `json:"title,omitempty"`
+	Description *string `json:"description,omitempty"`
+}
+
+// What happened to a task.
+type TaskEventKind string
+
+const (
+	TaskEventKindCreated TaskEventKind = "CREATED"
+	// Any change, including completion.
+	TaskEventKindUpdated TaskEventKind = "UPDATED"
+	TaskEventKindDeleted TaskEventKind = "DELETED"
+)
+
+var AllTaskEventKind = []TaskEventKind{
+	TaskEventKindCreated,
+	TaskEventKindUpdated,
+	TaskEventKindDeleted,
+}
+
+func (e TaskEventKind) IsValid() bool {
+	switch e {
+	case TaskEventKindCreated, TaskEventKindUpdated, TaskEventKindDeleted:
+		return true
+	}
+	return false
+}
+
+func (e TaskEventKind) String() string {
+	return string(e)
+}
+
+func (e *TaskEventKind) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = TaskEventKind(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid TaskEventKind", str)
+	}
+	return nil
+}
+
+func (e TaskEventKind) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+func (e *TaskEventKind) UnmarshalJSON(b []byte) error {
+	s, err := strconv.Unquote(string(b))
+	if err != nil {
+		return err
+	}
+	return e.UnmarshalGQL(s)
+}
+
+func (e TaskEventKind) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	e.MarshalGQL(&buf)
+	return buf.Bytes(), nil
+}
+
+// Narrows a list by blocker state.
+type TaskFilter string
+
+const (
+	TaskFilterAll TaskFilter = "ALL"
+	// Open tasks without open blockers.
+	TaskFilterReady TaskFilter = "READY"
+	// Open tasks with at least one open blocker.
+	TaskFilterBlocked TaskFilter = "BLOCKED"
+)
+
+var AllTaskFilter = []TaskFilter{
+	TaskFilterAll,
+	TaskFilterReady,
+	TaskFilterBlocked,
+}
+
+func (e TaskFilter) IsValid() bool {
+	switch e {
+	case TaskFilterAll, TaskFilterReady, TaskFilterBlocked:
+		return true
+	}
+	return false
+}
+
+func (e TaskFilter) String() string {
+	return string(e)
+}
+
+func (e *TaskFilter) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = TaskFilter(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid TaskFilter", str)
+	}
+	return nil
+}
+
+func (e TaskFilter) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+func (e *TaskFilter) UnmarshalJSON(b []byte) error {
+	s, err := strconv.Unquote(string(b))
+	if err != nil {
+		return err
+	}
+	return e.UnmarshalGQL(s)
+}
+
+func (e TaskFilter) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	e.MarshalGQL(&buf)
+	return buf.Bytes(), nil
+}
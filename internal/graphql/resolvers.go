@@ -0,0 +1,300 @@
+package graphql
+
+import (
+	"context"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/fuzail/08-todosvc/internal/todo"
+	"github.com/google/uuid"
+)
+
+// resolver resolves the schema over the services; generated.go calls it.
+// Reads of related tasks and comments go through the loaders, so a list of
+// tasks with their blockers and comments costs three queries however long
+// it is.
+type resolver struct {
+	svc      todo.Service
+	comments todo.CommentService
+	events   *todo.Broker
+}
+
+func (r *resolver) Query() QueryResolver               { return &queryResolver{r} }
+func (r *resolver) Mutation() MutationResolver         { return &mutationResolver{r} }
+func (r *resolver) Subscription() SubscriptionResolver { return &subscriptionResolver{r} }
+func (r *resolver) Task() TaskResolver                 { return &taskResolver{r} }
+func (r *resolver) Comment() CommentResolver           { return &commentResolver{r} }
+func (r *resolver) TaskEvent() TaskEventResolver       { return &taskEventResolver{r} }
+func (r *resolver) TaskPage() TaskPageResolver         { return &taskPageResolver{r} }
+
+var filters = map[TaskFilter]todo.ListFilter{
+	TaskFilterAll:     todo.FilterAll,
+	TaskFilterReady:   todo.FilterReady,
+	TaskFilterBlocked: todo.FilterBlocked,
+}
+
+// canonicalID returns id in the form tasks are keyed by, if it is a uuid.
+func canonicalID(id string) string {
+	if parsed, err := uuid.Parse(id); err == nil {
+		return parsed.String()
+	}
+	return id
+}
+
+type queryResolver struct{ *resolver }
+
+func (r *queryResolver) Task(ctx context.Context, id string) (*todo.Task, error) {
+	t, err := loadersFrom(ctx).tasks.load(canonicalID(id))
+	if err != nil {
+		return nil, fieldError(ctx, err)
+	}
+	return t, nil
+}
+
+func (r *queryResolver) Tasks(ctx context.Context, page, pageSize int, filter TaskFilter) (*TaskPage, error) {
+	items, total, err := r.svc.ListTasks(ctx, page, pageSize, filters[filter])
+	if err != nil {
+		return nil, fieldError(ctx, err)
+	}
+	l := loadersFrom(ctx)
+	for i := range items {
+		l.tasks.prime(items[i].ID, &items[i])
+	}
+	return &TaskPage{Items: items, TotalCount: int(total), Page: page, PageSize: pageSize}, nil
+}
+
+type mutationResolver struct{ *resolver }
+
+// mutate clears the loaders of a mutation, so the fields selected on its
+// result don't read what was cached before the write. The fields of a
+// mutation are run one after another.
+func mutate(ctx context.Context) {
+	loadersFrom(ctx).clear()
+}
+
+func (r *mutationResolver) CreateTask(ctx context.Context, in CreateTaskInput) (*todo.Task, error) {
+	mutate(ctx)
+	t, err := r.svc.CreateTask(ctx, deref(in.ID), in.Title, deref(in.Description), in.DueAt, deref(in.Recurrence))
+	if err != nil {
+		return nil, fieldError(ctx, err)
+	}
+	return t, nil
+}
+
+func (r *mutationResolver) UpdateTask(ctx context.Context, in UpdateTaskInput) (*todo.Task, error) {
+	mutate(ctx)
+	t, err := r.svc.GetTask(ctx, in.ID)
+	if err != nil {
+		return nil, fieldError(ctx, err)
+	}
+	title, description := t.Title, t.Description
+	if in.Title != nil {
+		title = *in.Title
+	}
+	if in.Description != nil {
+		description = *in.Description
+	}
+	if t, err = r.svc.UpdateTask(ctx, in.ID, title, description); err != nil {
+		return nil, fieldError(ctx, err)
+	}
+	return t, nil
+}
+
+func (r *mutationResolver) CompleteTask(ctx context.Context, id string, force bool) (*todo.Task, error) {
+	mutate(ctx)
+	t, err := r.svc.MarkComplete(ctx, id, true, force)
+	if err != nil {
+		return nil, fieldError(ctx, err)
+	}
+	return t, nil
+}
+
+func (r *mutationResolver) ReopenTask(ctx context.Context, id string) (*todo.Task, error) {
+	mutate(ctx)
+	t, err := r.svc.MarkComplete(ctx, id, false, false)
+	if err != nil {
+		return nil, fieldError(ctx, err)
+	}
+	return t, nil
+}
+
+func (r *mutationResolver) DeleteTask(ctx context.Context, id string) (string, error) {
+	mutate(ctx)
+	if err := r.svc.DeleteTask(ctx, id); err != nil {
+		return "", fieldError(ctx, err)
+	}
+	return id, nil
+}
+
+func (r *mutationResolver) AddDependency(ctx context.Context, id, blockedByID string) (*todo.Task, error) {
+	mutate(ctx)
+	if err := r.svc.AddDependency(ctx, id, blockedByID); err != nil {
+		return nil, fieldError(ctx, err)
+	}
+	t, err := r.svc.GetTask(ctx, id)
+	if err != nil {
+		return nil, fieldError(ctx, err)
+	}
+	return t, nil
+}
+
+func (r *mutationResolver) RemoveDependency(ctx context.Context, id, blockedByID string) (*todo.Task, error) {
+	mutate(ctx)
+	if err := r.svc.RemoveDependency(ctx, id, blockedByID); err != nil {
+		return nil, fieldError(ctx, err)
+	}
+	t, err := r.svc.GetTask(ctx, id)
+	if err != nil {
+		return nil, fieldError(ctx, err)
+	}
+	return t, nil
+}
+
+func (r *mutationResolver) AddComment(ctx context.Context, taskID, body, author string) (*todo.Comment, error) {
+	mutate(ctx)
+	c, err := r.comments.AddComment(ctx, taskID, author, body)
+	if err != nil {
+		return nil, fieldError(ctx, err)
+	}
+	return c, nil
+}
+
+type subscriptionResolver struct{ *resolver }
+
+// TaskChanged streams the changes to task id, or to every task. Each event
+// is resolved with loaders of its own (see loadersExtension), so it reads
+// the task as it is after the change.
+func (r *subscriptionResolver) TaskChanged(ctx context.Context, id *string) (<-chan *todo.TaskEvent, error) {
+	var only string
+	if id != nil {
+		parsed, err := uuid.Parse(*id)
+		if err != nil {
+			return nil, fieldError(ctx, todo.ErrInvalidID)
+		}
+		only = parsed.String()
+	}
+	src := r.events.Subscribe(ctx)
+	out := make(chan *todo.TaskEvent)
+	go func() {
+		// closing out while ctx is live tells the handler the broker
+		// dropped the subscriber
+		defer close(out)
+		for e := range src {
+			if only != "" && e.TaskID != only {
+				continue
+			}
+			select {
+			case out <- &e:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+// queueRelated queues the blockers and comments selected on tasks, the
+// list the field being resolved returns, so that they are fetched in one
+// batch rather than once per task.
+func queueRelated(ctx context.Context, tasks []todo.Task) {
+	l := loadersFrom(ctx)
+	vars := graphql.GetOperationContext(ctx).Variables
+	for _, f := range graphql.CollectFieldsCtx(ctx, []string{"Task"}) {
+		switch f.Name {
+		case "blockers":
+			for _, t := range tasks {
+				l.blockers.queue(t.ID)
+			}
+		case "comments":
+			first, ok := intValue(f.ArgumentMap(vars)["first"])
+			if !ok {
+				continue
+			}
+			for _, t := range tasks {
+				l.comments.queue(commentKey{taskID: t.ID, first: int(first)})
+			}
+		}
+	}
+}
+
+type taskResolver struct{ *resolver }
+
+func (r *taskResolver) Recurrence(_ context.Context, t *todo.Task) (*string, error) {
+	return optional(t.Recurrence), nil
+}
+
+func (r *taskResolver) SeriesID(_ context.Context, t *todo.Task) (*string, error) {
+	return optional(t.SeriesID), nil
+}
+
+func (r *taskResolver) Occurrence(_ context.Context, t *todo.Task) (*int, error) {
+	if t.Occurrence <= 0 {
+		return nil, nil
+	}
+	return &t.Occurrence, nil
+}
+
+func (r *taskResolver) Blockers(ctx context.Context, t *todo.Task) ([]todo.Task, error) {
+	blockers, err := loadersFrom(ctx).blockers.load(t.ID)
+	if err != nil {
+		return nil, fieldError(ctx, err)
+	}
+	queueRelated(ctx, blockers)
+	return blockers, nil
+}
+
+func (r *taskResolver) Comments(ctx context.Context, t *todo.Task, first int) ([]todo.Comment, error) {
+	l := loadersFrom(ctx)
+	// the comments' task is this one
+	l.tasks.prime(t.ID, t)
+	comments, err := l.comments.load(commentKey{taskID: t.ID, first: first})
+	if err != nil {
+		return nil, fieldError(ctx, err)
+	}
+	return comments, nil
+}
+
+type commentResolver struct{ *resolver }
+
+func (r *commentResolver) Task(ctx context.Context, c *todo.Comment) (*todo.Task, error) {
+	t, err := loadersFrom(ctx).tasks.load(c.TaskID)
+	if err != nil {
+		return nil, fieldError(ctx, err)
+	}
+	return t, nil
+}
+
+type taskPageResolver struct{ *resolver }
+
+func (r *taskPageResolver) Items(ctx context.Context, p *TaskPage) ([]todo.Task, error) {
+	queueRelated(ctx, p.Items)
+	return p.Items, nil
+}
+
+type taskEventResolver struct{ *resolver }
+
+func (r *taskEventResolver) Kind(_ context.Context, e *todo.TaskEvent) (TaskEventKind, error) {
+	return TaskEventKind(e.Kind), nil
+}
+
+func (r *taskEventResolver) Task(ctx context.Context, e *todo.TaskEvent) (*todo.Task, error) {
+	t, err := loadersFrom(ctx).tasks.load(e.TaskID)
+	if err != nil {
+		return nil, fieldError(ctx, err)
+	}
+	return t, nil
+}
+
+func optional(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+func deref[T any](p *T) T {
+	var v T
+	if p != nil {
+		v = *p
+	}
+	return v
+}
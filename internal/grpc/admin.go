@@ -0,0 +1,93 @@
+package grpc
+
+import (
+	"context"
+	"time"
+
+	"github.com/fuzail/08-todosvc/internal/apierr"
+	"github.com/fuzail/08-todosvc/internal/todo"
+	pb "github.com/fuzail/08-todosvc/proto/todo/v1"
+)
+
+type adminHandler struct {
+	pb.UnimplementedAdminServiceServer
+	quotas      todo.QuotaService
+	maintenance todo.MaintenanceService
+}
+
+func NewAdminHandler(q todo.QuotaService, m todo.MaintenanceService) pb.AdminServiceServer {
+	return &adminHandler{quotas: q, maintenance: m}
+}
+
+func toProtoQuota(q *todo.Quota) *pb.Quota {
+	return &pb.Quota{
+		Tenant:             q.Tenant,
+		MaxOpenTasks:       q.MaxOpenTasks,
+		MaxTasksPerDay:     q.MaxTasksPerDay,
+		MaxAttachmentBytes: q.MaxAttachmentBytes,
+	}
+}
+
+func (h *adminHandler) GetQuota(ctx context.Context, req *pb.GetQuotaRequest) (*pb.GetQuotaResponse, error) {
+	q, err := h.quotas.GetQuota(ctx, req.Tenant)
+	if err != nil {
+		return nil, apierr.Status(ctx, err)
+	}
+	return &pb.GetQuotaResponse{Quota: toProtoQuota(q)}, nil
+}
+
+func (h *adminHandler) SetQuota(ctx context.Context, req *pb.SetQuotaRequest) (*pb.SetQuotaResponse, error) {
+	q, err := h.quotas.SetQuota(ctx, todo.Quota{
+		Tenant:             req.Tenant,
+		MaxOpenTasks:       req.Quota.GetMaxOpenTasks(),
+		MaxTasksPerDay:     req.Quota.GetMaxTasksPerDay(),
+		MaxAttachmentBytes: req.Quota.GetMaxAttachmentBytes(),
+	})
+	if err != nil {
+		return nil, apierr.Status(ctx, err)
+	}
+	return &pb.SetQuotaResponse{Quota: toProtoQuota(q)}, nil
+}
+
+func (h *adminHandler) GetUsage(ctx context.Context, req *pb.GetUsageRequest) (*pb.GetUsageResponse, error) {
+	q, err := h.quotas.GetQuota(ctx, req.Tenant)
+	if err != nil {
+		return nil, apierr.Status(ctx, err)
+	}
+	u, err := h.quotas.GetUsage(ctx, req.Tenant)
+	if err != nil {
+		return nil, apierr.Status(ctx, err)
+	}
+	return &pb.GetUsageResponse{Quota: toProtoQuota(q), Usage: &pb.Usage{
+		OpenTasks:       u.OpenTasks,
+		TasksToday:      u.TasksToday,
+		AttachmentBytes: u.AttachmentBytes,
+	}}, nil
+}
+
+func (h *adminHandler) GetTaskStats(ctx context.Context, req *pb.GetTaskStatsRequest) (*pb.GetTaskStatsResponse, error) {
+	st, err := h.maintenance.Stats(ctx, req.Tenant)
+	if err != nil {
+		return nil, apierr.Status(ctx, err)
+	}
+	return &pb.GetTaskStatsResponse{Stats: &pb.TaskStats{
+		Tenant:          st.Tenant,
+		OpenTasks:       st.OpenTasks,
+		CompletedTasks:  st.CompletedTasks,
+		OverdueTasks:    st.OverdueTasks,
+		DeletedTasks:    st.DeletedTasks,
+		AttachmentBytes: st.AttachmentBytes,
+	}}, nil
+}
+
+func (h *adminHandler) PurgeDeletedTasks(ctx context.Context, req *pb.PurgeDeletedTasksRequest) (*pb.PurgeDeletedTasksResponse, error) {
+	var before time.Time
+	if req.DeletedBefore != nil {
+		before = req.DeletedBefore.AsTime()
+	}
+	res, err := h.maintenance.PurgeDeleted(ctx, before)
+	if err != nil {
+		return nil, apierr.Status(ctx, err)
+	}
+	return &pb.PurgeDeletedTasksResponse{Tasks: res.Tasks, Comments: res.Comments, Attachments: res.Attachments}, nil
+}
@@ -0,0 +1,139 @@
+package grpc
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/fuzail/08-todosvc/internal/apierr"
+	"github.com/fuzail/08-todosvc/internal/todo"
+	pb "github.com/fuzail/08-todosvc/proto/todo/v1"
+	grpcObj "google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// downloadChunkSize is the payload size of each DownloadAttachment message.
+const downloadChunkSize = 64 << 10
+
+func toProtoAttachment(a *todo.Attachment) *pb.Attachment {
+	if a == nil {
+		return nil
+	}
+	return &pb.Attachment{
+		Id:          a.ID,
+		TaskId:      a.TaskID,
+		Name:        a.Name,
+		Size:        a.Size,
+		ContentType: a.ContentType,
+		Checksum:    a.Checksum,
+		CreatedAt:   timestamppb.New(a.CreatedAt),
+	}
+}
+
+// uploadReader turns the chunk messages of an upload stream into an io.Reader.
+type uploadReader struct {
+	stream grpcObj.ClientStreamingServer[pb.UploadAttachmentRequest, pb.UploadAttachmentResponse]
+	buf    []byte
+}
+
+func (r *uploadReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		msg, err := r.stream.Recv()
+		if err != nil {
+			return 0, err // io.EOF when the client closes the stream
+		}
+		if msg.GetInfo() != nil {
+			return 0, status.Error(codes.InvalidArgument, "info must only be sent first")
+		}
+		r.buf = msg.GetChunk()
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+func (h *handler) UploadAttachment(stream grpcObj.ClientStreamingServer[pb.UploadAttachmentRequest, pb.UploadAttachmentResponse]) error {
+	first, err := stream.Recv()
+	if err != nil {
+		return status.Error(codes.InvalidArgument, "expected attachment info")
+	}
+	info := first.GetInfo()
+	if info == nil {
+		return status.Error(codes.InvalidArgument, "first message must carry info")
+	}
+	a, err := h.attachments.Upload(stream.Context(), info.TaskId, info.Name, info.ContentType, &uploadReader{stream: stream})
+	if err != nil {
+		return apierr.Status(stream.Context(), err)
+	}
+	return stream.SendAndClose(&pb.UploadAttachmentResponse{Attachment: toProtoAttachment(a)})
+}
+
+func (h *handler) DownloadAttachment(req *pb.DownloadAttachmentRequest, stream grpcObj.ServerStreamingServer[pb.DownloadAttachmentResponse]) error {
+	var violations []todo.FieldViolation
+	if req.Offset < 0 {
+		violations = append(violations, todo.FieldViolation{Field: "offset", Description: "must not be negative"})
+	}
+	if req.Length < 0 {
+		violations = append(violations, todo.FieldViolation{Field: "length", Description: "must not be negative"})
+	}
+	if err := todo.InvalidArgument(violations...); err != nil {
+		return apierr.Status(stream.Context(), err)
+	}
+	a, rc, err := h.attachments.Open(stream.Context(), req.TaskId, req.Id)
+	if err != nil {
+		return apierr.Status(stream.Context(), err)
+	}
+	defer rc.Close()
+	if req.Offset > a.Size {
+		return status.Error(codes.OutOfRange, "offset past end of attachment")
+	}
+	if _, err := rc.Seek(req.Offset, io.SeekStart); err != nil {
+		return apierr.Status(stream.Context(), fmt.Errorf("download: %w", err))
+	}
+	var r io.Reader = rc
+	if req.Length > 0 {
+		r = io.LimitReader(rc, req.Length)
+	}
+
+	if err := stream.Send(&pb.DownloadAttachmentResponse{Data: &pb.DownloadAttachmentResponse_Attachment{Attachment: toProtoAttachment(a)}}); err != nil {
+		return err
+	}
+	buf := make([]byte, downloadChunkSize)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			chunk := &pb.DownloadAttachmentResponse{Data: &pb.DownloadAttachmentResponse_Chunk{Chunk: buf[:n]}}
+			if err := stream.Send(chunk); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return apierr.Status(stream.Context(), fmt.Errorf("download: %w", err))
+		}
+	}
+}
+
+func (h *handler) ListAttachments(ctx context.Context, req *pb.ListAttachmentsRequest) (*pb.ListAttachmentsResponse, error) {
+	atts, err := h.attachments.ListAttachments(ctx, req.TaskId)
+	if err != nil {
+		return nil, apierr.Status(ctx, err)
+	}
+	out := make([]*pb.Attachment, 0, len(atts))
+	for _, a := range atts {
+		copyA := a
+		out = append(out, toProtoAttachment(&copyA))
+	}
+	return &pb.ListAttachmentsResponse{Attachments: out}, nil
+}
+
+func (h *handler) DeleteAttachment(ctx context.Context, req *pb.DeleteAttachmentRequest) (*pb.DeleteAttachmentResponse, error) {
+	if err := h.attachments.DeleteAttachment(ctx, req.TaskId, req.Id); err != nil {
+		return nil, apierr.Status(ctx, err)
+	}
+	return &pb.DeleteAttachmentResponse{Success: true}, nil
+}
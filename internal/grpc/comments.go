@@ -0,0 +1,74 @@
+package grpc
+
+import (
+	"context"
+
+	"github.com/fuzail/08-todosvc/internal/apierr"
+	"github.com/fuzail/08-todosvc/internal/todo"
+	pb "github.com/fuzail/08-todosvc/proto/todo/v1"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func toProtoComment(c *todo.Comment) *pb.Comment {
+	if c == nil {
+		return nil
+	}
+	return &pb.Comment{
+		Id:        c.ID,
+		TaskId:    c.TaskID,
+		Author:    c.Author,
+		Body:      c.Body,
+		CreatedAt: timestamppb.New(c.CreatedAt),
+		UpdatedAt: timestamppb.New(c.UpdatedAt),
+		EditedAt:  toProtoTime(c.EditedAt),
+	}
+}
+
+func (h *handler) AddComment(ctx context.Context, req *pb.AddCommentRequest) (*pb.AddCommentResponse, error) {
+	c, err := h.comments.AddComment(ctx, req.TaskId, req.Author, req.Body)
+	if err != nil {
+		return nil, apierr.Status(ctx, err)
+	}
+	return &pb.AddCommentResponse{Comment: toProtoComment(c)}, nil
+}
+
+func (h *handler) ListComments(ctx context.Context, req *pb.ListCommentsRequest) (*pb.ListCommentsResponse, error) {
+	page := int(req.Page)
+	if page == 0 {
+		page = 1
+	}
+	pageSize := int(req.PageSize)
+	if pageSize == 0 {
+		pageSize = 10
+	}
+	comments, total, err := h.comments.ListComments(ctx, req.TaskId, page, pageSize)
+	if err != nil {
+		return nil, apierr.Status(ctx, err)
+	}
+	protoComments := make([]*pb.Comment, 0, len(comments))
+	for _, c := range comments {
+		copyC := c
+		protoComments = append(protoComments, toProtoComment(&copyC))
+	}
+	return &pb.ListCommentsResponse{
+		Comments: protoComments,
+		Page:     int32(page),
+		PageSize: int32(pageSize),
+		Total:    total,
+	}, nil
+}
+
+func (h *handler) EditComment(ctx context.Context, req *pb.EditCommentRequest) (*pb.EditCommentResponse, error) {
+	c, err := h.comments.EditComment(ctx, req.TaskId, req.Id, req.Body)
+	if err != nil {
+		return nil, apierr.Status(ctx, err)
+	}
+	return &pb.EditCommentResponse{Comment: toProtoComment(c)}, nil
+}
+
+func (h *handler) DeleteComment(ctx context.Context, req *pb.DeleteCommentRequest) (*pb.DeleteCommentResponse, error) {
+	if err := h.comments.DeleteComment(ctx, req.TaskId, req.Id); err != nil {
+		return nil, apierr.Status(ctx, err)
+	}
+	return &pb.DeleteCommentResponse{Success: true}, nil
+}
@@ -2,21 +2,23 @@ package grpc
 
 import (
 	"context"
+	"time"
 
+	"github.com/fuzail/08-todosvc/internal/apierr"
 	"github.com/fuzail/08-todosvc/internal/todo"
-	pb "github.com/fuzail/08-todosvc/proto"
-	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/status"
+	pb "github.com/fuzail/08-todosvc/proto/todo/v1"
 	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 type handler struct {
 	pb.UnimplementedTodoServiceServer
-	svc todo.Service
+	svc         todo.Service
+	comments    todo.CommentService
+	attachments todo.AttachmentService
 }
 
-func NewHandler(s todo.Service) pb.TodoServiceServer {
-	return &handler{svc: s}
+func NewHandler(s todo.Service, c todo.CommentService, a todo.AttachmentService) pb.TodoServiceServer {
+	return &handler{svc: s, comments: c, attachments: a}
 }
 
 func toProtoTask(t *todo.Task) *pb.Task {
@@ -30,16 +32,33 @@ func toProtoTask(t *todo.Task) *pb.Task {
 		Completed:   t.Completed,
 		CreatedAt:   timestamppb.New(t.CreatedAt),
 		UpdatedAt:   timestamppb.New(t.UpdatedAt),
+		DueAt:       toProtoTime(t.DueAt),
+		Recurrence:  t.Recurrence,
+		SeriesId:    t.SeriesID,
+		Occurrence:  int32(t.Occurrence),
+		Tenant:      t.Tenant,
 	}
 }
 
-func (h *handler) CreateTask(ctx context.Context, req *pb.CreateTaskRequest) (*pb.CreateTaskResponse, error) {
-	if req.Title == "" {
-		return nil, status.Error(codes.InvalidArgument, "title is required")
+func toProtoTime(t *time.Time) *timestamppb.Timestamp {
+	if t == nil {
+		return nil
+	}
+	return timestamppb.New(*t)
+}
+
+func fromProtoTime(ts *timestamppb.Timestamp) *time.Time {
+	if ts == nil {
+		return nil
 	}
-	t, err := h.svc.CreateTask(ctx, req.Title, req.Description)
+	t := ts.AsTime()
+	return &t
+}
+
+func (h *handler) CreateTask(ctx context.Context, req *pb.CreateTaskRequest) (*pb.CreateTaskResponse, error) {
+	t, err := h.svc.CreateTask(ctx, req.Id, req.Title, req.Description, fromProtoTime(req.DueAt), req.Recurrence)
 	if err != nil {
-		return nil, status.Errorf(codes.Internal, "create: %v", err)
+		return nil, apierr.Status(ctx, err)
 	}
 	return &pb.CreateTaskResponse{Task: toProtoTask(t)}, nil
 }
@@ -47,10 +66,7 @@ func (h *handler) CreateTask(ctx context.Context, req *pb.CreateTaskRequest) (*p
 func (h *handler) GetTask(ctx context.Context, req *pb.GetTaskRequest) (*pb.GetTaskResponse, error) {
 	t, err := h.svc.GetTask(ctx, req.Id)
 	if err != nil {
-		if err == todo.ErrNotFound {
-			return nil, status.Error(codes.NotFound, "task not found")
-		}
-		return nil, status.Errorf(codes.Internal, "get: %v", err)
+		return nil, apierr.Status(ctx, err)
 	}
 	return &pb.GetTaskResponse{Task: toProtoTask(t)}, nil
 }
@@ -64,9 +80,16 @@ func (h *handler) ListTasks(ctx context.Context, req *pb.ListTasksRequest) (*pb.
 	if pageSize == 0 {
 		pageSize = 10
 	}
-	tasks, total, err := h.svc.ListTasks(ctx, page, pageSize)
+	var filter todo.ListFilter
+	switch req.Filter {
+	case pb.ListTasksRequest_READY:
+		filter = todo.FilterReady
+	case pb.ListTasksRequest_BLOCKED:
+		filter = todo.FilterBlocked
+	}
+	tasks, total, err := h.svc.ListTasks(ctx, page, pageSize, filter)
 	if err != nil {
-		return nil, status.Errorf(codes.Internal, "list: %v", err)
+		return nil, apierr.Status(ctx, err)
 	}
 	protoTasks := make([]*pb.Task, 0, len(tasks))
 	for _, t := range tasks {
@@ -83,42 +106,113 @@ func (h *handler) ListTasks(ctx context.Context, req *pb.ListTasksRequest) (*pb.
 }
 
 func (h *handler) UpdateTask(ctx context.Context, req *pb.UpdateTaskRequest) (*pb.UpdateTaskResponse, error) {
-	if req.Id == "" {
-		return nil, status.Error(codes.InvalidArgument, "id required")
-	}
 	t, err := h.svc.UpdateTask(ctx, req.Id, req.Title, req.Description)
 	if err != nil {
-		if err == todo.ErrNotFound {
-			return nil, status.Error(codes.NotFound, "task not found")
-		}
-		return nil, status.Errorf(codes.Internal, "update: %v", err)
+		return nil, apierr.Status(ctx, err)
 	}
 	return &pb.UpdateTaskResponse{Task: toProtoTask(t)}, nil
 }
 
 func (h *handler) MarkComplete(ctx context.Context, req *pb.MarkCompleteRequest) (*pb.MarkCompleteResponse, error) {
-	if req.Id == "" {
-		return nil, status.Error(codes.InvalidArgument, "id required")
-	}
-	t, err := h.svc.MarkComplete(ctx, req.Id, req.Completed)
+	t, err := h.svc.MarkComplete(ctx, req.Id, req.Completed, req.Force)
 	if err != nil {
-		if err == todo.ErrNotFound {
-			return nil, status.Error(codes.NotFound, "task not found")
-		}
-		return nil, status.Errorf(codes.Internal, "mark complete: %v", err)
+		return nil, apierr.Status(ctx, err)
 	}
 	return &pb.MarkCompleteResponse{Task: toProtoTask(t)}, nil
 }
 
 func (h *handler) DeleteTask(ctx context.Context, req *pb.DeleteTaskRequest) (*pb.DeleteTaskResponse, error) {
-	if req.Id == "" {
-		return nil, status.Error(codes.InvalidArgument, "id required")
-	}
 	if err := h.svc.DeleteTask(ctx, req.Id); err != nil {
-		if err == todo.ErrNotFound {
-			return nil, status.Error(codes.NotFound, "task not found")
-		}
-		return nil, status.Errorf(codes.Internal, "delete: %v", err)
+		return nil, apierr.Status(ctx, err)
 	}
 	return &pb.DeleteTaskResponse{Success: true}, nil
 }
+
+func (h *handler) AddDependency(ctx context.Context, req *pb.AddDependencyRequest) (*pb.AddDependencyResponse, error) {
+	if err := h.svc.AddDependency(ctx, req.TaskId, req.BlockedById); err != nil {
+		return nil, apierr.Status(ctx, err)
+	}
+	return &pb.AddDependencyResponse{Success: true}, nil
+}
+
+func (h *handler) RemoveDependency(ctx context.Context, req *pb.RemoveDependencyRequest) (*pb.RemoveDependencyResponse, error) {
+	if err := h.svc.RemoveDependency(ctx, req.TaskId, req.BlockedById); err != nil {
+		return nil, apierr.Status(ctx, err)
+	}
+	return &pb.RemoveDependencyResponse{Success: true}, nil
+}
+
+func (h *handler) ListBlockers(ctx context.Context, req *pb.ListBlockersRequest) (*pb.ListBlockersResponse, error) {
+	tasks, err := h.svc.ListBlockers(ctx, req.TaskId)
+	if err != nil {
+		return nil, apierr.Status(ctx, err)
+	}
+	protoTasks := make([]*pb.Task, 0, len(tasks))
+	for _, t := range tasks {
+		copyT := t
+		protoTasks = append(protoTasks, toProtoTask(&copyT))
+	}
+	return &pb.ListBlockersResponse{Tasks: protoTasks}, nil
+}
+
+func (h *handler) SetRecurrence(ctx context.Context, req *pb.SetRecurrenceRequest) (*pb.SetRecurrenceResponse, error) {
+	t, err := h.svc.SetRecurrence(ctx, req.Id, req.Recurrence, fromProtoTime(req.DueAt))
+	if err != nil {
+		return nil, apierr.Status(ctx, err)
+	}
+	return &pb.SetRecurrenceResponse{Task: toProtoTask(t)}, nil
+}
+
+func (h *handler) StopRecurrence(ctx context.Context, req *pb.StopRecurrenceRequest) (*pb.StopRecurrenceResponse, error) {
+	t, err := h.svc.StopRecurrence(ctx, req.Id)
+	if err != nil {
+		return nil, apierr.Status(ctx, err)
+	}
+	return &pb.StopRecurrenceResponse{Task: toProtoTask(t)}, nil
+}
+
+func (h *handler) SyncTasks(ctx context.Context, req *pb.SyncTasksRequest) (*pb.SyncTasksResponse, error) {
+	changes := make([]todo.TaskChange, 0, len(req.Changes))
+	for _, c := range req.Changes {
+		if c.GetTask() == nil {
+			return nil, apierr.Status(ctx, todo.InvalidArgument(todo.FieldViolation{Field: "changes.task", Description: "is required"}))
+		}
+		changes = append(changes, todo.TaskChange{
+			Task: todo.Task{
+				ID:          c.Task.Id,
+				Title:       c.Task.Title,
+				Description: c.Task.Description,
+				Completed:   c.Task.Completed,
+				DueAt:       fromProtoTime(c.Task.DueAt),
+				Recurrence:  c.Task.Recurrence,
+				UpdatedAt:   c.Task.UpdatedAt.AsTime(),
+			},
+			Deleted: c.Deleted,
+		})
+	}
+	res, err := h.svc.SyncTasks(ctx, req.Watermark, changes, int(req.Limit))
+	if err != nil {
+		return nil, apierr.Status(ctx, err)
+	}
+	resp := &pb.SyncTasksResponse{
+		Changes:   make([]*pb.TaskChange, 0, len(res.Changes)),
+		Watermark: res.Watermark,
+		HasMore:   res.HasMore,
+		Results:   make([]*pb.ChangeResult, 0, len(res.Results)),
+	}
+	for _, c := range res.Changes {
+		copyT := c.Task
+		resp.Changes = append(resp.Changes, &pb.TaskChange{Task: toProtoTask(&copyT), Deleted: c.Deleted})
+	}
+	for _, r := range res.Results {
+		st := pb.ChangeResult_APPLIED
+		switch r.Status {
+		case todo.ChangeConflict:
+			st = pb.ChangeResult_CONFLICT
+		case todo.ChangeRejected:
+			st = pb.ChangeResult_REJECTED
+		}
+		resp.Results = append(resp.Results, &pb.ChangeResult{Id: r.ID, Status: st, Reason: r.Reason})
+	}
+	return resp, nil
+}
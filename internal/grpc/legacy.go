@@ -0,0 +1,20 @@
+package grpc
+
+import (
+	pb "github.com/fuzail/08-todosvc/proto/todo/v1"
+	grpcObj "google.golang.org/grpc"
+)
+
+// LegacyServiceName is the name TodoService had before the proto package was
+// versioned as todo.v1. The messages didn't change, so the wire format is the
+// same and old clients keep working.
+const LegacyServiceName = "todo.TodoService"
+
+// RegisterLegacyService also serves srv under LegacyServiceName. It is
+// deprecated along with the unversioned REST paths and will be removed with
+// them.
+func RegisterLegacyService(s grpcObj.ServiceRegistrar, srv pb.TodoServiceServer) {
+	desc := pb.TodoService_ServiceDesc
+	desc.ServiceName = LegacyServiceName
+	s.RegisterService(&desc, srv)
+}
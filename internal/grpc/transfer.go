@@ -0,0 +1,115 @@
+package grpc
+
+import (
+	"bufio"
+
+	"github.com/fuzail/08-todosvc/internal/apierr"
+	"github.com/fuzail/08-todosvc/internal/taskio"
+	pb "github.com/fuzail/08-todosvc/proto/todo/v1"
+	grpcObj "google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// exportChunkSize is the payload size of each ExportTasks message.
+const exportChunkSize = 64 << 10
+
+var formats = map[pb.TaskFormat]taskio.Format{
+	pb.TaskFormat_TASK_FORMAT_UNSPECIFIED: taskio.NDJSON,
+	pb.TaskFormat_TASK_FORMAT_NDJSON:      taskio.NDJSON,
+	pb.TaskFormat_TASK_FORMAT_CSV:         taskio.CSV,
+	pb.TaskFormat_TASK_FORMAT_ICALENDAR:   taskio.ICalendar,
+}
+
+func fromProtoFormat(f pb.TaskFormat) (taskio.Format, error) {
+	format, ok := formats[f]
+	if !ok {
+		return "", status.Errorf(codes.InvalidArgument, "unknown format %v", f)
+	}
+	return format, nil
+}
+
+// chunkWriter sends what is written to it as ExportTasks messages.
+type chunkWriter struct {
+	stream grpcObj.ServerStreamingServer[pb.ExportTasksResponse]
+}
+
+func (w chunkWriter) Write(p []byte) (int, error) {
+	if err := w.stream.Send(&pb.ExportTasksResponse{Chunk: p}); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (h *handler) ExportTasks(req *pb.ExportTasksRequest, stream grpcObj.ServerStreamingServer[pb.ExportTasksResponse]) error {
+	format, err := fromProtoFormat(req.Format)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriterSize(chunkWriter{stream: stream}, exportChunkSize)
+	if err := taskio.Export(stream.Context(), h.svc, w, format); err != nil {
+		return apierr.Status(stream.Context(), err)
+	}
+	return w.Flush()
+}
+
+// importReader turns the chunk messages of an import stream into an
+// io.Reader.
+type importReader struct {
+	stream grpcObj.BidiStreamingServer[pb.ImportTasksRequest, pb.ImportTasksResponse]
+	buf    []byte
+}
+
+func (r *importReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		msg, err := r.stream.Recv()
+		if err != nil {
+			return 0, err // io.EOF when the client closes its side
+		}
+		if msg.GetOptions() != nil {
+			return 0, status.Error(codes.InvalidArgument, "options must only be sent first")
+		}
+		r.buf = msg.GetChunk()
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+var rowStatuses = map[taskio.Status]pb.ImportRowResult_Status{
+	taskio.Created: pb.ImportRowResult_CREATED,
+	taskio.Valid:   pb.ImportRowResult_VALID,
+	taskio.Exists:  pb.ImportRowResult_EXISTS,
+	taskio.Failed:  pb.ImportRowResult_FAILED,
+}
+
+func (h *handler) ImportTasks(stream grpcObj.BidiStreamingServer[pb.ImportTasksRequest, pb.ImportTasksResponse]) error {
+	first, err := stream.Recv()
+	if err != nil {
+		return status.Error(codes.InvalidArgument, "expected import options")
+	}
+	opts := first.GetOptions()
+	if opts == nil {
+		return status.Error(codes.InvalidArgument, "first message must carry options")
+	}
+	format, err := fromProtoFormat(opts.Format)
+	if err != nil {
+		return err
+	}
+	sum, err := taskio.Import(stream.Context(), h.svc, &importReader{stream: stream}, format, opts.DryRun, func(r taskio.Result) error {
+		row := &pb.ImportRowResult{Line: int64(r.Line), Id: r.ID, Status: rowStatuses[r.Status], Reason: r.Reason()}
+		if r.Err != nil {
+			row.Error = r.Err.Error()
+		}
+		return stream.Send(&pb.ImportTasksResponse{Result: &pb.ImportTasksResponse_Row{Row: row}})
+	})
+	if err != nil {
+		return apierr.Status(stream.Context(), err)
+	}
+	return stream.Send(&pb.ImportTasksResponse{Result: &pb.ImportTasksResponse_Summary{Summary: &pb.ImportSummary{
+		Created:  sum.Created,
+		Existing: sum.Existing,
+		Failed:   sum.Failed,
+		DryRun:   sum.DryRun,
+	}}})
+}
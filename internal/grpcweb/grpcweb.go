@@ -0,0 +1,232 @@
+// Package grpcweb serves gRPC-Web (https://github.com/grpc/grpc/blob/master/doc/PROTOCOL-WEB.md)
+// by translating each request into a gRPC call on a *grpc.Server's
+// ServeHTTP, so browsers can call the API without an Envoy-style proxy. It
+// also routes gRPC, gRPC-Web and REST traffic sharing one port.
+package grpcweb
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const (
+	contentTypeWeb     = "application/grpc-web"
+	contentTypeWebText = "application/grpc-web-text"
+
+	// trailerFlag marks the length-prefixed frame that carries the trailers.
+	trailerFlag = 0x80
+)
+
+// exposedHeaders lets browser code read the status of a call that failed
+// before any message was sent.
+const exposedHeaders = "Grpc-Status, Grpc-Message, Grpc-Status-Details-Bin"
+
+// IsGRPC reports whether r is a native gRPC call: HTTP/2 with an
+// application/grpc content type.
+func IsGRPC(r *http.Request) bool {
+	ct := r.Header.Get("Content-Type")
+	return r.ProtoMajor == 2 && strings.HasPrefix(ct, "application/grpc") && !strings.HasPrefix(ct, contentTypeWeb)
+}
+
+// IsGRPCWeb reports whether r is a gRPC-Web call or its CORS preflight.
+func IsGRPCWeb(r *http.Request) bool {
+	if r.Method == http.MethodOptions {
+		return strings.Contains(strings.ToLower(r.Header.Get("Access-Control-Request-Headers")), "x-grpc-web")
+	}
+	return r.Method == http.MethodPost && strings.HasPrefix(r.Header.Get("Content-Type"), contentTypeWeb)
+}
+
+// Router sends gRPC-Web requests to web, native gRPC calls to grpc and
+// everything else to next. A nil grpc leaves native calls to next, which
+// rejects them like any unknown path.
+func Router(grpc, web, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case grpc != nil && IsGRPC(r):
+			grpc.ServeHTTP(w, r)
+		case IsGRPCWeb(r):
+			web.ServeHTTP(w, r)
+		default:
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+// Handler translates gRPC-Web requests for a gRPC server's ServeHTTP.
+type Handler struct {
+	grpc    http.Handler
+	origins map[string]bool
+}
+
+// NewHandler serves gRPC-Web through grpc, normally a *grpc.Server, so calls
+// go through its interceptors like native ones. Browsers on allowedOrigins
+// may call it cross-origin; "*" allows any origin. With none, only
+// same-origin pages can.
+func NewHandler(grpc http.Handler, allowedOrigins []string) *Handler {
+	h := &Handler{grpc: grpc, origins: map[string]bool{}}
+	for _, o := range allowedOrigins {
+		if o = strings.TrimSpace(o); o != "" {
+			h.origins[o] = true
+		}
+	}
+	return h
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if origin := r.Header.Get("Origin"); origin != "" && (h.origins["*"] || h.origins[origin]) {
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		w.Header().Add("Vary", "Origin")
+		w.Header().Set("Access-Control-Expose-Headers", exposedHeaders)
+		if r.Method == http.MethodOptions {
+			w.Header().Set("Access-Control-Allow-Methods", http.MethodPost)
+			w.Header().Set("Access-Control-Allow-Headers", r.Header.Get("Access-Control-Request-Headers"))
+			w.Header().Set("Access-Control-Max-Age", "600")
+		}
+	}
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	ct := r.Header.Get("Content-Type")
+	text := strings.HasPrefix(ct, contentTypeWebText)
+	// "application/grpc-web-text+proto" -> "+proto"
+	subtype := strings.TrimPrefix(strings.TrimPrefix(ct, contentTypeWebText), contentTypeWeb)
+
+	req := r.Clone(r.Context())
+	req.ProtoMajor, req.ProtoMinor, req.Proto = 2, 0, "HTTP/2"
+	req.Header.Set("Content-Type", "application/grpc"+subtype)
+	req.Header.Del("Content-Length")
+	req.ContentLength = -1
+	if text {
+		req.Body = io.NopCloser(&textDecoder{r: r.Body})
+	}
+
+	rw := &responseWriter{w: w, text: text, contentType: ct, header: http.Header{}}
+	h.grpc.ServeHTTP(rw, req)
+	rw.finish()
+}
+
+// textDecoder decodes a grpc-web-text request body. Clients may encode the
+// body in chunks, each padded on its own, which a single base64 decoder
+// rejects; as padded chunks are whole 4-byte quanta, the body is decoded a
+// quantum at a time instead.
+type textDecoder struct {
+	r       io.Reader
+	buf     [4096]byte
+	quantum []byte // fewer than 4 bytes carried over from the last read
+	out     []byte
+	err     error
+}
+
+func (d *textDecoder) Read(p []byte) (int, error) {
+	for len(d.out) == 0 {
+		if d.err != nil {
+			if d.err == io.EOF && len(d.quantum) > 0 {
+				return 0, io.ErrUnexpectedEOF
+			}
+			return 0, d.err
+		}
+		n, err := d.r.Read(d.buf[:])
+		for _, c := range d.buf[:n] {
+			if c == '\r' || c == '\n' {
+				continue
+			}
+			d.quantum = append(d.quantum, c)
+			if len(d.quantum) < 4 {
+				continue
+			}
+			var b [3]byte
+			m, derr := base64.StdEncoding.Decode(b[:], d.quantum)
+			if derr != nil {
+				err = derr
+				break
+			}
+			d.out = append(d.out, b[:m]...)
+			d.quantum = d.quantum[:0]
+		}
+		d.err = err
+	}
+	n := copy(p, d.out)
+	d.out = d.out[n:]
+	return n, nil
+}
+
+// responseWriter turns a gRPC response into a gRPC-Web one: the HTTP/2
+// trailers become a final frame in the body, and the body is base64 encoded
+// for the text format.
+type responseWriter struct {
+	w           http.ResponseWriter
+	text        bool
+	contentType string
+	header      http.Header
+	wroteHeader bool
+}
+
+func (rw *responseWriter) Header() http.Header {
+	return rw.header
+}
+
+func (rw *responseWriter) WriteHeader(code int) {
+	if rw.wroteHeader {
+		return
+	}
+	rw.wroteHeader = true
+	dst := rw.w.Header()
+	for k, v := range rw.header {
+		if k == "Trailer" || strings.HasPrefix(k, http.TrailerPrefix) {
+			continue
+		}
+		dst[k] = v
+	}
+	dst.Set("Content-Type", rw.contentType)
+	rw.w.WriteHeader(code)
+}
+
+func (rw *responseWriter) Write(b []byte) (int, error) {
+	rw.WriteHeader(http.StatusOK)
+	if !rw.text {
+		return rw.w.Write(b)
+	}
+	// each write is encoded on its own, padding included, so it can be
+	// flushed; clients decode the body chunk by chunk
+	if _, err := io.WriteString(rw.w, base64.StdEncoding.EncodeToString(b)); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (rw *responseWriter) Flush() {
+	rw.WriteHeader(http.StatusOK)
+	if f, ok := rw.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// finish writes the trailers the gRPC server set after the body.
+func (rw *responseWriter) finish() {
+	rw.WriteHeader(http.StatusOK)
+	var trailers bytes.Buffer
+	write := func(k string, vv []string) {
+		for _, v := range vv {
+			trailers.WriteString(strings.ToLower(k) + ": " + v + "\r\n")
+		}
+	}
+	for _, k := range rw.header.Values("Trailer") {
+		write(k, rw.header.Values(k))
+	}
+	for k, vv := range rw.header {
+		if strings.HasPrefix(k, http.TrailerPrefix) {
+			write(strings.TrimPrefix(k, http.TrailerPrefix), vv)
+		}
+	}
+	frame := make([]byte, 5, 5+trailers.Len())
+	frame[0] = trailerFlag
+	binary.BigEndian.PutUint32(frame[1:], uint32(trailers.Len()))
+	_, _ = rw.Write(append(frame, trailers.Bytes()...))
+	rw.Flush()
+}
@@ -0,0 +1,88 @@
+// Package logging configures log/slog and provides access-log middleware for
+// the HTTP and gRPC servers.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/fuzail/08-todosvc/internal/reqctx"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// level is the default logger's level; SetLevel changes it at runtime.
+var level slog.LevelVar
+
+// Setup installs a JSON slog logger as the default (which also routes the
+// standard log package through it) at the given level: debug, info (default),
+// warn or error.
+func Setup(lvl string) error {
+	if err := SetLevel(lvl); err != nil {
+		return err
+	}
+	slog.SetDefault(New(os.Stdout, &level))
+	return nil
+}
+
+// SetLevel changes the level of the logger installed by Setup.
+func SetLevel(lvl string) error {
+	l, err := ParseLevel(lvl)
+	if err != nil {
+		return err
+	}
+	level.Set(l)
+	return nil
+}
+
+// New returns a JSON logger that adds request_id, tenant, client and trace_id
+// from the context to every record logged with a *Context method.
+func New(w io.Writer, level slog.Leveler) *slog.Logger {
+	return slog.New(contextHandler{slog.NewJSONHandler(w, &slog.HandlerOptions{Level: level})})
+}
+
+// ParseLevel parses a level name: debug, info (or empty), warn or error.
+func ParseLevel(s string) (slog.Level, error) {
+	switch strings.ToLower(s) {
+	case "", "info":
+		return slog.LevelInfo, nil
+	case "debug":
+		return slog.LevelDebug, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+	return 0, fmt.Errorf("unknown log level %q", s)
+}
+
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := reqctx.RequestID(ctx); id != "" {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	if t := reqctx.Tenant(ctx); t != "" {
+		r.AddAttrs(slog.String("tenant", t))
+	}
+	if c, ok := reqctx.ClientFrom(ctx); ok {
+		r.AddAttrs(slog.String("client", c.String()))
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		r.AddAttrs(slog.String("trace_id", sc.TraceID().String()))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,119 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/fuzail/08-todosvc/internal/reqctx"
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// requestID returns the incoming ID if the client sent a sane one, or a new
+// UUID.
+func requestID(incoming string) string {
+	if incoming != "" && len(incoming) <= 128 {
+		return incoming
+	}
+	return uuid.NewString()
+}
+
+// HTTPMiddleware assigns a request ID (from X-Request-ID when present), echoes
+// it in the response, stores it in the request context, and writes one
+// access log line per request. The tenant is stored by auth.Policy, which
+// runs inside it.
+func HTTPMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		id := requestID(r.Header.Get(reqctx.RequestIDHeader))
+		w.Header().Set(reqctx.RequestIDHeader, id)
+		ctx := reqctx.WithRequestID(r.Context(), id)
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r.WithContext(ctx))
+
+		slog.InfoContext(ctx, "http request",
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", rec.status),
+			slog.Duration("duration", time.Since(start)),
+		)
+	})
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	if !r.wroteHeader {
+		r.status = code
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// grpcContext reads x-request-id from the incoming metadata, sends it back as
+// a response header and stores it in ctx.
+func grpcContext(ctx context.Context) context.Context {
+	var incoming string
+	if v := metadata.ValueFromIncomingContext(ctx, strings.ToLower(reqctx.RequestIDHeader)); len(v) > 0 {
+		incoming = v[0]
+	}
+	id := requestID(incoming)
+	_ = grpc.SetHeader(ctx, metadata.Pairs(reqctx.RequestIDHeader, id))
+	return reqctx.WithRequestID(ctx, id)
+}
+
+func logGRPC(ctx context.Context, method string, start time.Time, err error) {
+	slog.InfoContext(ctx, "grpc request",
+		slog.String("method", method),
+		slog.String("status", status.Code(err).String()),
+		slog.Duration("duration", time.Since(start)),
+	)
+}
+
+// UnaryServerInterceptor is the gRPC counterpart of HTTPMiddleware.
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		ctx = grpcContext(ctx)
+		resp, err := handler(ctx, req)
+		logGRPC(ctx, info.FullMethod, start, err)
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor is the streaming counterpart of
+// UnaryServerInterceptor.
+func StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		ctx := grpcContext(ss.Context())
+		err := handler(srv, &contextStream{ServerStream: ss, ctx: ctx})
+		logGRPC(ctx, info.FullMethod, start, err)
+		return err
+	}
+}
+
+// contextStream overrides the context of a grpc.ServerStream.
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextStream) Context() context.Context {
+	return s.ctx
+}
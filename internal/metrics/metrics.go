@@ -0,0 +1,167 @@
+// Package metrics exposes Prometheus metrics for the gRPC and HTTP servers,
+// the database pool and task domain events.
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/fuzail/08-todosvc/internal/todo"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// Registry holds every metric served on /metrics.
+var Registry = prometheus.NewRegistry()
+
+var (
+	grpcHandled = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "grpc_server_handled_total",
+		Help: "gRPC calls completed, by method and status code.",
+	}, []string{"grpc_method", "grpc_code"})
+	grpcDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "grpc_server_handling_seconds",
+		Help:    "gRPC call latency, by method.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"grpc_method"})
+
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "HTTP requests completed, by route, method and status.",
+	}, []string{"route", "method", "code"})
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "HTTP request latency, by route and method.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method"})
+
+	tasksCreated = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "todosvc_tasks_created_total",
+		Help: "Tasks created, including imported and synced tasks and next occurrences.",
+	})
+	tasksCompleted = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "todosvc_tasks_completed_total",
+		Help: "Tasks that went from open to completed.",
+	})
+	tasksDeleted = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "todosvc_tasks_deleted_total",
+		Help: "Tasks deleted, including through sync.",
+	})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		grpcHandled, grpcDuration,
+		httpRequests, httpDuration,
+		tasksCreated, tasksCompleted, tasksDeleted,
+	)
+}
+
+// Handler serves the registry in the Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+// UnaryServerInterceptor records count and latency of unary gRPC calls.
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		observeGRPC(info.FullMethod, start, err)
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor records count and latency of streaming gRPC calls.
+func StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		err := handler(srv, ss)
+		observeGRPC(info.FullMethod, start, err)
+		return err
+	}
+}
+
+func observeGRPC(method string, start time.Time, err error) {
+	grpcHandled.WithLabelValues(method, status.Code(err).String()).Inc()
+	grpcDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+}
+
+// HTTPMiddleware records count and latency of HTTP requests. route maps a
+// request to a low-cardinality label such as "/tasks/{id}".
+func HTTPMiddleware(route func(*http.Request) string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		rt := route(r)
+		httpRequests.WithLabelValues(rt, r.Method, strconv.Itoa(rec.status)).Inc()
+		httpDuration.WithLabelValues(rt, r.Method).Observe(time.Since(start).Seconds())
+	})
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	if !r.wroteHeader {
+		r.status = code
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// instrumentedRepository counts task events on top of a todo.Repository.
+type instrumentedRepository struct {
+	todo.Repository
+}
+
+// InstrumentRepository wraps r so task creations, completions and deletions
+// are counted where they are stored: this covers every path that writes
+// them, such as imports, sync and the next occurrence of a recurring task,
+// and counts a completion only when a task goes from open to completed.
+func InstrumentRepository(r todo.Repository) todo.Repository {
+	return &instrumentedRepository{Repository: r}
+}
+
+func (r *instrumentedRepository) Create(ctx context.Context, t *todo.Task) error {
+	err := r.Repository.Create(ctx, t)
+	if err == nil {
+		tasksCreated.Inc()
+	}
+	return err
+}
+
+func (r *instrumentedRepository) Complete(ctx context.Context, t *todo.Task, next *todo.Task, ifSeq int64) (bool, error) {
+	done, err := r.Repository.Complete(ctx, t, next, ifSeq)
+	if done {
+		tasksCompleted.Inc()
+		if next != nil {
+			tasksCreated.Inc()
+		}
+	}
+	return done, err
+}
+
+func (r *instrumentedRepository) Delete(ctx context.Context, id string) error {
+	err := r.Repository.Delete(ctx, id)
+	if err == nil {
+		tasksDeleted.Inc()
+	}
+	return err
+}
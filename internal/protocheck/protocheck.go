@@ -0,0 +1,242 @@
+// Package protocheck detects wire- and REST-breaking changes between two
+// versions of a proto file, in the spirit of `buf breaking` but without
+// network access: the baseline is a FileDescriptorProto checked into the repo.
+package protocheck
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// Describe returns the descriptor of fd without source info, the form stored
+// as a baseline.
+func Describe(fd protoreflect.FileDescriptor) *descriptorpb.FileDescriptorProto {
+	fdp := protodesc.ToFileDescriptorProto(fd)
+	fdp.SourceCodeInfo = nil
+	return fdp
+}
+
+// Load reads a baseline written by Save.
+func Load(path string) (*descriptorpb.FileDescriptorProto, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("load baseline: %w", err)
+	}
+	fdp := &descriptorpb.FileDescriptorProto{}
+	if err := protojson.Unmarshal(b, fdp); err != nil {
+		return nil, fmt.Errorf("load baseline %s: %w", path, err)
+	}
+	return fdp, nil
+}
+
+// Save writes fdp as indented JSON so baseline updates are reviewable.
+func Save(path string, fdp *descriptorpb.FileDescriptorProto) error {
+	b, err := protojson.Marshal(fdp)
+	if err != nil {
+		return fmt.Errorf("save baseline: %w", err)
+	}
+	// protojson randomizes whitespace; re-indent so the file is stable
+	var out bytes.Buffer
+	if err := json.Indent(&out, b, "", "  "); err != nil {
+		return fmt.Errorf("save baseline: %w", err)
+	}
+	out.WriteByte('\n')
+	if err := os.WriteFile(path, out.Bytes(), 0o644); err != nil {
+		return fmt.Errorf("save baseline: %w", err)
+	}
+	return nil
+}
+
+// Breaking lists the changes from base to cur that would break existing
+// clients, sorted. Additions are allowed; deletions and changes to names,
+// numbers, types, cardinality, streaming and HTTP bindings are not. A field or
+// enum value may be deleted if its number is reserved.
+func Breaking(base, cur *descriptorpb.FileDescriptorProto) []string {
+	c := &checker{}
+	if base.GetPackage() != cur.GetPackage() {
+		c.report("package changed from %q to %q", base.GetPackage(), cur.GetPackage())
+	}
+	c.messages(base.GetPackage(), base.GetMessageType(), cur.GetMessageType())
+	c.enums(base.GetPackage(), base.GetEnumType(), cur.GetEnumType())
+
+	services := map[string]*descriptorpb.ServiceDescriptorProto{}
+	for _, s := range cur.GetService() {
+		services[s.GetName()] = s
+	}
+	for _, s := range base.GetService() {
+		name := base.GetPackage() + "." + s.GetName()
+		next, ok := services[s.GetName()]
+		if !ok {
+			c.report("service %s deleted", name)
+			continue
+		}
+		c.methods(name, s.GetMethod(), next.GetMethod())
+	}
+	sort.Strings(c.problems)
+	return c.problems
+}
+
+type checker struct {
+	problems []string
+}
+
+func (c *checker) report(format string, args ...interface{}) {
+	c.problems = append(c.problems, fmt.Sprintf(format, args...))
+}
+
+func (c *checker) messages(scope string, base, cur []*descriptorpb.DescriptorProto) {
+	byName := map[string]*descriptorpb.DescriptorProto{}
+	for _, m := range cur {
+		byName[m.GetName()] = m
+	}
+	for _, m := range base {
+		name := scope + "." + m.GetName()
+		next, ok := byName[m.GetName()]
+		if !ok {
+			c.report("message %s deleted", name)
+			continue
+		}
+		c.fields(name, m, next)
+		c.messages(name, m.GetNestedType(), next.GetNestedType())
+		c.enums(name, m.GetEnumType(), next.GetEnumType())
+	}
+}
+
+func (c *checker) fields(msg string, base, cur *descriptorpb.DescriptorProto) {
+	byNumber := map[int32]*descriptorpb.FieldDescriptorProto{}
+	for _, f := range cur.GetField() {
+		byNumber[f.GetNumber()] = f
+	}
+	for _, f := range base.GetField() {
+		name := msg + "." + f.GetName()
+		next, ok := byNumber[f.GetNumber()]
+		if !ok {
+			if !fieldReserved(cur, f.GetNumber()) {
+				c.report("field %s (%d) deleted without reserving its number", name, f.GetNumber())
+			}
+			continue
+		}
+		// the name is part of the JSON (REST) encoding
+		if next.GetName() != f.GetName() {
+			c.report("field %s (%d) renamed to %s", name, f.GetNumber(), next.GetName())
+		}
+		if next.GetType() != f.GetType() || next.GetTypeName() != f.GetTypeName() {
+			c.report("field %s changed type from %s to %s", name, fieldType(f), fieldType(next))
+		}
+		if next.GetLabel() != f.GetLabel() {
+			c.report("field %s changed cardinality from %s to %s", name, f.GetLabel(), next.GetLabel())
+		}
+		if oneofName(base, f) != oneofName(cur, next) {
+			c.report("field %s moved from oneof %q to %q", name, oneofName(base, f), oneofName(cur, next))
+		}
+	}
+}
+
+func fieldReserved(m *descriptorpb.DescriptorProto, n int32) bool {
+	for _, r := range m.GetReservedRange() {
+		// end is exclusive
+		if n >= r.GetStart() && n < r.GetEnd() {
+			return true
+		}
+	}
+	return false
+}
+
+func fieldType(f *descriptorpb.FieldDescriptorProto) string {
+	if f.GetTypeName() != "" {
+		return f.GetTypeName()
+	}
+	return f.GetType().String()
+}
+
+func oneofName(m *descriptorpb.DescriptorProto, f *descriptorpb.FieldDescriptorProto) string {
+	// proto3 optional fields live in a synthetic oneof that isn't part of the API
+	if f.OneofIndex == nil || f.GetProto3Optional() {
+		return ""
+	}
+	return m.GetOneofDecl()[f.GetOneofIndex()].GetName()
+}
+
+func (c *checker) enums(scope string, base, cur []*descriptorpb.EnumDescriptorProto) {
+	byName := map[string]*descriptorpb.EnumDescriptorProto{}
+	for _, e := range cur {
+		byName[e.GetName()] = e
+	}
+	for _, e := range base {
+		name := scope + "." + e.GetName()
+		next, ok := byName[e.GetName()]
+		if !ok {
+			c.report("enum %s deleted", name)
+			continue
+		}
+		byNumber := map[int32]*descriptorpb.EnumValueDescriptorProto{}
+		for _, v := range next.GetValue() {
+			byNumber[v.GetNumber()] = v
+		}
+		for _, v := range e.GetValue() {
+			nv, ok := byNumber[v.GetNumber()]
+			switch {
+			case !ok && !enumReserved(next, v.GetNumber()):
+				c.report("enum value %s.%s (%d) deleted without reserving its number", name, v.GetName(), v.GetNumber())
+			case ok && nv.GetName() != v.GetName():
+				// REST encodes enums by name
+				c.report("enum value %s.%s (%d) renamed to %s", name, v.GetName(), v.GetNumber(), nv.GetName())
+			}
+		}
+	}
+}
+
+func enumReserved(e *descriptorpb.EnumDescriptorProto, n int32) bool {
+	for _, r := range e.GetReservedRange() {
+		// end is inclusive for enums
+		if n >= r.GetStart() && n <= r.GetEnd() {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *checker) methods(svc string, base, cur []*descriptorpb.MethodDescriptorProto) {
+	byName := map[string]*descriptorpb.MethodDescriptorProto{}
+	for _, m := range cur {
+		byName[m.GetName()] = m
+	}
+	for _, m := range base {
+		name := svc + "." + m.GetName()
+		next, ok := byName[m.GetName()]
+		if !ok {
+			c.report("rpc %s deleted", name)
+			continue
+		}
+		if next.GetInputType() != m.GetInputType() {
+			c.report("rpc %s changed request type from %s to %s", name, m.GetInputType(), next.GetInputType())
+		}
+		if next.GetOutputType() != m.GetOutputType() {
+			c.report("rpc %s changed response type from %s to %s", name, m.GetOutputType(), next.GetOutputType())
+		}
+		if next.GetClientStreaming() != m.GetClientStreaming() || next.GetServerStreaming() != m.GetServerStreaming() {
+			c.report("rpc %s changed streaming", name)
+		}
+		if rule := httpRule(m); rule != nil && !proto.Equal(rule, httpRule(next)) {
+			c.report("rpc %s changed its HTTP binding", name)
+		}
+	}
+}
+
+func httpRule(m *descriptorpb.MethodDescriptorProto) *annotations.HttpRule {
+	if m.GetOptions() == nil {
+		return nil
+	}
+	rule, _ := proto.GetExtension(m.GetOptions(), annotations.E_Http).(*annotations.HttpRule)
+	return rule
+}
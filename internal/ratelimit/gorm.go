@@ -0,0 +1,54 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Bucket is a token bucket row of the Postgres store.
+type Bucket struct {
+	Name    string `gorm:"primaryKey;size:300"`
+	Tokens  float64
+	Updated time.Time
+}
+
+func (Bucket) TableName() string {
+	return "rate_limit_buckets"
+}
+
+type gormStore struct {
+	db  *gorm.DB
+	now func() time.Time
+}
+
+// NewGormStore keeps buckets in the database so replicas share them. Each
+// Take is a short transaction that locks the caller's row. Replicas' clocks
+// should be in sync; skew shifts refills by the same amount.
+func NewGormStore(db *gorm.DB) Store {
+	return &gormStore{db: db, now: time.Now}
+}
+
+func (s *gormStore) Take(ctx context.Context, key string, l Limit) (ok bool, retryAfter time.Duration, err error) {
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := s.now()
+		// create the bucket full, unless another request just did
+		full := Bucket{Name: key, Tokens: float64(l.Burst), Updated: now}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&full).Error; err != nil {
+			return err
+		}
+		var b Bucket
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&b, "name = ?", key).Error; err != nil {
+			return err
+		}
+		b.Tokens, ok, retryAfter = l.take(b.Tokens, b.Updated, now)
+		return tx.Model(&b).Updates(map[string]interface{}{"tokens": b.Tokens, "updated": now}).Error
+	})
+	if err != nil {
+		return false, 0, fmt.Errorf("take token: %w", err)
+	}
+	return ok, retryAfter, nil
+}
@@ -0,0 +1,60 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often idle buckets are dropped from a memoryStore.
+const sweepInterval = time.Minute
+
+type memoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	limit   Limit
+}
+
+// NewMemoryStore keeps buckets in this process. With several replicas each
+// one enforces the budget on its own, so a caller can get up to one budget
+// per replica.
+func NewMemoryStore() Store {
+	return &memoryStore{buckets: map[string]*bucket{}, now: time.Now}
+}
+
+func (s *memoryStore) Take(_ context.Context, key string, l Limit) (bool, time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	s.sweep(now)
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(l.Burst), updated: now}
+		s.buckets[key] = b
+	}
+	b.limit = l
+	left, ok, retryAfter := l.take(b.tokens, b.updated, now)
+	b.tokens, b.updated = left, now
+	return ok, retryAfter, nil
+}
+
+// sweep drops buckets that have refilled completely; a new full bucket is
+// the same thing.
+func (s *memoryStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < sweepInterval {
+		return
+	}
+	s.lastSweep = now
+	for key, b := range s.buckets {
+		if b.tokens+now.Sub(b.updated).Seconds()*b.limit.Rate >= float64(b.limit.Burst) {
+			delete(s.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,266 @@
+// Package ratelimit throttles callers with token buckets, with separate
+// budgets for read and write methods. Buckets live in a Store: in memory for
+// a single replica, or in Postgres to share them across replicas.
+package ratelimit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fuzail/08-todosvc/internal/apierr"
+	"github.com/fuzail/08-todosvc/internal/reqctx"
+	"github.com/fuzail/08-todosvc/internal/todo"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// APIKeyHeader names a caller for rate limiting when it holds one of the
+// configured keys. Over gRPC it is the x-api-key metadata key.
+const APIKeyHeader = "X-API-Key"
+
+// Limit is a token bucket: Burst requests at once, refilled at Rate per
+// second. A zero Rate means no limit.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// take refills a bucket holding tokens, last refilled at updated, and takes
+// one token if it can. It returns the new token count and, when no token was
+// left, how long until there is one.
+func (l Limit) take(tokens float64, updated, now time.Time) (left float64, ok bool, retryAfter time.Duration) {
+	if elapsed := now.Sub(updated).Seconds(); elapsed > 0 {
+		tokens = math.Min(float64(l.Burst), tokens+elapsed*l.Rate)
+	}
+	if tokens >= 1 {
+		return tokens - 1, true, 0
+	}
+	return tokens, false, time.Duration((1 - tokens) / l.Rate * float64(time.Second))
+}
+
+// Store holds the buckets.
+type Store interface {
+	// Take takes one token from the bucket named key, creating it full if it
+	// doesn't exist. If the bucket is empty it returns false and how long
+	// until the next token.
+	Take(ctx context.Context, key string, l Limit) (ok bool, retryAfter time.Duration, err error)
+}
+
+// Config is the per-caller budget for each class of method.
+type Config struct {
+	// Store is "memory" (the default) or "postgres".
+	Store string
+	Read  Limit
+	Write Limit
+	// APIKeys are the keys that get buckets of their own. A key is only a
+	// shared secret, so callers with a verified client certificate are
+	// limited by it instead.
+	APIKeys []string
+}
+
+// Limiter applies a Config to requests on both transports.
+type Limiter struct {
+	store  Store
+	limits atomic.Pointer[[2]Limit]        // read, write
+	keys   atomic.Pointer[map[string]bool] // hashed, see keyID
+}
+
+// New limits requests with the budgets in cfg, keeping buckets in store.
+// cfg.Store is only used by the caller to pick store.
+func New(store Store, cfg Config) *Limiter {
+	l := &Limiter{store: store}
+	l.SetLimits(cfg.Read, cfg.Write)
+	l.SetAPIKeys(cfg.APIKeys)
+	return l
+}
+
+// SetLimits changes the budgets. Existing buckets keep their tokens and
+// refill at the new rate from the next request.
+func (l *Limiter) SetLimits(read, write Limit) {
+	l.limits.Store(&[2]Limit{read, write})
+}
+
+// SetAPIKeys replaces the accepted API keys. Buckets of removed keys are left
+// to expire in the store.
+func (l *Limiter) SetAPIKeys(keys []string) {
+	ids := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		ids[keyID(k)] = true
+	}
+	l.keys.Store(&ids)
+}
+
+// Allow takes a token from the caller's bucket for the class of method. It
+// returns an error matching todo.ErrRateLimited, with the time to wait, when
+// the bucket is empty. If the store fails the request is let through: an
+// outage of the limiter shouldn't take the API down with it.
+func (l *Limiter) Allow(ctx context.Context, caller string, write bool) error {
+	limits := l.limits.Load()
+	limit, class := limits[0], "read"
+	if write {
+		limit, class = limits[1], "write"
+	}
+	if limit.Rate <= 0 {
+		return nil
+	}
+	ok, retryAfter, err := l.store.Take(ctx, class+":"+caller, limit)
+	if err != nil {
+		slog.WarnContext(ctx, "rate limit store failed; allowing request", "err", err)
+		return nil
+	}
+	if !ok {
+		return todo.RateLimited(retryAfter)
+	}
+	return nil
+}
+
+// caller names the bucket owner: the verified client certificate, else the
+// API key if it is a configured one, else the remote IP. Unknown keys are
+// ignored, so a caller can't get a fresh bucket by making one up.
+func (l *Limiter) caller(ctx context.Context, apiKey, remoteAddr string) string {
+	if c, ok := reqctx.ClientFrom(ctx); ok {
+		return "client:" + c.String()
+	}
+	if apiKey != "" {
+		if id := keyID(apiKey); (*l.keys.Load())[id] {
+			return "key:" + id
+		}
+	}
+	if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		remoteAddr = host
+	}
+	return "ip:" + remoteAddr
+}
+
+// keyID is a hash of key, so keys don't end up in the store.
+func keyID(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:12])
+}
+
+// Probes and scrapes are never limited.
+var (
+	exemptPaths        = map[string]bool{"/healthz": true, "/livez": true, "/readyz": true, "/metrics": true}
+	exemptMethodPrefix = "/grpc.health.v1.Health/"
+)
+
+// readMethods are RPC name prefixes that don't change state.
+var readMethods = []string{"Get", "List", "Download", "Export"}
+
+func isWriteMethod(fullMethod string) bool {
+	name := fullMethod[strings.LastIndex(fullMethod, "/")+1:]
+	for _, prefix := range readMethods {
+		if strings.HasPrefix(name, prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+// readHTTPMethods don't change state; PROPFIND and REPORT are CalDAV reads.
+var readHTTPMethods = map[string]bool{
+	http.MethodGet: true, http.MethodHead: true, http.MethodOptions: true, "PROPFIND": true, "REPORT": true,
+}
+
+// chargedPaths are charged by their handler, which is the one to know
+// whether a request reads or writes: a GraphQL POST may be a query or a
+// mutation. See Charge.
+var chargedPaths = map[string]bool{"/graphql": true}
+
+// HTTPMiddleware limits REST requests; readHTTPMethods count as reads, except
+// on chargedPaths. Limited requests are answered by deny. It must run inside
+// auth.HTTPMiddleware for client certificates to be used as the key.
+func (l *Limiter) HTTPMiddleware(deny func(http.ResponseWriter, *http.Request, error), next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if exemptPaths[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+		caller := l.caller(r.Context(), r.Header.Get(APIKeyHeader), r.RemoteAddr)
+		if chargedPaths[r.URL.Path] {
+			c := &charge{l: l, caller: caller}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), chargeKey{}, c)))
+			// a request the handler turned away before charging it, such
+			// as one that doesn't parse, still costs a read
+			_ = c.take(r.Context(), false)
+			return
+		}
+		if err := l.Allow(r.Context(), caller, !readHTTPMethods[r.Method]); err != nil {
+			deny(w, r, apierr.Status(r.Context(), err))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+type chargeKey struct{}
+
+// charge is the token a request on chargedPaths owes, taken once.
+type charge struct {
+	l      *Limiter
+	caller string
+	once   sync.Once
+	err    error
+}
+
+func (c *charge) take(ctx context.Context, write bool) error {
+	c.once.Do(func() { c.err = c.l.Allow(ctx, c.caller, write) })
+	return c.err
+}
+
+// Charge takes the token a request HTTPMiddleware left for its handler to
+// charge, as a read or a write, and returns an error matching
+// todo.ErrRateLimited if the caller has none left. Only the first call
+// takes a token; requests that aren't limited are always allowed.
+func Charge(ctx context.Context, write bool) error {
+	c, ok := ctx.Value(chargeKey{}).(*charge)
+	if !ok {
+		return nil
+	}
+	return c.take(ctx, write)
+}
+
+// UnaryServerInterceptor limits RPCs; Get*, List* and Download* count as
+// reads. It must run after auth.UnaryServerInterceptor.
+func (l *Limiter) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := l.allowRPC(ctx, info.FullMethod); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor limits streaming RPCs; a stream takes one token.
+func (l *Limiter) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := l.allowRPC(ss.Context(), info.FullMethod); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
+
+func (l *Limiter) allowRPC(ctx context.Context, method string) error {
+	if strings.HasPrefix(method, exemptMethodPrefix) {
+		return nil
+	}
+	var apiKey, addr string
+	if vals := metadata.ValueFromIncomingContext(ctx, strings.ToLower(APIKeyHeader)); len(vals) > 0 {
+		apiKey = vals[0]
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		addr = p.Addr.String()
+	}
+	return apierr.Status(ctx, l.Allow(ctx, l.caller(ctx, apiKey, addr), isWriteMethod(method)))
+}
@@ -0,0 +1,68 @@
+// Package reqctx carries per-request values (request ID, tenant, client
+// identity) through a context.Context, independent of the transport they came
+// in on.
+package reqctx
+
+import "context"
+
+// Header and metadata names the values are read from and echoed in. gRPC
+// metadata keys are the lowercase forms.
+const (
+	RequestIDHeader = "X-Request-ID"
+	TenantHeader    = "X-Tenant-ID"
+)
+
+type ctxKey int
+
+const (
+	requestIDKey ctxKey = iota
+	tenantKey
+	clientKey
+)
+
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// RequestID returns the request ID stored in ctx, or "".
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey, tenant)
+}
+
+// Tenant returns the tenant stored in ctx, or "".
+func Tenant(ctx context.Context) string {
+	t, _ := ctx.Value(tenantKey).(string)
+	return t
+}
+
+// Client is the identity of a caller that presented a certificate verified
+// against the client CA bundle (mTLS).
+type Client struct {
+	// Names are the certificate's URI SANs (e.g. SPIFFE IDs), DNS SANs, email
+	// SANs and subject common name, in that order. Authorization matches any.
+	Names []string
+}
+
+// String returns the most specific name, for logs.
+func (c Client) String() string {
+	if len(c.Names) == 0 {
+		return ""
+	}
+	return c.Names[0]
+}
+
+func WithClient(ctx context.Context, c Client) context.Context {
+	return context.WithValue(ctx, clientKey, c)
+}
+
+// ClientFrom returns the verified client identity stored in ctx. ok is false
+// for callers that didn't present a verified certificate.
+func ClientFrom(ctx context.Context) (c Client, ok bool) {
+	c, ok = ctx.Value(clientKey).(Client)
+	return c, ok
+}
@@ -0,0 +1,138 @@
+package rest
+
+import (
+	"context"
+	"io"
+	"mime"
+	"net/http"
+
+	"github.com/fuzail/08-todosvc/internal/apierr"
+	"github.com/fuzail/08-todosvc/internal/todo"
+	pb "github.com/fuzail/08-todosvc/proto/todo/v1"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// uploadChunkSize is the size of the chunks a multipart upload is fed to the
+// UploadAttachment RPC in.
+const uploadChunkSize = 64 << 10
+
+// attachmentHandler serves the attachment endpoints that carry raw bytes and so
+// can't be generated by the gateway.
+type attachmentHandler struct {
+	gw          *runtime.ServeMux
+	server      pb.TodoServiceServer
+	attachments todo.AttachmentService
+}
+
+// upload handles POST /tasks/{task_id}/attachments with a multipart/form-data
+// body whose "file" part is streamed into the UploadAttachment RPC.
+func (h *attachmentHandler) upload(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	// stream the part instead of ParseMultipartForm so large files aren't buffered
+	mr, err := r.MultipartReader()
+	if err != nil {
+		h.writeError(w, r, status.Error(codes.InvalidArgument, "expected multipart/form-data"))
+		return
+	}
+	for {
+		part, err := mr.NextPart()
+		if err != nil {
+			h.writeError(w, r, status.Error(codes.InvalidArgument, "missing file part"))
+			return
+		}
+		if part.FormName() != "file" {
+			part.Close()
+			continue
+		}
+		stream := &multipartUpload{
+			ctx: r.Context(),
+			info: &pb.AttachmentInfo{
+				TaskId:      params["task_id"],
+				Name:        part.FileName(),
+				ContentType: part.Header.Get("Content-Type"),
+			},
+			part: part,
+			buf:  make([]byte, uploadChunkSize),
+		}
+		err = h.server.UploadAttachment(stream)
+		part.Close()
+		if err != nil {
+			h.writeError(w, r, err)
+			return
+		}
+		_, out := runtime.MarshalerForRequest(h.gw, r)
+		runtime.ForwardResponseMessage(r.Context(), h.gw, out, w, r, stream.resp, setCreatedStatus)
+		return
+	}
+}
+
+// multipartUpload adapts a multipart file part to the client stream the
+// UploadAttachment RPC reads: the info message first, then chunks until EOF.
+type multipartUpload struct {
+	grpc.ServerStream // unused by UploadAttachment; nil
+	ctx               context.Context
+	info              *pb.AttachmentInfo
+	part              io.Reader
+	buf               []byte
+	resp              *pb.UploadAttachmentResponse
+}
+
+func (u *multipartUpload) Context() context.Context {
+	return u.ctx
+}
+
+func (u *multipartUpload) Recv() (*pb.UploadAttachmentRequest, error) {
+	if u.info != nil {
+		info := u.info
+		u.info = nil
+		return &pb.UploadAttachmentRequest{Data: &pb.UploadAttachmentRequest_Info{Info: info}}, nil
+	}
+	// the RPC consumes each chunk before asking for the next, so buf is reused
+	n, err := u.part.Read(u.buf)
+	if n > 0 {
+		return &pb.UploadAttachmentRequest{Data: &pb.UploadAttachmentRequest_Chunk{Chunk: u.buf[:n]}}, nil
+	}
+	if err == nil {
+		err = io.ErrNoProgress
+	}
+	return nil, err
+}
+
+func (u *multipartUpload) SendAndClose(resp *pb.UploadAttachmentResponse) error {
+	u.resp = resp
+	return nil
+}
+
+// download handles GET and HEAD /tasks/{task_id}/attachments/{id}. It reads
+// the attachment service directly, since Range requests need a seekable body.
+func (h *attachmentHandler) download(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	a, rs, err := h.attachments.Open(r.Context(), params["task_id"], params["id"])
+	if err != nil {
+		h.writeError(w, r, apierr.Status(r.Context(), err))
+		return
+	}
+	defer rs.Close()
+	// the content type is the uploader's; downloading rather than rendering,
+	// without sniffing and in a sandbox keeps browsers from running it as
+	// a page of this origin
+	w.Header().Set("Content-Type", a.ContentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": a.Name}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; sandbox")
+	w.Header().Set("ETag", `"`+a.Checksum+`"`)
+	// ServeContent handles Range, If-Range and HEAD
+	http.ServeContent(w, r, "", a.CreatedAt, rs)
+}
+
+func (h *attachmentHandler) writeError(w http.ResponseWriter, r *http.Request, err error) {
+	writeGatewayError(h.gw, w, r, err)
+}
+
+// writeGatewayError writes err the way the gateway writes errors from
+// generated routes.
+func writeGatewayError(gw *runtime.ServeMux, w http.ResponseWriter, r *http.Request, err error) {
+	_, out := runtime.MarshalerForRequest(gw, r)
+	runtime.HTTPError(r.Context(), gw, out, w, r, err)
+}
@@ -1,187 +1,158 @@
 package rest
 
 import (
-	"encoding/json"
-	"errors"
-	"log"
+	"context"
+	"fmt"
 	"net/http"
-	"strconv"
+	"strings"
 
+	"github.com/fuzail/08-todosvc/internal/caldav"
 	"github.com/fuzail/08-todosvc/internal/todo"
+	pb "github.com/fuzail/08-todosvc/proto/todo/v1"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
 )
 
-type apiHandler struct {
-	svc todo.Service
-}
-
-func RegisterHandlers(mux *http.ServeMux, svc todo.Service) {
-	h := &apiHandler{svc: svc}
-	mux.HandleFunc("/healthz", h.health)
-	mux.HandleFunc("/tasks", h.tasks)     // POST create, GET list
-	mux.HandleFunc("/tasks/", h.taskByID) // GET, PUT, DELETE, PATCH mark complete
-}
-
-func (h *apiHandler) health(w http.ResponseWriter, r *http.Request) {
-	w.WriteHeader(http.StatusOK)
-	_, _ = w.Write([]byte(`{"status":"ok"}`))
-}
-
-func (h *apiHandler) tasks(w http.ResponseWriter, r *http.Request) {
-	switch r.Method {
-	case http.MethodPost:
-		h.createTask(w, r)
-	case http.MethodGet:
-		h.listTasks(w, r)
-	default:
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
-	}
-}
-
-func (h *apiHandler) taskByID(w http.ResponseWriter, r *http.Request) {
-	// path: /tasks/{id} or /tasks/{id}/complete
-	id := r.URL.Path[len("/tasks/"):]
-	if id == "" {
-		http.Error(w, "id required", http.StatusBadRequest)
-		return
-	}
-	switch r.Method {
-	case http.MethodGet:
-		h.getTask(w, r, id)
-	case http.MethodPut:
-		h.updateTask(w, r, id)
-	case http.MethodDelete:
-		h.deleteTask(w, r, id)
-	case http.MethodPatch:
-		// support mark complete via PATCH with JSON {"completed": true}
-		h.markComplete(w, r, id)
-	default:
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+// RegisterHandlers serves the REST API on mux. Every RPC with a google.api.http
+// annotation in todo.proto is served by the grpc-gateway, which calls server
+// in-process, so REST and gRPC share request parsing, validation and error
+// codes. Request and response bodies are the proto messages in JSON with
+// snake_case field names, which makes todo.proto the versioned contract
+// instead of the GORM models. Errors are RFC 7807 problem+json. Attachment
+// upload and download and task export and import, which carry raw bytes, are
+// hand-written. The OpenAPI
+// v3 document is served at /openapi.json.
+//
+// Routes live under APIPrefix. The unversioned paths are deprecated aliases
+// (see legacyAlias).
+func RegisterHandlers(mux *http.ServeMux, server pb.TodoServiceServer, attachments todo.AttachmentService) error {
+	gw := newGateway()
+	if err := pb.RegisterTodoServiceHandlerServer(context.Background(), gw, server); err != nil {
+		return fmt.Errorf("register gateway: %w", err)
+	}
+	h := &attachmentHandler{gw: gw, server: server, attachments: attachments}
+	t := &transferHandler{gw: gw, server: server}
+	for _, route := range []struct {
+		method, path string
+		fn           runtime.HandlerFunc
+	}{
+		{http.MethodPost, APIPrefix + "/tasks/{task_id}/attachments", h.upload},
+		{http.MethodGet, APIPrefix + "/tasks/{task_id}/attachments/{id}", h.download},
+		{http.MethodHead, APIPrefix + "/tasks/{task_id}/attachments/{id}", h.download},
+		{http.MethodGet, APIPrefix + "/tasks:export", t.export},
+		{http.MethodPost, APIPrefix + "/tasks:import", t.importTasks},
+	} {
+		if err := gw.HandlePath(route.method, route.path, route.fn); err != nil {
+			return fmt.Errorf("register %s %s: %w", route.method, route.path, err)
+		}
 	}
-}
-
-type createReq struct {
-	Title       string `json:"title"`
-	Description string `json:"description"`
-}
 
-func (h *apiHandler) createTask(w http.ResponseWriter, r *http.Request) {
-	var req createReq
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "invalid body", http.StatusBadRequest)
-		return
-	}
-	ctx := r.Context()
-	t, err := h.svc.CreateTask(ctx, req.Title, req.Description)
+	spec, err := OpenAPI()
 	if err != nil {
-		http.Error(w, "create failed", http.StatusInternalServerError)
-		return
-	}
-	writeJSON(w, http.StatusCreated, t)
+		return err
+	}
+	mux.HandleFunc("/healthz", health)
+	mux.HandleFunc("/openapi.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(spec)
+	})
+	legacy := legacyAlias(gw)
+	for _, path := range []string{"/tasks", "/tasks/", "/sync"} {
+		mux.Handle(APIPrefix+path, gw)
+		mux.Handle(path, legacy)
+	}
+	// newer than the unversioned paths, so they have no alias
+	mux.Handle(APIPrefix+"/tasks:export", gw)
+	mux.Handle(APIPrefix+"/tasks:import", gw)
+	return nil
 }
 
-func (h *apiHandler) getTask(w http.ResponseWriter, r *http.Request, id string) {
-	ctx := r.Context()
-	t, err := h.svc.GetTask(ctx, id)
-	if err != nil {
-		if errors.Is(err, todo.ErrNotFound) {
-			http.Error(w, "not found", http.StatusNotFound)
-			return
-		}
-		http.Error(w, "internal error", http.StatusInternalServerError)
-		return
+// RegisterAdminHandlers serves the AdminService REST routes under
+// APIPrefix+"/admin/" on mux, the same way as RegisterHandlers.
+func RegisterAdminHandlers(mux *http.ServeMux, server pb.AdminServiceServer) error {
+	gw := newGateway()
+	if err := pb.RegisterAdminServiceHandlerServer(context.Background(), gw, server); err != nil {
+		return fmt.Errorf("register admin gateway: %w", err)
 	}
-	writeJSON(w, http.StatusOK, t)
+	mux.Handle(APIPrefix+"/admin/", gw)
+	return nil
 }
 
-func (h *apiHandler) listTasks(w http.ResponseWriter, r *http.Request) {
-	q := r.URL.Query()
-	page, _ := strconv.Atoi(q.Get("page"))
-	if page == 0 {
-		page = 1
-	}
-	pageSize, _ := strconv.Atoi(q.Get("page_size"))
-	if pageSize == 0 {
-		pageSize = 10
-	}
-	ctx := r.Context()
-	tasks, total, err := h.svc.ListTasks(ctx, page, pageSize)
-	if err != nil {
-		http.Error(w, "internal error", http.StatusInternalServerError)
-		return
-	}
-	resp := map[string]interface{}{
-		"tasks":     tasks,
-		"page":      page,
-		"page_size": pageSize,
-		"total":     total,
-	}
-	writeJSON(w, http.StatusOK, resp)
+func newGateway() *runtime.ServeMux {
+	return runtime.NewServeMux(
+		runtime.WithMarshalerOption(runtime.MIMEWildcard, &runtime.HTTPBodyMarshaler{
+			Marshaler: &runtime.JSONPb{
+				MarshalOptions:   protojson.MarshalOptions{UseProtoNames: true, EmitUnpopulated: true},
+				UnmarshalOptions: protojson.UnmarshalOptions{DiscardUnknown: true},
+			},
+		}),
+		runtime.WithForwardResponseOption(setCreatedStatus),
+		runtime.WithErrorHandler(problemErrorHandler),
+		runtime.WithRoutingErrorHandler(problemRoutingErrorHandler),
+	)
 }
 
-type updateReq struct {
-	Title       string `json:"title"`
-	Description string `json:"description"`
+// createdResponses are the responses of RPCs that create a resource; REST
+// answers them with 201 instead of 200.
+var createdResponses = map[protoreflect.FullName]bool{
+	(&pb.CreateTaskResponse{}).ProtoReflect().Descriptor().FullName():       true,
+	(&pb.AddCommentResponse{}).ProtoReflect().Descriptor().FullName():       true,
+	(&pb.UploadAttachmentResponse{}).ProtoReflect().Descriptor().FullName(): true,
 }
 
-func (h *apiHandler) updateTask(w http.ResponseWriter, r *http.Request, id string) {
-	var req updateReq
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "invalid body", http.StatusBadRequest)
-		return
+func setCreatedStatus(_ context.Context, w http.ResponseWriter, m proto.Message) error {
+	if createdResponses[m.ProtoReflect().Descriptor().FullName()] {
+		w.WriteHeader(http.StatusCreated)
 	}
-	ctx := r.Context()
-	t, err := h.svc.UpdateTask(ctx, id, req.Title, req.Description)
-	if err != nil {
-		if errors.Is(err, todo.ErrNotFound) {
-			http.Error(w, "not found", http.StatusNotFound)
-			return
-		}
-		http.Error(w, "internal error", http.StatusInternalServerError)
-		return
-	}
-	writeJSON(w, http.StatusOK, t)
-}
-
-type markReq struct {
-	Completed bool `json:"completed"`
+	return nil
 }
 
-func (h *apiHandler) markComplete(w http.ResponseWriter, r *http.Request, id string) {
-	var req markReq
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "invalid body", http.StatusBadRequest)
-		return
-	}
-	ctx := r.Context()
-	t, err := h.svc.MarkComplete(ctx, id, req.Completed)
-	if err != nil {
-		if errors.Is(err, todo.ErrNotFound) {
-			http.Error(w, "not found", http.StatusNotFound)
-			return
+// RoutePattern returns the route template for r's path with ids replaced by
+// placeholders, e.g. "/v1/tasks/{id}/comments/{child_id}", for use as a
+// low-cardinality metrics label. Deprecated unversioned paths keep their own
+// label so their remaining traffic is visible.
+func RoutePattern(r *http.Request) string {
+	switch r.URL.Path {
+	case "/healthz", "/livez", "/readyz", "/metrics", "/openapi.json", "/graphql":
+		return r.URL.Path
+	}
+	if pattern, ok := caldav.RoutePattern(r.URL.Path); ok {
+		return pattern
+	}
+	prefix, path := "", r.URL.Path
+	if rest, ok := strings.CutPrefix(path, APIPrefix+"/"); ok {
+		prefix, path = APIPrefix, "/"+rest
+	}
+	switch path {
+	case "/sync", "/tasks:export", "/tasks:import":
+		return prefix + path
+	}
+	segs := strings.Split(strings.Trim(path, "/"), "/")
+	if segs[0] == "admin" {
+		// /admin/stats, /admin/purge and /admin/tenants/{tenant}/quota|usage
+		switch {
+		case len(segs) == 2 && (segs[1] == "stats" || segs[1] == "purge"):
+			return prefix + "/admin/" + segs[1]
+		case len(segs) == 4 && segs[1] == "tenants":
+			return prefix + "/admin/tenants/{tenant}/" + segs[3]
 		}
-		http.Error(w, "internal error", http.StatusInternalServerError)
-		return
+		return "other"
 	}
-	writeJSON(w, http.StatusOK, t)
-}
-
-func (h *apiHandler) deleteTask(w http.ResponseWriter, r *http.Request, id string) {
-	ctx := r.Context()
-	if err := h.svc.DeleteTask(ctx, id); err != nil {
-		if errors.Is(err, todo.ErrNotFound) {
-			http.Error(w, "not found", http.StatusNotFound)
-			return
-		}
-		http.Error(w, "internal error", http.StatusInternalServerError)
-		return
+	if segs[0] != "tasks" || len(segs) > 4 {
+		return "other"
 	}
-	w.WriteHeader(http.StatusNoContent)
+	if len(segs) > 1 {
+		segs[1] = "{id}"
+	}
+	if len(segs) > 3 {
+		segs[3] = "{child_id}"
+	}
+	return prefix + "/" + strings.Join(segs, "/")
 }
 
-func writeJSON(w http.ResponseWriter, status int, v interface{}) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(status)
-	if err := json.NewEncoder(w).Encode(v); err != nil {
-		log.Printf("writeJSON: %v", err)
-	}
+func health(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte(`{"status":"ok"}`))
 }
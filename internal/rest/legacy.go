@@ -0,0 +1,42 @@
+package rest
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// APIPrefix is the path prefix of the current REST API version. It matches
+// the todo.v1 proto package the routes are generated from.
+const APIPrefix = "/v1"
+
+// The unversioned paths (/tasks, /sync) predate APIPrefix. They stay as
+// aliases until the sunset date so existing clients have time to move.
+var (
+	legacyDeprecatedAt = time.Date(2026, time.October, 18, 0, 0, 0, 0, time.UTC)
+	legacySunsetAt     = time.Date(2027, time.April, 30, 0, 0, 0, 0, time.UTC)
+)
+
+// legacyAlias serves an unversioned path as its APIPrefix equivalent. The
+// response is marked with Deprecation (RFC 9745) and Sunset (RFC 8594)
+// headers and links to the successor path.
+func legacyAlias(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		h.Set("Deprecation", "@"+strconv.FormatInt(legacyDeprecatedAt.Unix(), 10))
+		h.Set("Sunset", legacySunsetAt.Format(http.TimeFormat))
+		h.Add("Link", "<"+APIPrefix+r.URL.EscapedPath()+`>; rel="successor-version"`)
+
+		// same shallow copy as http.StripPrefix, in the other direction
+		r2 := new(http.Request)
+		*r2 = *r
+		r2.URL = new(url.URL)
+		*r2.URL = *r.URL
+		r2.URL.Path = APIPrefix + r.URL.Path
+		if r.URL.RawPath != "" {
+			r2.URL.RawPath = APIPrefix + r.URL.RawPath
+		}
+		next.ServeHTTP(w, r2)
+	})
+}
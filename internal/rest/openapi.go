@@ -0,0 +1,363 @@
+package rest
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/fuzail/08-todosvc/internal/taskio"
+	pb "github.com/fuzail/08-todosvc/proto/todo/v1"
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+type object = map[string]interface{}
+
+var pathParam = regexp.MustCompile(`\{([^}=]+)\}`)
+
+// OpenAPI returns an OpenAPI 3.0 document for the REST API. It is built from
+// the TodoService and AdminService descriptors and their google.api.http
+// annotations, the same source the gateway routes are generated from, so the
+// two can't drift.
+func OpenAPI() ([]byte, error) {
+	svc := pb.File_todo_v1_todo_proto.Services().ByName("TodoService")
+	admin := pb.File_todo_v1_todo_proto.Services().ByName("AdminService")
+	if svc == nil || admin == nil {
+		return nil, fmt.Errorf("openapi: TodoService or AdminService not found")
+	}
+	g := &openAPIGen{pkg: string(pb.File_todo_v1_todo_proto.Package()), schemas: object{}}
+	paths := object{}
+	addOp := func(path, method string, op object) {
+		item, _ := paths[path].(object)
+		if item == nil {
+			item = object{}
+			paths[path] = item
+		}
+		item[method] = op
+	}
+
+	var methods []protoreflect.MethodDescriptor
+	for _, sd := range []protoreflect.ServiceDescriptor{svc, admin} {
+		for i := 0; i < sd.Methods().Len(); i++ {
+			methods = append(methods, sd.Methods().Get(i))
+		}
+	}
+	for _, m := range methods {
+		rule, _ := proto.GetExtension(m.Options(), annotations.E_Http).(*annotations.HttpRule)
+		if rule == nil {
+			continue
+		}
+		for _, r := range append([]*annotations.HttpRule{rule}, rule.GetAdditionalBindings()...) {
+			method, path := httpPattern(r)
+			if path == "" {
+				continue
+			}
+			addOp(path, method, g.operation(m, r, path))
+		}
+	}
+	for _, hand := range []object{g.attachmentPaths(), g.transferPaths()} {
+		for path, item := range hand {
+			for method, op := range item.(object) {
+				addOp(path, method, op.(object))
+			}
+		}
+	}
+
+	g.schemas["Problem"] = object{
+		"type":     "object",
+		"required": []string{"type", "title", "status", "code"},
+		"properties": object{
+			"type":       object{"type": "string", "format": "uri"},
+			"title":      object{"type": "string"},
+			"status":     object{"type": "integer", "format": "int32"},
+			"detail":     object{"type": "string"},
+			"instance":   object{"type": "string"},
+			"code":       object{"type": "string", "description": "machine-readable error code, e.g. task_not_found"},
+			"request_id": object{"type": "string"},
+			"errors": object{
+				"type":        "array",
+				"description": "invalid fields of a validation error, or the exceeded quota",
+				"items": object{
+					"type":     "object",
+					"required": []string{"field", "description"},
+					"properties": object{
+						"field":       object{"type": "string"},
+						"description": object{"type": "string"},
+					},
+				},
+			},
+		},
+	}
+	doc := object{
+		"openapi": "3.0.3",
+		"info": object{
+			"title":   string(svc.FullName()),
+			"version": "1.0",
+		},
+		"paths":      paths,
+		"components": object{"schemas": g.schemas},
+	}
+	return json.MarshalIndent(doc, "", "  ")
+}
+
+func httpPattern(r *annotations.HttpRule) (method, path string) {
+	switch {
+	case r.GetGet() != "":
+		return "get", r.GetGet()
+	case r.GetPost() != "":
+		return "post", r.GetPost()
+	case r.GetPut() != "":
+		return "put", r.GetPut()
+	case r.GetPatch() != "":
+		return "patch", r.GetPatch()
+	case r.GetDelete() != "":
+		return "delete", r.GetDelete()
+	}
+	return "", ""
+}
+
+type openAPIGen struct {
+	pkg     string
+	schemas object
+}
+
+func (g *openAPIGen) operation(m protoreflect.MethodDescriptor, r *annotations.HttpRule, path string) object {
+	in := m.Input()
+	inPath := map[string]bool{}
+	var params []interface{}
+	for _, match := range pathParam.FindAllStringSubmatch(path, -1) {
+		name := match[1]
+		inPath[name] = true
+		p := object{"name": name, "in": "path", "required": true, "schema": object{"type": "string"}}
+		if f := in.Fields().ByName(protoreflect.Name(name)); f != nil {
+			p["schema"] = g.fieldSchema(f)
+		}
+		params = append(params, p)
+	}
+
+	op := object{
+		"operationId": string(m.Name()),
+		"tags":        []string{string(m.Parent().Name())},
+	}
+	switch r.GetBody() {
+	case "":
+		// everything not bound to the path comes from the query string
+		fields := in.Fields()
+		for i := 0; i < fields.Len(); i++ {
+			f := fields.Get(i)
+			if inPath[string(f.Name())] || f.Kind() == protoreflect.MessageKind || f.IsList() {
+				continue
+			}
+			params = append(params, object{"name": string(f.Name()), "in": "query", "schema": g.fieldSchema(f)})
+		}
+	case "*":
+		op["requestBody"] = object{
+			"required": true,
+			"content":  object{"application/json": object{"schema": g.bodySchema(in, inPath)}},
+		}
+	default:
+		// a single field is the body
+		if f := in.Fields().ByName(protoreflect.Name(r.GetBody())); f != nil {
+			op["requestBody"] = object{
+				"required": true,
+				"content":  object{"application/json": object{"schema": g.fieldSchema(f)}},
+			}
+		}
+	}
+	if len(params) > 0 {
+		op["parameters"] = params
+	}
+
+	code := "200"
+	if createdResponses[m.Output().FullName()] {
+		code = "201"
+	}
+	op["responses"] = object{
+		code: object{
+			"description": "OK",
+			"content":     object{"application/json": object{"schema": g.messageRef(m.Output())}},
+		},
+		"default": errorResponse(),
+	}
+	return op
+}
+
+// attachmentPaths documents the hand-written upload and download routes.
+func (g *openAPIGen) attachmentPaths() object {
+	params := func(names ...string) []interface{} {
+		var out []interface{}
+		for _, n := range names {
+			out = append(out, object{"name": n, "in": "path", "required": true, "schema": object{"type": "string"}})
+		}
+		return out
+	}
+	attachment := pb.File_todo_v1_todo_proto.Messages().ByName("UploadAttachmentResponse")
+	return object{
+		APIPrefix + "/tasks/{task_id}/attachments": object{
+			"post": object{
+				"operationId": "UploadAttachment",
+				"tags":        []string{"TodoService"},
+				"parameters":  params("task_id"),
+				"requestBody": object{
+					"required": true,
+					"content": object{"multipart/form-data": object{"schema": object{
+						"type":       "object",
+						"properties": object{"file": object{"type": "string", "format": "binary"}},
+						"required":   []string{"file"},
+					}}},
+				},
+				"responses": object{
+					"201": object{
+						"description": "Created",
+						"content":     object{"application/json": object{"schema": g.messageRef(attachment)}},
+					},
+					"default": errorResponse(),
+				},
+			},
+		},
+		APIPrefix + "/tasks/{task_id}/attachments/{id}": object{
+			"get": object{
+				"operationId": "DownloadAttachment",
+				"tags":        []string{"TodoService"},
+				"parameters": append(params("task_id", "id"),
+					object{"name": "Range", "in": "header", "schema": object{"type": "string"}}),
+				"responses": object{
+					"200": object{
+						"description": "Attachment content",
+						"content":     object{"application/octet-stream": object{"schema": object{"type": "string", "format": "binary"}}},
+					},
+					"206": object{
+						"description": "Partial content",
+						"content":     object{"application/octet-stream": object{"schema": object{"type": "string", "format": "binary"}}},
+					},
+					"default": errorResponse(),
+				},
+			},
+		},
+	}
+}
+
+// transferPaths documents the hand-written export and import routes.
+func (g *openAPIGen) transferPaths() object {
+	format := object{"name": "format", "in": "query", "schema": object{"type": "string", "enum": []string{"ndjson", "csv", "ical"}}}
+	file := object{"type": "string", "format": "binary"}
+	files := object{}
+	for _, f := range []taskio.Format{taskio.NDJSON, taskio.CSV, taskio.ICalendar} {
+		files[f.ContentType()] = object{"schema": file}
+	}
+	result := pb.File_todo_v1_todo_proto.Messages().ByName("ImportTasksResponse")
+	return object{
+		APIPrefix + "/tasks:export": object{
+			"get": object{
+				"operationId": "ExportTasks",
+				"tags":        []string{"TodoService"},
+				"parameters":  []interface{}{format},
+				"responses": object{
+					"200":     object{"description": "Every task", "content": files},
+					"default": errorResponse(),
+				},
+			},
+		},
+		APIPrefix + "/tasks:import": object{
+			"post": object{
+				"operationId": "ImportTasks",
+				"tags":        []string{"TodoService"},
+				"parameters": []interface{}{
+					object{"name": "format", "in": "query", "description": "defaults to the format of the Content-Type", "schema": format["schema"]},
+					object{"name": "dry_run", "in": "query", "schema": object{"type": "boolean"}},
+				},
+				"requestBody": object{"required": true, "content": files},
+				"responses": object{
+					"200": object{
+						"description": "One ImportTasksResponse per line: a row result per row, then the summary",
+						"content":     object{taskio.NDJSON.ContentType(): object{"schema": g.messageRef(result)}},
+					},
+					"default": errorResponse(),
+				},
+			},
+		},
+	}
+}
+
+func errorResponse() object {
+	return object{
+		"description": "Error",
+		"content":     object{problemContentType: object{"schema": object{"$ref": "#/components/schemas/Problem"}}},
+	}
+}
+
+// bodySchema is the request message minus the fields bound to the path.
+func (g *openAPIGen) bodySchema(md protoreflect.MessageDescriptor, exclude map[string]bool) object {
+	if len(exclude) == 0 {
+		return g.messageRef(md)
+	}
+	props := object{}
+	fields := md.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		f := fields.Get(i)
+		if !exclude[string(f.Name())] {
+			props[string(f.Name())] = g.fieldSchema(f)
+		}
+	}
+	return object{"type": "object", "properties": props}
+}
+
+// messageRef returns a $ref to md's schema, adding it (and the messages it
+// refers to) to the components on first use.
+func (g *openAPIGen) messageRef(md protoreflect.MessageDescriptor) object {
+	if md.FullName() == "google.protobuf.Timestamp" {
+		return object{"type": "string", "format": "date-time"}
+	}
+	name := strings.TrimPrefix(string(md.FullName()), g.pkg+".")
+	ref := object{"$ref": "#/components/schemas/" + name}
+	if _, ok := g.schemas[name]; ok {
+		return ref
+	}
+	props := object{}
+	schema := object{"type": "object", "properties": props}
+	g.schemas[name] = schema // before recursing, for cycles
+	fields := md.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		f := fields.Get(i)
+		props[string(f.Name())] = g.fieldSchema(f)
+	}
+	return ref
+}
+
+func (g *openAPIGen) fieldSchema(f protoreflect.FieldDescriptor) object {
+	var s object
+	switch f.Kind() {
+	case protoreflect.BoolKind:
+		s = object{"type": "boolean"}
+	case protoreflect.StringKind:
+		s = object{"type": "string"}
+	case protoreflect.BytesKind:
+		s = object{"type": "string", "format": "byte"}
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind,
+		protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		s = object{"type": "integer", "format": "int32"}
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind,
+		protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		// protojson encodes 64-bit integers as strings
+		s = object{"type": "string", "format": "int64"}
+	case protoreflect.FloatKind, protoreflect.DoubleKind:
+		s = object{"type": "number"}
+	case protoreflect.EnumKind:
+		values := f.Enum().Values()
+		names := make([]string, 0, values.Len())
+		for i := 0; i < values.Len(); i++ {
+			names = append(names, string(values.Get(i).Name()))
+		}
+		s = object{"type": "string", "enum": names}
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		s = g.messageRef(f.Message())
+	default:
+		s = object{}
+	}
+	if f.IsList() {
+		return object{"type": "array", "items": s}
+	}
+	return s
+}
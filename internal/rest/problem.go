@@ -0,0 +1,144 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/fuzail/08-todosvc/internal/apierr"
+	"github.com/fuzail/08-todosvc/internal/reqctx"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/status"
+)
+
+const problemContentType = "application/problem+json"
+
+// problemTypePrefix prefixes Problem.Code to form Problem.Type. A URN rather
+// than a URL, since there is no documentation page to dereference.
+const problemTypePrefix = "urn:todosvc:problem:"
+
+// Problem is the RFC 7807 body of every REST error response. Clients should
+// branch on Code (also the suffix of Type), not on Detail, which is meant for
+// humans and may change.
+type Problem struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	Instance  string `json:"instance,omitempty"`
+	Code      string `json:"code"`
+	RequestID string `json:"request_id,omitempty"`
+	// Errors lists the invalid fields of a validation failure.
+	Errors []FieldError `json:"errors,omitempty"`
+}
+
+// FieldError is one invalid request field, from the BadRequest status detail.
+type FieldError struct {
+	Field       string `json:"field"`
+	Description string `json:"description"`
+}
+
+// problemErrorHandler is the gateway error handler: it turns the gRPC status
+// returned by a handler into a problem+json response. The HTTP status comes
+// from apierr; the code is the ErrorInfo reason of domain errors and the gRPC
+// code otherwise.
+func problemErrorHandler(ctx context.Context, _ *runtime.ServeMux, _ runtime.Marshaler, w http.ResponseWriter, r *http.Request, err error) {
+	p, retryAfter := toProblem(r, err)
+	if retryAfter != "" {
+		w.Header().Set("Retry-After", retryAfter)
+	}
+	writeProblem(w, r, p)
+}
+
+// toProblem builds the problem for err, and the Retry-After header value if
+// the caller should wait before trying again.
+func toProblem(r *http.Request, err error) (p Problem, retryAfter string) {
+	var custom *runtime.HTTPStatusError
+	if errors.As(err, &custom) {
+		err = custom.Err
+	}
+	s := status.Convert(err)
+	httpStatus := apierr.HTTPStatus(err)
+	if custom != nil {
+		httpStatus = custom.HTTPStatus
+	}
+	code := snakeCase(s.Code().String())
+	var fields []FieldError
+	for _, d := range s.Details() {
+		switch d := d.(type) {
+		case *errdetails.ErrorInfo:
+			code = strings.ToLower(d.GetReason())
+		case *errdetails.BadRequest:
+			for _, v := range d.GetFieldViolations() {
+				fields = append(fields, FieldError{Field: v.GetField(), Description: v.GetDescription()})
+			}
+		case *errdetails.QuotaFailure:
+			for _, v := range d.GetViolations() {
+				fields = append(fields, FieldError{Field: v.GetSubject(), Description: v.GetDescription()})
+			}
+		case *errdetails.RetryInfo:
+			// whole seconds, rounded up so clients don't retry too early
+			secs := (d.GetRetryDelay().AsDuration() + time.Second - 1) / time.Second
+			retryAfter = strconv.Itoa(int(secs))
+		}
+	}
+	return newProblem(r, httpStatus, code, s.Message(), fields), retryAfter
+}
+
+// WriteError writes err, typically a gRPC status from apierr.Status, as a
+// problem+json response. It is for middleware outside the gateway that needs
+// to reject a request the same way.
+func WriteError(w http.ResponseWriter, r *http.Request, err error) {
+	problemErrorHandler(r.Context(), nil, nil, w, r, err)
+}
+
+// problemRoutingErrorHandler reports unknown routes and methods, which never
+// reach a handler.
+func problemRoutingErrorHandler(_ context.Context, _ *runtime.ServeMux, _ runtime.Marshaler, w http.ResponseWriter, r *http.Request, httpStatus int) {
+	writeProblem(w, r, newProblem(r, httpStatus, snakeCase(strings.ReplaceAll(http.StatusText(httpStatus), " ", "")), "", nil))
+}
+
+func newProblem(r *http.Request, httpStatus int, code, detail string, fields []FieldError) Problem {
+	return Problem{
+		Type:      problemTypePrefix + code,
+		Title:     http.StatusText(httpStatus),
+		Status:    httpStatus,
+		Detail:    detail,
+		Instance:  r.URL.Path,
+		Code:      code,
+		RequestID: reqctx.RequestID(r.Context()),
+		Errors:    fields,
+	}
+}
+
+func writeProblem(w http.ResponseWriter, r *http.Request, p Problem) {
+	w.Header().Del("Trailer")
+	w.Header().Set("Content-Type", problemContentType)
+	w.WriteHeader(p.Status)
+	if err := json.NewEncoder(w).Encode(p); err != nil {
+		slog.ErrorContext(r.Context(), "write problem", "err", err)
+	}
+}
+
+// snakeCase turns a Go-style name such as "FailedPrecondition" into
+// "failed_precondition".
+func snakeCase(s string) string {
+	var b strings.Builder
+	prevLower := false
+	for _, c := range s {
+		upper := unicode.IsUpper(c)
+		if upper && prevLower {
+			b.WriteByte('_')
+		}
+		prevLower = !upper
+		b.WriteRune(unicode.ToLower(c))
+	}
+	return b.String()
+}
@@ -0,0 +1,177 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"github.com/fuzail/08-todosvc/internal/taskio"
+	pb "github.com/fuzail/08-todosvc/proto/todo/v1"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var protoFormats = map[taskio.Format]pb.TaskFormat{
+	taskio.NDJSON:    pb.TaskFormat_TASK_FORMAT_NDJSON,
+	taskio.CSV:       pb.TaskFormat_TASK_FORMAT_CSV,
+	taskio.ICalendar: pb.TaskFormat_TASK_FORMAT_ICALENDAR,
+}
+
+// transferHandler serves task export and import, which stream files rather
+// than JSON messages and so can't be generated by the gateway.
+type transferHandler struct {
+	gw     *runtime.ServeMux
+	server pb.TodoServiceServer
+}
+
+// export handles GET /tasks:export?format=ndjson|csv|ical by streaming the
+// ExportTasks RPC into the response body.
+func (h *transferHandler) export(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+	format, err := taskio.ParseFormat(r.URL.Query().Get("format"))
+	if err != nil {
+		writeGatewayError(h.gw, w, r, status.Error(codes.InvalidArgument, err.Error()))
+		return
+	}
+	stream := &exportDownload{ctx: r.Context(), w: w, format: format}
+	if err := h.server.ExportTasks(&pb.ExportTasksRequest{Format: protoFormats[format]}, stream); err != nil {
+		if !stream.started {
+			writeGatewayError(h.gw, w, r, err)
+			return
+		}
+		// the status is sent; cut the body short so the client can't take
+		// part of the file for all of it
+		slog.ErrorContext(r.Context(), "export failed", "err", err)
+		panic(http.ErrAbortHandler)
+	}
+	stream.start() // an empty NDJSON export sends no chunks
+}
+
+// exportDownload adapts the response to the server stream ExportTasks writes.
+type exportDownload struct {
+	grpc.ServerStream // unused by ExportTasks; nil
+	ctx               context.Context
+	w                 http.ResponseWriter
+	format            taskio.Format
+	started           bool
+}
+
+func (d *exportDownload) Context() context.Context {
+	return d.ctx
+}
+
+func (d *exportDownload) start() {
+	if d.started {
+		return
+	}
+	d.started = true
+	d.w.Header().Set("Content-Type", d.format.ContentType())
+	d.w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": "tasks" + d.format.Ext()}))
+	d.w.WriteHeader(http.StatusOK)
+}
+
+func (d *exportDownload) Send(msg *pb.ExportTasksResponse) error {
+	d.start()
+	_, err := d.w.Write(msg.Chunk)
+	return err
+}
+
+// importTasks handles POST /tasks:import. The body is the file, in the format
+// named by the format parameter or else by the Content-Type; dry_run=true
+// only checks it. The response is NDJSON: an ImportTasksResponse per row as
+// it is imported, then the summary. An error after the first row ends the
+// response with an {"error": problem} line instead of the summary.
+func (h *transferHandler) importTasks(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+	q := r.URL.Query()
+	format, err := taskio.ParseFormat(q.Get("format"))
+	if q.Get("format") == "" {
+		if f, ok := taskio.FormatForContentType(r.Header.Get("Content-Type")); ok {
+			format = f
+		}
+	}
+	if err != nil {
+		writeGatewayError(h.gw, w, r, status.Error(codes.InvalidArgument, err.Error()))
+		return
+	}
+	dryRun := false
+	if v := q.Get("dry_run"); v != "" {
+		if dryRun, err = strconv.ParseBool(v); err != nil {
+			writeGatewayError(h.gw, w, r, status.Errorf(codes.InvalidArgument, "dry_run: %q is not true or false", v))
+			return
+		}
+	}
+	// results are written while the body is still being read
+	_ = http.NewResponseController(w).EnableFullDuplex()
+	_, out := runtime.MarshalerForRequest(h.gw, r)
+	stream := &importUpload{
+		ctx:     r.Context(),
+		options: &pb.ImportOptions{Format: protoFormats[format], DryRun: dryRun},
+		body:    r.Body,
+		buf:     make([]byte, uploadChunkSize),
+		w:       w,
+		out:     out,
+	}
+	if err := h.server.ImportTasks(stream); err != nil {
+		if !stream.started {
+			writeGatewayError(h.gw, w, r, err)
+			return
+		}
+		p, _ := toProblem(r, err)
+		if err := json.NewEncoder(w).Encode(map[string]Problem{"error": p}); err != nil {
+			slog.ErrorContext(r.Context(), "write import error", "err", err)
+		}
+	}
+}
+
+// importUpload adapts the request body and response to the stream the
+// ImportTasks RPC reads and writes: options first, then chunks of the body.
+type importUpload struct {
+	grpc.ServerStream // unused by ImportTasks; nil
+	ctx               context.Context
+	options           *pb.ImportOptions
+	body              io.Reader
+	buf               []byte
+	w                 http.ResponseWriter
+	out               runtime.Marshaler
+	started           bool
+}
+
+func (u *importUpload) Context() context.Context {
+	return u.ctx
+}
+
+func (u *importUpload) Recv() (*pb.ImportTasksRequest, error) {
+	if u.options != nil {
+		opts := u.options
+		u.options = nil
+		return &pb.ImportTasksRequest{Data: &pb.ImportTasksRequest_Options{Options: opts}}, nil
+	}
+	// the RPC consumes each chunk before asking for the next, so buf is reused
+	n, err := u.body.Read(u.buf)
+	if n > 0 {
+		return &pb.ImportTasksRequest{Data: &pb.ImportTasksRequest_Chunk{Chunk: u.buf[:n]}}, nil
+	}
+	if err == nil {
+		err = io.ErrNoProgress
+	}
+	return nil, err
+}
+
+func (u *importUpload) Send(msg *pb.ImportTasksResponse) error {
+	if !u.started {
+		u.started = true
+		u.w.Header().Set("Content-Type", taskio.NDJSON.ContentType())
+		u.w.WriteHeader(http.StatusOK)
+	}
+	b, err := u.out.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	_, err = u.w.Write(append(b, '\n'))
+	return err
+}
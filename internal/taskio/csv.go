@@ -0,0 +1,131 @@
+package taskio
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fuzail/08-todosvc/internal/todo"
+)
+
+// csvColumns are the columns of an export. Imports need a header naming the
+// columns, in any order; only title is required and unknown columns are
+// ignored.
+var csvColumns = []string{"id", "title", "description", "completed", "due_at", "recurrence", "tenant", "created_at", "updated_at"}
+
+type csvEncoder struct {
+	w      *csv.Writer
+	header bool
+}
+
+func newCSVEncoder(w io.Writer) *csvEncoder {
+	return &csvEncoder{w: csv.NewWriter(w)}
+}
+
+func (e *csvEncoder) writeHeader() error {
+	if e.header {
+		return nil
+	}
+	e.header = true
+	return e.w.Write(csvColumns)
+}
+
+func (e *csvEncoder) Encode(t *todo.Task) error {
+	if err := e.writeHeader(); err != nil {
+		return err
+	}
+	due := ""
+	if t.DueAt != nil {
+		due = t.DueAt.UTC().Format(time.RFC3339)
+	}
+	return e.w.Write([]string{t.ID, t.Title, t.Description, strconv.FormatBool(t.Completed), due, t.Recurrence, t.Tenant,
+		t.CreatedAt.UTC().Format(time.RFC3339), t.UpdatedAt.UTC().Format(time.RFC3339)})
+}
+
+// Close writes the header of an empty export and flushes.
+func (e *csvEncoder) Close() error {
+	if err := e.writeHeader(); err != nil {
+		return err
+	}
+	e.w.Flush()
+	return e.w.Error()
+}
+
+type csvDecoder struct {
+	r       *csv.Reader
+	columns map[string]int // nil until the header is read
+}
+
+func newCSVDecoder(r io.Reader) *csvDecoder {
+	c := csv.NewReader(r)
+	c.FieldsPerRecord = -1
+	c.ReuseRecord = true
+	return &csvDecoder{r: c}
+}
+
+func (d *csvDecoder) readHeader() error {
+	header, err := d.r.Read()
+	if errors.Is(err, io.EOF) {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrCSVHeader, err)
+	}
+	d.columns = map[string]int{}
+	for i, name := range header {
+		// a UTF-8 BOM, as spreadsheets write, is not part of the name
+		name = strings.TrimPrefix(name, "\ufeff")
+		d.columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := d.columns["title"]; !ok {
+		return fmt.Errorf(`%w: no "title" column`, ErrCSVHeader)
+	}
+	return nil
+}
+
+func (d *csvDecoder) Decode() (Row, error) {
+	if d.columns == nil {
+		if err := d.readHeader(); err != nil {
+			return Row{}, err
+		}
+	}
+	record, err := d.r.Read()
+	if err != nil {
+		var perr *csv.ParseError
+		if errors.As(err, &perr) {
+			// the reader goes on with the next record
+			return Row{}, &RowError{Line: perr.StartLine, Err: err}
+		}
+		return Row{}, err
+	}
+	line, _ := d.r.FieldPos(0)
+	get := func(name string) string {
+		if i, ok := d.columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+	row := Row{Line: line, Task: todo.Task{
+		ID:          get("id"),
+		Title:       get("title"),
+		Description: get("description"),
+		Recurrence:  get("recurrence"),
+	}}
+	if v := get("completed"); v != "" {
+		if row.Task.Completed, err = strconv.ParseBool(v); err != nil {
+			return row, &RowError{Line: line, Err: fmt.Errorf("completed: %q is not true or false", v)}
+		}
+	}
+	if v := get("due_at"); v != "" {
+		due, err := parseTime(v)
+		if err != nil {
+			return row, &RowError{Line: line, Err: fmt.Errorf("due_at: %w", err)}
+		}
+		row.Task.DueAt = &due
+	}
+	return row, nil
+}
@@ -0,0 +1,394 @@
+package taskio
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/emersion/go-ical"
+	"github.com/fuzail/08-todosvc/internal/todo"
+	"github.com/google/uuid"
+)
+
+// ProdID identifies this service in the calendars it writes.
+const ProdID = "-//todosvc//todosvc//EN"
+
+// uidNamespace is the namespace of the name-based UUIDs that stand in for
+// iCalendar UIDs that aren't UUIDs, so importing the same file twice finds
+// the tasks already there.
+var uidNamespace = uuid.MustParse("f8a2a01a-4ae0-46b5-a644-e69c572f5fc4")
+
+const (
+	icalUTC      = "20060102T150405Z"
+	icalFloating = "20060102T150405"
+	icalDate     = "20060102"
+)
+
+// icalEncoder writes one VCALENDAR holding a VTODO per task (RFC 5545).
+// It streams the components ToDo builds rather than using go-ical's
+// encoder, which wants the whole calendar and doesn't fold lines.
+type icalEncoder struct {
+	w       io.Writer
+	b       strings.Builder
+	started bool
+}
+
+func newICalEncoder(w io.Writer) *icalEncoder {
+	return &icalEncoder{w: w}
+}
+
+// line adds a content line, folded at 75 octets without splitting
+// characters.
+func (e *icalEncoder) line(name, value string) {
+	s := name + ":" + value
+	for width := 75; len(s) > width; width = 74 {
+		cut := width
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		e.b.WriteString(s[:cut])
+		e.b.WriteString("\r\n ")
+		s = s[cut:]
+	}
+	e.b.WriteString(s)
+	e.b.WriteString("\r\n")
+}
+
+// component adds comp, its properties in name order as go-ical writes
+// them.
+func (e *icalEncoder) component(comp *ical.Component) {
+	e.line("BEGIN", comp.Name)
+	for _, name := range slices.Sorted(maps.Keys(comp.Props)) {
+		for _, p := range comp.Props[name] {
+			name := p.Name
+			for _, param := range slices.Sorted(maps.Keys(p.Params)) {
+				name += ";" + param + "=" + paramValue(p.Params[param])
+			}
+			e.line(name, p.Value)
+		}
+	}
+	for _, child := range comp.Children {
+		e.component(child)
+	}
+	e.line("END", comp.Name)
+}
+
+// paramValue joins the values of a parameter, quoting those that hold
+// separators.
+func paramValue(values []string) string {
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		if strings.ContainsAny(v, ";:,") {
+			v = `"` + v + `"`
+		}
+		quoted[i] = v
+	}
+	return strings.Join(quoted, ",")
+}
+
+func (e *icalEncoder) flush() error {
+	_, err := io.WriteString(e.w, e.b.String())
+	e.b.Reset()
+	return err
+}
+
+func (e *icalEncoder) begin() {
+	if !e.started {
+		e.started = true
+		e.line("BEGIN", ical.CompCalendar)
+		e.line(ical.PropVersion, "2.0")
+		e.line(ical.PropProductID, ProdID)
+	}
+}
+
+func (e *icalEncoder) Encode(t *todo.Task) error {
+	e.begin()
+	e.component(ToDo(t))
+	return e.flush()
+}
+
+func (e *icalEncoder) Close() error {
+	e.begin()
+	e.line("END", ical.CompCalendar)
+	return e.flush()
+}
+
+// ToDo returns the VTODO of t.
+func ToDo(t *todo.Task) *ical.Component {
+	comp := ical.NewComponent(ical.CompToDo)
+	set := func(name, value string) {
+		comp.Props.Set(&ical.Prop{Name: name, Params: ical.Params{}, Value: value})
+	}
+	set(ical.PropUID, t.ID)
+	set(ical.PropDateTimeStamp, t.UpdatedAt.UTC().Format(icalUTC))
+	set(ical.PropCreated, t.CreatedAt.UTC().Format(icalUTC))
+	set(ical.PropLastModified, t.UpdatedAt.UTC().Format(icalUTC))
+	set(ical.PropSummary, escapeText(t.Title))
+	if t.Description != "" {
+		set(ical.PropDescription, escapeText(t.Description))
+	}
+	if t.DueAt != nil {
+		set(ical.PropDue, t.DueAt.UTC().Format(icalUTC))
+	}
+	if t.Recurrence != "" {
+		set(ical.PropRecurrenceRule, t.Recurrence)
+	}
+	if t.Completed {
+		set(ical.PropStatus, "COMPLETED")
+		// the completion time isn't stored; the last change is the closest
+		set(ical.PropCompleted, t.UpdatedAt.UTC().Format(icalUTC))
+	} else {
+		set(ical.PropStatus, "NEEDS-ACTION")
+	}
+	return comp
+}
+
+var textEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`, "\r", "")
+
+func escapeText(s string) string {
+	return textEscaper.Replace(s)
+}
+
+func unescapeText(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 'n', 'N':
+			b.WriteByte('\n')
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
+
+// icalDecoder reads the VTODOs of a calendar; other components, such as
+// VEVENTs, and unknown properties are skipped.
+type icalDecoder struct {
+	s       *bufio.Scanner
+	line    int    // of the last physical line read
+	next    string // read ahead to unfold
+	hasNext bool
+}
+
+func newICalDecoder(r io.Reader) *icalDecoder {
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 64<<10), maxLine)
+	return &icalDecoder{s: s}
+}
+
+// readLine returns the next unfolded content line and where it starts.
+func (d *icalDecoder) readLine() (string, int, error) {
+	if !d.hasNext {
+		if !d.s.Scan() {
+			return "", 0, d.scanErr()
+		}
+		d.line++
+		d.next = strings.TrimSuffix(d.s.Text(), "\r")
+	}
+	start, cur := d.line, d.next
+	d.hasNext = false
+	for d.s.Scan() {
+		d.line++
+		l := strings.TrimSuffix(d.s.Text(), "\r")
+		if l == "" || (l[0] != ' ' && l[0] != '\t') {
+			d.next, d.hasNext = l, true
+			return cur, start, nil
+		}
+		if len(cur)+len(l) > maxLine {
+			return "", 0, fmt.Errorf("line %d: %w", start, ErrLineTooLong)
+		}
+		cur += l[1:]
+	}
+	if err := d.s.Err(); err != nil {
+		return "", 0, d.scanErr()
+	}
+	return cur, start, nil
+}
+
+func (d *icalDecoder) scanErr() error {
+	err := d.s.Err()
+	if err == nil {
+		return io.EOF
+	}
+	if errors.Is(err, bufio.ErrTooLong) {
+		err = ErrLineTooLong
+	}
+	return fmt.Errorf("line %d: %w", d.line+1, err)
+}
+
+// parseContentLine parses NAME;PARAM=VALUE;...:VALUE. Parameter values
+// are kept whole, commas and all.
+func parseContentLine(s string) (*ical.Prop, error) {
+	i := strings.IndexAny(s, ";:")
+	if i <= 0 {
+		return nil, fmt.Errorf("%q is not a content line", s)
+	}
+	p := ical.NewProp(s[:i])
+	for s[i] == ';' {
+		s = s[i+1:]
+		eq := strings.IndexByte(s, '=')
+		if eq <= 0 {
+			return nil, fmt.Errorf("bad parameter in %s", p.Name)
+		}
+		key := s[:eq]
+		s = s[eq+1:]
+		// values may be quoted to hold ; and :
+		var val string
+		if strings.HasPrefix(s, `"`) {
+			end := strings.IndexByte(s[1:], '"')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated quote in %s", p.Name)
+			}
+			val, s = s[1:end+1], s[end+2:]
+		} else {
+			end := strings.IndexAny(s, ";:")
+			if end < 0 {
+				return nil, fmt.Errorf("%s has no value", p.Name)
+			}
+			val, s = s[:end], s[end:]
+		}
+		p.Params.Set(key, val)
+		i = 0
+		if s == "" {
+			return nil, fmt.Errorf("%s has no value", p.Name)
+		}
+	}
+	if s[i] != ':' {
+		return nil, fmt.Errorf("%s has no value", p.Name)
+	}
+	p.Value = s[i+1:]
+	return p, nil
+}
+
+func (d *icalDecoder) Decode() (Row, error) {
+	// depth counts open components inside the VTODO, such as VALARMs,
+	// which are skipped
+	var comp *ical.Component
+	var line int
+	var rowErr error
+	depth := 0
+	for {
+		s, n, err := d.readLine()
+		if errors.Is(err, io.EOF) && comp != nil {
+			return Row{}, &RowError{Line: line, Err: errors.New("missing END:VTODO")}
+		}
+		if err != nil {
+			return Row{}, err
+		}
+		if strings.TrimSpace(s) == "" {
+			continue
+		}
+		p, err := parseContentLine(s)
+		if err != nil {
+			if comp != nil && rowErr == nil {
+				rowErr = fmt.Errorf("line %d: %w", n, err)
+			}
+			continue
+		}
+		switch {
+		case p.Name == "BEGIN" && comp == nil:
+			if strings.EqualFold(p.Value, ical.CompToDo) {
+				comp, line = ical.NewComponent(ical.CompToDo), n
+			}
+		case p.Name == "BEGIN":
+			depth++
+		case p.Name == "END" && comp != nil && depth > 0:
+			depth--
+		case p.Name == "END" && comp != nil:
+			if rowErr != nil {
+				return Row{}, &RowError{Line: line, Err: rowErr}
+			}
+			t, err := FromToDo(comp)
+			if err != nil {
+				return Row{}, &RowError{Line: line, Err: err}
+			}
+			return Row{Line: line, Task: t}, nil
+		case comp != nil && depth == 0:
+			comp.Props.Add(p)
+		}
+	}
+}
+
+// FromToDo returns the task a VTODO describes. Properties tasks have no
+// field for, and subcomponents, are ignored.
+func FromToDo(comp *ical.Component) (todo.Task, error) {
+	var t todo.Task
+	if p := comp.Props.Get(ical.PropUID); p != nil {
+		t.ID = TaskID(p.Value)
+	}
+	if p := comp.Props.Get(ical.PropSummary); p != nil {
+		t.Title = unescapeText(p.Value)
+	}
+	if p := comp.Props.Get(ical.PropDescription); p != nil {
+		t.Description = unescapeText(p.Value)
+	}
+	if p := comp.Props.Get(ical.PropDue); p != nil {
+		due, err := parseDateTime(p)
+		if err != nil {
+			return todo.Task{}, fmt.Errorf("DUE: %w", err)
+		}
+		t.DueAt = &due
+	}
+	if p := comp.Props.Get(ical.PropRecurrenceRule); p != nil {
+		t.Recurrence = p.Value
+	}
+	if p := comp.Props.Get(ical.PropStatus); p != nil {
+		t.Completed = strings.EqualFold(p.Value, "COMPLETED")
+	}
+	if comp.Props.Get(ical.PropCompleted) != nil {
+		t.Completed = true
+	}
+	return t, nil
+}
+
+// TaskID returns the task id for an iCalendar UID: the UID itself if it is
+// a UUID, else a UUID derived from it.
+func TaskID(uid string) string {
+	uid = strings.TrimSpace(uid)
+	if uid == "" {
+		return ""
+	}
+	if id, err := uuid.Parse(uid); err == nil {
+		return id.String()
+	}
+	return uuid.NewSHA1(uidNamespace, []byte(uid)).String()
+}
+
+// parseDateTime parses a DATE or DATE-TIME value. Dates are midnight UTC;
+// floating times are taken as UTC unless TZID names a zone.
+func parseDateTime(p *ical.Prop) (time.Time, error) {
+	v := strings.TrimSpace(p.Value)
+	if strings.EqualFold(p.Params.Get(ical.ParamValue), "DATE") || len(v) == len(icalDate) {
+		return time.Parse(icalDate, v)
+	}
+	if strings.HasSuffix(v, "Z") {
+		return time.Parse(icalUTC, v)
+	}
+	loc := time.UTC
+	if tzid := p.Params.Get(ical.ParamTimezoneID); tzid != "" {
+		var err error
+		if loc, err = time.LoadLocation(strings.TrimPrefix(tzid, "/")); err != nil {
+			return time.Time{}, fmt.Errorf("unknown time zone %q", tzid)
+		}
+	}
+	t, err := time.ParseInLocation(icalFloating, v, loc)
+	if err != nil {
+		return t, fmt.Errorf("%q is not a date-time", v)
+	}
+	return t.UTC(), nil
+}
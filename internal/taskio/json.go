@@ -0,0 +1,98 @@
+package taskio
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/fuzail/08-todosvc/internal/todo"
+)
+
+// jsonTask is a task in an NDJSON file. Imports ignore tenant and the
+// timestamps.
+type jsonTask struct {
+	ID          string     `json:"id"`
+	Title       string     `json:"title"`
+	Description string     `json:"description,omitempty"`
+	Completed   bool       `json:"completed"`
+	DueAt       *time.Time `json:"due_at,omitempty"`
+	Recurrence  string     `json:"recurrence,omitempty"`
+	Tenant      string     `json:"tenant,omitempty"`
+	CreatedAt   *time.Time `json:"created_at,omitempty"`
+	UpdatedAt   *time.Time `json:"updated_at,omitempty"`
+}
+
+type jsonEncoder struct {
+	enc *json.Encoder
+}
+
+func newJSONEncoder(w io.Writer) *jsonEncoder {
+	return &jsonEncoder{enc: json.NewEncoder(w)}
+}
+
+func (e *jsonEncoder) Encode(t *todo.Task) error {
+	created, updated := t.CreatedAt.UTC(), t.UpdatedAt.UTC()
+	rec := jsonTask{
+		ID:          t.ID,
+		Title:       t.Title,
+		Description: t.Description,
+		Completed:   t.Completed,
+		Recurrence:  t.Recurrence,
+		Tenant:      t.Tenant,
+		CreatedAt:   &created,
+		UpdatedAt:   &updated,
+	}
+	if t.DueAt != nil {
+		due := t.DueAt.UTC()
+		rec.DueAt = &due
+	}
+	return e.enc.Encode(rec)
+}
+
+func (e *jsonEncoder) Close() error {
+	return nil
+}
+
+type jsonDecoder struct {
+	s    *bufio.Scanner
+	line int
+}
+
+func newJSONDecoder(r io.Reader) *jsonDecoder {
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 64<<10), maxLine)
+	return &jsonDecoder{s: s}
+}
+
+func (d *jsonDecoder) Decode() (Row, error) {
+	for d.s.Scan() {
+		d.line++
+		b := bytes.TrimSpace(d.s.Bytes())
+		if len(b) == 0 {
+			continue
+		}
+		var rec jsonTask
+		if err := json.Unmarshal(b, &rec); err != nil {
+			return Row{}, &RowError{Line: d.line, Err: fmt.Errorf("invalid JSON: %w", err)}
+		}
+		return Row{Line: d.line, Task: todo.Task{
+			ID:          rec.ID,
+			Title:       rec.Title,
+			Description: rec.Description,
+			Completed:   rec.Completed,
+			DueAt:       rec.DueAt,
+			Recurrence:  rec.Recurrence,
+		}}, nil
+	}
+	if err := d.s.Err(); err != nil {
+		if errors.Is(err, bufio.ErrTooLong) {
+			err = ErrLineTooLong
+		}
+		return Row{}, fmt.Errorf("line %d: %w", d.line+1, err)
+	}
+	return Row{}, io.EOF
+}
@@ -0,0 +1,162 @@
+// Package taskio reads and writes tasks in the file formats other tools
+// exchange them in: NDJSON, CSV and iCalendar VTODO. Encoders and decoders
+// work a task at a time, so files of any size are handled in bounded memory.
+package taskio
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/fuzail/08-todosvc/internal/todo"
+)
+
+// Format is a task file format.
+type Format string
+
+const (
+	NDJSON    Format = "ndjson"
+	CSV       Format = "csv"
+	ICalendar Format = "ical"
+)
+
+var formatNames = map[string]Format{
+	"ndjson": NDJSON, "jsonl": NDJSON, "json": NDJSON,
+	"csv":  CSV,
+	"ical": ICalendar, "ics": ICalendar, "icalendar": ICalendar, "vtodo": ICalendar,
+}
+
+// ParseFormat parses a format name, or one of its aliases such as "jsonl"
+// or "ics". The empty string is NDJSON.
+func ParseFormat(s string) (Format, error) {
+	if s == "" {
+		return NDJSON, nil
+	}
+	if f, ok := formatNames[strings.ToLower(s)]; ok {
+		return f, nil
+	}
+	return "", fmt.Errorf("unknown format %q (want ndjson, csv or ical)", s)
+}
+
+// FormatForFile returns the format named by a file's extension.
+func FormatForFile(name string) (Format, bool) {
+	f, ok := formatNames[strings.ToLower(strings.TrimPrefix(path.Ext(name), "."))]
+	return f, ok
+}
+
+var contentTypes = map[Format]string{
+	NDJSON:    "application/x-ndjson",
+	CSV:       "text/csv; charset=utf-8",
+	ICalendar: "text/calendar; charset=utf-8",
+}
+
+// FormatForContentType returns the format of a media type such as
+// "text/csv".
+func FormatForContentType(contentType string) (Format, bool) {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "", false
+	}
+	switch mt {
+	case "application/x-ndjson", "application/jsonl", "application/json":
+		return NDJSON, true
+	case "text/csv":
+		return CSV, true
+	case "text/calendar":
+		return ICalendar, true
+	}
+	return "", false
+}
+
+// ContentType is the media type of files in f.
+func (f Format) ContentType() string {
+	return contentTypes[f]
+}
+
+// Ext is the usual file extension of f, with the dot.
+func (f Format) Ext() string {
+	if f == ICalendar {
+		return ".ics"
+	}
+	return "." + string(f)
+}
+
+// Encoder writes tasks to a file. Close finishes the file; it doesn't close
+// the underlying writer.
+type Encoder interface {
+	Encode(t *todo.Task) error
+	Close() error
+}
+
+// NewEncoder writes tasks to w in format f.
+func NewEncoder(w io.Writer, f Format) (Encoder, error) {
+	switch f {
+	case NDJSON:
+		return newJSONEncoder(w), nil
+	case CSV:
+		return newCSVEncoder(w), nil
+	case ICalendar:
+		return newICalEncoder(w), nil
+	}
+	return nil, fmt.Errorf("unknown format %q", f)
+}
+
+// Row is one task read from a file. Only the fields an import uses are set:
+// ID, Title, Description, Completed, DueAt and Recurrence.
+type Row struct {
+	Line int // where the row starts, 1-based
+	Task todo.Task
+}
+
+// RowError is a row that can't be read. Decoding can go on with the next
+// row.
+type RowError struct {
+	Line int
+	Err  error
+}
+
+func (e *RowError) Error() string { return fmt.Sprintf("line %d: %v", e.Line, e.Err) }
+func (e *RowError) Unwrap() error { return e.Err }
+
+// Decoder reads tasks from a file. Decode returns io.EOF after the last row
+// and a *RowError for a bad row; any other error ends the file.
+type Decoder interface {
+	Decode() (Row, error)
+}
+
+// NewDecoder reads tasks in format f from r.
+func NewDecoder(r io.Reader, f Format) (Decoder, error) {
+	switch f {
+	case NDJSON:
+		return newJSONDecoder(r), nil
+	case CSV:
+		return newCSVDecoder(r), nil
+	case ICalendar:
+		return newICalDecoder(r), nil
+	}
+	return nil, fmt.Errorf("unknown format %q", f)
+}
+
+// maxLine bounds the length of a line, which is read whole.
+const maxLine = 1 << 20
+
+// Errors that end an import: the file can't be read any further.
+var (
+	ErrLineTooLong = &todo.Error{Kind: todo.KindInvalid, Reason: "LINE_TOO_LONG", Message: "line longer than 1 MiB"}
+	ErrCSVHeader   = &todo.Error{Kind: todo.KindInvalid, Reason: "INVALID_CSV_HEADER", Message: "invalid CSV header"}
+)
+
+// parseTime accepts RFC 3339 times and dates, which are midnight UTC.
+func parseTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.DateOnly, s)
+	if err != nil {
+		return t, fmt.Errorf("%q is not an RFC 3339 time or a YYYY-MM-DD date", s)
+	}
+	return t, nil
+}
@@ -0,0 +1,124 @@
+package taskio
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"github.com/fuzail/08-todosvc/internal/todo"
+)
+
+// Export writes every task to w in format f.
+func Export(ctx context.Context, svc todo.Service, w io.Writer, f Format) error {
+	enc, err := NewEncoder(w, f)
+	if err != nil {
+		return err
+	}
+	if err := svc.ExportTasks(ctx, enc.Encode); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// Status is the outcome of importing one row.
+type Status string
+
+const (
+	Created Status = "created"
+	Valid   Status = "valid" // dry run: the row would be created
+	Exists  Status = "exists"
+	Failed  Status = "failed"
+)
+
+// ReasonInvalidRow is the Result.Reason of rows that can't be read.
+const ReasonInvalidRow = "INVALID_ROW"
+
+// Result reports on one imported row.
+type Result struct {
+	Line   int
+	ID     string // the row's id, or the created task's
+	Status Status
+	Err    error // for Failed: a *todo.Error or a *RowError
+}
+
+// Reason is the machine-readable reason a row failed, e.g. TITLE_REQUIRED.
+func (r Result) Reason() string {
+	var de *todo.Error
+	switch {
+	case r.Err == nil:
+		return ""
+	case errors.As(r.Err, &de):
+		return de.Reason
+	}
+	return ReasonInvalidRow
+}
+
+// Summary counts the results of an import.
+type Summary struct {
+	Created  int64 // valid rows on a dry run
+	Existing int64
+	Failed   int64
+	DryRun   bool
+}
+
+// Import creates a task for each row read from r in format f and reports
+// each row to report as it goes. Rows that can't be read or are rejected by
+// the service fail on their own and the import goes on; rows whose id is
+// taken are skipped. Any other error, such as a read or storage error, ends
+// the import and is returned with the summary so far.
+func Import(ctx context.Context, svc todo.Service, r io.Reader, f Format, dryRun bool, report func(Result) error) (Summary, error) {
+	sum := Summary{DryRun: dryRun}
+	dec, err := NewDecoder(r, f)
+	if err != nil {
+		return sum, err
+	}
+	for {
+		row, err := dec.Decode()
+		if errors.Is(err, io.EOF) {
+			return sum, nil
+		}
+		res := Result{Line: row.Line, ID: row.Task.ID}
+		var rowErr *RowError
+		switch {
+		case errors.As(err, &rowErr):
+			res.Line, res.Status, res.Err = rowErr.Line, Failed, rowErr.Err
+		case err != nil:
+			return sum, err
+		default:
+			res.Status, res.Err = importRow(ctx, svc, row, dryRun, &res.ID)
+			if res.Status == "" {
+				return sum, res.Err
+			}
+		}
+		switch res.Status {
+		case Created, Valid:
+			sum.Created++
+		case Exists:
+			sum.Existing++
+		case Failed:
+			sum.Failed++
+		}
+		if err := report(res); err != nil {
+			return sum, err
+		}
+	}
+}
+
+// importRow imports one row. It returns no status for errors that should
+// end the import.
+func importRow(ctx context.Context, svc todo.Service, row Row, dryRun bool, id *string) (Status, error) {
+	t, err := svc.ImportTask(ctx, row.Task, dryRun)
+	var de *todo.Error
+	switch {
+	case err == nil && dryRun:
+		return Valid, nil
+	case err == nil:
+		*id = t.ID
+		return Created, nil
+	case errors.Is(err, todo.ErrAlreadyExists):
+		return Exists, nil
+	case errors.As(err, &de):
+		return Failed, err
+	}
+	return "", err
+}
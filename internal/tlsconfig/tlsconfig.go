@@ -0,0 +1,98 @@
+// Package tlsconfig builds server TLS configs from certificate files that can
+// be reloaded at runtime, e.g. when a cert manager rotates them.
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sync/atomic"
+)
+
+// Config names the files the server's TLS material is read from.
+type Config struct {
+	CertFile string
+	KeyFile  string
+	// ClientCAFile is a PEM bundle of CAs client certificates are verified
+	// against. Setting it enables mutual TLS.
+	ClientCAFile string
+	// ClientCertOptional accepts clients without a certificate; ones that do
+	// present one must still pass verification.
+	ClientCertOptional bool
+}
+
+// Reloader serves the certificate and client CA pool most recently loaded
+// from a Config's files.
+type Reloader struct {
+	cfg     Config
+	current atomic.Pointer[material]
+}
+
+type material struct {
+	cert      tls.Certificate
+	clientCAs *x509.CertPool
+}
+
+// NewReloader loads the files once; it fails if they are missing or invalid.
+func NewReloader(cfg Config) (*Reloader, error) {
+	r := &Reloader{cfg: cfg}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload re-reads the files. New handshakes use the new material; existing
+// connections keep theirs. On error the previous material stays in use.
+func (r *Reloader) Reload() error {
+	cert, err := tls.LoadX509KeyPair(r.cfg.CertFile, r.cfg.KeyFile)
+	if err != nil {
+		return fmt.Errorf("load tls key pair: %w", err)
+	}
+	m := &material{cert: cert}
+	if r.cfg.ClientCAFile != "" {
+		pem, err := os.ReadFile(r.cfg.ClientCAFile)
+		if err != nil {
+			return fmt.Errorf("load client ca: %w", err)
+		}
+		m.clientCAs = x509.NewCertPool()
+		if !m.clientCAs.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("load client ca: no certificates in %s", r.cfg.ClientCAFile)
+		}
+	}
+	r.current.Store(m)
+	return nil
+}
+
+// MutualTLS reports whether client certificates are verified.
+func (r *Reloader) MutualTLS() bool {
+	return r.cfg.ClientCAFile != ""
+}
+
+// ServerConfig returns a TLS config that picks up reloaded material on every
+// handshake. nextProtos are the ALPN protocols of the server using it ("h2"
+// for gRPC, "h2" and "http/1.1" for HTTP); they must be set here because the
+// per-handshake config replaces whatever the server adds to the outer one.
+func (r *Reloader) ServerConfig(nextProtos ...string) *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		NextProtos: nextProtos,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			m := r.current.Load()
+			c := &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				NextProtos:   nextProtos,
+				Certificates: []tls.Certificate{m.cert},
+			}
+			if m.clientCAs != nil {
+				c.ClientCAs = m.clientCAs
+				c.ClientAuth = tls.RequireAndVerifyClientCert
+				if r.cfg.ClientCertOptional {
+					c.ClientAuth = tls.VerifyClientCertIfGiven
+				}
+			}
+			return c, nil
+		},
+	}
+}
@@ -0,0 +1,60 @@
+package todo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+var ErrAttachmentNotFound = &Error{Kind: KindNotFound, Reason: "ATTACHMENT_NOT_FOUND", Message: "attachment not found"}
+
+// AttachmentRepository defines data access operations for attachment metadata.
+type AttachmentRepository interface {
+	Create(ctx context.Context, a *Attachment) error
+	GetByID(ctx context.Context, taskID, id string) (*Attachment, error)
+	ListByTask(ctx context.Context, taskID string) ([]Attachment, error) // oldest first
+	Delete(ctx context.Context, taskID, id string) error
+}
+
+type gormAttachmentRepository struct {
+	db *gorm.DB
+}
+
+func NewGormAttachmentRepository(db *gorm.DB) AttachmentRepository {
+	return &gormAttachmentRepository{db: db}
+}
+
+func (r *gormAttachmentRepository) Create(ctx context.Context, a *Attachment) error {
+	if err := r.db.WithContext(ctx).Create(a).Error; err != nil {
+		return fmt.Errorf("create attachment: %w", err)
+	}
+	return nil
+}
+
+func (r *gormAttachmentRepository) GetByID(ctx context.Context, taskID, id string) (*Attachment, error) {
+	var a Attachment
+	if err := r.db.WithContext(ctx).First(&a, "id = ? AND task_id = ?", id, taskID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrAttachmentNotFound
+		}
+		return nil, fmt.Errorf("get attachment: %w", err)
+	}
+	return &a, nil
+}
+
+func (r *gormAttachmentRepository) ListByTask(ctx context.Context, taskID string) ([]Attachment, error) {
+	var atts []Attachment
+	if err := r.db.WithContext(ctx).Where("task_id = ?", taskID).Order("created_at asc, id asc").Find(&atts).Error; err != nil {
+		return nil, fmt.Errorf("list attachments: %w", err)
+	}
+	return atts, nil
+}
+
+func (r *gormAttachmentRepository) Delete(ctx context.Context, taskID, id string) error {
+	if err := r.db.WithContext(ctx).Where("id = ? AND task_id = ?", id, taskID).Delete(&Attachment{}).Error; err != nil {
+		return fmt.Errorf("delete attachment: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+package todo
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"mime"
+
+	"github.com/fuzail/08-todosvc/pkg/storage"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrAttachmentName     = invalidField("ATTACHMENT_NAME_REQUIRED", "name", "attachment name is required")
+	ErrAttachmentTooLarge = &Error{Kind: KindTooLarge, Reason: "ATTACHMENT_TOO_LARGE", Message: "attachment is too large"}
+)
+
+// DefaultMaxAttachmentSize is used when NewAttachmentService gets maxSize <= 0.
+const DefaultMaxAttachmentSize = 25 << 20
+
+// AttachmentService stores files attached to tasks. Metadata goes through an
+// AttachmentRepository, bytes through a storage.BlobStore.
+type AttachmentService interface {
+	// Upload stores the content of r. A contentType that isn't a valid media
+	// type is stored as application/octet-stream.
+	Upload(ctx context.Context, taskID, name, contentType string, r io.Reader) (*Attachment, error)
+	ListAttachments(ctx context.Context, taskID string) ([]Attachment, error)
+	// Open returns the attachment and a seekable reader over its content. The
+	// caller must close the reader.
+	Open(ctx context.Context, taskID, id string) (*Attachment, io.ReadSeekCloser, error)
+	DeleteAttachment(ctx context.Context, taskID, id string) error
+}
+
+type attachmentService struct {
+	attachments AttachmentRepository
+	tasks       Repository
+	blobs       storage.BlobStore
+	maxSize     int64
+	quotas      QuotaService
+}
+
+// NewAttachmentService enforces the tenant attachment quota unless quotas is
+// nil.
+func NewAttachmentService(a AttachmentRepository, t Repository, b storage.BlobStore, maxSize int64, quotas QuotaService) AttachmentService {
+	if maxSize <= 0 {
+		maxSize = DefaultMaxAttachmentSize
+	}
+	return &attachmentService{attachments: a, tasks: t, blobs: b, maxSize: maxSize, quotas: quotas}
+}
+
+func (s *attachmentService) Upload(ctx context.Context, taskID, name, contentType string, r io.Reader) (*Attachment, error) {
+	ctx, span := tracer.Start(ctx, "todo.AttachmentService/Upload")
+	defer span.End()
+	if err := required("task_id", taskID); err != nil {
+		return nil, err
+	}
+	if name == "" {
+		return nil, ErrAttachmentName
+	}
+	task, err := s.tasks.GetByID(ctx, taskID)
+	if err != nil {
+		return nil, err
+	}
+	// fail before streaming if the tenant has no room left, and read no
+	// more than the room it has
+	limit := s.maxSize
+	if s.quotas != nil {
+		room, err := s.quotas.AttachmentRoom(ctx, task.Tenant)
+		if err != nil {
+			return nil, err
+		}
+		if room >= 0 && room < limit {
+			limit = room
+		}
+	}
+	if _, _, err := mime.ParseMediaType(contentType); err != nil {
+		contentType = "application/octet-stream"
+	}
+	id, err := uuid.NewV7()
+	if err != nil {
+		return nil, err
+	}
+	a := &Attachment{
+		ID:          id.String(),
+		TaskID:      taskID,
+		Name:        name,
+		ContentType: contentType,
+		StorageKey:  "tasks/" + taskID + "/" + id.String(),
+	}
+
+	// hash and count while streaming; read one byte past the limit to detect
+	// uploads over the size limit or the quota
+	h := sha256.New()
+	counter := &countingReader{r: io.LimitReader(r, limit+1)}
+	if err := s.blobs.Put(ctx, a.StorageKey, io.TeeReader(counter, h), -1, contentType); err != nil {
+		return nil, err
+	}
+	if counter.n > s.maxSize {
+		_ = s.blobs.Delete(ctx, a.StorageKey)
+		return nil, ErrAttachmentTooLarge
+	}
+	// checked again, as other uploads may have used the room meanwhile
+	if s.quotas != nil {
+		if err := s.quotas.CheckAttachment(ctx, task.Tenant, counter.n); err != nil {
+			_ = s.blobs.Delete(ctx, a.StorageKey)
+			return nil, err
+		}
+	}
+	a.Size = counter.n
+	a.Checksum = hex.EncodeToString(h.Sum(nil))
+
+	if err := s.attachments.Create(ctx, a); err != nil {
+		_ = s.blobs.Delete(ctx, a.StorageKey)
+		return nil, err
+	}
+	return a, nil
+}
+
+func (s *attachmentService) ListAttachments(ctx context.Context, taskID string) ([]Attachment, error) {
+	ctx, span := tracer.Start(ctx, "todo.AttachmentService/ListAttachments")
+	defer span.End()
+	if err := required("task_id", taskID); err != nil {
+		return nil, err
+	}
+	if _, err := s.tasks.GetByID(ctx, taskID); err != nil {
+		return nil, err
+	}
+	return s.attachments.ListByTask(ctx, taskID)
+}
+
+func (s *attachmentService) Open(ctx context.Context, taskID, id string) (*Attachment, io.ReadSeekCloser, error) {
+	ctx, span := tracer.Start(ctx, "todo.AttachmentService/Open")
+	defer span.End()
+	if err := required("task_id", taskID, "id", id); err != nil {
+		return nil, nil, err
+	}
+	if _, err := s.tasks.GetByID(ctx, taskID); err != nil {
+		return nil, nil, err
+	}
+	a, err := s.attachments.GetByID(ctx, taskID, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	return a, storage.NewReadSeeker(ctx, s.blobs, a.StorageKey, a.Size), nil
+}
+
+func (s *attachmentService) DeleteAttachment(ctx context.Context, taskID, id string) error {
+	ctx, span := tracer.Start(ctx, "todo.AttachmentService/DeleteAttachment")
+	defer span.End()
+	if err := required("task_id", taskID, "id", id); err != nil {
+		return err
+	}
+	if _, err := s.tasks.GetByID(ctx, taskID); err != nil {
+		return err
+	}
+	a, err := s.attachments.GetByID(ctx, taskID, id)
+	if err != nil {
+		return err
+	}
+	if err := s.attachments.Delete(ctx, taskID, id); err != nil {
+		return err
+	}
+	// metadata is soft-deleted, but the bytes go; a failure here only leaks storage
+	_ = s.blobs.Delete(ctx, a.StorageKey)
+	return nil
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
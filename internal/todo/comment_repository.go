@@ -0,0 +1,108 @@
+package todo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+var ErrCommentNotFound = &Error{Kind: KindNotFound, Reason: "COMMENT_NOT_FOUND", Message: "comment not found"}
+
+// CommentRepository defines data access operations for task comments.
+type CommentRepository interface {
+	Create(ctx context.Context, c *Comment) error
+	GetByID(ctx context.Context, taskID, id string) (*Comment, error)
+	ListByTask(ctx context.Context, taskID string, page, pageSize int) ([]Comment, int64, error) // oldest first
+	// ListByTasks returns the oldest limit comments of each task in one
+	// query, keyed by task id.
+	ListByTasks(ctx context.Context, taskIDs []string, limit int) (map[string][]Comment, error)
+	Update(ctx context.Context, c *Comment) error
+	Delete(ctx context.Context, taskID, id string) error
+}
+
+type gormCommentRepository struct {
+	db *gorm.DB
+}
+
+func NewGormCommentRepository(db *gorm.DB) CommentRepository {
+	return &gormCommentRepository{db: db}
+}
+
+func (r *gormCommentRepository) Create(ctx context.Context, c *Comment) error {
+	if err := r.db.WithContext(ctx).Create(c).Error; err != nil {
+		return fmt.Errorf("create comment: %w", err)
+	}
+	return nil
+}
+
+func (r *gormCommentRepository) GetByID(ctx context.Context, taskID, id string) (*Comment, error) {
+	var c Comment
+	if err := r.db.WithContext(ctx).First(&c, "id = ? AND task_id = ?", id, taskID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrCommentNotFound
+		}
+		return nil, fmt.Errorf("get comment: %w", err)
+	}
+	return &c, nil
+}
+
+func (r *gormCommentRepository) ListByTask(ctx context.Context, taskID string, page, pageSize int) ([]Comment, int64, error) {
+	if page < 1 {
+		page = 1
+	}
+	if pageSize <= 0 {
+		pageSize = 10
+	}
+	var comments []Comment
+	var total int64
+	q := r.db.WithContext(ctx).Model(&Comment{}).Where("task_id = ?", taskID)
+	if err := q.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("count comments: %w", err)
+	}
+	offset := (page - 1) * pageSize
+	if err := q.Order("created_at asc, id asc").Limit(pageSize).Offset(offset).Find(&comments).Error; err != nil {
+		return nil, 0, fmt.Errorf("list comments: %w", err)
+	}
+	return comments, total, nil
+}
+
+// firstCommentsSQL numbers each task's comments so the first few of every
+// task come back in one query.
+const firstCommentsSQL = `SELECT * FROM (
+	SELECT c.*, ROW_NUMBER() OVER (PARTITION BY c.task_id ORDER BY c.created_at, c.id) AS n
+	FROM comments c WHERE c.task_id IN ? AND c.deleted_at IS NULL
+) numbered WHERE n <= ? ORDER BY task_id, n`
+
+func (r *gormCommentRepository) ListByTasks(ctx context.Context, taskIDs []string, limit int) (map[string][]Comment, error) {
+	comments := map[string][]Comment{}
+	if len(taskIDs) == 0 {
+		return comments, nil
+	}
+	var rows []Comment
+	if err := r.db.WithContext(ctx).Raw(firstCommentsSQL, taskIDs, limit).Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("list comments of tasks: %w", err)
+	}
+	for _, c := range rows {
+		comments[c.TaskID] = append(comments[c.TaskID], c)
+	}
+	return comments, nil
+}
+
+func (r *gormCommentRepository) Update(ctx context.Context, c *Comment) error {
+	if err := r.db.WithContext(ctx).Model(&Comment{}).Where("id = ? AND task_id = ?", c.ID, c.TaskID).Updates(map[string]interface{}{
+		"body":      c.Body,
+		"edited_at": c.EditedAt,
+	}).Error; err != nil {
+		return fmt.Errorf("update comment: %w", err)
+	}
+	return nil
+}
+
+func (r *gormCommentRepository) Delete(ctx context.Context, taskID, id string) error {
+	if err := r.db.WithContext(ctx).Where("id = ? AND task_id = ?", id, taskID).Delete(&Comment{}).Error; err != nil {
+		return fmt.Errorf("delete comment: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+package todo
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/fuzail/08-todosvc/internal/reqctx"
+)
+
+var ErrEmptyComment = invalidField("COMMENT_BODY_REQUIRED", "body", "comment body is required")
+
+// CommentService manages the discussion thread on tasks. Every call checks
+// that the task exists, so a missing task returns ErrNotFound and a missing
+// comment returns ErrCommentNotFound.
+type CommentService interface {
+	// AddComment takes the author from the caller's verified client
+	// certificate (see reqctx.ClientFrom) if it has one, ignoring author;
+	// otherwise author is required and checked like a title.
+	AddComment(ctx context.Context, taskID, author, body string) (*Comment, error)
+	ListComments(ctx context.Context, taskID string, page, pageSize int) ([]Comment, int64, error)
+	// ListCommentsOf returns the first limit comments of each of taskIDs
+	// that has any, for batched reads. It doesn't check that the tasks
+	// exist and takes at most MaxBatchSize ids.
+	ListCommentsOf(ctx context.Context, taskIDs []string, limit int) (map[string][]Comment, error)
+	EditComment(ctx context.Context, taskID, id, body string) (*Comment, error)
+	DeleteComment(ctx context.Context, taskID, id string) error
+}
+
+type commentService struct {
+	comments CommentRepository
+	tasks    Repository
+	limits   Limits
+}
+
+func NewCommentService(c CommentRepository, t Repository, limits Limits) CommentService {
+	return &commentService{comments: c, tasks: t, limits: limits.withDefaults()}
+}
+
+// checkBody validates and trims a comment body.
+func (s *commentService) checkBody(body string) (string, error) {
+	body = strings.TrimSpace(body)
+	if body == "" {
+		return "", ErrEmptyComment
+	}
+	var v validator
+	body = v.multiLine("body", body, s.limits.MaxCommentLength, true)
+	return body, v.err()
+}
+
+// checkAuthor returns the author of a new comment: the caller's identity if
+// it is known, so authors can't be made up, or else author trimmed.
+func checkAuthor(ctx context.Context, v *validator, author string) string {
+	if c, ok := reqctx.ClientFrom(ctx); ok && c.String() != "" {
+		return c.String()
+	}
+	return v.singleLine("author", author, MaxAuthorLength, true)
+}
+
+func (s *commentService) AddComment(ctx context.Context, taskID, author, body string) (*Comment, error) {
+	ctx, span := tracer.Start(ctx, "todo.CommentService/AddComment")
+	defer span.End()
+	var v validator
+	v.required("task_id", taskID)
+	author = checkAuthor(ctx, &v, author)
+	if err := v.err(); err != nil {
+		return nil, err
+	}
+	body, err := s.checkBody(body)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.tasks.GetByID(ctx, taskID); err != nil {
+		return nil, err
+	}
+	c := &Comment{
+		TaskID: taskID,
+		Author: author,
+		Body:   body,
+	}
+	if err := s.comments.Create(ctx, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (s *commentService) ListComments(ctx context.Context, taskID string, page, pageSize int) ([]Comment, int64, error) {
+	ctx, span := tracer.Start(ctx, "todo.CommentService/ListComments")
+	defer span.End()
+	var v validator
+	v.required("task_id", taskID)
+	v.page(page, pageSize, s.limits.MaxPageSize)
+	if err := v.err(); err != nil {
+		return nil, 0, err
+	}
+	if _, err := s.tasks.GetByID(ctx, taskID); err != nil {
+		return nil, 0, err
+	}
+	return s.comments.ListByTask(ctx, taskID, page, pageSize)
+}
+
+func (s *commentService) ListCommentsOf(ctx context.Context, taskIDs []string, limit int) (map[string][]Comment, error) {
+	ctx, span := tracer.Start(ctx, "todo.CommentService/ListCommentsOf")
+	defer span.End()
+	var v validator
+	v.batch("task_ids", taskIDs)
+	if limit < 1 || limit > s.limits.MaxPageSize {
+		v.add("limit", fmt.Sprintf("must be between 1 and %d", s.limits.MaxPageSize))
+	}
+	if err := v.err(); err != nil {
+		return nil, err
+	}
+	return s.comments.ListByTasks(ctx, taskIDs, limit)
+}
+
+func (s *commentService) EditComment(ctx context.Context, taskID, id, body string) (*Comment, error) {
+	ctx, span := tracer.Start(ctx, "todo.CommentService/EditComment")
+	defer span.End()
+	if err := required("task_id", taskID, "id", id); err != nil {
+		return nil, err
+	}
+	body, err := s.checkBody(body)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.tasks.GetByID(ctx, taskID); err != nil {
+		return nil, err
+	}
+	c, err := s.comments.GetByID(ctx, taskID, id)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	c.Body = body
+	c.EditedAt = &now
+	if err := s.comments.Update(ctx, c); err != nil {
+		return nil, err
+	}
+	// Update sets updated_at on the row, not on c
+	return s.comments.GetByID(ctx, taskID, id)
+}
+
+func (s *commentService) DeleteComment(ctx context.Context, taskID, id string) error {
+	ctx, span := tracer.Start(ctx, "todo.CommentService/DeleteComment")
+	defer span.End()
+	if err := required("task_id", taskID, "id", id); err != nil {
+		return err
+	}
+	if _, err := s.tasks.GetByID(ctx, taskID); err != nil {
+		return err
+	}
+	// check existence to return ErrCommentNotFound consistently
+	if _, err := s.comments.GetByID(ctx, taskID, id); err != nil {
+		return err
+	}
+	return s.comments.Delete(ctx, taskID, id)
+}
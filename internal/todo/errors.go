@@ -0,0 +1,97 @@
+package todo
+
+import (
+	"strings"
+	"time"
+)
+
+// Kind classifies a domain error. Transports map kinds to status codes in one
+// place (internal/apierr), so services never deal with gRPC or HTTP codes.
+type Kind int
+
+const (
+	KindInvalid      Kind = iota + 1 // the request itself is malformed
+	KindNotFound                     // a referenced resource doesn't exist
+	KindConflict                     // the resource already exists
+	KindPrecondition                 // the current state doesn't allow the operation
+	KindPermission                   // the caller may not perform the operation
+	KindTooLarge                     // a payload exceeds a configured limit
+	KindRateLimited                  // the caller sent too many requests
+	KindQuota                        // the tenant has used up a quota
+)
+
+// FieldViolation describes one invalid request field. Field uses the public
+// (proto/JSON) field name.
+type FieldViolation struct {
+	Field       string
+	Description string
+}
+
+// Error is the error type raised by the todo services. Reason is a stable
+// UPPER_SNAKE_CASE code clients can branch on; Message is for humans.
+//
+// The package's Err* sentinels are *Error values, so errors.Is works on them
+// as before, and errors.As(err, &*Error) recovers the kind and reason.
+type Error struct {
+	Kind       Kind
+	Reason     string
+	Message    string
+	Violations []FieldViolation
+	// RetryAfter tells a rate-limited caller when to try again.
+	RetryAfter time.Duration
+	// Parent is a more general sentinel this error also matches with
+	// errors.Is, e.g. a missing dependency is also ErrNotFound.
+	Parent error
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Parent
+}
+
+var ErrPermissionDenied = &Error{Kind: KindPermission, Reason: "PERMISSION_DENIED", Message: "permission denied"}
+
+var ErrRateLimited = &Error{Kind: KindRateLimited, Reason: "RATE_LIMITED", Message: "rate limit exceeded"}
+
+// RateLimited returns an error matching ErrRateLimited that asks the caller to
+// wait retryAfter.
+func RateLimited(retryAfter time.Duration) error {
+	return &Error{
+		Kind:       KindRateLimited,
+		Reason:     ErrRateLimited.Reason,
+		Message:    ErrRateLimited.Message,
+		RetryAfter: retryAfter,
+		Parent:     ErrRateLimited,
+	}
+}
+
+// invalidField returns a validation sentinel for a single field.
+func invalidField(reason, field, msg string) *Error {
+	return &Error{
+		Kind:       KindInvalid,
+		Reason:     reason,
+		Message:    msg,
+		Violations: []FieldViolation{{Field: field, Description: msg}},
+	}
+}
+
+// InvalidArgument returns a validation error listing every violation, or nil
+// if there are none.
+func InvalidArgument(violations ...FieldViolation) error {
+	if len(violations) == 0 {
+		return nil
+	}
+	msgs := make([]string, 0, len(violations))
+	for _, v := range violations {
+		msgs = append(msgs, v.Field+" "+v.Description)
+	}
+	return &Error{
+		Kind:       KindInvalid,
+		Reason:     "INVALID_ARGUMENT",
+		Message:    strings.Join(msgs, "; "),
+		Violations: violations,
+	}
+}
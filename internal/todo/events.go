@@ -0,0 +1,127 @@
+package todo
+
+import (
+	"context"
+	"sync"
+)
+
+// EventKind says what happened to a task.
+type EventKind string
+
+const (
+	EventCreated EventKind = "CREATED"
+	EventUpdated EventKind = "UPDATED" // includes completion and restores
+	EventDeleted EventKind = "DELETED"
+)
+
+// TaskEvent reports a write to a task. It carries only the id: subscribers
+// read the task themselves, so they see it as stored.
+type TaskEvent struct {
+	Kind   EventKind
+	TaskID string
+}
+
+// subscriberBuffer is how many events a subscriber may fall behind by
+// before it is dropped.
+const subscriberBuffer = 256
+
+// Broker fans task events out to the subscribers in this process. Writes
+// made by other server instances aren't seen.
+type Broker struct {
+	mu   sync.Mutex
+	subs map[chan TaskEvent]struct{}
+}
+
+func NewBroker() *Broker {
+	return &Broker{subs: map[chan TaskEvent]struct{}{}}
+}
+
+// Subscribe returns a channel of the events published from now on. It is
+// closed when ctx is done, or early, with ctx still live, if the subscriber
+// falls behind: publishing never waits for a slow reader.
+func (b *Broker) Subscribe(ctx context.Context) <-chan TaskEvent {
+	ch := make(chan TaskEvent, subscriberBuffer)
+	b.mu.Lock()
+	b.subs[ch] = struct{}{}
+	b.mu.Unlock()
+	go func() {
+		<-ctx.Done()
+		b.mu.Lock()
+		b.drop(ch)
+		b.mu.Unlock()
+	}()
+	return ch
+}
+
+// drop removes and closes ch unless that has been done. b.mu must be held.
+func (b *Broker) drop(ch chan TaskEvent) {
+	if _, ok := b.subs[ch]; ok {
+		delete(b.subs, ch)
+		close(ch)
+	}
+}
+
+func (b *Broker) Publish(e TaskEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subs {
+		select {
+		case ch <- e:
+		default:
+			b.drop(ch)
+		}
+	}
+}
+
+// publishingRepository publishes an event for every task write that
+// succeeds.
+type publishingRepository struct {
+	Repository
+	events *Broker
+}
+
+// PublishChanges wraps r so task creations, updates, deletions and restores
+// are published to events. Wrapping the repository rather than the service
+// also covers writes the service makes on its own, such as the next
+// occurrence of a recurring task.
+func PublishChanges(r Repository, events *Broker) Repository {
+	return &publishingRepository{Repository: r, events: events}
+}
+
+func (r *publishingRepository) publish(err error, kind EventKind, id string) error {
+	if err == nil {
+		r.events.Publish(TaskEvent{Kind: kind, TaskID: id})
+	}
+	return err
+}
+
+func (r *publishingRepository) Create(ctx context.Context, t *Task) error {
+	err := r.Repository.Create(ctx, t)
+	return r.publish(err, EventCreated, t.ID)
+}
+
+func (r *publishingRepository) Update(ctx context.Context, t *Task, ifSeq int64) error {
+	err := r.Repository.Update(ctx, t, ifSeq)
+	return r.publish(err, EventUpdated, t.ID)
+}
+
+func (r *publishingRepository) Complete(ctx context.Context, t *Task, next *Task, ifSeq int64) (bool, error) {
+	done, err := r.Repository.Complete(ctx, t, next, ifSeq)
+	if done {
+		r.events.Publish(TaskEvent{Kind: EventUpdated, TaskID: t.ID})
+		if next != nil {
+			r.events.Publish(TaskEvent{Kind: EventCreated, TaskID: next.ID})
+		}
+	}
+	return done, err
+}
+
+func (r *publishingRepository) Delete(ctx context.Context, id string) error {
+	err := r.Repository.Delete(ctx, id)
+	return r.publish(err, EventDeleted, id)
+}
+
+func (r *publishingRepository) Restore(ctx context.Context, id string) error {
+	err := r.Repository.Restore(ctx, id)
+	return r.publish(err, EventUpdated, id)
+}
@@ -0,0 +1,100 @@
+package todo
+
+import (
+	"context"
+	"time"
+
+	"github.com/fuzail/08-todosvc/pkg/storage"
+)
+
+var ErrPurgeCutoff = invalidField("DELETED_BEFORE_REQUIRED", "deleted_before", "deleted_before is required")
+
+// purgeBatchSize is how many tasks are purged per transaction.
+const purgeBatchSize = 500
+
+// Stats counts a tenant's tasks, or every tenant's.
+type Stats struct {
+	Tenant          string // empty for all tenants
+	OpenTasks       int64
+	CompletedTasks  int64
+	OverdueTasks    int64 // open and due before now
+	DeletedTasks    int64 // soft-deleted, not yet purged
+	AttachmentBytes int64
+}
+
+// PurgeResult counts what a purge removed for good.
+type PurgeResult struct {
+	Tasks       int64
+	Comments    int64
+	Attachments int64
+}
+
+// MaintenanceRepository defines data access for maintenance jobs.
+type MaintenanceRepository interface {
+	Stats(ctx context.Context, tenant string, now time.Time) (Stats, error)
+	// PurgeTasks permanently removes up to limit tasks soft-deleted before
+	// the cutoff, with their dependencies, comments and attachment metadata.
+	// It returns the storage keys of the attachments removed.
+	PurgeTasks(ctx context.Context, deletedBefore time.Time, limit int) (PurgeResult, []string, error)
+}
+
+// MaintenanceService reports on and cleans up tasks across tenants, for
+// operators rather than end users.
+type MaintenanceService interface {
+	// Stats counts tasks for tenant, or for all tenants if it is empty.
+	Stats(ctx context.Context, tenant string) (*Stats, error)
+	// PurgeDeleted permanently removes tasks soft-deleted before the cutoff,
+	// and everything attached to them. Sync clients that last synced before
+	// the cutoff won't see those deletions. The cutoff is capped at the start
+	// of the current UTC day so purging can't reset daily quotas.
+	PurgeDeleted(ctx context.Context, deletedBefore time.Time) (*PurgeResult, error)
+}
+
+type maintenanceService struct {
+	repo  MaintenanceRepository
+	blobs storage.BlobStore
+	now   func() time.Time
+}
+
+// NewMaintenanceService deletes purged attachments' content from blobs.
+func NewMaintenanceService(r MaintenanceRepository, blobs storage.BlobStore) MaintenanceService {
+	return &maintenanceService{repo: r, blobs: blobs, now: time.Now}
+}
+
+func (s *maintenanceService) Stats(ctx context.Context, tenant string) (*Stats, error) {
+	ctx, span := tracer.Start(ctx, "todo.MaintenanceService/Stats")
+	defer span.End()
+	st, err := s.repo.Stats(ctx, tenant, s.now())
+	if err != nil {
+		return nil, err
+	}
+	return &st, nil
+}
+
+func (s *maintenanceService) PurgeDeleted(ctx context.Context, deletedBefore time.Time) (*PurgeResult, error) {
+	ctx, span := tracer.Start(ctx, "todo.MaintenanceService/PurgeDeleted")
+	defer span.End()
+	if deletedBefore.IsZero() {
+		return nil, ErrPurgeCutoff
+	}
+	if dayStart := s.now().UTC().Truncate(24 * time.Hour); deletedBefore.After(dayStart) {
+		deletedBefore = dayStart
+	}
+	var total PurgeResult
+	for {
+		res, keys, err := s.repo.PurgeTasks(ctx, deletedBefore, purgeBatchSize)
+		if err != nil {
+			return &total, err
+		}
+		total.Tasks += res.Tasks
+		total.Comments += res.Comments
+		total.Attachments += res.Attachments
+		// the metadata is gone; a failure here only leaks storage
+		for _, key := range keys {
+			_ = s.blobs.Delete(ctx, key)
+		}
+		if res.Tasks < purgeBatchSize {
+			return &total, nil
+		}
+	}
+}
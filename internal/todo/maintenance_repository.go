@@ -0,0 +1,90 @@
+package todo
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type gormMaintenanceRepository struct {
+	db *gorm.DB
+}
+
+func NewGormMaintenanceRepository(db *gorm.DB) MaintenanceRepository {
+	return &gormMaintenanceRepository{db: db}
+}
+
+func (r *gormMaintenanceRepository) Stats(ctx context.Context, tenant string, now time.Time) (Stats, error) {
+	st := Stats{Tenant: tenant}
+	// tasks of the tenant, deleted ones included
+	tasks := func() *gorm.DB {
+		q := r.db.WithContext(ctx).Unscoped().Model(&Task{})
+		if tenant != "" {
+			q = q.Where("tenant = ?", tenant)
+		}
+		return q
+	}
+	for _, c := range []struct {
+		n     *int64
+		where string
+		args  []interface{}
+	}{
+		{&st.OpenTasks, "deleted_at IS NULL AND completed = ?", []interface{}{false}},
+		{&st.CompletedTasks, "deleted_at IS NULL AND completed = ?", []interface{}{true}},
+		{&st.OverdueTasks, "deleted_at IS NULL AND completed = ? AND due_at < ?", []interface{}{false, now}},
+		{&st.DeletedTasks, "deleted_at IS NOT NULL", nil},
+	} {
+		if err := tasks().Where(c.where, c.args...).Count(c.n).Error; err != nil {
+			return st, fmt.Errorf("task stats: %w", err)
+		}
+	}
+	q := r.db.WithContext(ctx).Model(&Attachment{}).Joins("JOIN tasks ON tasks.id = attachments.task_id")
+	if tenant != "" {
+		q = q.Where("tasks.tenant = ?", tenant)
+	}
+	if err := q.Select("COALESCE(SUM(attachments.size), 0)").Scan(&st.AttachmentBytes).Error; err != nil {
+		return st, fmt.Errorf("sum attachment bytes: %w", err)
+	}
+	return st, nil
+}
+
+func (r *gormMaintenanceRepository) PurgeTasks(ctx context.Context, deletedBefore time.Time, limit int) (PurgeResult, []string, error) {
+	var res PurgeResult
+	var keys []string
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var ids []string
+		if err := tx.Unscoped().Model(&Task{}).Where("deleted_at < ?", deletedBefore).
+			Order("deleted_at").Limit(limit).Pluck("id", &ids).Error; err != nil {
+			return fmt.Errorf("find purgeable tasks: %w", err)
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+		if err := tx.Unscoped().Model(&Attachment{}).Where("task_id IN ?", ids).Pluck("storage_key", &keys).Error; err != nil {
+			return fmt.Errorf("find attachments: %w", err)
+		}
+		del := tx.Unscoped().Where("task_id IN ?", ids).Delete(&Attachment{})
+		if del.Error != nil {
+			return fmt.Errorf("purge attachments: %w", del.Error)
+		}
+		res.Attachments = del.RowsAffected
+		if del = tx.Unscoped().Where("task_id IN ?", ids).Delete(&Comment{}); del.Error != nil {
+			return fmt.Errorf("purge comments: %w", del.Error)
+		}
+		res.Comments = del.RowsAffected
+		if err := tx.Where("task_id IN ? OR blocked_by_id IN ?", ids, ids).Delete(&Dependency{}).Error; err != nil {
+			return fmt.Errorf("purge dependencies: %w", err)
+		}
+		if del = tx.Unscoped().Where("id IN ?", ids).Delete(&Task{}); del.Error != nil {
+			return fmt.Errorf("purge tasks: %w", del.Error)
+		}
+		res.Tasks = del.RowsAffected
+		return nil
+	})
+	if err != nil {
+		return PurgeResult{}, nil, err
+	}
+	return res, keys, nil
+}
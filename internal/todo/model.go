@@ -9,19 +9,117 @@ import (
 
 // Task is the domain and GORM model for todo tasks.
 type Task struct {
+	ID          string     `gorm:"primaryKey;type:uuid"`
+	Title       string     `gorm:"type:text;not null"`
+	Description string     `gorm:"type:text"`
+	Completed   bool       `gorm:"not null;default:false"`
+	DueAt       *time.Time `gorm:"index"`
+
+	// Recurrence is an RRULE (see ParseRule). Only the newest occurrence of a
+	// series carries it; completing that occurrence creates the next one.
+	Recurrence string `gorm:"type:text"`
+	SeriesID   string `gorm:"type:text;index"`    // ID of the first occurrence
+	Occurrence int    `gorm:"not null;default:0"` // 1-based position in the series
+
+	// Tenant owns the task and its quota usage (see QuotaService).
+	Tenant string `gorm:"type:text;not null;default:'default';index"`
+
+	// ChangeSeq orders writes for sync: every write takes the next value of
+	// the ChangeCounter. Rows written before it existed have 0.
+	ChangeSeq int64 `gorm:"not null;default:0;index"`
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+}
+
+// BeforeCreate hook to populate UUID. Generated IDs are UUIDv7 so they sort by
+// creation time.
+func (t *Task) BeforeCreate(tx *gorm.DB) (err error) {
+	if t.ID == "" {
+		id, err := uuid.NewV7()
+		if err != nil {
+			return err
+		}
+		t.ID = id.String()
+	}
+	// a recurring task created on its own starts a new series
+	if t.Recurrence != "" && t.SeriesID == "" {
+		t.SeriesID = t.ID
+		t.Occurrence = 1
+	}
+	return nil
+}
+
+// ChangeCounter is the single-row counter Task.ChangeSeq values are taken
+// from.
+type ChangeCounter struct {
+	ID    int   `gorm:"primaryKey;autoIncrement:false"`
+	Value int64 `gorm:"not null;default:0"`
+}
+
+func (ChangeCounter) TableName() string {
+	return "task_change_counter"
+}
+
+// Dependency records that TaskID is blocked by BlockedByID until the blocker
+// is completed. The graph is kept acyclic by the service.
+type Dependency struct {
+	TaskID      string `gorm:"primaryKey;type:uuid"`
+	BlockedByID string `gorm:"primaryKey;type:uuid;index"`
+	CreatedAt   time.Time
+}
+
+func (Dependency) TableName() string {
+	return "task_dependencies"
+}
+
+// Comment is a note in a task's discussion thread.
+type Comment struct {
+	ID        string `gorm:"primaryKey;type:uuid"`
+	TaskID    string `gorm:"type:uuid;not null;index"`
+	Author    string `gorm:"type:text;not null"`
+	Body      string `gorm:"type:text;not null"`
+	EditedAt  *time.Time
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+}
+
+// BeforeCreate hook to populate UUID
+func (c *Comment) BeforeCreate(tx *gorm.DB) (err error) {
+	if c.ID == "" {
+		id, err := uuid.NewV7()
+		if err != nil {
+			return err
+		}
+		c.ID = id.String()
+	}
+	return nil
+}
+
+// Attachment is the metadata of a file attached to a task. The bytes live in
+// a storage.BlobStore under StorageKey.
+type Attachment struct {
 	ID          string `gorm:"primaryKey;type:uuid"`
-	Title       string `gorm:"type:text;not null"`
-	Description string `gorm:"type:text"`
-	Completed   bool   `gorm:"not null;default:false"`
+	TaskID      string `gorm:"type:uuid;not null;index"`
+	Name        string `gorm:"type:text;not null"`
+	Size        int64  `gorm:"not null"`
+	ContentType string `gorm:"type:text;not null"`
+	Checksum    string `gorm:"type:text;not null"` // hex sha256 of the content
+	StorageKey  string `gorm:"type:text;not null"`
 	CreatedAt   time.Time
-	UpdatedAt   time.Time
 	DeletedAt   gorm.DeletedAt `gorm:"index"`
 }
 
 // BeforeCreate hook to populate UUID
-func (t *Task) BeforeCreate(tx *gorm.DB) (err error) {
-	if t.ID == "" {
-		t.ID = uuid.NewString()
+func (a *Attachment) BeforeCreate(tx *gorm.DB) (err error) {
+	if a.ID == "" {
+		id, err := uuid.NewV7()
+		if err != nil {
+			return err
+		}
+		a.ID = id.String()
 	}
 	return nil
 }
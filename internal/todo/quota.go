@@ -0,0 +1,221 @@
+package todo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/fuzail/08-todosvc/internal/reqctx"
+)
+
+// DefaultTenant owns tasks created without a tenant, such as by callers
+// without a tenant of their own (see auth.Policy.Tenant).
+const DefaultTenant = "default"
+
+// tenantOf returns the tenant a request acts for.
+func tenantOf(ctx context.Context) string {
+	if t := reqctx.Tenant(ctx); t != "" {
+		return t
+	}
+	return DefaultTenant
+}
+
+// ErrQuotaExceeded is matched by every quota error; errors.As gives the
+// quota in Violations[0].Field.
+var ErrQuotaExceeded = &Error{Kind: KindQuota, Reason: "QUOTA_EXCEEDED", Message: "tenant quota exceeded"}
+
+func quotaExceeded(tenant, quota string, limit int64) error {
+	msg := fmt.Sprintf("tenant %q has reached its %s quota of %d", tenant, quota, limit)
+	return &Error{
+		Kind:       KindQuota,
+		Reason:     ErrQuotaExceeded.Reason,
+		Message:    msg,
+		Violations: []FieldViolation{{Field: quota, Description: msg}},
+		Parent:     ErrQuotaExceeded,
+	}
+}
+
+// Quota caps what a tenant may store. Zero means unlimited.
+type Quota struct {
+	Tenant             string `gorm:"primaryKey;type:text"`
+	MaxOpenTasks       int64  `gorm:"not null;default:0"` // incomplete, not deleted
+	MaxTasksPerDay     int64  `gorm:"not null;default:0"` // created since 00:00 UTC, deleted ones included
+	MaxAttachmentBytes int64  `gorm:"not null;default:0"` // total size of attachments
+	UpdatedAt          time.Time
+}
+
+func (Quota) TableName() string {
+	return "tenant_quotas"
+}
+
+// Usage is what a tenant currently counts against its quota.
+type Usage struct {
+	OpenTasks       int64
+	TasksToday      int64
+	AttachmentBytes int64
+}
+
+// QuotaRepository defines data access for quotas and usage.
+type QuotaRepository interface {
+	// GetQuota returns ErrQuotaNotSet if the tenant has no quota of its own.
+	GetQuota(ctx context.Context, tenant string) (*Quota, error)
+	SetQuota(ctx context.Context, q *Quota) error // create or replace
+	Usage(ctx context.Context, tenant string, dayStart time.Time) (Usage, error)
+}
+
+var ErrQuotaNotSet = &Error{Kind: KindNotFound, Reason: "QUOTA_NOT_SET", Message: "tenant has no quota of its own"}
+
+// QuotaService reads and sets per-tenant quotas and enforces them for the
+// other services. Tenants without a quota of their own get the defaults.
+//
+// Checks count current usage and then act, so concurrent requests from one
+// tenant can overshoot a quota by a few tasks or one attachment.
+type QuotaService interface {
+	// GetQuota returns the quota in effect for tenant.
+	GetQuota(ctx context.Context, tenant string) (*Quota, error)
+	SetQuota(ctx context.Context, q Quota) (*Quota, error)
+	GetUsage(ctx context.Context, tenant string) (Usage, error)
+
+	// CheckTask fails with ErrQuotaExceeded if tenant can't create another
+	// task; open tells whether it counts as an open task.
+	CheckTask(ctx context.Context, tenant string, open bool) error
+	// CheckOpenTask fails with ErrQuotaExceeded if tenant can't have another
+	// open task, for tasks that become open again without being created,
+	// such as restored ones.
+	CheckOpenTask(ctx context.Context, tenant string) error
+	// CheckAttachment fails with ErrQuotaExceeded if tenant can't store size
+	// more attachment bytes.
+	CheckAttachment(ctx context.Context, tenant string, size int64) error
+	// AttachmentRoom returns how many more attachment bytes tenant may
+	// store, or -1 if it has no limit. It fails with ErrQuotaExceeded if
+	// there is no room left.
+	AttachmentRoom(ctx context.Context, tenant string) (int64, error)
+}
+
+type quotaService struct {
+	repo     QuotaRepository
+	defaults Quota
+	now      func() time.Time
+}
+
+// NewQuotaService applies defaults to tenants without a quota of their own.
+func NewQuotaService(r QuotaRepository, defaults Quota) QuotaService {
+	return &quotaService{repo: r, defaults: defaults, now: time.Now}
+}
+
+func (s *quotaService) GetQuota(ctx context.Context, tenant string) (*Quota, error) {
+	if err := required("tenant", tenant); err != nil {
+		return nil, err
+	}
+	q, err := s.repo.GetQuota(ctx, tenant)
+	if errors.Is(err, ErrQuotaNotSet) {
+		q := s.defaults
+		q.Tenant = tenant
+		return &q, nil
+	}
+	return q, err
+}
+
+func (s *quotaService) SetQuota(ctx context.Context, q Quota) (*Quota, error) {
+	ctx, span := tracer.Start(ctx, "todo.QuotaService/SetQuota")
+	defer span.End()
+	var v validator
+	v.required("tenant", q.Tenant)
+	for _, f := range []struct {
+		name  string
+		value int64
+	}{
+		{"max_open_tasks", q.MaxOpenTasks},
+		{"max_tasks_per_day", q.MaxTasksPerDay},
+		{"max_attachment_bytes", q.MaxAttachmentBytes},
+	} {
+		if f.value < 0 {
+			v.add(f.name, "must not be negative")
+		}
+	}
+	if err := v.err(); err != nil {
+		return nil, err
+	}
+	if err := s.repo.SetQuota(ctx, &q); err != nil {
+		return nil, err
+	}
+	return &q, nil
+}
+
+func (s *quotaService) GetUsage(ctx context.Context, tenant string) (Usage, error) {
+	if err := required("tenant", tenant); err != nil {
+		return Usage{}, err
+	}
+	return s.repo.Usage(ctx, tenant, s.dayStart())
+}
+
+func (s *quotaService) dayStart() time.Time {
+	return s.now().UTC().Truncate(24 * time.Hour)
+}
+
+func (s *quotaService) CheckTask(ctx context.Context, tenant string, open bool) error {
+	q, err := s.GetQuota(ctx, tenant)
+	if err != nil || (q.MaxTasksPerDay == 0 && (q.MaxOpenTasks == 0 || !open)) {
+		return err
+	}
+	u, err := s.repo.Usage(ctx, tenant, s.dayStart())
+	if err != nil {
+		return err
+	}
+	if q.MaxTasksPerDay > 0 && u.TasksToday >= q.MaxTasksPerDay {
+		return quotaExceeded(tenant, "max_tasks_per_day", q.MaxTasksPerDay)
+	}
+	if open && q.MaxOpenTasks > 0 && u.OpenTasks >= q.MaxOpenTasks {
+		return quotaExceeded(tenant, "max_open_tasks", q.MaxOpenTasks)
+	}
+	return nil
+}
+
+func (s *quotaService) CheckOpenTask(ctx context.Context, tenant string) error {
+	q, err := s.GetQuota(ctx, tenant)
+	if err != nil || q.MaxOpenTasks == 0 {
+		return err
+	}
+	u, err := s.repo.Usage(ctx, tenant, s.dayStart())
+	if err != nil {
+		return err
+	}
+	if u.OpenTasks >= q.MaxOpenTasks {
+		return quotaExceeded(tenant, "max_open_tasks", q.MaxOpenTasks)
+	}
+	return nil
+}
+
+func (s *quotaService) CheckAttachment(ctx context.Context, tenant string, size int64) error {
+	q, err := s.GetQuota(ctx, tenant)
+	if err != nil || q.MaxAttachmentBytes == 0 {
+		return err
+	}
+	u, err := s.repo.Usage(ctx, tenant, s.dayStart())
+	if err != nil {
+		return err
+	}
+	if u.AttachmentBytes+size > q.MaxAttachmentBytes {
+		return quotaExceeded(tenant, "max_attachment_bytes", q.MaxAttachmentBytes)
+	}
+	return nil
+}
+
+func (s *quotaService) AttachmentRoom(ctx context.Context, tenant string) (int64, error) {
+	q, err := s.GetQuota(ctx, tenant)
+	if err != nil {
+		return 0, err
+	}
+	if q.MaxAttachmentBytes == 0 {
+		return -1, nil
+	}
+	u, err := s.repo.Usage(ctx, tenant, s.dayStart())
+	if err != nil {
+		return 0, err
+	}
+	if u.AttachmentBytes >= q.MaxAttachmentBytes {
+		return 0, quotaExceeded(tenant, "max_attachment_bytes", q.MaxAttachmentBytes)
+	}
+	return q.MaxAttachmentBytes - u.AttachmentBytes, nil
+}
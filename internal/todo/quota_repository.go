@@ -0,0 +1,61 @@
+package todo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type gormQuotaRepository struct {
+	db *gorm.DB
+}
+
+func NewGormQuotaRepository(db *gorm.DB) QuotaRepository {
+	return &gormQuotaRepository{db: db}
+}
+
+func (r *gormQuotaRepository) GetQuota(ctx context.Context, tenant string) (*Quota, error) {
+	var q Quota
+	if err := r.db.WithContext(ctx).First(&q, "tenant = ?", tenant).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrQuotaNotSet
+		}
+		return nil, fmt.Errorf("get quota: %w", err)
+	}
+	return &q, nil
+}
+
+func (r *gormQuotaRepository) SetQuota(ctx context.Context, q *Quota) error {
+	q.UpdatedAt = time.Now()
+	err := r.db.WithContext(ctx).Clauses(clause.OnConflict{UpdateAll: true}).Create(q).Error
+	if err != nil {
+		return fmt.Errorf("set quota: %w", err)
+	}
+	return nil
+}
+
+func (r *gormQuotaRepository) Usage(ctx context.Context, tenant string, dayStart time.Time) (Usage, error) {
+	var u Usage
+	db := r.db.WithContext(ctx)
+	if err := db.Model(&Task{}).Where("tenant = ? AND completed = ?", tenant, false).Count(&u.OpenTasks).Error; err != nil {
+		return u, fmt.Errorf("count open tasks: %w", err)
+	}
+	// deleted tasks count too, or deleting junk would reset the daily quota
+	if err := db.Unscoped().Model(&Task{}).Where("tenant = ? AND created_at >= ?", tenant, dayStart).Count(&u.TasksToday).Error; err != nil {
+		return u, fmt.Errorf("count tasks today: %w", err)
+	}
+	// attachments of deleted tasks count until the tasks are purged: their
+	// content is still stored, and sync can restore them
+	err := db.Model(&Attachment{}).
+		Joins("JOIN tasks ON tasks.id = attachments.task_id").
+		Where("tasks.tenant = ?", tenant).
+		Select("COALESCE(SUM(attachments.size), 0)").Scan(&u.AttachmentBytes).Error
+	if err != nil {
+		return u, fmt.Errorf("sum attachment bytes: %w", err)
+	}
+	return u, nil
+}
@@ -4,19 +4,68 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
-var ErrNotFound = errors.New("task not found")
+var (
+	ErrNotFound      = &Error{Kind: KindNotFound, Reason: "TASK_NOT_FOUND", Message: "task not found"}
+	ErrAlreadyExists = &Error{Kind: KindConflict, Reason: "TASK_ALREADY_EXISTS", Message: "task already exists"}
+	ErrInvalidID     = invalidField("INVALID_ID", "id", "task id must be a uuid")
+	// ErrDependencyNotFound also matches ErrNotFound.
+	ErrDependencyNotFound = &Error{Kind: KindNotFound, Reason: "DEPENDENCY_NOT_FOUND", Message: "dependency not found", Parent: ErrNotFound}
+)
+
+// ListFilter narrows List results by blocker state. Both variants only match
+// open tasks; a blocker counts while it is open and not deleted.
+type ListFilter string
+
+const (
+	FilterAll     ListFilter = ""
+	FilterReady   ListFilter = "ready"   // no open blockers
+	FilterBlocked ListFilter = "blocked" // at least one open blocker
+)
+
+// openBlockersSQL matches tasks with at least one open blocker.
+const openBlockersSQL = `EXISTS (SELECT 1 FROM task_dependencies d JOIN tasks b ON b.id = d.blocked_by_id
+	WHERE d.task_id = tasks.id AND b.completed = ? AND b.deleted_at IS NULL)`
 
 // Repository defines data access operations for tasks.
 type Repository interface {
 	Create(ctx context.Context, t *Task) error
 	GetByID(ctx context.Context, id string) (*Task, error)
-	List(ctx context.Context, page, pageSize int) ([]Task, int64, error) // returns items, total
-	Update(ctx context.Context, t *Task) error
+	GetByIDs(ctx context.Context, ids []string) ([]Task, error)                             // the ones that exist, in no order
+	List(ctx context.Context, page, pageSize int, filter ListFilter) ([]Task, int64, error) // returns items, total
+	// Update writes t. If ifSeq isn't 0, it only does so if the stored task
+	// is still at that ChangeSeq, and returns ErrTaskModified otherwise.
+	Update(ctx context.Context, t *Task, ifSeq int64) error
+	// Complete is Update for t being completed, and creates next, the
+	// following occurrence of its series, unless it is nil. Both happen in
+	// one transaction and only if t is still open in the database;
+	// otherwise nothing is written and Complete reports false. With an ifSeq
+	// other than 0, a task written since returns ErrTaskModified instead.
+	Complete(ctx context.Context, t *Task, next *Task, ifSeq int64) (bool, error)
 	Delete(ctx context.Context, id string) error
+	GetSeriesHead(ctx context.Context, seriesID string) (*Task, error) // newest occurrence
+
+	AddDependency(ctx context.Context, taskID, blockedByID string) error
+	RemoveDependency(ctx context.Context, taskID, blockedByID string) error
+	ListBlockers(ctx context.Context, taskID string) ([]Task, error) // includes completed blockers
+	ListBlockerIDs(ctx context.Context, taskID string) ([]string, error)
+	// ListBlockersOf is ListBlockers for several tasks in one query, keyed
+	// by task id; tasks without blockers are left out.
+	ListBlockersOf(ctx context.Context, taskIDs []string) (map[string][]Task, error)
+
+	// sync support; these include soft-deleted rows
+	GetAnyByID(ctx context.Context, id string) (*Task, error)
+	Restore(ctx context.Context, id string) error
+	ListChanges(ctx context.Context, since SyncCursor, limit int) ([]Task, error) // ordered by change_seq, id
+
+	// Iterate calls fn with every task in id order, reading batchSize rows
+	// at a time.
+	Iterate(ctx context.Context, batchSize int, fn func(*Task) error) error
 }
 
 type gormRepository struct {
@@ -28,12 +77,51 @@ func NewGormRepository(db *gorm.DB) Repository {
 }
 
 func (r *gormRepository) Create(ctx context.Context, t *Task) error {
-	if err := r.db.WithContext(ctx).Create(t).Error; err != nil {
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		seq, err := nextChangeSeq(tx)
+		if err != nil {
+			return err
+		}
+		t.ChangeSeq = seq
+		return tx.Create(t).Error
+	})
+	if err != nil {
+		// requires gorm.Config{TranslateError: true}
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return ErrAlreadyExists
+		}
 		return fmt.Errorf("create task: %w", err)
 	}
 	return nil
 }
 
+// nextChangeSeq takes the next value of the change counter for a write in
+// tx. The counter row stays locked until tx ends, so writes commit in the
+// order of their values and ListChanges never passes over one that commits
+// late.
+func nextChangeSeq(tx *gorm.DB) (int64, error) {
+	bump := func() (int64, error) {
+		res := tx.Model(&ChangeCounter{}).Where("id = ?", 1).Update("value", gorm.Expr("value + 1"))
+		return res.RowsAffected, res.Error
+	}
+	n, err := bump()
+	if err == nil && n == 0 {
+		// first write to the database
+		err = tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&ChangeCounter{ID: 1}).Error
+		if err == nil {
+			_, err = bump()
+		}
+	}
+	if err != nil {
+		return 0, fmt.Errorf("bump change counter: %w", err)
+	}
+	var c ChangeCounter
+	if err := tx.First(&c, 1).Error; err != nil {
+		return 0, fmt.Errorf("read change counter: %w", err)
+	}
+	return c.Value, nil
+}
+
 func (r *gormRepository) GetByID(ctx context.Context, id string) (*Task, error) {
 	var t Task
 	if err := r.db.WithContext(ctx).First(&t, "id = ?", id).Error; err != nil {
@@ -45,7 +133,18 @@ func (r *gormRepository) GetByID(ctx context.Context, id string) (*Task, error)
 	return &t, nil
 }
 
-func (r *gormRepository) List(ctx context.Context, page, pageSize int) ([]Task, int64, error) {
+func (r *gormRepository) GetByIDs(ctx context.Context, ids []string) ([]Task, error) {
+	var tasks []Task
+	if len(ids) == 0 {
+		return tasks, nil
+	}
+	if err := r.db.WithContext(ctx).Where("id IN ?", ids).Find(&tasks).Error; err != nil {
+		return nil, fmt.Errorf("get by ids: %w", err)
+	}
+	return tasks, nil
+}
+
+func (r *gormRepository) List(ctx context.Context, page, pageSize int, filter ListFilter) ([]Task, int64, error) {
 	if page < 1 {
 		page = 1
 	}
@@ -55,6 +154,12 @@ func (r *gormRepository) List(ctx context.Context, page, pageSize int) ([]Task,
 	var tasks []Task
 	var total int64
 	q := r.db.WithContext(ctx).Model(&Task{})
+	switch filter {
+	case FilterReady:
+		q = q.Where("completed = ?", false).Where("NOT "+openBlockersSQL, false)
+	case FilterBlocked:
+		q = q.Where("completed = ?", false).Where(openBlockersSQL, false)
+	}
 	if err := q.Count(&total).Error; err != nil {
 		return nil, 0, fmt.Errorf("count tasks: %w", err)
 	}
@@ -65,24 +170,247 @@ func (r *gormRepository) List(ctx context.Context, page, pageSize int) ([]Task,
 	return tasks, total, nil
 }
 
-func (r *gormRepository) Update(ctx context.Context, t *Task) error {
-	// Save updates UpdatedAt automatically
-	if err := r.db.WithContext(ctx).Model(&Task{}).Where("id = ?", t.ID).Updates(map[string]interface{}{
-		"title":       t.Title,
-		"description": t.Description,
-		"completed":   t.Completed,
-	}).Error; err != nil {
+func (r *gormRepository) Update(ctx context.Context, t *Task, ifSeq int64) error {
+	if err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		seq, err := nextChangeSeq(tx)
+		if err != nil {
+			return err
+		}
+		q := tx.Model(&Task{}).Where("id = ?", t.ID)
+		if ifSeq != 0 {
+			q = q.Where("change_seq = ?", ifSeq)
+		}
+		// Updates sets UpdatedAt automatically
+		res := q.Updates(map[string]interface{}{
+			"title":       t.Title,
+			"description": t.Description,
+			"completed":   t.Completed,
+			"due_at":      t.DueAt,
+			"recurrence":  t.Recurrence,
+			"series_id":   t.SeriesID,
+			"occurrence":  t.Occurrence,
+			"change_seq":  seq,
+		})
+		if res.Error == nil && res.RowsAffected == 0 && ifSeq != 0 {
+			return ErrTaskModified
+		}
+		return res.Error
+	}); err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return ErrNotFound
 		}
+		if errors.Is(err, ErrTaskModified) {
+			return err
+		}
 		return fmt.Errorf("update task: %w", err)
 	}
 	return nil
 }
 
+func (r *gormRepository) Complete(ctx context.Context, t *Task, next *Task, ifSeq int64) (bool, error) {
+	done := false
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		seq, err := nextChangeSeq(tx)
+		if err != nil {
+			return err
+		}
+		q := tx.Model(&Task{}).Where("id = ? AND completed = ?", t.ID, false)
+		if ifSeq != 0 {
+			q = q.Where("change_seq = ?", ifSeq)
+		}
+		res := q.Updates(map[string]interface{}{
+			"title":       t.Title,
+			"description": t.Description,
+			"completed":   true,
+			"due_at":      t.DueAt,
+			"recurrence":  t.Recurrence,
+			"series_id":   t.SeriesID,
+			"occurrence":  t.Occurrence,
+			"change_seq":  seq,
+		})
+		if res.Error == nil && res.RowsAffected == 0 && ifSeq != 0 {
+			return ErrTaskModified
+		}
+		if res.Error != nil || res.RowsAffected == 0 {
+			// someone else completed it first
+			return res.Error
+		}
+		done = true
+		if next == nil {
+			return nil
+		}
+		if next.ChangeSeq, err = nextChangeSeq(tx); err != nil {
+			return err
+		}
+		return tx.Create(next).Error
+	})
+	if errors.Is(err, ErrTaskModified) {
+		return false, err
+	}
+	if err != nil {
+		return false, fmt.Errorf("complete task: %w", err)
+	}
+	return done, nil
+}
+
 func (r *gormRepository) Delete(ctx context.Context, id string) error {
-	if err := r.db.WithContext(ctx).Where("id = ?", id).Delete(&Task{}).Error; err != nil {
+	// soft delete, bumping updated_at and the change seq so the tombstone
+	// shows up in ListChanges
+	if err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		seq, err := nextChangeSeq(tx)
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		return tx.Model(&Task{}).Where("id = ?", id).Updates(map[string]interface{}{
+			"deleted_at": now,
+			"updated_at": now,
+			"change_seq": seq,
+		}).Error
+	}); err != nil {
 		return fmt.Errorf("delete task: %w", err)
 	}
 	return nil
 }
+
+func (r *gormRepository) GetSeriesHead(ctx context.Context, seriesID string) (*Task, error) {
+	var t Task
+	if err := r.db.WithContext(ctx).Where("series_id = ?", seriesID).Order("occurrence desc").First(&t).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("get series head: %w", err)
+	}
+	return &t, nil
+}
+
+func (r *gormRepository) GetAnyByID(ctx context.Context, id string) (*Task, error) {
+	var t Task
+	if err := r.db.WithContext(ctx).Unscoped().First(&t, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("get any by id: %w", err)
+	}
+	return &t, nil
+}
+
+func (r *gormRepository) Restore(ctx context.Context, id string) error {
+	if err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		seq, err := nextChangeSeq(tx)
+		if err != nil {
+			return err
+		}
+		return tx.Unscoped().Model(&Task{}).Where("id = ?", id).Updates(map[string]interface{}{
+			"deleted_at": nil,
+			"updated_at": time.Now(),
+			"change_seq": seq,
+		}).Error
+	}); err != nil {
+		return fmt.Errorf("restore task: %w", err)
+	}
+	return nil
+}
+
+func (r *gormRepository) ListChanges(ctx context.Context, since SyncCursor, limit int) ([]Task, error) {
+	var tasks []Task
+	q := r.db.WithContext(ctx).Unscoped().Model(&Task{})
+	if since != (SyncCursor{}) {
+		q = q.Where("change_seq > ? OR (change_seq = ? AND id > ?)", since.Seq, since.Seq, since.ID)
+	}
+	if err := q.Order("change_seq asc, id asc").Limit(limit).Find(&tasks).Error; err != nil {
+		return nil, fmt.Errorf("list changes: %w", err)
+	}
+	return tasks, nil
+}
+
+func (r *gormRepository) Iterate(ctx context.Context, batchSize int, fn func(*Task) error) error {
+	// keyset pagination, so each batch is an index range scan however deep
+	after := ""
+	for {
+		var tasks []Task
+		q := r.db.WithContext(ctx)
+		if after != "" {
+			// not on the first batch: "" isn't a valid uuid on Postgres
+			q = q.Where("id > ?", after)
+		}
+		if err := q.Order("id asc").Limit(batchSize).Find(&tasks).Error; err != nil {
+			return fmt.Errorf("iterate tasks: %w", err)
+		}
+		for i := range tasks {
+			if err := fn(&tasks[i]); err != nil {
+				return err
+			}
+		}
+		if len(tasks) < batchSize {
+			return nil
+		}
+		after = tasks[len(tasks)-1].ID
+	}
+}
+
+func (r *gormRepository) AddDependency(ctx context.Context, taskID, blockedByID string) error {
+	dep := &Dependency{TaskID: taskID, BlockedByID: blockedByID}
+	if err := r.db.WithContext(ctx).Create(dep).Error; err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			// already recorded; adding is idempotent
+			return nil
+		}
+		return fmt.Errorf("add dependency: %w", err)
+	}
+	return nil
+}
+
+func (r *gormRepository) RemoveDependency(ctx context.Context, taskID, blockedByID string) error {
+	res := r.db.WithContext(ctx).Where("task_id = ? AND blocked_by_id = ?", taskID, blockedByID).Delete(&Dependency{})
+	if res.Error != nil {
+		return fmt.Errorf("remove dependency: %w", res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return ErrDependencyNotFound
+	}
+	return nil
+}
+
+func (r *gormRepository) ListBlockers(ctx context.Context, taskID string) ([]Task, error) {
+	var tasks []Task
+	if err := r.db.WithContext(ctx).
+		Joins("JOIN task_dependencies d ON d.blocked_by_id = tasks.id").
+		Where("d.task_id = ?", taskID).
+		Order("d.created_at asc").
+		Find(&tasks).Error; err != nil {
+		return nil, fmt.Errorf("list blockers: %w", err)
+	}
+	return tasks, nil
+}
+
+func (r *gormRepository) ListBlockersOf(ctx context.Context, taskIDs []string) (map[string][]Task, error) {
+	blockers := map[string][]Task{}
+	if len(taskIDs) == 0 {
+		return blockers, nil
+	}
+	var rows []struct {
+		Task
+		BlockedTaskID string
+	}
+	if err := r.db.WithContext(ctx).Model(&Task{}).
+		Select("tasks.*, d.task_id AS blocked_task_id").
+		Joins("JOIN task_dependencies d ON d.blocked_by_id = tasks.id").
+		Where("d.task_id IN ?", taskIDs).
+		Order("d.created_at asc").
+		Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("list blockers of: %w", err)
+	}
+	for _, row := range rows {
+		blockers[row.BlockedTaskID] = append(blockers[row.BlockedTaskID], row.Task)
+	}
+	return blockers, nil
+}
+
+func (r *gormRepository) ListBlockerIDs(ctx context.Context, taskID string) ([]string, error) {
+	var ids []string
+	if err := r.db.WithContext(ctx).Model(&Dependency{}).Where("task_id = ?", taskID).Pluck("blocked_by_id", &ids).Error; err != nil {
+		return nil, fmt.Errorf("list blocker ids: %w", err)
+	}
+	return ids, nil
+}
@@ -0,0 +1,171 @@
+package todo
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidRecurrence = invalidField("INVALID_RECURRENCE", "recurrence", "invalid recurrence rule")
+
+// Frequency is the RRULE FREQ part. Only the subset below is supported.
+type Frequency string
+
+const (
+	Daily   Frequency = "DAILY"
+	Weekly  Frequency = "WEEKLY"
+	Monthly Frequency = "MONTHLY"
+)
+
+// Rule is a parsed RFC 5545 RRULE subset: FREQ (DAILY, WEEKLY, MONTHLY),
+// INTERVAL, BYDAY (plain weekdays, DAILY and WEEKLY only), COUNT and UNTIL.
+// The first occurrence is the task's due date, the way DTSTART would be.
+type Rule struct {
+	Freq     Frequency
+	Interval int
+	ByDay    []time.Weekday
+	Count    int       // total occurrences, 0 = unbounded
+	Until    time.Time // last allowed due date, zero = unbounded
+}
+
+var weekdays = map[string]time.Weekday{
+	"SU": time.Sunday, "MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday,
+	"TH": time.Thursday, "FR": time.Friday, "SA": time.Saturday,
+}
+
+// ParseRule parses an RRULE value such as "FREQ=WEEKLY;BYDAY=MO,WE;COUNT=10".
+// A leading "RRULE:" is accepted.
+func ParseRule(s string) (*Rule, error) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "RRULE:")
+	r := &Rule{Interval: 1}
+	for _, part := range strings.Split(s, ";") {
+		key, val, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidRecurrence, part)
+		}
+		switch strings.ToUpper(key) {
+		case "FREQ":
+			switch f := Frequency(strings.ToUpper(val)); f {
+			case Daily, Weekly, Monthly:
+				r.Freq = f
+			default:
+				return nil, fmt.Errorf("%w: unsupported FREQ %q", ErrInvalidRecurrence, val)
+			}
+		case "INTERVAL":
+			i, err := strconv.Atoi(val)
+			if err != nil || i < 1 {
+				return nil, fmt.Errorf("%w: INTERVAL %q", ErrInvalidRecurrence, val)
+			}
+			r.Interval = i
+		case "BYDAY":
+			for _, d := range strings.Split(val, ",") {
+				wd, ok := weekdays[strings.ToUpper(d)]
+				if !ok {
+					return nil, fmt.Errorf("%w: BYDAY %q", ErrInvalidRecurrence, d)
+				}
+				r.ByDay = append(r.ByDay, wd)
+			}
+		case "COUNT":
+			c, err := strconv.Atoi(val)
+			if err != nil || c < 1 {
+				return nil, fmt.Errorf("%w: COUNT %q", ErrInvalidRecurrence, val)
+			}
+			r.Count = c
+		case "UNTIL":
+			t, err := parseUntil(val)
+			if err != nil {
+				return nil, fmt.Errorf("%w: UNTIL %q", ErrInvalidRecurrence, val)
+			}
+			r.Until = t
+		default:
+			return nil, fmt.Errorf("%w: unsupported part %q", ErrInvalidRecurrence, key)
+		}
+	}
+	if r.Freq == "" {
+		return nil, fmt.Errorf("%w: FREQ is required", ErrInvalidRecurrence)
+	}
+	if r.Count > 0 && !r.Until.IsZero() {
+		return nil, fmt.Errorf("%w: COUNT and UNTIL are exclusive", ErrInvalidRecurrence)
+	}
+	if len(r.ByDay) > 0 && r.Freq == Monthly {
+		return nil, fmt.Errorf("%w: BYDAY is not supported with FREQ=MONTHLY", ErrInvalidRecurrence)
+	}
+	return r, nil
+}
+
+func parseUntil(v string) (time.Time, error) {
+	if t, err := time.Parse("20060102T150405Z", v); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse("20060102", v)
+	if err != nil {
+		return time.Time{}, err
+	}
+	// a date-only UNTIL includes the whole day
+	return t.Add(24*time.Hour - time.Nanosecond), nil
+}
+
+// Next returns the due date of the occurrence after due, where due is the due
+// date of occurrence number n (1-based). ok is false when the series is over.
+func (r *Rule) Next(due time.Time, n int) (next time.Time, ok bool) {
+	if r.Count > 0 && n >= r.Count {
+		return time.Time{}, false
+	}
+	switch r.Freq {
+	case Daily:
+		next = due.AddDate(0, 0, r.Interval)
+		// weekdays repeat every 7 steps, so give up if none of them match
+		for i := 0; len(r.ByDay) > 0 && !r.hasDay(next.Weekday()); i++ {
+			if i == 7 {
+				return time.Time{}, false
+			}
+			next = next.AddDate(0, 0, r.Interval)
+		}
+	case Weekly:
+		if len(r.ByDay) == 0 {
+			next = due.AddDate(0, 0, 7*r.Interval)
+			break
+		}
+		// scan forward day by day, keeping only weeks that are a multiple of
+		// Interval away from the week of due
+		start := weekStart(due)
+		for next = due.AddDate(0, 0, 1); ; next = next.AddDate(0, 0, 1) {
+			if next.Sub(due) > time.Duration(r.Interval+1)*7*24*time.Hour {
+				return time.Time{}, false
+			}
+			weeks := int(weekStart(next).Sub(start).Hours()/24+0.5) / 7
+			if weeks%r.Interval == 0 && r.hasDay(next.Weekday()) {
+				break
+			}
+		}
+	case Monthly:
+		// months without the day (e.g. the 31st) are skipped, as in RFC 5545
+		for i := r.Interval; ; i += r.Interval {
+			next = due.AddDate(0, i, 0)
+			if next.Day() == due.Day() {
+				break
+			}
+		}
+	}
+	if !r.Until.IsZero() && next.After(r.Until) {
+		return time.Time{}, false
+	}
+	return next, true
+}
+
+func (r *Rule) hasDay(d time.Weekday) bool {
+	for _, wd := range r.ByDay {
+		if wd == d {
+			return true
+		}
+	}
+	return false
+}
+
+// weekStart returns midnight on the Monday (RRULE default WKST) of t's week.
+func weekStart(t time.Time) time.Time {
+	offset := (int(t.Weekday()) + 6) % 7
+	y, m, d := t.AddDate(0, 0, -offset).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
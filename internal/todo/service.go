@@ -2,29 +2,135 @@ package todo
 
 import (
 	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
 )
 
+var tracer = otel.Tracer("github.com/fuzail/08-todosvc/internal/todo")
+
+var (
+	ErrSeriesEnded     = &Error{Kind: KindPrecondition, Reason: "SERIES_ENDED", Message: "recurring series has ended"}
+	ErrBlocked         = &Error{Kind: KindPrecondition, Reason: "TASK_BLOCKED", Message: "task has open blockers"}
+	ErrDependencyCycle = &Error{Kind: KindPrecondition, Reason: "DEPENDENCY_CYCLE", Message: "dependency would create a cycle"}
+	ErrTaskModified    = &Error{Kind: KindPrecondition, Reason: "TASK_MODIFIED", Message: "task was changed since it was read"}
+)
+
+// Service is the task use-case layer. It validates its input against Limits
+// (see validate.go) and reports failures as *Error values (see errors.go).
+// Titles and descriptions are stored trimmed.
 type Service interface {
-	CreateTask(ctx context.Context, title, description string) (*Task, error)
+	// CreateTask stores a new task. id is optional; when set it must be a UUID
+	// and ErrAlreadyExists is returned if it is taken. A recurrence rule needs
+	// a due date, which is the first occurrence.
+	CreateTask(ctx context.Context, id, title, description string, dueAt *time.Time, recurrence string) (*Task, error)
 	GetTask(ctx context.Context, id string) (*Task, error)
-	ListTasks(ctx context.Context, page, pageSize int) ([]Task, int64, error)
+	ListTasks(ctx context.Context, page, pageSize int, filter ListFilter) ([]Task, int64, error)
 	UpdateTask(ctx context.Context, id, title, description string) (*Task, error)
-	MarkComplete(ctx context.Context, id string, completed bool) (*Task, error)
+	// ReplaceTask overwrites the title, description, due date, recurrence
+	// and completion of task t.ID with t's, for clients that send whole
+	// tasks such as CalDAV. Completing works as MarkComplete without force.
+	// A rule sent for an occurrence older than the newest of its series is
+	// dropped. If t.ChangeSeq isn't 0, the task is only written if it is
+	// still at that ChangeSeq, and ErrTaskModified is returned otherwise.
+	ReplaceTask(ctx context.Context, t Task) (*Task, error)
+	// MarkComplete completes or reopens a task. Completing a task with open
+	// blockers fails with ErrBlocked unless force is set. Completing the open
+	// occurrence of a recurring task creates the next occurrence.
+	MarkComplete(ctx context.Context, id string, completed, force bool) (*Task, error)
+	// SetRecurrence sets or replaces the rule (and optionally the due date) of
+	// the series id belongs to. StopRecurrence ends the series; the open
+	// occurrence is kept.
+	SetRecurrence(ctx context.Context, id, recurrence string, dueAt *time.Time) (*Task, error)
+	StopRecurrence(ctx context.Context, id string) (*Task, error)
 	DeleteTask(ctx context.Context, id string) error
+	// AddDependency records that id is blocked by blockedByID. It fails with
+	// ErrDependencyCycle if blockedByID already depends on id.
+	AddDependency(ctx context.Context, id, blockedByID string) error
+	RemoveDependency(ctx context.Context, id, blockedByID string) error
+	ListBlockers(ctx context.Context, id string) ([]Task, error)
+	// GetTasks and ListBlockersOf read for many tasks at once, for callers
+	// that batch lookups such as GraphQL. GetTasks returns the tasks of ids
+	// that exist, in no order; ListBlockersOf the blockers of each of ids
+	// that has any. Both take at most MaxBatchSize ids.
+	GetTasks(ctx context.Context, ids []string) ([]Task, error)
+	ListBlockersOf(ctx context.Context, ids []string) (map[string][]Task, error)
+	SyncTasks(ctx context.Context, watermark string, changes []TaskChange, limit int) (*SyncResult, error)
+	// ExportTasks calls fn with every task in ID order, reading them in
+	// batches so memory doesn't grow with the number of tasks.
+	ExportTasks(ctx context.Context, fn func(*Task) error) error
+	// ImportTask creates a task read from an export: id (optional), title,
+	// description, due date, recurrence and completion are taken from t, the
+	// rest is set as by CreateTask. A dry run only validates, including the
+	// id not being taken, and doesn't check quotas.
+	ImportTask(ctx context.Context, t Task, dryRun bool) (*Task, error)
 }
 
 type service struct {
-	repo Repository
+	repo   Repository
+	limits Limits
+	quotas QuotaService
+}
+
+// NewService enforces tenant quotas on task creation unless quotas is nil.
+func NewService(r Repository, limits Limits, quotas QuotaService) Service {
+	return &service{repo: r, limits: limits.withDefaults(), quotas: quotas}
+}
+
+// checkQuota checks that the tenant may create another task.
+func (s *service) checkQuota(ctx context.Context, tenant string, open bool) error {
+	if s.quotas == nil {
+		return nil
+	}
+	return s.quotas.CheckTask(ctx, tenant, open)
 }
 
-func NewService(r Repository) Service {
-	return &service{repo: r}
+// checkOpenQuota checks that the tenant may have another open task, for
+// tasks that become open again.
+func (s *service) checkOpenQuota(ctx context.Context, tenant string) error {
+	if s.quotas == nil {
+		return nil
+	}
+	return s.quotas.CheckOpenTask(ctx, tenant)
+}
+
+// checkTask validates and trims a task's title and description. prefix is
+// prepended to the field names, for tasks nested in a request.
+func (s *service) checkTask(v *validator, prefix string, title, description *string) {
+	*title = v.singleLine(prefix+"title", *title, s.limits.MaxTitleLength, true)
+	*description = v.multiLine(prefix+"description", *description, s.limits.MaxDescriptionLength, false)
 }
 
-func (s *service) CreateTask(ctx context.Context, title, description string) (*Task, error) {
+func (s *service) CreateTask(ctx context.Context, id, title, description string, dueAt *time.Time, recurrence string) (*Task, error) {
+	ctx, span := tracer.Start(ctx, "todo.Service/CreateTask")
+	defer span.End()
+	var v validator
+	s.checkTask(&v, "", &title, &description)
+	if err := v.err(); err != nil {
+		return nil, err
+	}
+	id, err := normalizeID(id)
+	if err != nil {
+		return nil, err
+	}
+	if recurrence != "" {
+		if err := checkRecurrence(recurrence, dueAt); err != nil {
+			return nil, err
+		}
+	}
+	tenant := tenantOf(ctx)
+	if err := s.checkQuota(ctx, tenant, true); err != nil {
+		return nil, err
+	}
 	t := &Task{
+		ID:          id,
 		Title:       title,
 		Description: description,
+		DueAt:       dueAt,
+		Recurrence:  recurrence,
+		Tenant:      tenant,
 	}
 	if err := s.repo.Create(ctx, t); err != nil {
 		return nil, err
@@ -32,40 +138,405 @@ func (s *service) CreateTask(ctx context.Context, title, description string) (*T
 	return t, nil
 }
 
+// normalizeID validates a client-supplied id and returns its canonical
+// lowercase form so lookups match. An empty id is passed through.
+func normalizeID(id string) (string, error) {
+	if id == "" {
+		return "", nil
+	}
+	parsed, err := uuid.Parse(id)
+	if err != nil {
+		return "", ErrInvalidID
+	}
+	return parsed.String(), nil
+}
+
 func (s *service) GetTask(ctx context.Context, id string) (*Task, error) {
+	ctx, span := tracer.Start(ctx, "todo.Service/GetTask")
+	defer span.End()
+	if err := required("id", id); err != nil {
+		return nil, err
+	}
 	return s.repo.GetByID(ctx, id)
 }
 
-func (s *service) ListTasks(ctx context.Context, page, pageSize int) ([]Task, int64, error) {
-	return s.repo.List(ctx, page, pageSize)
+func (s *service) ListTasks(ctx context.Context, page, pageSize int, filter ListFilter) ([]Task, int64, error) {
+	ctx, span := tracer.Start(ctx, "todo.Service/ListTasks")
+	defer span.End()
+	var v validator
+	v.page(page, pageSize, s.limits.MaxPageSize)
+	if err := v.err(); err != nil {
+		return nil, 0, err
+	}
+	return s.repo.List(ctx, page, pageSize, filter)
 }
 
 func (s *service) UpdateTask(ctx context.Context, id, title, description string) (*Task, error) {
+	ctx, span := tracer.Start(ctx, "todo.Service/UpdateTask")
+	defer span.End()
+	if err := required("id", id); err != nil {
+		return nil, err
+	}
+	var v validator
+	s.checkTask(&v, "", &title, &description)
+	if err := v.err(); err != nil {
+		return nil, err
+	}
 	t, err := s.repo.GetByID(ctx, id)
 	if err != nil {
 		return nil, err
 	}
 	t.Title = title
 	t.Description = description
-	if err := s.repo.Update(ctx, t); err != nil {
+	if err := s.repo.Update(ctx, t, 0); err != nil {
 		return nil, err
 	}
 	return t, nil
 }
 
-func (s *service) MarkComplete(ctx context.Context, id string, completed bool) (*Task, error) {
+func (s *service) MarkComplete(ctx context.Context, id string, completed, force bool) (*Task, error) {
+	ctx, span := tracer.Start(ctx, "todo.Service/MarkComplete")
+	defer span.End()
+	if err := required("id", id); err != nil {
+		return nil, err
+	}
 	t, err := s.repo.GetByID(ctx, id)
 	if err != nil {
 		return nil, err
 	}
+	if completed && !t.Completed {
+		if !force {
+			if err := s.checkBlockers(ctx, id); err != nil {
+				return nil, err
+			}
+		}
+		if err := s.complete(ctx, t, 0); err != nil {
+			return nil, err
+		}
+		return t, nil
+	}
+	if !completed && t.Completed {
+		if err := s.checkOpenQuota(ctx, t.Tenant); err != nil {
+			return nil, err
+		}
+	}
 	t.Completed = completed
-	if err := s.repo.Update(ctx, t); err != nil {
+	if err := s.repo.Update(ctx, t, 0); err != nil {
 		return nil, err
 	}
 	return t, nil
 }
 
+// complete stores the open task t as completed, along with whatever else the
+// caller changed, and creates the next occurrence if t carries a rule. If
+// another request completed t first, nothing is written and t is reloaded,
+// so each occurrence is followed by one next occurrence only.
+//
+// The next occurrence counts as a task created today; it takes the place of
+// t among the open ones. ifSeq is as for Repository.Complete.
+func (s *service) complete(ctx context.Context, t *Task, ifSeq int64) error {
+	var next *Task
+	if t.Recurrence != "" {
+		if next = nextOccurrence(t); next != nil {
+			if err := s.checkQuota(ctx, t.Tenant, false); err != nil {
+				return err
+			}
+		}
+		// the rule moves to the new occurrence
+		t.Recurrence = ""
+	}
+	t.Completed = true
+	done, err := s.repo.Complete(ctx, t, next, ifSeq)
+	if err != nil || done {
+		return err
+	}
+	stored, err := s.repo.GetByID(ctx, t.ID)
+	if err != nil {
+		return err
+	}
+	*t = *stored
+	return nil
+}
+
+// checkBlockers returns ErrBlocked if a blocker of id is still open.
+func (s *service) checkBlockers(ctx context.Context, id string) error {
+	blockers, err := s.repo.ListBlockers(ctx, id)
+	if err != nil {
+		return err
+	}
+	for _, b := range blockers {
+		if !b.Completed {
+			return ErrBlocked
+		}
+	}
+	return nil
+}
+
+func (s *service) ReplaceTask(ctx context.Context, t Task) (*Task, error) {
+	ctx, span := tracer.Start(ctx, "todo.Service/ReplaceTask")
+	defer span.End()
+	if err := required("id", t.ID); err != nil {
+		return nil, err
+	}
+	var v validator
+	s.checkTask(&v, "", &t.Title, &t.Description)
+	if err := v.err(); err != nil {
+		return nil, err
+	}
+	existing, err := s.repo.GetByID(ctx, t.ID)
+	if err != nil {
+		return nil, err
+	}
+	if t.ChangeSeq != 0 && existing.ChangeSeq != t.ChangeSeq {
+		return nil, ErrTaskModified
+	}
+	if t.Recurrence != "" {
+		head, err := s.seriesHead(ctx, existing)
+		if err != nil {
+			return nil, err
+		}
+		// older occurrences don't carry the rule
+		if head.ID != existing.ID {
+			t.Recurrence = ""
+		}
+	}
+	if t.Recurrence != "" {
+		if err := checkRecurrence(t.Recurrence, t.DueAt); err != nil {
+			return nil, err
+		}
+		if existing.SeriesID == "" {
+			existing.SeriesID = existing.ID
+			existing.Occurrence = 1
+		}
+	}
+	existing.Title = t.Title
+	existing.Description = t.Description
+	existing.DueAt = t.DueAt
+	existing.Recurrence = t.Recurrence
+	if t.Completed && !existing.Completed {
+		if err := s.checkBlockers(ctx, existing.ID); err != nil {
+			return nil, err
+		}
+		if err := s.complete(ctx, existing, t.ChangeSeq); err != nil {
+			return nil, err
+		}
+		return existing, nil
+	}
+	if t.Completed {
+		existing.Recurrence = ""
+	} else if existing.Completed {
+		if err := s.checkOpenQuota(ctx, existing.Tenant); err != nil {
+			return nil, err
+		}
+	}
+	existing.Completed = t.Completed
+	if err := s.repo.Update(ctx, existing, t.ChangeSeq); err != nil {
+		return nil, err
+	}
+	return existing, nil
+}
+
+// nextOccurrence returns the occurrence that follows t in its series, or
+// nil if the series ends with t.
+func nextOccurrence(t *Task) *Task {
+	rule, err := ParseRule(t.Recurrence)
+	if err != nil || t.DueAt == nil {
+		// stored rules are validated on write; treat a bad one as the end
+		return nil
+	}
+	due, ok := rule.Next(*t.DueAt, t.Occurrence)
+	if !ok {
+		return nil
+	}
+	return &Task{
+		Title:       t.Title,
+		Description: t.Description,
+		DueAt:       &due,
+		Recurrence:  t.Recurrence,
+		SeriesID:    t.SeriesID,
+		Occurrence:  t.Occurrence + 1,
+		Tenant:      t.Tenant,
+	}
+}
+
+func checkRecurrence(recurrence string, dueAt *time.Time) error {
+	if _, err := ParseRule(recurrence); err != nil {
+		return err
+	}
+	if dueAt == nil {
+		return fmt.Errorf("%w: a due date is required", ErrInvalidRecurrence)
+	}
+	return nil
+}
+
+// seriesHead returns the newest occurrence of the series t belongs to, or t
+// itself for a one-off task.
+func (s *service) seriesHead(ctx context.Context, t *Task) (*Task, error) {
+	if t.SeriesID == "" {
+		return t, nil
+	}
+	return s.repo.GetSeriesHead(ctx, t.SeriesID)
+}
+
+func (s *service) SetRecurrence(ctx context.Context, id, recurrence string, dueAt *time.Time) (*Task, error) {
+	ctx, span := tracer.Start(ctx, "todo.Service/SetRecurrence")
+	defer span.End()
+	if err := required("id", id); err != nil {
+		return nil, err
+	}
+	t, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	head, err := s.seriesHead(ctx, t)
+	if err != nil {
+		return nil, err
+	}
+	if head.Completed {
+		return nil, ErrSeriesEnded
+	}
+	if dueAt == nil {
+		dueAt = head.DueAt
+	}
+	if err := checkRecurrence(recurrence, dueAt); err != nil {
+		return nil, err
+	}
+	if head.SeriesID == "" {
+		head.SeriesID = head.ID
+		head.Occurrence = 1
+	}
+	head.Recurrence = recurrence
+	head.DueAt = dueAt
+	if err := s.repo.Update(ctx, head, 0); err != nil {
+		return nil, err
+	}
+	return head, nil
+}
+
+func (s *service) StopRecurrence(ctx context.Context, id string) (*Task, error) {
+	ctx, span := tracer.Start(ctx, "todo.Service/StopRecurrence")
+	defer span.End()
+	if err := required("id", id); err != nil {
+		return nil, err
+	}
+	t, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	head, err := s.seriesHead(ctx, t)
+	if err != nil {
+		return nil, err
+	}
+	if head.Recurrence == "" {
+		return head, nil
+	}
+	head.Recurrence = ""
+	if err := s.repo.Update(ctx, head, 0); err != nil {
+		return nil, err
+	}
+	return head, nil
+}
+
+func (s *service) AddDependency(ctx context.Context, id, blockedByID string) error {
+	ctx, span := tracer.Start(ctx, "todo.Service/AddDependency")
+	defer span.End()
+	if err := required("task_id", id, "blocked_by_id", blockedByID); err != nil {
+		return err
+	}
+	if id == blockedByID {
+		return ErrDependencyCycle
+	}
+	// both tasks must exist
+	if _, err := s.repo.GetByID(ctx, id); err != nil {
+		return err
+	}
+	if _, err := s.repo.GetByID(ctx, blockedByID); err != nil {
+		return err
+	}
+	// walk the blockers of blockedByID; reaching id means a cycle
+	seen := map[string]bool{blockedByID: true}
+	queue := []string{blockedByID}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		ids, err := s.repo.ListBlockerIDs(ctx, cur)
+		if err != nil {
+			return err
+		}
+		for _, next := range ids {
+			if next == id {
+				return ErrDependencyCycle
+			}
+			if !seen[next] {
+				seen[next] = true
+				queue = append(queue, next)
+			}
+		}
+	}
+	return s.repo.AddDependency(ctx, id, blockedByID)
+}
+
+func (s *service) RemoveDependency(ctx context.Context, id, blockedByID string) error {
+	ctx, span := tracer.Start(ctx, "todo.Service/RemoveDependency")
+	defer span.End()
+	if err := required("task_id", id, "blocked_by_id", blockedByID); err != nil {
+		return err
+	}
+	return s.repo.RemoveDependency(ctx, id, blockedByID)
+}
+
+func (s *service) ListBlockers(ctx context.Context, id string) ([]Task, error) {
+	ctx, span := tracer.Start(ctx, "todo.Service/ListBlockers")
+	defer span.End()
+	if err := required("task_id", id); err != nil {
+		return nil, err
+	}
+	if _, err := s.repo.GetByID(ctx, id); err != nil {
+		return nil, err
+	}
+	return s.repo.ListBlockers(ctx, id)
+}
+
+func (s *service) GetTasks(ctx context.Context, ids []string) ([]Task, error) {
+	ctx, span := tracer.Start(ctx, "todo.Service/GetTasks")
+	defer span.End()
+	var v validator
+	v.batch("ids", ids)
+	if err := v.err(); err != nil {
+		return nil, err
+	}
+	return s.repo.GetByIDs(ctx, validIDs(ids))
+}
+
+func (s *service) ListBlockersOf(ctx context.Context, ids []string) (map[string][]Task, error) {
+	ctx, span := tracer.Start(ctx, "todo.Service/ListBlockersOf")
+	defer span.End()
+	var v validator
+	v.batch("ids", ids)
+	if err := v.err(); err != nil {
+		return nil, err
+	}
+	return s.repo.ListBlockersOf(ctx, validIDs(ids))
+}
+
+// validIDs drops the ids that aren't uuids: they match no task, and would
+// fail the whole query on databases with a uuid column type.
+func validIDs(ids []string) []string {
+	out := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if _, err := uuid.Parse(id); err == nil {
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
 func (s *service) DeleteTask(ctx context.Context, id string) error {
+	ctx, span := tracer.Start(ctx, "todo.Service/DeleteTask")
+	defer span.End()
+	if err := required("id", id); err != nil {
+		return err
+	}
 	// check existence to return ErrNotFound consistently
 	_, err := s.repo.GetByID(ctx, id)
 	if err != nil {
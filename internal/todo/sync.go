@@ -0,0 +1,250 @@
+package todo
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidWatermark = invalidField("INVALID_WATERMARK", "watermark", "invalid sync watermark")
+
+const (
+	defaultSyncLimit = 100
+	maxSyncLimit     = 1000
+)
+
+// SyncCursor is the position of the last change a client has seen. Changes
+// are ordered by (Seq, ID): Seq is the task's ChangeSeq, which only repeats
+// for rows written before it existed.
+type SyncCursor struct {
+	Seq int64
+	ID  string
+}
+
+// Watermark encodes the cursor as the opaque string handed to clients.
+func (c SyncCursor) Watermark() string {
+	if c == (SyncCursor{}) {
+		return ""
+	}
+	raw := strconv.FormatInt(c.Seq, 10) + "|" + c.ID
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// ParseWatermark decodes a watermark produced by SyncCursor.Watermark. An empty
+// watermark is the zero cursor (pull everything).
+func ParseWatermark(w string) (SyncCursor, error) {
+	if w == "" {
+		return SyncCursor{}, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(w)
+	if err != nil {
+		return SyncCursor{}, ErrInvalidWatermark
+	}
+	head, id, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return SyncCursor{}, ErrInvalidWatermark
+	}
+	seq, err := strconv.ParseInt(head, 10, 64)
+	if err != nil {
+		return SyncCursor{}, ErrInvalidWatermark
+	}
+	return SyncCursor{Seq: seq, ID: id}, nil
+}
+
+// TaskChange is a task state exchanged during sync. For pushed changes
+// Task.UpdatedAt is the time the client made the change.
+type TaskChange struct {
+	Task    Task
+	Deleted bool
+}
+
+type ChangeStatus int
+
+const (
+	ChangeApplied ChangeStatus = iota + 1
+	ChangeConflict
+	ChangeRejected // not allowed, such as completing a blocked task or going over a quota
+)
+
+type ChangeResult struct {
+	ID     string
+	Status ChangeStatus
+	Reason string // for ChangeRejected, the reason of the error, e.g. TASK_BLOCKED or QUOTA_EXCEEDED
+}
+
+type SyncResult struct {
+	Changes   []TaskChange
+	Watermark string
+	HasMore   bool
+	Results   []ChangeResult
+}
+
+// SyncTasks applies the pushed changes and then returns every task changed
+// after watermark, tombstones included.
+//
+// Conflicts are resolved last-writer-wins on UpdatedAt: a pushed change is
+// applied only if its UpdatedAt is strictly after the server copy's UpdatedAt
+// (deletes bump UpdatedAt too). Otherwise it is reported as ChangeConflict and
+// the client picks up the server copy from the pulled changes. Changes that
+// aren't allowed, such as completing a task with open blockers or creating
+// one over the tenant's quota, are reported as ChangeRejected, so the changes
+// applied before them in the batch still get their results. Applied changes
+// take a new change seq, so they are pulled back as well.
+//
+// A pushed task that doesn't exist yet is created with its due date and rule.
+// For existing tasks the title, description and completion are applied;
+// completing works as MarkComplete, creating the next occurrence of a
+// recurring task.
+func (s *service) SyncTasks(ctx context.Context, watermark string, changes []TaskChange, limit int) (*SyncResult, error) {
+	ctx, span := tracer.Start(ctx, "todo.Service/SyncTasks")
+	defer span.End()
+	since, err := ParseWatermark(watermark)
+	if err != nil {
+		return nil, err
+	}
+	if limit <= 0 {
+		limit = defaultSyncLimit
+	}
+	if limit > maxSyncLimit {
+		limit = maxSyncLimit
+	}
+
+	// validate every change before applying any; fields are trimmed in place
+	var v validator
+	for i := range changes {
+		t := &changes[i].Task
+		if changes[i].Deleted {
+			continue
+		}
+		prefix := fmt.Sprintf("changes[%d].task.", i)
+		s.checkTask(&v, prefix, &t.Title, &t.Description)
+		// a completed task's rule has already moved on to the next occurrence
+		if t.Completed {
+			t.Recurrence = ""
+		}
+		if t.Recurrence != "" {
+			if err := checkRecurrence(t.Recurrence, t.DueAt); err != nil {
+				v.add(prefix+"recurrence", err.Error())
+			}
+		}
+	}
+	if err := v.err(); err != nil {
+		return nil, err
+	}
+
+	res := &SyncResult{Results: make([]ChangeResult, 0, len(changes))}
+	for _, c := range changes {
+		r, err := s.applyChange(ctx, c)
+		// quotas are checked before anything of the change is written
+		if errors.Is(err, ErrQuotaExceeded) {
+			r, err = ChangeResult{Status: ChangeRejected, Reason: ErrQuotaExceeded.Reason}, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		r.ID = c.Task.ID
+		res.Results = append(res.Results, r)
+	}
+
+	// fetch one extra row to know whether there's another page
+	tasks, err := s.repo.ListChanges(ctx, since, limit+1)
+	if err != nil {
+		return nil, err
+	}
+	if len(tasks) > limit {
+		tasks = tasks[:limit]
+		res.HasMore = true
+	}
+	res.Changes = make([]TaskChange, 0, len(tasks))
+	for _, t := range tasks {
+		res.Changes = append(res.Changes, TaskChange{Task: t, Deleted: t.DeletedAt.Valid})
+	}
+	if n := len(tasks); n > 0 {
+		since = SyncCursor{Seq: tasks[n-1].ChangeSeq, ID: tasks[n-1].ID}
+	}
+	res.Watermark = since.Watermark()
+	return res, nil
+}
+
+func (s *service) applyChange(ctx context.Context, c TaskChange) (ChangeResult, error) {
+	applied := ChangeResult{Status: ChangeApplied}
+	id, err := normalizeID(c.Task.ID)
+	if err != nil || id == "" {
+		return ChangeResult{}, ErrInvalidID
+	}
+	existing, err := s.repo.GetAnyByID(ctx, id)
+	if errors.Is(err, ErrNotFound) {
+		if c.Deleted {
+			// nothing to delete; the client can drop its tombstone
+			return applied, nil
+		}
+		tenant := tenantOf(ctx)
+		if err := s.checkQuota(ctx, tenant, !c.Task.Completed); err != nil {
+			return ChangeResult{}, err
+		}
+		t := &Task{
+			ID:          id,
+			Title:       c.Task.Title,
+			Description: c.Task.Description,
+			Completed:   c.Task.Completed,
+			DueAt:       c.Task.DueAt,
+			Recurrence:  c.Task.Recurrence,
+			Tenant:      tenant,
+		}
+		if err := s.repo.Create(ctx, t); err != nil {
+			return ChangeResult{}, err
+		}
+		return applied, nil
+	}
+	if err != nil {
+		return ChangeResult{}, err
+	}
+
+	if !c.Task.UpdatedAt.After(existing.UpdatedAt) {
+		return ChangeResult{Status: ChangeConflict}, nil
+	}
+	if c.Deleted {
+		if !existing.DeletedAt.Valid {
+			if err := s.repo.Delete(ctx, id); err != nil {
+				return ChangeResult{}, err
+			}
+		}
+		return applied, nil
+	}
+	// completing needs the blockers done, as MarkComplete without force
+	completing := c.Task.Completed && !existing.Completed
+	if completing {
+		if err := s.checkBlockers(ctx, id); errors.Is(err, ErrBlocked) {
+			return ChangeResult{Status: ChangeRejected, Reason: ErrBlocked.Reason}, nil
+		} else if err != nil {
+			return ChangeResult{}, err
+		}
+	}
+	// deleted and completed tasks don't count as open
+	if (existing.DeletedAt.Valid || existing.Completed) && !c.Task.Completed {
+		if err := s.checkOpenQuota(ctx, existing.Tenant); err != nil {
+			return ChangeResult{}, err
+		}
+	}
+	if existing.DeletedAt.Valid {
+		if err := s.repo.Restore(ctx, id); err != nil {
+			return ChangeResult{}, err
+		}
+	}
+	existing.Title = c.Task.Title
+	existing.Description = c.Task.Description
+	if completing {
+		if err := s.complete(ctx, existing, 0); err != nil {
+			return ChangeResult{}, err
+		}
+		return applied, nil
+	}
+	existing.Completed = c.Task.Completed
+	if err := s.repo.Update(ctx, existing, 0); err != nil {
+		return ChangeResult{}, err
+	}
+	return applied, nil
+}
@@ -0,0 +1,67 @@
+package todo
+
+import (
+	"context"
+	"errors"
+)
+
+// exportBatchSize is how many tasks ExportTasks reads at a time.
+const exportBatchSize = 500
+
+func (s *service) ExportTasks(ctx context.Context, fn func(*Task) error) error {
+	ctx, span := tracer.Start(ctx, "todo.Service/ExportTasks")
+	defer span.End()
+	return s.repo.Iterate(ctx, exportBatchSize, fn)
+}
+
+func (s *service) ImportTask(ctx context.Context, t Task, dryRun bool) (*Task, error) {
+	ctx, span := tracer.Start(ctx, "todo.Service/ImportTask")
+	defer span.End()
+	var v validator
+	s.checkTask(&v, "", &t.Title, &t.Description)
+	if err := v.err(); err != nil {
+		return nil, err
+	}
+	id, err := normalizeID(t.ID)
+	if err != nil {
+		return nil, err
+	}
+	// a completed task's rule has already moved on to the next occurrence
+	// in the tool it came from
+	if t.Completed {
+		t.Recurrence = ""
+	}
+	if t.Recurrence != "" {
+		if err := checkRecurrence(t.Recurrence, t.DueAt); err != nil {
+			return nil, err
+		}
+	}
+	tenant := tenantOf(ctx)
+	task := &Task{
+		ID:          id,
+		Title:       t.Title,
+		Description: t.Description,
+		Completed:   t.Completed,
+		DueAt:       t.DueAt,
+		Recurrence:  t.Recurrence,
+		Tenant:      tenant,
+	}
+	if dryRun {
+		if id != "" {
+			// deleted tasks keep their ids
+			if _, err := s.repo.GetAnyByID(ctx, id); err == nil {
+				return nil, ErrAlreadyExists
+			} else if !errors.Is(err, ErrNotFound) {
+				return nil, err
+			}
+		}
+		return task, nil
+	}
+	if err := s.checkQuota(ctx, tenant, !t.Completed); err != nil {
+		return nil, err
+	}
+	if err := s.repo.Create(ctx, task); err != nil {
+		return nil, err
+	}
+	return task, nil
+}
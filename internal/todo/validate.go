@@ -0,0 +1,135 @@
+package todo
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Defaults for the zero fields of Limits. Lengths are in characters (runes),
+// not bytes.
+const (
+	DefaultMaxTitleLength       = 200
+	DefaultMaxDescriptionLength = 10000
+	DefaultMaxCommentLength     = 10000
+	DefaultMaxPageSize          = 100
+)
+
+// MaxBatchSize is the most ids a batched read such as GetTasks takes.
+const MaxBatchSize = 1000
+
+// MaxAuthorLength bounds the comment authors callers name themselves, in
+// characters.
+const MaxAuthorLength = 100
+
+// Limits bounds user input checked by the services. A zero field uses its
+// Default* value.
+type Limits struct {
+	MaxTitleLength       int
+	MaxDescriptionLength int
+	MaxCommentLength     int
+	MaxPageSize          int
+}
+
+func (l Limits) withDefaults() Limits {
+	if l.MaxTitleLength <= 0 {
+		l.MaxTitleLength = DefaultMaxTitleLength
+	}
+	if l.MaxDescriptionLength <= 0 {
+		l.MaxDescriptionLength = DefaultMaxDescriptionLength
+	}
+	if l.MaxCommentLength <= 0 {
+		l.MaxCommentLength = DefaultMaxCommentLength
+	}
+	if l.MaxPageSize <= 0 {
+		l.MaxPageSize = DefaultMaxPageSize
+	}
+	return l
+}
+
+// validator collects every violation of a request so clients can fix them in
+// one round trip.
+type validator struct {
+	violations []FieldViolation
+}
+
+func (v *validator) add(field, description string) {
+	v.violations = append(v.violations, FieldViolation{Field: field, Description: description})
+}
+
+func (v *validator) err() error {
+	return InvalidArgument(v.violations...)
+}
+
+// required adds a violation for each named value that is blank. pairs
+// alternates field names and values.
+func (v *validator) required(pairs ...string) {
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if strings.TrimSpace(pairs[i+1]) == "" {
+			v.add(pairs[i], "is required")
+		}
+	}
+}
+
+// required is the validator method for callers that check nothing else.
+func required(pairs ...string) error {
+	var v validator
+	v.required(pairs...)
+	return v.err()
+}
+
+// singleLine checks a one-line text field such as a title and returns it
+// trimmed.
+func (v *validator) singleLine(field, s string, max int, required bool) string {
+	return v.text(field, s, max, required, false)
+}
+
+// multiLine is singleLine for free text, where newlines and tabs are allowed.
+func (v *validator) multiLine(field, s string, max int, required bool) string {
+	return v.text(field, s, max, required, true)
+}
+
+func (v *validator) text(field, s string, max int, required, multiline bool) string {
+	s = strings.TrimSpace(s)
+	switch {
+	case !utf8.ValidString(s):
+		v.add(field, "must be valid UTF-8")
+	case s == "":
+		if required {
+			v.add(field, "is required")
+		}
+	case utf8.RuneCountInString(s) > max:
+		v.add(field, fmt.Sprintf("must be at most %d characters", max))
+	case hasControl(s, multiline):
+		v.add(field, "must not contain control characters")
+	}
+	return s
+}
+
+func hasControl(s string, multiline bool) bool {
+	for _, r := range s {
+		if multiline && (r == '\n' || r == '\r' || r == '\t') {
+			continue
+		}
+		if unicode.IsControl(r) {
+			return true
+		}
+	}
+	return false
+}
+
+func (v *validator) batch(field string, ids []string) {
+	if len(ids) > MaxBatchSize {
+		v.add(field, fmt.Sprintf("must have at most %d ids", MaxBatchSize))
+	}
+}
+
+func (v *validator) page(page, pageSize, max int) {
+	if page < 1 {
+		v.add("page", "must be at least 1")
+	}
+	if pageSize < 1 || pageSize > max {
+		v.add("page_size", fmt.Sprintf("must be between 1 and %d", max))
+	}
+}
@@ -0,0 +1,296 @@
+package todoctl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/fuzail/08-todosvc/internal/taskio"
+	"github.com/fuzail/08-todosvc/internal/todo"
+	pb "github.com/fuzail/08-todosvc/proto/todo/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Backend is what the commands need from the service. It is either the
+// service itself, run against the database, or a server reached over gRPC.
+type Backend interface {
+	CreateTask(ctx context.Context, id, title, description string, dueAt *time.Time, recurrence string) (*todo.Task, error)
+	GetTask(ctx context.Context, id string) (*todo.Task, error)
+	ListTasks(ctx context.Context, page, pageSize int, filter todo.ListFilter) ([]todo.Task, int64, error)
+	UpdateTask(ctx context.Context, id, title, description string) (*todo.Task, error)
+	MarkComplete(ctx context.Context, id string, completed, force bool) (*todo.Task, error)
+	DeleteTask(ctx context.Context, id string) error
+	Stats(ctx context.Context, tenant string) (*todo.Stats, error)
+	PurgeDeleted(ctx context.Context, deletedBefore time.Time) (*todo.PurgeResult, error)
+	Export(ctx context.Context, w io.Writer, format taskio.Format) error
+	Import(ctx context.Context, r io.Reader, format taskio.Format, dryRun bool, report func(taskio.Result) error) (taskio.Summary, error)
+}
+
+type localBackend struct {
+	todo.Service
+	todo.MaintenanceService
+}
+
+// NewLocalBackend runs commands in-process against the service.
+func NewLocalBackend(s todo.Service, m todo.MaintenanceService) Backend {
+	return localBackend{Service: s, MaintenanceService: m}
+}
+
+func (b localBackend) Export(ctx context.Context, w io.Writer, format taskio.Format) error {
+	return taskio.Export(ctx, b.Service, w, format)
+}
+
+func (b localBackend) Import(ctx context.Context, r io.Reader, format taskio.Format, dryRun bool, report func(taskio.Result) error) (taskio.Summary, error) {
+	return taskio.Import(ctx, b.Service, r, format, dryRun, report)
+}
+
+type grpcBackend struct {
+	tasks pb.TodoServiceClient
+	admin pb.AdminServiceClient
+}
+
+// NewGRPCBackend runs commands on a server. Stats and purge use the admin
+// API, so the client must be an admin (AUTH_ADMIN_CLIENTS).
+func NewGRPCBackend(conn grpc.ClientConnInterface) Backend {
+	return grpcBackend{tasks: pb.NewTodoServiceClient(conn), admin: pb.NewAdminServiceClient(conn)}
+}
+
+// plain strips the "rpc error: code = ..." prefix from status errors; the
+// message already says what went wrong.
+func plain(err error) error {
+	if s, ok := status.FromError(err); ok && err != nil {
+		return statusError{s}
+	}
+	return err
+}
+
+type statusError struct {
+	s *status.Status
+}
+
+func (e statusError) Error() string {
+	return e.s.Message() + " (" + e.s.Code().String() + ")"
+}
+
+func (e statusError) GRPCStatus() *status.Status {
+	return e.s
+}
+
+func fromProto(t *pb.Task) *todo.Task {
+	out := &todo.Task{
+		ID:          t.GetId(),
+		Title:       t.GetTitle(),
+		Description: t.GetDescription(),
+		Completed:   t.GetCompleted(),
+		Recurrence:  t.GetRecurrence(),
+		SeriesID:    t.GetSeriesId(),
+		Occurrence:  int(t.GetOccurrence()),
+		Tenant:      t.GetTenant(),
+		CreatedAt:   t.GetCreatedAt().AsTime(),
+		UpdatedAt:   t.GetUpdatedAt().AsTime(),
+	}
+	if t.DueAt != nil {
+		due := t.DueAt.AsTime()
+		out.DueAt = &due
+	}
+	return out
+}
+
+func (b grpcBackend) CreateTask(ctx context.Context, id, title, description string, dueAt *time.Time, recurrence string) (*todo.Task, error) {
+	req := &pb.CreateTaskRequest{Id: id, Title: title, Description: description, Recurrence: recurrence}
+	if dueAt != nil {
+		req.DueAt = timestamppb.New(*dueAt)
+	}
+	resp, err := b.tasks.CreateTask(ctx, req)
+	if err != nil {
+		return nil, plain(err)
+	}
+	return fromProto(resp.Task), nil
+}
+
+func (b grpcBackend) GetTask(ctx context.Context, id string) (*todo.Task, error) {
+	resp, err := b.tasks.GetTask(ctx, &pb.GetTaskRequest{Id: id})
+	if err != nil {
+		return nil, plain(err)
+	}
+	return fromProto(resp.Task), nil
+}
+
+var protoFilters = map[todo.ListFilter]pb.ListTasksRequest_Filter{
+	todo.FilterAll:     pb.ListTasksRequest_ALL,
+	todo.FilterReady:   pb.ListTasksRequest_READY,
+	todo.FilterBlocked: pb.ListTasksRequest_BLOCKED,
+}
+
+func (b grpcBackend) ListTasks(ctx context.Context, page, pageSize int, filter todo.ListFilter) ([]todo.Task, int64, error) {
+	resp, err := b.tasks.ListTasks(ctx, &pb.ListTasksRequest{
+		Page:     int32(page),
+		PageSize: int32(pageSize),
+		Filter:   protoFilters[filter],
+	})
+	if err != nil {
+		return nil, 0, plain(err)
+	}
+	tasks := make([]todo.Task, 0, len(resp.Tasks))
+	for _, t := range resp.Tasks {
+		tasks = append(tasks, *fromProto(t))
+	}
+	return tasks, resp.Total, nil
+}
+
+func (b grpcBackend) UpdateTask(ctx context.Context, id, title, description string) (*todo.Task, error) {
+	resp, err := b.tasks.UpdateTask(ctx, &pb.UpdateTaskRequest{Id: id, Title: title, Description: description})
+	if err != nil {
+		return nil, plain(err)
+	}
+	return fromProto(resp.Task), nil
+}
+
+func (b grpcBackend) MarkComplete(ctx context.Context, id string, completed, force bool) (*todo.Task, error) {
+	resp, err := b.tasks.MarkComplete(ctx, &pb.MarkCompleteRequest{Id: id, Completed: completed, Force: force})
+	if err != nil {
+		return nil, plain(err)
+	}
+	return fromProto(resp.Task), nil
+}
+
+func (b grpcBackend) DeleteTask(ctx context.Context, id string) error {
+	_, err := b.tasks.DeleteTask(ctx, &pb.DeleteTaskRequest{Id: id})
+	return plain(err)
+}
+
+func (b grpcBackend) Stats(ctx context.Context, tenant string) (*todo.Stats, error) {
+	resp, err := b.admin.GetTaskStats(ctx, &pb.GetTaskStatsRequest{Tenant: tenant})
+	if err != nil {
+		return nil, plain(err)
+	}
+	st := resp.Stats
+	return &todo.Stats{
+		Tenant:          st.GetTenant(),
+		OpenTasks:       st.GetOpenTasks(),
+		CompletedTasks:  st.GetCompletedTasks(),
+		OverdueTasks:    st.GetOverdueTasks(),
+		DeletedTasks:    st.GetDeletedTasks(),
+		AttachmentBytes: st.GetAttachmentBytes(),
+	}, nil
+}
+
+func (b grpcBackend) PurgeDeleted(ctx context.Context, deletedBefore time.Time) (*todo.PurgeResult, error) {
+	resp, err := b.admin.PurgeDeletedTasks(ctx, &pb.PurgeDeletedTasksRequest{DeletedBefore: timestamppb.New(deletedBefore)})
+	if err != nil {
+		return nil, plain(err)
+	}
+	return &todo.PurgeResult{Tasks: resp.Tasks, Comments: resp.Comments, Attachments: resp.Attachments}, nil
+}
+
+var protoFormats = map[taskio.Format]pb.TaskFormat{
+	taskio.NDJSON:    pb.TaskFormat_TASK_FORMAT_NDJSON,
+	taskio.CSV:       pb.TaskFormat_TASK_FORMAT_CSV,
+	taskio.ICalendar: pb.TaskFormat_TASK_FORMAT_ICALENDAR,
+}
+
+func (b grpcBackend) Export(ctx context.Context, w io.Writer, format taskio.Format) error {
+	stream, err := b.tasks.ExportTasks(ctx, &pb.ExportTasksRequest{Format: protoFormats[format]})
+	if err != nil {
+		return plain(err)
+	}
+	for {
+		msg, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return plain(err)
+		}
+		if _, err := w.Write(msg.Chunk); err != nil {
+			return err
+		}
+	}
+}
+
+// importChunkSize is the payload size of each ImportTasks message.
+const importChunkSize = 64 << 10
+
+var rowStatuses = map[pb.ImportRowResult_Status]taskio.Status{
+	pb.ImportRowResult_CREATED: taskio.Created,
+	pb.ImportRowResult_VALID:   taskio.Valid,
+	pb.ImportRowResult_EXISTS:  taskio.Exists,
+	pb.ImportRowResult_FAILED:  taskio.Failed,
+}
+
+func (b grpcBackend) Import(ctx context.Context, r io.Reader, format taskio.Format, dryRun bool, report func(taskio.Result) error) (taskio.Summary, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := b.tasks.ImportTasks(ctx)
+	if err != nil {
+		return taskio.Summary{}, plain(err)
+	}
+	// send the file while reading results; a send fails once the server
+	// has ended the stream, and Recv returns why
+	sendErr := make(chan error, 1)
+	go func() {
+		err := sendImport(stream, r, &pb.ImportOptions{Format: protoFormats[format], DryRun: dryRun})
+		sendErr <- err
+		if err != nil {
+			cancel()
+		}
+	}()
+	for {
+		msg, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			// the server ended the stream without a summary
+			return taskio.Summary{}, errors.New("import: no summary from server")
+		}
+		if err != nil {
+			select {
+			case serr := <-sendErr:
+				if serr != nil && status.Code(err) == codes.Canceled {
+					// reading the file failed and canceled the stream
+					return taskio.Summary{}, serr
+				}
+			default:
+			}
+			return taskio.Summary{}, plain(err)
+		}
+		if sum := msg.GetSummary(); sum != nil {
+			return taskio.Summary{Created: sum.Created, Existing: sum.Existing, Failed: sum.Failed, DryRun: sum.DryRun}, nil
+		}
+		row := msg.GetRow()
+		res := taskio.Result{Line: int(row.GetLine()), ID: row.GetId(), Status: rowStatuses[row.GetStatus()]}
+		if row.GetError() != "" {
+			res.Err = &todo.Error{Reason: row.GetReason(), Message: row.GetError()}
+		}
+		if err := report(res); err != nil {
+			return taskio.Summary{}, err
+		}
+	}
+}
+
+// sendImport sends the options and then r in chunks. It returns an error if
+// r can't be read; the caller then cancels the stream rather than end it, so
+// part of a file isn't imported as if it were all of it.
+func sendImport(stream grpc.BidiStreamingClient[pb.ImportTasksRequest, pb.ImportTasksResponse], r io.Reader, opts *pb.ImportOptions) error {
+	if err := stream.Send(&pb.ImportTasksRequest{Data: &pb.ImportTasksRequest_Options{Options: opts}}); err != nil {
+		return nil
+	}
+	buf := make([]byte, importChunkSize)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			if err := stream.Send(&pb.ImportTasksRequest{Data: &pb.ImportTasksRequest_Chunk{Chunk: buf[:n]}}); err != nil {
+				return nil
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return stream.CloseSend()
+		}
+		if err != nil {
+			return fmt.Errorf("read import file: %w", err)
+		}
+	}
+}
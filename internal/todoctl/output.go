@@ -0,0 +1,190 @@
+package todoctl
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/fuzail/08-todosvc/internal/todo"
+)
+
+// Output formats.
+const (
+	FormatTable = "table"
+	FormatJSON  = "json" // one object per line
+	FormatCSV   = "csv"
+)
+
+// row is something printed as one line of output. JSON output encodes the
+// row itself.
+type row interface {
+	header() []string
+	record() []string
+}
+
+// taskRow is a task as printed.
+type taskRow struct {
+	ID          string     `json:"id"`
+	Title       string     `json:"title"`
+	Description string     `json:"description,omitempty"`
+	Completed   bool       `json:"completed"`
+	DueAt       *time.Time `json:"due_at,omitempty"`
+	Recurrence  string     `json:"recurrence,omitempty"`
+	Tenant      string     `json:"tenant,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+func newTaskRow(t *todo.Task) taskRow {
+	return taskRow{
+		ID:          t.ID,
+		Title:       t.Title,
+		Description: t.Description,
+		Completed:   t.Completed,
+		DueAt:       t.DueAt,
+		Recurrence:  t.Recurrence,
+		Tenant:      t.Tenant,
+		CreatedAt:   t.CreatedAt.UTC(),
+		UpdatedAt:   t.UpdatedAt.UTC(),
+	}
+}
+
+var taskColumns = []string{"id", "title", "description", "completed", "due_at", "recurrence", "tenant", "created_at", "updated_at"}
+
+func (taskRow) header() []string { return taskColumns }
+
+func (r taskRow) record() []string {
+	due := ""
+	if r.DueAt != nil {
+		due = r.DueAt.UTC().Format(time.RFC3339)
+	}
+	return []string{r.ID, r.Title, r.Description, strconv.FormatBool(r.Completed), due, r.Recurrence, r.Tenant,
+		r.CreatedAt.Format(time.RFC3339), r.UpdatedAt.Format(time.RFC3339)}
+}
+
+type statsRow struct {
+	Tenant          string `json:"tenant"`
+	OpenTasks       int64  `json:"open_tasks"`
+	CompletedTasks  int64  `json:"completed_tasks"`
+	OverdueTasks    int64  `json:"overdue_tasks"`
+	DeletedTasks    int64  `json:"deleted_tasks"`
+	AttachmentBytes int64  `json:"attachment_bytes"`
+}
+
+func (statsRow) header() []string {
+	return []string{"tenant", "open_tasks", "completed_tasks", "overdue_tasks", "deleted_tasks", "attachment_bytes"}
+}
+
+func (r statsRow) record() []string {
+	tenant := r.Tenant
+	if tenant == "" {
+		tenant = "*"
+	}
+	return []string{tenant, itoa(r.OpenTasks), itoa(r.CompletedTasks), itoa(r.OverdueTasks), itoa(r.DeletedTasks), itoa(r.AttachmentBytes)}
+}
+
+type purgeRow struct {
+	DeletedBefore time.Time `json:"deleted_before"`
+	Tasks         int64     `json:"tasks"`
+	Comments      int64     `json:"comments"`
+	Attachments   int64     `json:"attachments"`
+}
+
+func (purgeRow) header() []string {
+	return []string{"deleted_before", "tasks", "comments", "attachments"}
+}
+
+func (r purgeRow) record() []string {
+	return []string{r.DeletedBefore.Format(time.RFC3339), itoa(r.Tasks), itoa(r.Comments), itoa(r.Attachments)}
+}
+
+// importRow reports an input row that wasn't imported.
+type importRow struct {
+	Line   int    `json:"line"`
+	ID     string `json:"id,omitempty"`
+	Result string `json:"result"` // exists or failed
+	Error  string `json:"error,omitempty"`
+}
+
+func (importRow) header() []string { return []string{"line", "id", "result", "error"} }
+
+func (r importRow) record() []string {
+	return []string{strconv.Itoa(r.Line), r.ID, r.Result, r.Error}
+}
+
+func itoa(n int64) string {
+	return strconv.FormatInt(n, 10)
+}
+
+// printer writes rows in one format. The header comes from the first row;
+// call flush when done.
+type printer struct {
+	format string
+	json   *json.Encoder
+	csv    *csv.Writer
+	table  *tabwriter.Writer
+	header bool
+}
+
+func newPrinter(w io.Writer, format string) (*printer, error) {
+	p := &printer{format: format}
+	switch format {
+	case FormatJSON:
+		p.json = json.NewEncoder(w)
+	case FormatCSV:
+		p.csv = csv.NewWriter(w)
+	case FormatTable:
+		p.table = tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	default:
+		return nil, fmt.Errorf("unknown output format %q (want table, json or csv)", format)
+	}
+	return p, nil
+}
+
+// maxCell keeps table columns readable; json and csv print values whole.
+const maxCell = 40
+
+func (p *printer) print(r row) error {
+	switch p.format {
+	case FormatJSON:
+		return p.json.Encode(r)
+	case FormatCSV:
+		if !p.header {
+			p.header = true
+			if err := p.csv.Write(r.header()); err != nil {
+				return err
+			}
+		}
+		return p.csv.Write(r.record())
+	}
+	if !p.header {
+		p.header = true
+		fmt.Fprintln(p.table, strings.ToUpper(strings.Join(r.header(), "\t")))
+	}
+	cells := r.record()
+	for i, c := range cells {
+		c = strings.Join(strings.Fields(c), " ")
+		if len([]rune(c)) > maxCell {
+			c = string([]rune(c)[:maxCell-1]) + "…"
+		}
+		cells[i] = c
+	}
+	_, err := fmt.Fprintln(p.table, strings.Join(cells, "\t"))
+	return err
+}
+
+func (p *printer) flush() error {
+	switch p.format {
+	case FormatCSV:
+		p.csv.Flush()
+		return p.csv.Error()
+	case FormatTable:
+		return p.table.Flush()
+	}
+	return nil
+}
@@ -0,0 +1,416 @@
+// Package todoctl implements the todoctl admin commands. They run against a
+// Backend: the service on the configured database, or a server over gRPC.
+package todoctl
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/fuzail/08-todosvc/internal/taskio"
+	"github.com/fuzail/08-todosvc/internal/todo"
+)
+
+// ErrUsage is returned for bad command lines, after the usage is printed.
+var ErrUsage = errors.New("usage error")
+
+// allPageSize is the page size list -all fetches with. It must not be over
+// the server's PAGE_SIZE_MAX, 100 by default.
+const allPageSize = 100
+
+// App runs one command.
+type App struct {
+	Backend Backend
+	// Format is the output format: table (default), json or csv.
+	Format string
+	// Tenant scopes stats; tasks are created for the tenant in the context.
+	Tenant string
+	In     io.Reader // import reads "-" from here
+	Out    io.Writer
+	Err    io.Writer // usage and summaries
+	// Open opens an import file; required to import from a path.
+	Open func(name string) (io.ReadCloser, error)
+	// Now defaults to time.Now.
+	Now func() time.Time
+}
+
+type command struct {
+	usage string
+	run   func(a *App, ctx context.Context, fs *flag.FlagSet, args []string) error
+}
+
+var commands = map[string]command{
+	"create":   {"create [-id UUID] [-description TEXT] [-due TIME] [-recurrence RRULE] TITLE", (*App).create},
+	"list":     {"list [-filter ready|blocked] [-page N] [-page-size N] [-all]", (*App).list},
+	"get":      {"get ID...", (*App).get},
+	"update":   {"update [-title TEXT] [-description TEXT] ID", (*App).update},
+	"complete": {"complete [-reopen] [-force] ID...", (*App).complete},
+	"delete":   {"delete ID...", (*App).delete},
+	"export":   {"export [-format ndjson|csv|ical]", (*App).export},
+	"import":   {"import [-format ndjson|csv|ical] [-dry-run] FILE|-", (*App).importTasks},
+	"purge":    {"purge [-older-than DURATION] -yes", (*App).purge},
+	"stats":    {"stats", (*App).stats},
+}
+
+var commandOrder = []string{"create", "list", "get", "update", "complete", "delete", "export", "import", "purge", "stats"}
+
+// Usage lists the commands.
+func Usage(w io.Writer) {
+	fmt.Fprintln(w, "commands:")
+	for _, name := range commandOrder {
+		fmt.Fprintln(w, "  "+commands[name].usage)
+	}
+}
+
+// Run runs the command named by args[0] with the rest of args.
+func (a *App) Run(ctx context.Context, args []string) error {
+	if a.Format == "" {
+		a.Format = FormatTable
+	}
+	if a.Now == nil {
+		a.Now = time.Now
+	}
+	if len(args) == 0 {
+		Usage(a.Err)
+		return ErrUsage
+	}
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(a.Err, "unknown command %q\n", args[0])
+		Usage(a.Err)
+		return ErrUsage
+	}
+	fs := flag.NewFlagSet(args[0], flag.ContinueOnError)
+	fs.SetOutput(a.Err)
+	fs.Usage = func() {
+		fmt.Fprintln(a.Err, "usage: todoctl "+cmd.usage)
+		fs.PrintDefaults()
+	}
+	return cmd.run(a, ctx, fs, args[1:])
+}
+
+// parse parses flags and checks the number of arguments left.
+func parse(fs *flag.FlagSet, args []string, minArgs, maxArgs int) error {
+	if err := fs.Parse(args); err != nil {
+		return ErrUsage
+	}
+	if n := fs.NArg(); n < minArgs || (maxArgs >= 0 && n > maxArgs) {
+		fs.Usage()
+		return ErrUsage
+	}
+	return nil
+}
+
+// printTasks prints tasks in the output format.
+func (a *App) printTasks(tasks ...*todo.Task) error {
+	p, err := newPrinter(a.Out, a.Format)
+	if err != nil {
+		return err
+	}
+	for _, t := range tasks {
+		if err := p.print(newTaskRow(t)); err != nil {
+			return err
+		}
+	}
+	return p.flush()
+}
+
+// parseTime accepts RFC 3339 times and dates, which are midnight UTC.
+func parseTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.DateOnly, s)
+	if err != nil {
+		return t, fmt.Errorf("%q is not an RFC 3339 time or a YYYY-MM-DD date", s)
+	}
+	return t, nil
+}
+
+func (a *App) create(ctx context.Context, fs *flag.FlagSet, args []string) error {
+	id := fs.String("id", "", "task UUID; generated when empty")
+	description := fs.String("description", "", "description")
+	due := fs.String("due", "", "due time (RFC 3339 or YYYY-MM-DD)")
+	recurrence := fs.String("recurrence", "", `recurrence rule, e.g. "FREQ=WEEKLY;BYDAY=MO"; needs -due`)
+	if err := parse(fs, args, 1, -1); err != nil {
+		return err
+	}
+	var dueAt *time.Time
+	if *due != "" {
+		t, err := parseTime(*due)
+		if err != nil {
+			return err
+		}
+		dueAt = &t
+	}
+	t, err := a.Backend.CreateTask(ctx, *id, strings.Join(fs.Args(), " "), *description, dueAt, *recurrence)
+	if err != nil {
+		return err
+	}
+	return a.printTasks(t)
+}
+
+var filters = map[string]todo.ListFilter{"": todo.FilterAll, "ready": todo.FilterReady, "blocked": todo.FilterBlocked}
+
+func (a *App) list(ctx context.Context, fs *flag.FlagSet, args []string) error {
+	filterName := fs.String("filter", "", "ready (no open blockers) or blocked")
+	page := fs.Int("page", 1, "page number")
+	pageSize := fs.Int("page-size", 50, "tasks per page")
+	all := fs.Bool("all", false, "list every page")
+	if err := parse(fs, args, 0, 0); err != nil {
+		return err
+	}
+	filter, ok := filters[*filterName]
+	if !ok {
+		return fmt.Errorf("unknown filter %q (want ready or blocked)", *filterName)
+	}
+	p, err := newPrinter(a.Out, a.Format)
+	if err != nil {
+		return err
+	}
+	if *all {
+		if err := a.eachTask(ctx, filter, func(t *todo.Task) error { return p.print(newTaskRow(t)) }); err != nil {
+			return err
+		}
+		return p.flush()
+	}
+	tasks, total, err := a.Backend.ListTasks(ctx, *page, *pageSize, filter)
+	if err != nil {
+		return err
+	}
+	for i := range tasks {
+		if err := p.print(newTaskRow(&tasks[i])); err != nil {
+			return err
+		}
+	}
+	if err := p.flush(); err != nil {
+		return err
+	}
+	if a.Format == FormatTable {
+		fmt.Fprintf(a.Err, "page %d, %d of %d tasks\n", *page, len(tasks), total)
+	}
+	return nil
+}
+
+// eachTask calls fn for every task, a page at a time. Tasks created or
+// deleted meanwhile may be missed or seen twice.
+func (a *App) eachTask(ctx context.Context, filter todo.ListFilter, fn func(*todo.Task) error) error {
+	var seen int64
+	for page := 1; ; page++ {
+		tasks, total, err := a.Backend.ListTasks(ctx, page, allPageSize, filter)
+		if err != nil {
+			return err
+		}
+		for i := range tasks {
+			if err := fn(&tasks[i]); err != nil {
+				return err
+			}
+		}
+		seen += int64(len(tasks))
+		if len(tasks) == 0 || seen >= total {
+			return nil
+		}
+	}
+}
+
+func (a *App) get(ctx context.Context, fs *flag.FlagSet, args []string) error {
+	if err := parse(fs, args, 1, -1); err != nil {
+		return err
+	}
+	var tasks []*todo.Task
+	for _, id := range fs.Args() {
+		t, err := a.Backend.GetTask(ctx, id)
+		if err != nil {
+			return fmt.Errorf("%s: %w", id, err)
+		}
+		tasks = append(tasks, t)
+	}
+	return a.printTasks(tasks...)
+}
+
+func (a *App) update(ctx context.Context, fs *flag.FlagSet, args []string) error {
+	title := fs.String("title", "", "new title")
+	description := fs.String("description", "", "new description")
+	if err := parse(fs, args, 1, 1); err != nil {
+		return err
+	}
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	if len(set) == 0 {
+		return errors.New("nothing to update: pass -title and/or -description")
+	}
+	// the API replaces both fields; keep the one not given
+	id := fs.Arg(0)
+	cur, err := a.Backend.GetTask(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !set["title"] {
+		*title = cur.Title
+	}
+	if !set["description"] {
+		*description = cur.Description
+	}
+	t, err := a.Backend.UpdateTask(ctx, id, *title, *description)
+	if err != nil {
+		return err
+	}
+	return a.printTasks(t)
+}
+
+func (a *App) complete(ctx context.Context, fs *flag.FlagSet, args []string) error {
+	reopen := fs.Bool("reopen", false, "mark the tasks open again")
+	force := fs.Bool("force", false, "complete tasks even if they have open blockers")
+	if err := parse(fs, args, 1, -1); err != nil {
+		return err
+	}
+	var tasks []*todo.Task
+	for _, id := range fs.Args() {
+		t, err := a.Backend.MarkComplete(ctx, id, !*reopen, *force)
+		if err != nil {
+			return fmt.Errorf("%s: %w", id, err)
+		}
+		tasks = append(tasks, t)
+	}
+	return a.printTasks(tasks...)
+}
+
+func (a *App) delete(ctx context.Context, fs *flag.FlagSet, args []string) error {
+	if err := parse(fs, args, 1, -1); err != nil {
+		return err
+	}
+	for _, id := range fs.Args() {
+		if err := a.Backend.DeleteTask(ctx, id); err != nil {
+			return fmt.Errorf("%s: %w", id, err)
+		}
+		fmt.Fprintln(a.Err, "deleted", id)
+	}
+	return nil
+}
+
+func (a *App) export(ctx context.Context, fs *flag.FlagSet, args []string) error {
+	name := fs.String("format", string(taskio.NDJSON), "ndjson, csv or ical")
+	if err := parse(fs, args, 0, 0); err != nil {
+		return err
+	}
+	format, err := taskio.ParseFormat(*name)
+	if err != nil {
+		return err
+	}
+	return a.Backend.Export(ctx, a.Out, format)
+}
+
+// errImportFailed is returned when some rows could not be imported.
+var errImportFailed = errors.New("some rows were not imported")
+
+func (a *App) importTasks(ctx context.Context, fs *flag.FlagSet, args []string) error {
+	name := fs.String("format", "", "ndjson, csv or ical; by default from the file extension, else ndjson")
+	dryRun := fs.Bool("dry-run", false, "check every row without creating tasks")
+	if err := parse(fs, args, 1, 1); err != nil {
+		return err
+	}
+	file := fs.Arg(0)
+	format, err := taskio.ParseFormat(*name)
+	if err != nil {
+		return err
+	}
+	if f, ok := taskio.FormatForFile(file); ok && *name == "" {
+		format = f
+	}
+	var in io.Reader = a.In
+	if file != "-" {
+		if a.Open == nil {
+			return errors.New("import: reading files is not supported here")
+		}
+		f, err := a.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+
+	p, err := newPrinter(a.Out, a.Format)
+	if err != nil {
+		return err
+	}
+	// only rows that weren't imported are listed
+	sum, err := a.Backend.Import(ctx, in, format, *dryRun, func(r taskio.Result) error {
+		if r.Status == taskio.Created || r.Status == taskio.Valid {
+			return nil
+		}
+		row := importRow{Line: r.Line, ID: r.ID, Result: string(r.Status)}
+		if r.Err != nil {
+			row.Error = r.Err.Error()
+		}
+		return p.print(row)
+	})
+	if ferr := p.flush(); err == nil {
+		err = ferr
+	}
+	if err != nil {
+		return err
+	}
+	verb := "created"
+	if sum.DryRun {
+		verb = "valid"
+	}
+	fmt.Fprintf(a.Err, "%d %s, %d already existed, %d failed\n", sum.Created, verb, sum.Existing, sum.Failed)
+	if sum.Failed > 0 {
+		return errImportFailed
+	}
+	return nil
+}
+
+func (a *App) purge(ctx context.Context, fs *flag.FlagSet, args []string) error {
+	olderThan := fs.Duration("older-than", 30*24*time.Hour, "purge tasks deleted longer ago than this")
+	yes := fs.Bool("yes", false, "confirm; purged tasks can't be restored")
+	if err := parse(fs, args, 0, 0); err != nil {
+		return err
+	}
+	if !*yes {
+		return errors.New("purge permanently removes deleted tasks, their comments and attachments; pass -yes to confirm")
+	}
+	before := a.Now().Add(-*olderThan)
+	res, err := a.Backend.PurgeDeleted(ctx, before)
+	if err != nil {
+		return err
+	}
+	p, err := newPrinter(a.Out, a.Format)
+	if err != nil {
+		return err
+	}
+	if err := p.print(purgeRow{DeletedBefore: before.UTC(), Tasks: res.Tasks, Comments: res.Comments, Attachments: res.Attachments}); err != nil {
+		return err
+	}
+	return p.flush()
+}
+
+func (a *App) stats(ctx context.Context, fs *flag.FlagSet, args []string) error {
+	if err := parse(fs, args, 0, 0); err != nil {
+		return err
+	}
+	st, err := a.Backend.Stats(ctx, a.Tenant)
+	if err != nil {
+		return err
+	}
+	p, err := newPrinter(a.Out, a.Format)
+	if err != nil {
+		return err
+	}
+	if err := p.print(statsRow{
+		Tenant:          st.Tenant,
+		OpenTasks:       st.OpenTasks,
+		CompletedTasks:  st.CompletedTasks,
+		OverdueTasks:    st.OverdueTasks,
+		DeletedTasks:    st.DeletedTasks,
+		AttachmentBytes: st.AttachmentBytes,
+	}); err != nil {
+		return err
+	}
+	return p.flush()
+}
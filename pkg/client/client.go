@@ -0,0 +1,63 @@
+// Package client is the Go client of the todo service's gRPC API. It wraps
+// the generated clients with the things every caller needs: credentials,
+// the tenant, a default deadline and retries of idempotent RPCs.
+//
+//	c, err := client.New("todo.internal:50051",
+//		client.WithMTLS("client.crt", "client.key", "ca.crt"),
+//		client.WithTenant("acme"))
+//	if err != nil {
+//		return err
+//	}
+//	defer c.Close()
+//	for task, err := range c.Tasks(ctx, &pb.ListTasksRequest{Filter: pb.ListTasksRequest_READY}) {
+//		...
+//	}
+//
+// For tests, package clienttest runs the service in process.
+package client
+
+import (
+	"fmt"
+
+	pb "github.com/fuzail/08-todosvc/proto/todo/v1"
+	"google.golang.org/grpc"
+)
+
+// Client calls the todo service. The RPCs are those of the generated
+// TodoServiceClient; the admin API is on Admin. It is safe for concurrent
+// use, and should be shared rather than created per call.
+type Client struct {
+	pb.TodoServiceClient
+	Admin pb.AdminServiceClient
+
+	conn *grpc.ClientConn
+}
+
+// New connects to the server at target, e.g. "dns:///todo.internal:50051".
+// Connections are made lazily, so a server that is down fails the first
+// RPC rather than New. Without options, the connection uses TLS with the
+// system roots, RPCs get DefaultTimeout and idempotent ones are retried by
+// DefaultRetryPolicy.
+func New(target string, opts ...Option) (*Client, error) {
+	o := defaultOptions()
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.err != nil {
+		return nil, fmt.Errorf("client options: %w", o.err)
+	}
+	conn, err := grpc.NewClient(target, o.dialOptions()...)
+	if err != nil {
+		return nil, fmt.Errorf("dial %s: %w", target, err)
+	}
+	return &Client{
+		TodoServiceClient: pb.NewTodoServiceClient(conn),
+		Admin:             pb.NewAdminServiceClient(conn),
+		conn:              conn,
+	}, nil
+}
+
+// Close closes the connection; RPCs in flight fail.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
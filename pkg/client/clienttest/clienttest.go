@@ -0,0 +1,187 @@
+// Package clienttest runs the todo service in process, for tests of code
+// that uses package client. The server is the real one, with its
+// validation, errors and pagination, over an in-memory SQLite database and
+// a bufconn listener, so tests need neither a network nor Postgres:
+//
+//	srv, err := clienttest.NewServer()
+//	if err != nil {
+//		t.Fatal(err)
+//	}
+//	defer srv.Close()
+//	c, err := srv.Client(client.WithTenant("acme"))
+//
+// Each Server has its own database. The client acts for the tenant it sends,
+// as if its certificate had every tenant; client certificates, rate limits
+// and quotas are not checked.
+package clienttest
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	grpcapi "github.com/fuzail/08-todosvc/internal/grpc"
+	"github.com/fuzail/08-todosvc/internal/reqctx"
+	"github.com/fuzail/08-todosvc/internal/todo"
+	"github.com/fuzail/08-todosvc/pkg/client"
+	"github.com/fuzail/08-todosvc/pkg/storage"
+	pb "github.com/fuzail/08-todosvc/proto/todo/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/test/bufconn"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+const bufSize = 1 << 20
+
+// databases numbers the in-memory databases so servers don't share one.
+var databases atomic.Int64
+
+// Server is an in-process todo service.
+type Server struct {
+	lis     *bufconn.Listener
+	srv     *grpc.Server
+	db      *gorm.DB
+	blobDir string
+
+	mu       sync.Mutex
+	failures map[string][]error
+}
+
+// NewServer starts a server with an empty database.
+func NewServer() (*Server, error) {
+	dsn := fmt.Sprintf("file:clienttest-%d?mode=memory&cache=shared", databases.Add(1))
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{TranslateError: true, Logger: logger.Discard})
+	if err != nil {
+		return nil, fmt.Errorf("open sqlite: %w", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	// one connection keeps the in-memory database alive and serializes
+	// writes, which SQLite can't run concurrently
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&todo.Task{}, &todo.ChangeCounter{}, &todo.Dependency{}, &todo.Comment{}, &todo.Attachment{}, &todo.Quota{}); err != nil {
+		_ = sqlDB.Close()
+		return nil, fmt.Errorf("migrate: %w", err)
+	}
+	blobDir, err := os.MkdirTemp("", "clienttest-blobs-")
+	if err != nil {
+		_ = sqlDB.Close()
+		return nil, err
+	}
+	blobs, err := storage.NewFSStore(blobDir)
+	if err != nil {
+		_ = sqlDB.Close()
+		_ = os.RemoveAll(blobDir)
+		return nil, err
+	}
+
+	repo := todo.NewGormRepository(db)
+	quotas := todo.NewQuotaService(todo.NewGormQuotaRepository(db), todo.Quota{})
+	s := &Server{
+		lis:      bufconn.Listen(bufSize),
+		db:       db,
+		blobDir:  blobDir,
+		failures: map[string][]error{},
+	}
+	s.srv = grpc.NewServer(
+		grpc.ChainUnaryInterceptor(tenantUnary, s.failUnary),
+		grpc.ChainStreamInterceptor(tenantStream, s.failStream))
+	pb.RegisterTodoServiceServer(s.srv, grpcapi.NewHandler(
+		todo.NewService(repo, todo.Limits{}, nil),
+		todo.NewCommentService(todo.NewGormCommentRepository(db), repo, todo.Limits{}),
+		todo.NewAttachmentService(todo.NewGormAttachmentRepository(db), repo, blobs, todo.DefaultMaxAttachmentSize, nil)))
+	pb.RegisterAdminServiceServer(s.srv, grpcapi.NewAdminHandler(quotas,
+		todo.NewMaintenanceService(todo.NewGormMaintenanceRepository(db), blobs)))
+	go func() { _ = s.srv.Serve(s.lis) }()
+	return s, nil
+}
+
+// Client returns a client of the server. It is plaintext and, unless opts
+// say otherwise, has the default deadline and retry policy.
+func (s *Server) Client(opts ...client.Option) (*client.Client, error) {
+	dial := func(ctx context.Context, _ string) (net.Conn, error) { return s.lis.DialContext(ctx) }
+	opts = append([]client.Option{
+		client.WithInsecure(),
+		client.WithDialOptions(grpc.WithContextDialer(dial)),
+	}, opts...)
+	return client.New("passthrough:///bufconn", opts...)
+}
+
+// FailNext makes the next len(errs) calls of method, a full method name such
+// as pb.TodoService_GetTask_FullMethodName, fail with errs in turn before
+// reaching the service, e.g. to test how code copes with an unavailable
+// server. The errors should be status errors.
+func (s *Server) FailNext(method string, errs ...error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures[method] = append(s.failures[method], errs...)
+}
+
+// Close stops the server and removes its data.
+func (s *Server) Close() {
+	s.srv.Stop()
+	if sqlDB, err := s.db.DB(); err == nil {
+		_ = sqlDB.Close()
+	}
+	_ = os.RemoveAll(s.blobDir)
+}
+
+func (s *Server) nextFailure(method string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	errs := s.failures[method]
+	if len(errs) == 0 {
+		return nil
+	}
+	s.failures[method] = errs[1:]
+	return errs[0]
+}
+
+func (s *Server) failUnary(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if err := s.nextFailure(info.FullMethod); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (s *Server) failStream(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := s.nextFailure(info.FullMethod); err != nil {
+		return err
+	}
+	return handler(srv, ss)
+}
+
+// tenantUnary and tenantStream take the tenant from the metadata, as the
+// server does for a client that may act for every tenant.
+func tenantUnary(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	return handler(withTenant(ctx), req)
+}
+
+func tenantStream(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	return handler(srv, &tenantServerStream{ServerStream: ss, ctx: withTenant(ss.Context())})
+}
+
+type tenantServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *tenantServerStream) Context() context.Context {
+	return s.ctx
+}
+
+func withTenant(ctx context.Context) context.Context {
+	if v := metadata.ValueFromIncomingContext(ctx, strings.ToLower(reqctx.TenantHeader)); len(v) > 0 {
+		return reqctx.WithTenant(ctx, v[0])
+	}
+	return ctx
+}
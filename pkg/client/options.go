@@ -0,0 +1,196 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+)
+
+// Metadata keys the server reads; they match its X-API-Key and X-Tenant-ID
+// HTTP headers.
+const (
+	apiKeyKey = "x-api-key"
+	tenantKey = "x-tenant-id"
+)
+
+// DefaultTimeout is the deadline of unary RPCs whose context has none.
+const DefaultTimeout = 10 * time.Second
+
+// Option configures a Client.
+type Option func(*options)
+
+type options struct {
+	transport credentials.TransportCredentials
+	perRPC    []credentials.PerRPCCredentials
+	tenant    string
+	timeout   time.Duration
+	retry     RetryPolicy
+	extra     []grpc.DialOption
+	err       error
+}
+
+func defaultOptions() options {
+	return options{
+		transport: credentials.NewTLS(&tls.Config{MinVersion: tls.VersionTLS12}),
+		timeout:   DefaultTimeout,
+		retry:     DefaultRetryPolicy,
+	}
+}
+
+func (o *options) dialOptions() []grpc.DialOption {
+	opts := []grpc.DialOption{grpc.WithTransportCredentials(o.transport)}
+	for _, c := range o.perRPC {
+		opts = append(opts, grpc.WithPerRPCCredentials(c))
+	}
+	// the deadline is set first so it bounds every retry of a call
+	opts = append(opts,
+		grpc.WithChainUnaryInterceptor(tenantUnary(o.tenant), deadlineUnary(o.timeout), retryUnary(o.retry)),
+		grpc.WithChainStreamInterceptor(tenantStream(o.tenant)))
+	return append(opts, o.extra...)
+}
+
+// WithInsecure sends RPCs in plaintext, as to a server without TLS on a
+// development machine. Credentials that need TLS, such as WithJWT, then
+// make New fail.
+func WithInsecure() Option {
+	return func(o *options) { o.transport = insecure.NewCredentials() }
+}
+
+// WithTLSConfig uses cfg for the connection, e.g. for a private CA or a
+// client certificate held in memory.
+func WithTLSConfig(cfg *tls.Config) Option {
+	return func(o *options) { o.transport = credentials.NewTLS(cfg) }
+}
+
+// WithMTLS authenticates the client with the certificate and key in
+// certFile and keyFile (PEM), the way the server identifies callers. caFile
+// is the CA bundle to verify the server with; the system roots are used if
+// it is empty.
+func WithMTLS(certFile, keyFile, caFile string) Option {
+	return func(o *options) {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			o.err = errors.Join(o.err, fmt.Errorf("client certificate: %w", err))
+			return
+		}
+		cfg := &tls.Config{MinVersion: tls.VersionTLS12, Certificates: []tls.Certificate{cert}}
+		if caFile != "" {
+			pem, err := os.ReadFile(caFile)
+			if err != nil {
+				o.err = errors.Join(o.err, fmt.Errorf("ca file: %w", err))
+				return
+			}
+			cfg.RootCAs = x509.NewCertPool()
+			if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+				o.err = errors.Join(o.err, fmt.Errorf("%s: no certificates found", caFile))
+				return
+			}
+		}
+		o.transport = credentials.NewTLS(cfg)
+	}
+}
+
+// WithAPIKey sends key as x-api-key. It doesn't authenticate the client:
+// the server only uses it to rate limit by, and only if it is one of the
+// keys in RATE_LIMIT_API_KEYS, so it is sent over plaintext connections
+// too. Clients are authenticated by their certificate (WithMTLS).
+func WithAPIKey(key string) Option {
+	return func(o *options) { o.perRPC = append(o.perRPC, apiKeyCreds(key)) }
+}
+
+// WithJWT sends token as a bearer token in the authorization metadata, for
+// deployments where a gateway or proxy in front of the server verifies it.
+// The server itself doesn't: it authenticates clients by their certificate.
+func WithJWT(token string) Option {
+	return WithTokenSource(func(context.Context) (string, error) { return token, nil })
+}
+
+// WithTokenSource is WithJWT for tokens that expire: source is called for
+// every RPC and should cache the token until it is about to expire.
+func WithTokenSource(source func(ctx context.Context) (string, error)) Option {
+	return func(o *options) { o.perRPC = append(o.perRPC, tokenCreds(source)) }
+}
+
+// WithTenant sends every RPC on behalf of tenant. The server only accepts
+// tenants configured for the client's certificate; without this option the
+// client acts for the first of them.
+func WithTenant(tenant string) Option {
+	return func(o *options) { o.tenant = tenant }
+}
+
+// WithTimeout sets the deadline of unary RPCs whose context has none, in
+// place of DefaultTimeout; 0 leaves them without one. Streaming RPCs such
+// as ExportTasks only end with their context.
+func WithTimeout(d time.Duration) Option {
+	return func(o *options) { o.timeout = d }
+}
+
+// WithRetryPolicy replaces DefaultRetryPolicy; a MaxAttempts of 1 turns
+// retries off.
+func WithRetryPolicy(p RetryPolicy) Option {
+	return func(o *options) { o.retry = p }
+}
+
+// WithDialOptions adds options to the underlying grpc.NewClient call, e.g.
+// a custom dialer or stats handler.
+func WithDialOptions(opts ...grpc.DialOption) Option {
+	return func(o *options) { o.extra = append(o.extra, opts...) }
+}
+
+type apiKeyCreds string
+
+func (k apiKeyCreds) GetRequestMetadata(context.Context, ...string) (map[string]string, error) {
+	return map[string]string{apiKeyKey: string(k)}, nil
+}
+
+func (apiKeyCreds) RequireTransportSecurity() bool { return false }
+
+type tokenCreds func(ctx context.Context) (string, error)
+
+func (t tokenCreds) GetRequestMetadata(ctx context.Context, _ ...string) (map[string]string, error) {
+	token, err := t(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("token: %w", err)
+	}
+	return map[string]string{"authorization": "Bearer " + token}, nil
+}
+
+func (tokenCreds) RequireTransportSecurity() bool { return true }
+
+func tenantUnary(tenant string) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if tenant != "" {
+			ctx = metadata.AppendToOutgoingContext(ctx, tenantKey, tenant)
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+func tenantStream(tenant string) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		if tenant != "" {
+			ctx = metadata.AppendToOutgoingContext(ctx, tenantKey, tenant)
+		}
+		return streamer(ctx, desc, cc, method, opts...)
+	}
+}
+
+func deadlineUnary(d time.Duration) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if _, ok := ctx.Deadline(); !ok && d > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, d)
+			defer cancel()
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
@@ -0,0 +1,122 @@
+package client
+
+import (
+	"context"
+	"math/rand/v2"
+	"time"
+
+	pb "github.com/fuzail/08-todosvc/proto/todo/v1"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// RetryPolicy retries the idempotent RPCs: reads, and writes that set a
+// value such as UpdateTask, which leave the same result however often they
+// run. Others, such as CreateTask or MarkComplete on a recurring task, are
+// never retried, since the first attempt may have taken effect.
+//
+// An attempt is retried if the server was unavailable, or if it was rate
+// limited and said when to retry (a RetryInfo detail). Attempts are
+// spaced by exponential backoff with full jitter, or by the server's
+// RetryInfo, and all of them share the call's deadline.
+type RetryPolicy struct {
+	// MaxAttempts counts the first attempt; 1 or less turns retries off.
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+}
+
+// DefaultRetryPolicy is the policy of clients without WithRetryPolicy.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    4,
+	InitialBackoff: 100 * time.Millisecond,
+	MaxBackoff:     5 * time.Second,
+	Multiplier:     2,
+}
+
+// idempotentMethods are the RPCs the retry policy applies to.
+var idempotentMethods = map[string]bool{
+	pb.TodoService_GetTask_FullMethodName:         true,
+	pb.TodoService_ListTasks_FullMethodName:       true,
+	pb.TodoService_UpdateTask_FullMethodName:      true,
+	pb.TodoService_ListBlockers_FullMethodName:    true,
+	pb.TodoService_ListComments_FullMethodName:    true,
+	pb.TodoService_EditComment_FullMethodName:     true,
+	pb.TodoService_ListAttachments_FullMethodName: true,
+	pb.AdminService_GetQuota_FullMethodName:       true,
+	pb.AdminService_SetQuota_FullMethodName:       true,
+	pb.AdminService_GetUsage_FullMethodName:       true,
+	pb.AdminService_GetTaskStats_FullMethodName:   true,
+}
+
+// backoff is how long to wait before retry n (1-based).
+func (p RetryPolicy) backoff(n int) time.Duration {
+	d := float64(p.InitialBackoff)
+	for i := 1; i < n; i++ {
+		d *= p.Multiplier
+	}
+	if limit := float64(p.MaxBackoff); p.MaxBackoff > 0 && d > limit {
+		d = limit
+	}
+	if d < 1 {
+		return 0
+	}
+	return rand.N(time.Duration(d))
+}
+
+// retryDelay reports whether err may be retried and, if the server said
+// how long to wait, for how long.
+func retryDelay(err error) (delay time.Duration, ok bool) {
+	st := status.Convert(err)
+	switch st.Code() {
+	case codes.Unavailable:
+		ok = true
+	case codes.ResourceExhausted:
+		// quota errors are resource exhausted too, but come without a delay
+		// as waiting doesn't help
+	default:
+		return 0, false
+	}
+	for _, d := range st.Details() {
+		if info, isInfo := d.(*errdetails.RetryInfo); isInfo && info.GetRetryDelay() != nil {
+			return info.GetRetryDelay().AsDuration(), true
+		}
+	}
+	return 0, ok
+}
+
+func retryUnary(p RetryPolicy) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if p.MaxAttempts <= 1 || !idempotentMethods[method] {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+		for attempt := 1; ; attempt++ {
+			err := invoker(ctx, method, req, reply, cc, opts...)
+			if err == nil || attempt >= p.MaxAttempts {
+				return err
+			}
+			wait, ok := retryDelay(err)
+			if !ok {
+				return err
+			}
+			if wait == 0 {
+				wait = p.backoff(attempt)
+			}
+			// report the server's error rather than a deadline that would
+			// pass while waiting
+			if deadline, has := ctx.Deadline(); has && time.Until(deadline) < wait {
+				return err
+			}
+			timer := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return err
+			case <-timer.C:
+			}
+		}
+	}
+}
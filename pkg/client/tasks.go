@@ -0,0 +1,54 @@
+package client
+
+import (
+	"context"
+	"iter"
+
+	pb "github.com/fuzail/08-todosvc/proto/todo/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// DefaultPageSize is the page size Tasks reads with when the request sets
+// none; it is the server's default maximum.
+const DefaultPageSize = 100
+
+// Tasks iterates over the tasks req lists, newest first, reading a page at
+// a time from req.Page (the first if unset). It stops at the first error,
+// which it yields with a nil task:
+//
+//	for task, err := range c.Tasks(ctx, &pb.ListTasksRequest{}) {
+//		if err != nil {
+//			return err
+//		}
+//		...
+//	}
+//
+// Pages are numbered, so tasks created while iterating shift the later
+// pages: a task may then be seen twice. Use SyncTasks to follow changes.
+func (c *Client) Tasks(ctx context.Context, req *pb.ListTasksRequest) iter.Seq2[*pb.Task, error] {
+	return func(yield func(*pb.Task, error) bool) {
+		req := proto.Clone(req).(*pb.ListTasksRequest)
+		if req.Page < 1 {
+			req.Page = 1
+		}
+		if req.PageSize < 1 {
+			req.PageSize = DefaultPageSize
+		}
+		for {
+			resp, err := c.ListTasks(ctx, req)
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			for _, t := range resp.Tasks {
+				if !yield(t, nil) {
+					return
+				}
+			}
+			if len(resp.Tasks) < int(req.PageSize) || int64(req.Page)*int64(req.PageSize) >= resp.Total {
+				return
+			}
+			req.Page++
+		}
+	}
+}
@@ -3,46 +3,46 @@ package db
 import (
 	"context"
 	"fmt"
-	"log"
-	"os"
-	"strconv"
+	"log/slog"
 	"time"
 
-	"github.com/joho/godotenv"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
 )
 
-func envOrDefault(key, d string) string {
-	v := os.Getenv(key)
-	if v == "" {
-		return d
-	}
-	return v
-}
-
-func NewGormDBFromEnv() (*gorm.DB, error) {
-	// try to load .env if present — non-fatal if file is missing
-	if err := godotenv.Load(); err != nil {
-		// it's okay if .env doesn't exist; prefer real env vars in CI/prod
-		if !os.IsNotExist(err) {
-			// Print a debug message but continue; godotenv returns an error even when .env missing,
-			// so only log in verbose cases (we keep it simple and log).
-			log.Printf("warning: could not load .env: %v", err)
-		}
-	}
+// Config is how to reach Postgres and size the connection pool.
+type Config struct {
+	Host     string
+	Port     int
+	User     string
+	Password string
+	Name     string
+	SSLMode  string
 
-	host := envOrDefault("DB_HOST", "localhost")
-	port := envOrDefault("DB_PORT", "5432")
-	user := envOrDefault("DB_USER", "todo")
-	password := envOrDefault("DB_PASSWORD", "todo")
-	dbname := envOrDefault("DB_NAME", "todo_db")
-	ssl := envOrDefault("DB_SSLMODE", "disable")
+	MaxIdleConns    int
+	MaxOpenConns    int
+	ConnMaxLifetime time.Duration
+}
 
-	dsn := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
-		host, port, user, password, dbname, ssl)
+// DSN returns the connection string for cfg.
+func (cfg Config) DSN() string {
+	return fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
+		cfg.Host, cfg.Port, cfg.User, cfg.Password, cfg.Name, cfg.SSLMode)
+}
 
-	gormDB, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+// NewGormDB connects to Postgres and checks the connection.
+func NewGormDB(cfg Config) (*gorm.DB, error) {
+	// TranslateError maps driver errors (e.g. unique violations) to gorm.Err* values
+	gormDB, err := gorm.Open(postgres.Open(cfg.DSN()), &gorm.Config{
+		TranslateError: true,
+		// slow queries and errors go through slog so they carry the request ID
+		Logger: logger.NewSlogLogger(slog.Default(), logger.Config{
+			LogLevel:                  logger.Warn,
+			SlowThreshold:             200 * time.Millisecond,
+			IgnoreRecordNotFoundError: true,
+		}),
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -53,36 +53,15 @@ func NewGormDBFromEnv() (*gorm.DB, error) {
 		return nil, err
 	}
 
-	// sensible defaults
-	maxIdleConns := 10
-	maxOpenConns := 100
-	connMaxLifetime := time.Minute * 30
-
-	if v := os.Getenv("DB_MAX_IDLE_CONNS"); v != "" {
-		if i, err := strconv.Atoi(v); err == nil {
-			maxIdleConns = i
-		}
-	}
-	if v := os.Getenv("DB_MAX_OPEN_CONNS"); v != "" {
-		if i, err := strconv.Atoi(v); err == nil {
-			maxOpenConns = i
-		}
-	}
-	if v := os.Getenv("DB_CONN_MAX_LIFETIME_MIN"); v != "" {
-		if i, err := strconv.Atoi(v); err == nil {
-			connMaxLifetime = time.Duration(i) * time.Minute
-		}
-	}
-
-	sqlDB.SetMaxIdleConns(maxIdleConns)
-	sqlDB.SetMaxOpenConns(maxOpenConns)
-	sqlDB.SetConnMaxLifetime(connMaxLifetime)
+	sqlDB.SetMaxIdleConns(cfg.MaxIdleConns)
+	sqlDB.SetMaxOpenConns(cfg.MaxOpenConns)
+	sqlDB.SetConnMaxLifetime(cfg.ConnMaxLifetime)
 
 	// quick ping check with timeout
 	tctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 	if err := sqlDB.PingContext(tctx); err != nil {
-		log.Printf("db ping failed: %v", err)
+		slog.Error("db ping failed", "err", err)
 		return nil, err
 	}
 
@@ -0,0 +1,18 @@
+package db
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"gorm.io/gorm"
+)
+
+// StatsCollector reports the sql.DBStats of gormDB's pool (open, in use and
+// idle connections, waits, ...) as go_sql_* gauges and counters labelled with
+// dbName.
+func StatsCollector(gormDB *gorm.DB, dbName string) (prometheus.Collector, error) {
+	sqlDB, err := gormDB.DB()
+	if err != nil {
+		return nil, err
+	}
+	return collectors.NewDBStatsCollector(sqlDB, dbName), nil
+}
@@ -0,0 +1,68 @@
+package db
+
+import (
+	"context"
+	"errors"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+var tracer = otel.Tracer("github.com/fuzail/08-todosvc/pkg/db")
+
+const parentCtxKey = "otel:parent_ctx"
+
+// RegisterTracing adds GORM callbacks that wrap every statement in a span
+// named after the operation ("gorm.query", "gorm.create", ...) with the SQL,
+// table and affected rows as attributes.
+func RegisterTracing(gormDB *gorm.DB) error {
+	cb := gormDB.Callback()
+	return errors.Join(
+		cb.Create().Before("gorm:create").Register("otel:before_create", startSpan("create")),
+		cb.Create().After("gorm:create").Register("otel:after_create", endSpan),
+		cb.Query().Before("gorm:query").Register("otel:before_query", startSpan("query")),
+		cb.Query().After("gorm:query").Register("otel:after_query", endSpan),
+		cb.Update().Before("gorm:update").Register("otel:before_update", startSpan("update")),
+		cb.Update().After("gorm:update").Register("otel:after_update", endSpan),
+		cb.Delete().Before("gorm:delete").Register("otel:before_delete", startSpan("delete")),
+		cb.Delete().After("gorm:delete").Register("otel:after_delete", endSpan),
+		cb.Row().Before("gorm:row").Register("otel:before_row", startSpan("row")),
+		cb.Row().After("gorm:row").Register("otel:after_row", endSpan),
+		cb.Raw().Before("gorm:raw").Register("otel:before_raw", startSpan("raw")),
+		cb.Raw().After("gorm:raw").Register("otel:after_raw", endSpan),
+	)
+}
+
+func startSpan(op string) func(*gorm.DB) {
+	return func(tx *gorm.DB) {
+		// remember the caller's context so a reused statement (Count then
+		// Find) doesn't nest the next span under this one
+		tx.InstanceSet(parentCtxKey, tx.Statement.Context)
+		ctx, _ := tracer.Start(tx.Statement.Context, "gorm."+op, trace.WithSpanKind(trace.SpanKindClient))
+		tx.Statement.Context = ctx
+	}
+}
+
+func endSpan(tx *gorm.DB) {
+	span := trace.SpanFromContext(tx.Statement.Context)
+	if parent, ok := tx.InstanceGet(parentCtxKey); ok {
+		tx.Statement.Context = parent.(context.Context)
+	}
+	if !span.IsRecording() {
+		return
+	}
+	span.SetAttributes(
+		attribute.String("db.system", tx.Dialector.Name()),
+		attribute.String("db.statement", tx.Statement.SQL.String()),
+		attribute.String("db.sql.table", tx.Statement.Table),
+		attribute.Int64("db.rows_affected", tx.Statement.RowsAffected),
+	)
+	if tx.Error != nil && !errors.Is(tx.Error, gorm.ErrRecordNotFound) {
+		span.RecordError(tx.Error)
+		span.SetStatus(codes.Error, tx.Error.Error())
+	}
+	span.End()
+}
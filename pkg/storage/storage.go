@@ -0,0 +1,104 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+)
+
+var ErrNotFound = errors.New("blob not found")
+
+// BlobStore keeps attachment bytes. Keys are slash-separated paths chosen by
+// the caller.
+type BlobStore interface {
+	// Put stores size bytes from r under key. size may be -1 if unknown.
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Get returns length bytes starting at offset; length -1 reads to the end.
+	Get(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// Config picks a blob store and configures it.
+type Config struct {
+	// Store is "fs" or "s3".
+	Store string
+	// FSDir is the directory the fs store writes under.
+	FSDir string
+	S3    S3Config
+}
+
+// New opens the store named by cfg.Store.
+func New(cfg Config) (BlobStore, error) {
+	switch cfg.Store {
+	case "fs":
+		return NewFSStore(cfg.FSDir)
+	case "s3":
+		return NewS3Store(cfg.S3)
+	default:
+		return nil, fmt.Errorf("unknown blob store %q", cfg.Store)
+	}
+}
+
+// ReadSeeker adapts a stored blob of known size to io.ReadSeeker, e.g. for
+// http.ServeContent. Each seek followed by a read opens a new ranged Get.
+type ReadSeeker struct {
+	ctx   context.Context
+	store BlobStore
+	key   string
+	size  int64
+	off   int64
+	rc    io.ReadCloser
+}
+
+func NewReadSeeker(ctx context.Context, store BlobStore, key string, size int64) *ReadSeeker {
+	return &ReadSeeker{ctx: ctx, store: store, key: key, size: size}
+}
+
+func (r *ReadSeeker) Read(p []byte) (int, error) {
+	if r.off >= r.size {
+		return 0, io.EOF
+	}
+	if r.rc == nil {
+		rc, err := r.store.Get(r.ctx, r.key, r.off, -1)
+		if err != nil {
+			return 0, err
+		}
+		r.rc = rc
+	}
+	n, err := r.rc.Read(p)
+	r.off += int64(n)
+	return n, err
+}
+
+func (r *ReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	var abs int64
+	switch whence {
+	case io.SeekStart:
+		abs = offset
+	case io.SeekCurrent:
+		abs = r.off + offset
+	case io.SeekEnd:
+		abs = r.size + offset
+	default:
+		return 0, errors.New("seek: invalid whence")
+	}
+	if abs < 0 {
+		return 0, errors.New("seek: negative position")
+	}
+	if abs != r.off && r.rc != nil {
+		r.rc.Close()
+		r.rc = nil
+	}
+	r.off = abs
+	return abs, nil
+}
+
+func (r *ReadSeeker) Close() error {
+	if r.rc == nil {
+		return nil
+	}
+	err := r.rc.Close()
+	r.rc = nil
+	return err
+}
@@ -0,0 +1,177 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/fuzail/08-todosvc/internal/todo"
+	"github.com/fuzail/08-todosvc/pkg/storage"
+)
+
+// s3Stub is a minimal MinIO-style object server: PUT, GET (with Range) and
+// DELETE on /bucket/key, requiring a SigV4 Authorization header.
+func s3Stub(t *testing.T) *httptest.Server {
+	var mu sync.Mutex
+	objects := map[string][]byte{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=test-key/") ||
+			r.Header.Get("X-Amz-Date") == "" {
+			http.Error(w, "AccessDenied", http.StatusForbidden)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.Method {
+		case http.MethodPut:
+			body, _ := io.ReadAll(r.Body)
+			if int64(len(body)) != r.ContentLength {
+				http.Error(w, "IncompleteBody", http.StatusBadRequest)
+				return
+			}
+			objects[r.URL.Path] = body
+		case http.MethodGet:
+			obj, ok := objects[r.URL.Path]
+			if !ok {
+				http.Error(w, "NoSuchKey", http.StatusNotFound)
+				return
+			}
+			var start, end int
+			end = len(obj) - 1
+			if rng := r.Header.Get("Range"); rng != "" {
+				if _, err := fmt.Sscanf(rng, "bytes=%d-%d", &start, &end); err != nil {
+					fmt.Sscanf(rng, "bytes=%d-", &start)
+				}
+				w.WriteHeader(http.StatusPartialContent)
+			}
+			w.Write(obj[start : end+1])
+		case http.MethodDelete:
+			delete(objects, r.URL.Path)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func testBlobStores(t *testing.T) map[string]storage.BlobStore {
+	fs, err := storage.NewFSStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("fs store: %v", err)
+	}
+	s3, err := storage.NewS3Store(storage.S3Config{
+		Endpoint:        s3Stub(t).URL,
+		Bucket:          "todo",
+		AccessKeyID:     "test-key",
+		SecretAccessKey: "test-secret",
+	})
+	if err != nil {
+		t.Fatalf("s3 store: %v", err)
+	}
+	return map[string]storage.BlobStore{"fs": fs, "s3": s3}
+}
+
+func TestAttachments(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 10000)
+	sum := sha256.Sum256(content)
+
+	for name, blobs := range testBlobStores(t) {
+		t.Run(name, func(t *testing.T) {
+			db := setupTestDB(t)
+			repo := todo.NewGormRepository(db)
+			svc := todo.NewService(repo, todo.Limits{}, nil)
+			atts := todo.NewAttachmentService(todo.NewGormAttachmentRepository(db), repo, blobs, 0, nil)
+			ctx := context.Background()
+
+			task, _ := svc.CreateTask(ctx, "", "file taxes", "", nil, "")
+			a, err := atts.Upload(ctx, task.ID, "receipts.txt", "text/plain", bytes.NewReader(content))
+			if err != nil {
+				t.Fatalf("upload: %v", err)
+			}
+			if a.Size != int64(len(content)) || a.Checksum != hex.EncodeToString(sum[:]) {
+				t.Fatalf("unexpected metadata: size=%d checksum=%s", a.Size, a.Checksum)
+			}
+
+			_, rs, err := atts.Open(ctx, task.ID, a.ID)
+			if err != nil {
+				t.Fatalf("open: %v", err)
+			}
+			if _, err := rs.Seek(99990, io.SeekStart); err != nil {
+				t.Fatalf("seek: %v", err)
+			}
+			tail, _ := io.ReadAll(rs)
+			rs.Close()
+			if string(tail) != "0123456789" {
+				t.Fatalf("unexpected tail %q", tail)
+			}
+
+			if err := atts.DeleteAttachment(ctx, task.ID, a.ID); err != nil {
+				t.Fatalf("delete: %v", err)
+			}
+			if list, _ := atts.ListAttachments(ctx, task.ID); len(list) != 0 {
+				t.Fatalf("expected no attachments, got %d", len(list))
+			}
+		})
+	}
+}
+
+func TestAttachmentLimitsAndRESTRange(t *testing.T) {
+	db := setupTestDB(t)
+	repo := todo.NewGormRepository(db)
+	svc := todo.NewService(repo, todo.Limits{}, nil)
+	blobs, _ := storage.NewFSStore(t.TempDir())
+	atts := todo.NewAttachmentService(todo.NewGormAttachmentRepository(db), repo, blobs, 16, nil)
+	ctx := context.Background()
+	task, _ := svc.CreateTask(ctx, "", "t", "", nil, "")
+
+	if _, err := atts.Upload(ctx, task.ID, "big.bin", "", strings.NewReader(strings.Repeat("x", 17))); !errors.Is(err, todo.ErrAttachmentTooLarge) {
+		t.Fatalf("expected ErrAttachmentTooLarge, got %v", err)
+	}
+	if a, err := atts.Upload(ctx, task.ID, "odd.bin", "text/html\r\nX-Evil: 1", strings.NewReader("x")); err != nil || a.ContentType != "application/octet-stream" {
+		t.Fatalf("expected an invalid content type to be replaced, got %+v %v", a, err)
+	}
+
+	srv := newRESTServer(t, svc, todo.NewCommentService(todo.NewGormCommentRepository(db), repo, todo.Limits{}), atts)
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, _ := mw.CreateFormFile("file", "alphabet.txt")
+	fw.Write([]byte("abcdefghijklmnop"))
+	mw.Close()
+	resp, err := http.Post(srv.URL+"/v1/tasks/"+task.ID+"/attachments", mw.FormDataContentType(), &body)
+	if err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+	var created struct {
+		Attachment struct{ ID string }
+	}
+	decodeJSON(t, resp, http.StatusCreated, &created)
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/v1/tasks/"+task.ID+"/attachments/"+created.Attachment.ID, nil)
+	req.Header.Set("Range", "bytes=2-4")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("download: %v", err)
+	}
+	defer resp.Body.Close()
+	got, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusPartialContent || string(got) != "cde" {
+		t.Fatalf("expected 206 cde, got %d %q", resp.StatusCode, got)
+	}
+	// browsers save downloads rather than render them
+	if resp.Header.Get("X-Content-Type-Options") != "nosniff" ||
+		!strings.HasPrefix(resp.Header.Get("Content-Disposition"), "attachment;") ||
+		!strings.Contains(resp.Header.Get("Content-Security-Policy"), "sandbox") {
+		t.Fatalf("unexpected download headers: %v", resp.Header)
+	}
+}
@@ -0,0 +1,355 @@
+package test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-ical"
+	davclient "github.com/emersion/go-webdav/caldav"
+	"github.com/fuzail/08-todosvc/internal/caldav"
+	"github.com/fuzail/08-todosvc/internal/taskio"
+	"github.com/fuzail/08-todosvc/internal/todo"
+)
+
+// davClient is go-webdav's CalDAV client, plus raw requests for what it
+// can't send: conditional requests and malformed bodies.
+type davClient struct {
+	*davclient.Client
+	t   *testing.T
+	url string
+}
+
+func newCalDAVServer(t *testing.T, svc todo.Service) *davClient {
+	t.Helper()
+	mux := http.NewServeMux()
+	caldav.RegisterHandlers(mux, svc)
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	c, err := davclient.NewClient(srv.Client(), srv.URL+caldav.Prefix)
+	if err != nil {
+		t.Fatalf("client: %v", err)
+	}
+	return &davClient{Client: c, t: t, url: srv.URL}
+}
+
+func (c *davClient) do(method, path, body string, header ...string) (*http.Response, string) {
+	c.t.Helper()
+	req, err := http.NewRequest(method, c.url+path, strings.NewReader(body))
+	if err != nil {
+		c.t.Fatalf("request: %v", err)
+	}
+	req.Header.Set("Content-Type", ical.MIMEType)
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Do(req)
+	if err != nil {
+		c.t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	b, _ := io.ReadAll(resp.Body)
+	return resp, string(b)
+}
+
+// etags lists the calendar and returns the ETag of every object by path.
+func (c *davClient) etags() map[string]string {
+	c.t.Helper()
+	objects, err := c.QueryCalendar(context.Background(), caldav.CalendarPath, &davclient.CalendarQuery{
+		CompFilter: davclient.CompFilter{Name: ical.CompCalendar},
+	})
+	if err != nil {
+		c.t.Fatalf("list: %v", err)
+	}
+	tags := map[string]string{}
+	for _, co := range objects {
+		tags[co.Path] = `"` + co.ETag + `"`
+	}
+	return tags
+}
+
+func vtodo(lines ...string) string {
+	return "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:-//Example//Client//EN\r\nBEGIN:VTODO\r\nDTSTAMP:20300101T000000Z\r\n" +
+		strings.Join(lines, "\r\n") + "\r\nEND:VTODO\r\nEND:VCALENDAR\r\n"
+}
+
+func parseCalendar(t *testing.T, s string) *ical.Calendar {
+	t.Helper()
+	cal, err := ical.NewDecoder(strings.NewReader(s)).Decode()
+	if err != nil {
+		t.Fatalf("parse calendar: %v", err)
+	}
+	return cal
+}
+
+func todoSummary(co davclient.CalendarObject) string {
+	for _, comp := range co.Data.Children {
+		if comp.Name == ical.CompToDo {
+			s, _ := comp.Props.Text(ical.PropSummary)
+			return s
+		}
+	}
+	return ""
+}
+
+func TestCalDAV(t *testing.T) {
+	ctx := context.Background()
+	svc := todo.NewService(todo.NewGormRepository(setupTestDB(t)), todo.Limits{}, nil)
+	c := newCalDAVServer(t, svc)
+
+	// discovery: well-known URL, principal, calendar home, calendar
+	resp, _ := c.do(http.MethodGet, caldav.WellKnownPath, "")
+	if resp.StatusCode != http.StatusPermanentRedirect || resp.Header.Get("Location") != caldav.PrincipalPath {
+		t.Fatalf("well-known: %d %v", resp.StatusCode, resp.Header)
+	}
+	resp, _ = c.do(http.MethodOptions, caldav.CalendarPath, "")
+	if !strings.Contains(resp.Header.Get("DAV"), "calendar-access") || !strings.Contains(resp.Header.Get("Allow"), "REPORT") {
+		t.Fatalf("options: %v", resp.Header)
+	}
+	principal, err := c.FindCurrentUserPrincipal(ctx)
+	if err != nil || principal != caldav.PrincipalPath {
+		t.Fatalf("principal %q: %v", principal, err)
+	}
+	home, err := c.FindCalendarHomeSet(ctx, principal)
+	if err != nil {
+		t.Fatalf("home set: %v", err)
+	}
+	calendars, err := c.FindCalendars(ctx, home)
+	if err != nil || len(calendars) != 1 || calendars[0].Path != caldav.CalendarPath ||
+		!slices.Equal(calendars[0].SupportedComponentSet, []string{ical.CompToDo}) {
+		t.Fatalf("calendars %+v: %v", calendars, err)
+	}
+
+	// a task created through the API and one created by the client
+	due := time.Date(2030, 5, 1, 12, 0, 0, 0, time.UTC)
+	api, err := svc.CreateTask(ctx, "", "from the api", "", &due, "")
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	const id = "5f0c6a4e-3b1d-4c8e-9a7f-2d6b8e1c4a90"
+	path := caldav.CalendarPath + id + ".ics"
+	body := vtodo("UID:"+id, "SUMMARY:from the client", "DESCRIPTION:milk\\, eggs")
+	if _, err := c.PutCalendarObject(ctx, path, parseCalendar(t, body)); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if resp, _ := c.do(http.MethodPut, path, body, "If-None-Match", "*"); resp.StatusCode != http.StatusPreconditionFailed {
+		t.Fatalf("create over an existing task: %d", resp.StatusCode)
+	}
+	got, err := svc.GetTask(ctx, id)
+	if err != nil || got.Title != "from the client" || got.Description != "milk, eggs" {
+		t.Fatalf("created %+v %v", got, err)
+	}
+
+	// sync: list ETags, then fetch
+	tags := c.etags()
+	if len(tags) != 2 || tags[path] == "" {
+		t.Fatalf("listing: %v", tags)
+	}
+	co, err := c.GetCalendarObject(ctx, path)
+	if err != nil || `"`+co.ETag+`"` != tags[path] || todoSummary(*co) != "from the client" {
+		t.Fatalf("get %+v: %v", co, err)
+	}
+	if resp, _ := c.do(http.MethodGet, path, "", "If-None-Match", tags[path]); resp.StatusCode != http.StatusNotModified {
+		t.Fatalf("conditional get: %d", resp.StatusCode)
+	}
+
+	// edit with the ETag; a stale ETag is refused, however soon it is sent
+	edited := vtodo("UID:"+id, "SUMMARY:edited", "DUE;VALUE=DATE:20300601", "STATUS:COMPLETED")
+	if resp, b := c.do(http.MethodPut, path, edited, "If-Match", tags[path]); resp.StatusCode != http.StatusCreated {
+		t.Fatalf("update: %d %s", resp.StatusCode, b)
+	}
+	if resp, _ := c.do(http.MethodPut, path, edited, "If-Match", tags[path]); resp.StatusCode != http.StatusPreconditionFailed {
+		t.Fatalf("update with a stale etag: %d", resp.StatusCode)
+	}
+	got, _ = svc.GetTask(ctx, id)
+	if got.Title != "edited" || got.Description != "" || !got.Completed || got.DueAt == nil || !got.DueAt.Equal(time.Date(2030, 6, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("updated %+v", got)
+	}
+
+	// calendar-query: open tasks, a due range and a text match
+	apiPath := caldav.CalendarPath + api.ID + ".ics"
+	for _, tc := range []struct {
+		name   string
+		filter davclient.CompFilter
+		want   []string
+	}{
+		{"all", davclient.CompFilter{}, []string{apiPath, path}},
+		{"open", davclient.CompFilter{Props: []davclient.PropFilter{{Name: "STATUS", TextMatch: &davclient.TextMatch{Text: "needs-action"}}}}, []string{apiPath}},
+		{"due", davclient.CompFilter{
+			Start: time.Date(2030, 5, 1, 0, 0, 0, 0, time.UTC),
+			End:   time.Date(2030, 5, 2, 0, 0, 0, 0, time.UTC),
+		}, []string{apiPath}},
+		{"text", davclient.CompFilter{Props: []davclient.PropFilter{{Name: "SUMMARY", TextMatch: &davclient.TextMatch{Text: "EDIT"}}}}, []string{path}},
+		{"alarm", davclient.CompFilter{Comps: []davclient.CompFilter{{Name: ical.CompAlarm}}}, nil},
+	} {
+		tc.filter.Name = ical.CompToDo
+		objects, err := c.QueryCalendar(ctx, caldav.CalendarPath, &davclient.CalendarQuery{
+			CompRequest: davclient.CalendarCompRequest{Name: ical.CompCalendar, AllProps: true, AllComps: true},
+			CompFilter:  davclient.CompFilter{Name: ical.CompCalendar, Comps: []davclient.CompFilter{tc.filter}},
+		})
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		var paths []string
+		for _, co := range objects {
+			paths = append(paths, co.Path)
+			if todoSummary(co) == "" {
+				t.Fatalf("%s: calendar data %+v", tc.name, co.Data)
+			}
+		}
+		if !slices.Equal(paths, tc.want) {
+			t.Fatalf("%s: got %v, want %v", tc.name, paths, tc.want)
+		}
+	}
+	_, err = c.QueryCalendar(ctx, caldav.CalendarPath, &davclient.CalendarQuery{CompFilter: davclient.CompFilter{
+		Name: ical.CompCalendar,
+		Comps: []davclient.CompFilter{{Name: ical.CompToDo, Props: []davclient.PropFilter{{
+			Name: "SUMMARY", ParamFilter: []davclient.ParamFilter{{Name: "LANGUAGE"}},
+		}}}},
+	}})
+	if err == nil || !strings.Contains(err.Error(), "supported-filter") {
+		t.Fatalf("param-filter: %v", err)
+	}
+
+	// calendar-multiget answers for each href, missing tasks with a 404
+	objects, err := c.MultiGetCalendar(ctx, caldav.CalendarPath, &davclient.CalendarMultiGet{
+		Paths:       []string{path, apiPath},
+		CompRequest: davclient.CalendarCompRequest{Name: ical.CompCalendar, AllProps: true, AllComps: true},
+	})
+	if err != nil || len(objects) != 2 || todoSummary(objects[0]) != "edited" || todoSummary(objects[1]) != "from the api" {
+		t.Fatalf("multiget %+v: %v", objects, err)
+	}
+	resp, b := c.do("REPORT", caldav.CalendarPath, `<C:calendar-multiget xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav">
+		<D:prop><D:getetag/></D:prop><D:href>`+caldav.CalendarPath+`00000000-0000-0000-0000-000000000000.ics</D:href></C:calendar-multiget>`,
+		"Content-Type", "application/xml")
+	if resp.StatusCode != http.StatusMultiStatus || !strings.Contains(b, "404") {
+		t.Fatalf("multiget of a missing task: %d %s", resp.StatusCode, b)
+	}
+
+	// delete with the ETag
+	tags = c.etags()
+	if resp, _ := c.do(http.MethodDelete, apiPath, "", "If-Match", `"stale"`); resp.StatusCode != http.StatusPreconditionFailed {
+		t.Fatalf("delete with a stale etag: %d", resp.StatusCode)
+	}
+	if resp, _ := c.do(http.MethodDelete, apiPath, "", "If-Match", tags[apiPath]); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("delete: %d", resp.StatusCode)
+	}
+	if _, err := c.GetCalendarObject(ctx, apiPath); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Fatalf("get deleted: %v", err)
+	}
+}
+
+func TestCalDAVPut(t *testing.T) {
+	ctx := context.Background()
+	svc := todo.NewService(todo.NewGormRepository(setupTestDB(t)), todo.Limits{}, nil)
+	c := newCalDAVServer(t, svc)
+
+	// a name that isn't a task id maps to one, as a UID does
+	named := caldav.CalendarPath + "abc@example.com.ics"
+	co, err := c.PutCalendarObject(ctx, named, parseCalendar(t, vtodo("UID:abc@example.com", "SUMMARY:named")))
+	if href := caldav.CalendarPath + taskio.TaskID("abc@example.com") + ".ics"; err != nil || co.Path != href {
+		t.Fatalf("create %+v: %v", co, err)
+	}
+	if co, err := c.GetCalendarObject(ctx, named); err != nil || todoSummary(*co) != "named" {
+		t.Fatalf("get by name %+v: %v", co, err)
+	}
+
+	// completing a recurring task through CalDAV starts the next occurrence
+	const id = "0b1e4c2a-7d3f-4e8a-b6c5-9f1a2d3e4b5c"
+	path := caldav.CalendarPath + id + ".ics"
+	recurring := []string{"UID:" + id, "SUMMARY:water plants", "DUE:20300105T080000Z", "RRULE:FREQ=WEEKLY"}
+	if _, err := c.PutCalendarObject(ctx, path, parseCalendar(t, vtodo(recurring...))); err != nil {
+		t.Fatalf("create recurring: %v", err)
+	}
+	if _, err := c.PutCalendarObject(ctx, path, parseCalendar(t, vtodo(append(recurring, "STATUS:COMPLETED")...))); err != nil {
+		t.Fatalf("complete: %v", err)
+	}
+	done, _ := svc.GetTask(ctx, id)
+	tasks, _, _ := svc.ListTasks(ctx, 1, 10, todo.FilterAll)
+	if !done.Completed || done.Recurrence != "" || len(tasks) != 3 {
+		t.Fatalf("completed %+v; %d tasks", done, len(tasks))
+	}
+	for _, task := range tasks {
+		if task.ID != id && task.Title == "water plants" && (task.Recurrence != "FREQ=WEEKLY" || !task.DueAt.Equal(time.Date(2030, 1, 12, 8, 0, 0, 0, time.UTC))) {
+			t.Fatalf("next occurrence %+v", task)
+		}
+	}
+
+	for _, tc := range []struct {
+		name, body, want string
+		status           int
+	}{
+		{"event", "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nUID:x\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n", "supported-calendar-component", http.StatusConflict},
+		{"bad due", vtodo("UID:x", "SUMMARY:x", "DUE:soon"), "valid-calendar-data", http.StatusConflict},
+		{"two tasks", vtodo("UID:a", "SUMMARY:a", "END:VTODO", "BEGIN:VTODO", "DTSTAMP:20300101T000000Z", "UID:b", "SUMMARY:b"), "valid-calendar-object-resource", http.StatusConflict},
+		{"no title", vtodo("UID:x"), "title", http.StatusBadRequest},
+		{"too large", vtodo("UID:x", "SUMMARY:"+strings.Repeat("x", 1<<20)), "", http.StatusRequestEntityTooLarge},
+	} {
+		resp, b := c.do(http.MethodPut, caldav.CalendarPath+tc.name+".ics", tc.body)
+		if resp.StatusCode != tc.status || !strings.Contains(b, tc.want) {
+			t.Fatalf("%s: %d %s", tc.name, resp.StatusCode, b)
+		}
+	}
+	if resp, _ := c.do(http.MethodPut, caldav.CalendarPath, vtodo("UID:x", "SUMMARY:x")); resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Fatalf("put on the calendar: %d", resp.StatusCode)
+	}
+	if err := c.RemoveAll(ctx, caldav.CalendarPath); err == nil {
+		t.Fatal("deleted the calendar")
+	}
+}
+
+// racingService writes task id right after the next read of it, as another
+// client could between a PUT's check of its conditions and its write.
+type racingService struct {
+	todo.Service
+	id    string
+	raced bool
+}
+
+func (s *racingService) GetTask(ctx context.Context, id string) (*todo.Task, error) {
+	t, err := s.Service.GetTask(ctx, id)
+	if id == s.id && !s.raced {
+		s.raced = true
+		if _, err := s.Service.UpdateTask(ctx, id, "someone else's", ""); err != nil {
+			return nil, err
+		}
+	}
+	return t, err
+}
+
+func TestCalDAVConditionalPutRace(t *testing.T) {
+	ctx := context.Background()
+	svc := todo.NewService(todo.NewGormRepository(setupTestDB(t)), todo.Limits{}, nil)
+	task, err := svc.CreateTask(ctx, "", "shared", "", nil, "")
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	racing := &racingService{Service: svc}
+	c := newCalDAVServer(t, racing)
+	path := caldav.CalendarPath + task.ID + ".ics"
+	tag := c.etags()[path]
+
+	racing.id = task.ID
+	resp, b := c.do(http.MethodPut, path, vtodo("UID:"+task.ID, "SUMMARY:mine"), "If-Match", tag)
+	if resp.StatusCode != http.StatusPreconditionFailed {
+		t.Fatalf("expected the write in between to fail the PUT, got %d %s", resp.StatusCode, b)
+	}
+	if got, _ := svc.GetTask(ctx, task.ID); got.Title != "someone else's" {
+		t.Fatalf("the other write was lost: %+v", got)
+	}
+
+	// without conditions the PUT overwrites
+	racing.raced = false
+	if resp, b := c.do(http.MethodPut, path, vtodo("UID:"+task.ID, "SUMMARY:mine")); resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusCreated {
+		t.Fatalf("unconditional put: %d %s", resp.StatusCode, b)
+	}
+	if got, _ := svc.GetTask(ctx, task.ID); got.Title != "mine" {
+		t.Fatalf("unconditional put not written: %+v", got)
+	}
+}
@@ -0,0 +1,273 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fuzail/08-todosvc/internal/auth"
+	grpcapi "github.com/fuzail/08-todosvc/internal/grpc"
+	"github.com/fuzail/08-todosvc/internal/reqctx"
+	"github.com/fuzail/08-todosvc/internal/tlsconfig"
+	"github.com/fuzail/08-todosvc/internal/todo"
+	"github.com/fuzail/08-todosvc/pkg/client"
+	"github.com/fuzail/08-todosvc/pkg/client/clienttest"
+	pb "github.com/fuzail/08-todosvc/proto/todo/v1"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// fastRetries keeps the retry tests quick.
+var fastRetries = client.RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond, Multiplier: 2}
+
+func newFakeClient(t *testing.T, opts ...client.Option) (*clienttest.Server, *client.Client) {
+	t.Helper()
+	srv, err := clienttest.NewServer()
+	if err != nil {
+		t.Fatalf("fake server: %v", err)
+	}
+	t.Cleanup(srv.Close)
+	c, err := srv.Client(opts...)
+	if err != nil {
+		t.Fatalf("client: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return srv, c
+}
+
+func TestClientTasksIterator(t *testing.T) {
+	_, c := newFakeClient(t, client.WithTenant("acme"))
+	ctx := context.Background()
+
+	for i := 0; i < 7; i++ {
+		resp, err := c.CreateTask(ctx, &pb.CreateTaskRequest{Title: fmt.Sprintf("task %d", i)})
+		if err != nil {
+			t.Fatalf("create: %v", err)
+		}
+		if resp.Task.Tenant != "acme" {
+			t.Fatalf("expected tenant acme, got %q", resp.Task.Tenant)
+		}
+	}
+
+	var titles []string
+	for task, err := range c.Tasks(ctx, &pb.ListTasksRequest{PageSize: 3}) {
+		if err != nil {
+			t.Fatalf("iterate: %v", err)
+		}
+		titles = append(titles, task.Title)
+	}
+	if len(titles) != 7 || titles[0] != "task 6" || titles[6] != "task 0" {
+		t.Fatalf("expected all 7 tasks newest first, got %v", titles)
+	}
+
+	// breaking out stops reading pages
+	n := 0
+	for range c.Tasks(ctx, &pb.ListTasksRequest{PageSize: 2, Page: 2}) {
+		n++
+		if n == 3 {
+			break
+		}
+	}
+	if n != 3 {
+		t.Fatalf("expected to stop after 3 tasks, got %d", n)
+	}
+
+	// errors end the iteration
+	for task, err := range c.Tasks(ctx, &pb.ListTasksRequest{PageSize: 1000}) {
+		if task != nil || status.Code(err) != codes.InvalidArgument {
+			t.Fatalf("expected one InvalidArgument error, got %v, %v", task, err)
+		}
+	}
+}
+
+func TestClientRetries(t *testing.T) {
+	srv, c := newFakeClient(t, client.WithRetryPolicy(fastRetries))
+	ctx := context.Background()
+	created, err := c.CreateTask(ctx, &pb.CreateTaskRequest{Title: "retry me"})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	get := &pb.GetTaskRequest{Id: created.Task.Id}
+	unavailable := status.Error(codes.Unavailable, "down")
+
+	// idempotent RPCs are retried until an attempt succeeds
+	srv.FailNext(pb.TodoService_GetTask_FullMethodName, unavailable, unavailable)
+	if _, err := c.GetTask(ctx, get); err != nil {
+		t.Fatalf("expected the third attempt to succeed, got %v", err)
+	}
+	// up to MaxAttempts
+	srv.FailNext(pb.TodoService_GetTask_FullMethodName, unavailable, unavailable, unavailable)
+	if _, err := c.GetTask(ctx, get); status.Code(err) != codes.Unavailable {
+		t.Fatalf("expected Unavailable after 3 attempts, got %v", err)
+	}
+
+	// others are not, as the first attempt may have taken effect
+	srv.FailNext(pb.TodoService_CreateTask_FullMethodName, unavailable)
+	if _, err := c.CreateTask(ctx, &pb.CreateTaskRequest{Title: "once"}); status.Code(err) != codes.Unavailable {
+		t.Fatalf("expected CreateTask not to be retried, got %v", err)
+	}
+
+	// rate limits are retried after the server's delay; quota errors, which
+	// come without one, are not
+	limited, _ := status.New(codes.ResourceExhausted, "rate limited").
+		WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(20 * time.Millisecond)})
+	srv.FailNext(pb.TodoService_GetTask_FullMethodName, limited.Err())
+	start := time.Now()
+	if _, err := c.GetTask(ctx, get); err != nil {
+		t.Fatalf("expected the rate limited call to be retried, got %v", err)
+	}
+	if waited := time.Since(start); waited < 20*time.Millisecond {
+		t.Fatalf("expected to wait for the retry delay, waited %v", waited)
+	}
+	srv.FailNext(pb.TodoService_GetTask_FullMethodName, status.Error(codes.ResourceExhausted, "quota exceeded"))
+	if _, err := c.GetTask(ctx, get); status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("expected the quota error, got %v", err)
+	}
+
+	// a delay beyond the deadline returns the server's error at once
+	long, _ := status.New(codes.ResourceExhausted, "rate limited").
+		WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(time.Hour)})
+	srv.FailNext(pb.TodoService_GetTask_FullMethodName, long.Err())
+	if _, err := c.GetTask(ctx, get); status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("expected the rate limit error, got %v", err)
+	}
+}
+
+func TestClientDeadlines(t *testing.T) {
+	var deadline atomic.Value
+	record := grpc.WithChainUnaryInterceptor(func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		d, _ := ctx.Deadline()
+		deadline.Store(d)
+		return invoker(ctx, method, req, reply, cc, opts...)
+	})
+	_, c := newFakeClient(t, client.WithDialOptions(record))
+	ctx := context.Background()
+
+	if _, err := c.ListTasks(ctx, &pb.ListTasksRequest{}); err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if left := time.Until(deadline.Load().(time.Time)); left <= 0 || left > client.DefaultTimeout {
+		t.Fatalf("expected the default deadline, got %v left", left)
+	}
+
+	// a deadline of the caller's own is kept
+	short, cancel := context.WithTimeout(ctx, time.Minute+client.DefaultTimeout)
+	defer cancel()
+	if _, err := c.ListTasks(short, &pb.ListTasksRequest{}); err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if left := time.Until(deadline.Load().(time.Time)); left <= client.DefaultTimeout {
+		t.Fatalf("expected the caller's deadline, got %v left", left)
+	}
+
+	_, c = newFakeClient(t, client.WithDialOptions(record), client.WithTimeout(0))
+	if _, err := c.ListTasks(ctx, &pb.ListTasksRequest{}); err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if !deadline.Load().(time.Time).IsZero() {
+		t.Fatalf("expected no deadline with WithTimeout(0)")
+	}
+}
+
+func TestClientCredentials(t *testing.T) {
+	ca := newTestCA(t)
+	dir := t.TempDir()
+	certs, err := tlsconfig.NewReloader(writeServerFiles(t, ca, dir, "server"))
+	if err != nil {
+		t.Fatalf("reloader: %v", err)
+	}
+	certPEM, keyPEM := ca.issue(t, "web", false)
+	certFile, keyFile := filepath.Join(dir, "client.crt"), filepath.Join(dir, "client.key")
+	for path, b := range map[string][]byte{certFile: certPEM, keyFile: keyPEM} {
+		if err := os.WriteFile(path, b, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	db := setupTestDB(t)
+	repo := todo.NewGormRepository(db)
+	var seen struct {
+		client         reqctx.Client
+		apiKey, bearer string
+	}
+	record := func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, next grpc.UnaryHandler) (any, error) {
+		seen.client, _ = reqctx.ClientFrom(ctx)
+		seen.apiKey, seen.bearer = "", ""
+		if v := metadata.ValueFromIncomingContext(ctx, "x-api-key"); len(v) > 0 {
+			seen.apiKey = v[0]
+		}
+		if v := metadata.ValueFromIncomingContext(ctx, "authorization"); len(v) > 0 {
+			seen.bearer = v[0]
+		}
+		return next(ctx, req)
+	}
+	srv := grpc.NewServer(grpc.Creds(credentials.NewTLS(certs.ServerConfig("h2"))),
+		grpc.ChainUnaryInterceptor(auth.UnaryServerInterceptor(), record))
+	pb.RegisterTodoServiceServer(srv, grpcapi.NewHandler(todo.NewService(repo, todo.Limits{}, nil),
+		todo.NewCommentService(todo.NewGormCommentRepository(db), repo, todo.Limits{}), nil))
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	c, err := client.New(lis.Addr().String(),
+		client.WithMTLS(certFile, keyFile, filepath.Join(dir, "ca.crt")),
+		client.WithAPIKey("team-a"),
+		client.WithTokenSource(func(context.Context) (string, error) { return "header.payload.sig", nil }))
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	defer c.Close()
+	if _, err := c.ListTasks(context.Background(), &pb.ListTasksRequest{}); err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if seen.client.String() != "spiffe://example.org/web" {
+		t.Fatalf("expected the client certificate, got %v", seen.client.Names)
+	}
+	if seen.apiKey != "team-a" || seen.bearer != "Bearer header.payload.sig" {
+		t.Fatalf("unexpected credentials: %q, %q", seen.apiKey, seen.bearer)
+	}
+
+	// token errors fail the call
+	c, _ = client.New(lis.Addr().String(),
+		client.WithMTLS(certFile, keyFile, filepath.Join(dir, "ca.crt")),
+		client.WithTokenSource(func(context.Context) (string, error) { return "", errors.New("expired") }))
+	defer c.Close()
+	if _, err := c.ListTasks(context.Background(), &pb.ListTasksRequest{}); err == nil || !strings.Contains(err.Error(), "expired") {
+		t.Fatalf("expected the token error, got %v", err)
+	}
+
+	// files that can't be read fail New
+	if _, err := client.New("localhost:1", client.WithMTLS(filepath.Join(dir, "missing.crt"), keyFile, "")); err == nil {
+		t.Fatal("expected an error for a missing certificate")
+	}
+
+	// bearer tokens are not sent in plaintext
+	fake, err := clienttest.NewServer()
+	if err != nil {
+		t.Fatalf("fake server: %v", err)
+	}
+	defer fake.Close()
+	if _, err := fake.Client(client.WithJWT("header.payload.sig")); err == nil {
+		t.Fatal("expected a JWT over plaintext to be refused")
+	}
+	// API keys are sent in plaintext too
+	_, plain := newFakeClient(t, client.WithAPIKey("team-a"))
+	if _, err := plain.ListTasks(context.Background(), &pb.ListTasksRequest{}); err != nil {
+		t.Fatalf("expected an API key over plaintext to work, got %v", err)
+	}
+}
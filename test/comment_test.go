@@ -0,0 +1,91 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fuzail/08-todosvc/internal/reqctx"
+	"github.com/fuzail/08-todosvc/internal/todo"
+)
+
+func TestComments(t *testing.T) {
+	db := setupTestDB(t)
+	repo := todo.NewGormRepository(db)
+	svc := todo.NewService(repo, todo.Limits{}, nil)
+	comments := todo.NewCommentService(todo.NewGormCommentRepository(db), repo, todo.Limits{})
+	ctx := context.Background()
+
+	task, _ := svc.CreateTask(ctx, "", "plan offsite", "", nil, "")
+	if _, err := comments.AddComment(ctx, "missing", "ann", "hi"); !errors.Is(err, todo.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound for missing task, got %v", err)
+	}
+	if _, err := comments.AddComment(ctx, task.ID, "ann", ""); !errors.Is(err, todo.ErrEmptyComment) {
+		t.Fatalf("expected ErrEmptyComment, got %v", err)
+	}
+
+	first, err := comments.AddComment(ctx, task.ID, "ann", "lisbon?")
+	if err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	if _, err := comments.AddComment(ctx, task.ID, "bo", "porto!"); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+
+	time.Sleep(time.Millisecond)
+	edited, err := comments.EditComment(ctx, task.ID, first.ID, "lisbon or porto?")
+	if err != nil {
+		t.Fatalf("edit: %v", err)
+	}
+	if edited.EditedAt == nil || !edited.UpdatedAt.After(first.UpdatedAt) {
+		t.Fatalf("expected edited_at and a new updated_at, got %+v", edited)
+	}
+
+	page, total, err := comments.ListComments(ctx, task.ID, 1, 1)
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if total != 2 || len(page) != 1 || page[0].Body != "lisbon or porto?" {
+		t.Fatalf("unexpected first page: total=%d %+v", total, page)
+	}
+
+	if err := comments.DeleteComment(ctx, task.ID, first.ID); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if err := comments.DeleteComment(ctx, task.ID, first.ID); !errors.Is(err, todo.ErrCommentNotFound) {
+		t.Fatalf("expected ErrCommentNotFound, got %v", err)
+	}
+	if _, total, _ := comments.ListComments(ctx, task.ID, 1, 10); total != 1 {
+		t.Fatalf("expected 1 comment after delete, got %d", total)
+	}
+}
+
+func TestCommentAuthor(t *testing.T) {
+	db := setupTestDB(t)
+	repo := todo.NewGormRepository(db)
+	svc := todo.NewService(repo, todo.Limits{}, nil)
+	comments := todo.NewCommentService(todo.NewGormCommentRepository(db), repo, todo.Limits{})
+	ctx := context.Background()
+	task, _ := svc.CreateTask(ctx, "", "plan offsite", "", nil, "")
+
+	for _, author := range []string{"", "  ", "ann\nbo", strings.Repeat("a", todo.MaxAuthorLength+1)} {
+		if _, err := comments.AddComment(ctx, task.ID, author, "hi"); violations(t, err)["author"] == "" {
+			t.Fatalf("expected an author violation for %q, got %v", author, err)
+		}
+	}
+	c, err := comments.AddComment(ctx, task.ID, "  ann ", "hi")
+	if err != nil || c.Author != "ann" {
+		t.Fatalf("expected author ann, got %+v %v", c, err)
+	}
+
+	// callers with a client certificate comment as themselves
+	web := reqctx.WithClient(ctx, reqctx.Client{Names: []string{"spiffe://example.org/web", "web"}})
+	for _, author := range []string{"", "ann"} {
+		c, err := comments.AddComment(web, task.ID, author, "hi")
+		if err != nil || c.Author != "spiffe://example.org/web" {
+			t.Fatalf("expected the client identity as author, got %+v %v", c, err)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package test
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fuzail/08-todosvc/internal/config"
+)
+
+// newLoader returns a loader reading env instead of the process environment,
+// with args parsed as the command line.
+func newLoader(t *testing.T, env map[string]string, args ...string) *config.Loader {
+	t.Helper()
+	fs := flag.NewFlagSet("server", flag.ContinueOnError)
+	l := config.NewLoader(fs)
+	l.DotEnv = ""
+	l.LookupEnv = func(key string) (string, bool) {
+		v, ok := env[key]
+		return v, ok
+	}
+	if err := fs.Parse(args); err != nil {
+		t.Fatalf("parse flags: %v", err)
+	}
+	return l
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("write %s: %v", name, err)
+	}
+	return path
+}
+
+func TestConfigPrecedence(t *testing.T) {
+	file := writeFile(t, "todosvc.yaml", `
+server:
+  http_port: 9000
+  grpc_port: 9001
+log:
+  level: warn
+auth:
+  admin_clients: [ops]
+rate_limit:
+  write_rps: 2
+`)
+	dotenv := writeFile(t, ".env", "GRPC_PORT=9002\nDB_HOST=db.internal # inline comment\n")
+	l := newLoader(t, map[string]string{
+		config.FileEnv: file,
+		"GRPC_PORT":    "9003",
+		"LOG_LEVEL":    "error",
+		"HTTP_PORT":    "", // empty counts as unset
+	}, "-log.level", "debug", "-server.single_port")
+	l.DotEnv = dotenv
+
+	cfg, err := l.Load()
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	switch {
+	case cfg.Server.HTTPPort != 9000:
+		t.Errorf("file should set http_port, got %d", cfg.Server.HTTPPort)
+	case cfg.Server.GRPCPort != 9003:
+		t.Errorf("env should beat .env and the file, got %d", cfg.Server.GRPCPort)
+	case cfg.DB.Host != "db.internal":
+		t.Errorf(".env should set db.host, got %q", cfg.DB.Host)
+	case cfg.Log.Level != "debug" || !cfg.Server.SinglePort:
+		t.Errorf("flags should beat env, got %q %v", cfg.Log.Level, cfg.Server.SinglePort)
+	case len(cfg.Auth.AdminClients) != 1 || cfg.Auth.AdminClients[0] != "ops":
+		t.Errorf("unexpected admin clients %v", cfg.Auth.AdminClients)
+	case cfg.DB.Port != 5432 || cfg.Blob.Store != "fs":
+		t.Errorf("defaults lost: %+v", cfg)
+	}
+	if rl := cfg.RateLimitConfig(); rl.Write.Rate != 2 || rl.Write.Burst != 2 || rl.Read.Rate != 0 {
+		t.Errorf("unexpected rate limits %+v", rl)
+	}
+}
+
+func TestConfigValidation(t *testing.T) {
+	_, err := newLoader(t, map[string]string{
+		"ENV":                "production",
+		"HTTP_PORT":          "70000",
+		"AUTH_ADMIN_CLIENTS": "*",
+		"TLS_KEY_FILE":       "server.key",
+		"BLOB_STORE":         "s3",
+	}, "-limits.page_size_max=0").Load()
+	if err == nil {
+		t.Fatal("expected validation errors")
+	}
+	// every problem is reported, not just the first
+	for _, key := range []string{"server.http_port", "auth.admin_clients", "tls.cert_file", "blob.s3.bucket", "limits.page_size_max"} {
+		if !strings.Contains(err.Error(), key) {
+			t.Errorf("error doesn't mention %s: %v", key, err)
+		}
+	}
+
+	if _, err := newLoader(t, map[string]string{"GRPC_PORT": "fifty"}).Load(); err == nil || !strings.Contains(err.Error(), "GRPC_PORT") {
+		t.Errorf("expected a parse error naming GRPC_PORT, got %v", err)
+	}
+	// a typo in the file is an error, not a silently ignored key
+	file := writeFile(t, "todosvc.yaml", "server:\n  http_prot: 9000\n")
+	if _, err := newLoader(t, nil, "-config", file).Load(); err == nil || !strings.Contains(err.Error(), "http_prot") {
+		t.Errorf("expected an unknown key error, got %v", err)
+	}
+}
+
+func TestConfigEnvExample(t *testing.T) {
+	l := newLoader(t, nil)
+	l.DotEnv = "../.env.example"
+	if _, err := l.Load(); err != nil {
+		t.Fatalf(".env.example is not a valid config: %v", err)
+	}
+}
+
+func TestConfigPrintRedacts(t *testing.T) {
+	cfg, err := newLoader(t, map[string]string{"DB_PASSWORD": "hunter2", "S3_SECRET_ACCESS_KEY": "s3cret",
+		"RATE_LIMIT_API_KEYS": "k3y-one,k3y-two"}).Load()
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	var out bytes.Buffer
+	if err := cfg.Print(&out); err != nil {
+		t.Fatalf("print: %v", err)
+	}
+	if strings.Contains(out.String(), "hunter2") || strings.Contains(out.String(), "s3cret") ||
+		strings.Contains(out.String(), "k3y") {
+		t.Fatalf("secrets printed:\n%s", out.String())
+	}
+	if cfg.DB.Password != "hunter2" || cfg.RateLimit.APIKeys[0] != "k3y-one" {
+		t.Fatal("printing changed the config")
+	}
+
+	// the output is a config file that loads back to the same settings
+	printed, err := newLoader(t, nil, "-config", writeFile(t, "printed.yaml", out.String())).Load()
+	if err != nil {
+		t.Fatalf("load printed config: %v", err)
+	}
+	if _, applied, restart := config.Reload(cfg.Redacted(), printed); len(applied)+len(restart) != 0 {
+		t.Fatalf("printed config differs: %v %v", applied, restart)
+	}
+}
+
+func TestConfigReload(t *testing.T) {
+	cur := config.Default()
+	next := cur
+	next.Log.Level = "debug"
+	next.RateLimit.ReadRPS = 10
+	next.Server.HTTPPort = 9090
+
+	merged, applied, restart := config.Reload(cur, next)
+	if strings.Join(applied, ",") != "log.level,rate_limit.read_rps" || strings.Join(restart, ",") != "server.http_port" {
+		t.Fatalf("applied %v, restart %v", applied, restart)
+	}
+	if merged.Log.Level != "debug" || merged.RateLimit.ReadRPS != 10 || merged.Server.HTTPPort != 8080 {
+		t.Fatalf("unexpected merged config %+v", merged)
+	}
+}
@@ -0,0 +1,101 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/fuzail/08-todosvc/internal/todo"
+)
+
+func TestDependencies(t *testing.T) {
+	db := setupTestDB(t)
+	svc := todo.NewService(todo.NewGormRepository(db), todo.Limits{}, nil)
+	ctx := context.Background()
+
+	a, _ := svc.CreateTask(ctx, "", "design", "", nil, "")
+	b, _ := svc.CreateTask(ctx, "", "build", "", nil, "")
+	c, _ := svc.CreateTask(ctx, "", "ship", "", nil, "")
+
+	// c <- b <- a
+	if err := svc.AddDependency(ctx, b.ID, a.ID); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	if err := svc.AddDependency(ctx, c.ID, b.ID); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	if err := svc.AddDependency(ctx, a.ID, c.ID); !errors.Is(err, todo.ErrDependencyCycle) {
+		t.Fatalf("expected ErrDependencyCycle, got %v", err)
+	}
+	if err := svc.AddDependency(ctx, a.ID, a.ID); !errors.Is(err, todo.ErrDependencyCycle) {
+		t.Fatalf("expected ErrDependencyCycle for self dependency, got %v", err)
+	}
+
+	ready, total, err := svc.ListTasks(ctx, 1, 10, todo.FilterReady)
+	if err != nil {
+		t.Fatalf("list ready: %v", err)
+	}
+	if total != 1 || len(ready) != 1 || ready[0].ID != a.ID {
+		t.Fatalf("expected only %s ready, got %d tasks", a.ID, total)
+	}
+	if _, total, _ := svc.ListTasks(ctx, 1, 10, todo.FilterBlocked); total != 2 {
+		t.Fatalf("expected 2 blocked tasks, got %d", total)
+	}
+
+	if _, err := svc.MarkComplete(ctx, b.ID, true, false); !errors.Is(err, todo.ErrBlocked) {
+		t.Fatalf("expected ErrBlocked, got %v", err)
+	}
+	if _, err := svc.MarkComplete(ctx, a.ID, true, false); err != nil {
+		t.Fatalf("complete: %v", err)
+	}
+	if _, err := svc.MarkComplete(ctx, b.ID, true, false); err != nil {
+		t.Fatalf("complete after blocker done: %v", err)
+	}
+
+	// forcing skips the check; removing the edge unblocks too
+	if err := svc.RemoveDependency(ctx, c.ID, b.ID); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	if err := svc.RemoveDependency(ctx, c.ID, b.ID); !errors.Is(err, todo.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	d, _ := svc.CreateTask(ctx, "", "docs", "", nil, "")
+	_ = svc.AddDependency(ctx, d.ID, c.ID)
+	if _, err := svc.MarkComplete(ctx, d.ID, true, true); err != nil {
+		t.Fatalf("forced complete: %v", err)
+	}
+}
+
+func TestSyncCompletionOfBlockedTask(t *testing.T) {
+	db := setupTestDB(t)
+	svc := todo.NewService(todo.NewGormRepository(db), todo.Limits{}, nil)
+	ctx := context.Background()
+
+	a, _ := svc.CreateTask(ctx, "", "design", "", nil, "")
+	b, _ := svc.CreateTask(ctx, "", "build", "", nil, "")
+	if err := svc.AddDependency(ctx, b.ID, a.ID); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+
+	done := todo.Task{ID: b.ID, Title: "build it", Completed: true, UpdatedAt: time.Now().Add(time.Minute)}
+	res, err := svc.SyncTasks(ctx, "", []todo.TaskChange{{Task: done}}, 0)
+	if err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	if r := res.Results[0]; r.Status != todo.ChangeRejected || r.Reason != todo.ErrBlocked.Reason {
+		t.Fatalf("expected the completion to be rejected, got %+v", r)
+	}
+	if got, _ := svc.GetTask(ctx, b.ID); got.Completed || got.Title != "build" {
+		t.Fatalf("rejected change was applied: %+v", got)
+	}
+
+	// once the blocker is done it goes through
+	if _, err := svc.MarkComplete(ctx, a.ID, true, false); err != nil {
+		t.Fatalf("complete: %v", err)
+	}
+	res, err = svc.SyncTasks(ctx, "", []todo.TaskChange{{Task: done}}, 0)
+	if err != nil || res.Results[0].Status != todo.ChangeApplied {
+		t.Fatalf("sync: %+v %v", res, err)
+	}
+}
@@ -0,0 +1,121 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/fuzail/08-todosvc/internal/apierr"
+	"github.com/fuzail/08-todosvc/internal/grpc"
+	"github.com/fuzail/08-todosvc/internal/rest"
+	"github.com/fuzail/08-todosvc/internal/todo"
+	"github.com/fuzail/08-todosvc/pkg/storage"
+	pb "github.com/fuzail/08-todosvc/proto/todo/v1"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestServiceValidationErrors(t *testing.T) {
+	db := setupTestDB(t)
+	repo := todo.NewGormRepository(db)
+	svc := todo.NewService(repo, todo.Limits{}, nil)
+	comments := todo.NewCommentService(todo.NewGormCommentRepository(db), repo, todo.Limits{})
+	ctx := context.Background()
+
+	_, err := svc.CreateTask(ctx, "", " ", "", nil, "")
+	var de *todo.Error
+	if !errors.As(err, &de) || de.Kind != todo.KindInvalid || len(de.Violations) != 1 || de.Violations[0].Field != "title" {
+		t.Fatalf("expected title violation, got %#v", err)
+	}
+	if err := svc.AddDependency(ctx, "", ""); !errors.As(err, &de) || len(de.Violations) != 2 {
+		t.Fatalf("expected two violations, got %v", err)
+	}
+	if _, err := comments.EditComment(ctx, "", "", "body"); !errors.As(err, &de) || de.Kind != todo.KindInvalid {
+		t.Fatalf("expected validation error, got %v", err)
+	}
+
+	// wrapping keeps the kind
+	wrapped := fmt.Errorf("import: %w", todo.ErrBlocked)
+	if !errors.As(wrapped, &de) || de.Kind != todo.KindPrecondition || !errors.Is(wrapped, todo.ErrBlocked) {
+		t.Fatalf("wrapped error lost its kind: %v", wrapped)
+	}
+	if !errors.Is(todo.ErrDependencyNotFound, todo.ErrNotFound) {
+		t.Fatal("ErrDependencyNotFound should match ErrNotFound")
+	}
+}
+
+func TestGRPCErrorDetails(t *testing.T) {
+	db := setupTestDB(t)
+	repo := todo.NewGormRepository(db)
+	blobs, _ := storage.NewFSStore(t.TempDir())
+	h := grpc.NewHandler(todo.NewService(repo, todo.Limits{}, nil),
+		todo.NewCommentService(todo.NewGormCommentRepository(db), repo, todo.Limits{}),
+		todo.NewAttachmentService(todo.NewGormAttachmentRepository(db), repo, blobs, 0, nil))
+	ctx := context.Background()
+
+	_, err := h.CreateTask(ctx, &pb.CreateTaskRequest{Recurrence: "FREQ=HOURLY"})
+	st := status.Convert(err)
+	if st.Code() != codes.InvalidArgument {
+		t.Fatalf("expected InvalidArgument, got %v", err)
+	}
+	var reason string
+	var fields []string
+	for _, d := range st.Details() {
+		switch d := d.(type) {
+		case *errdetails.ErrorInfo:
+			reason = d.GetReason()
+		case *errdetails.BadRequest:
+			for _, v := range d.GetFieldViolations() {
+				fields = append(fields, v.GetField())
+			}
+		}
+	}
+	if reason != "INVALID_ARGUMENT" || len(fields) != 1 || fields[0] != "title" {
+		t.Fatalf("unexpected details reason=%q fields=%v", reason, fields)
+	}
+
+	_, err = h.GetTask(ctx, &pb.GetTaskRequest{Id: "0198f0e4-0000-7000-8000-000000000000"})
+	if status.Code(err) != codes.NotFound || status.Convert(err).Message() != "task not found" {
+		t.Fatalf("expected NotFound, got %v", err)
+	}
+
+	// errors outside the domain don't leak their text
+	err = apierr.Status(ctx, errors.New("pq: connection refused"))
+	if status.Code(err) != codes.Internal || status.Convert(err).Message() != "internal error" {
+		t.Fatalf("expected opaque Internal, got %v", err)
+	}
+	if got := apierr.HTTPStatus(apierr.Status(ctx, todo.ErrAttachmentTooLarge)); got != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected 413, got %d", got)
+	}
+}
+
+func TestRESTPreconditionConflict(t *testing.T) {
+	db := setupTestDB(t)
+	repo := todo.NewGormRepository(db)
+	svc := todo.NewService(repo, todo.Limits{}, nil)
+	blobs, _ := storage.NewFSStore(t.TempDir())
+	srv := newRESTServer(t, svc,
+		todo.NewCommentService(todo.NewGormCommentRepository(db), repo, todo.Limits{}),
+		todo.NewAttachmentService(todo.NewGormAttachmentRepository(db), repo, blobs, 0, nil))
+	ctx := context.Background()
+
+	a, _ := svc.CreateTask(ctx, "", "a", "", nil, "")
+	b, _ := svc.CreateTask(ctx, "", "b", "", nil, "")
+	if err := svc.AddDependency(ctx, b.ID, a.ID); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	resp, err := http.Post(srv.URL+"/v1/tasks/"+a.ID+"/dependencies", "application/json",
+		strings.NewReader(`{"blocked_by_id":"`+b.ID+`"}`))
+	if err != nil {
+		t.Fatalf("post: %v", err)
+	}
+	var problem rest.Problem
+	decodeJSON(t, resp, http.StatusConflict, &problem)
+	if problem.Code != "dependency_cycle" {
+		t.Fatalf("unexpected problem %+v", problem)
+	}
+}
@@ -0,0 +1,482 @@
+package test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fuzail/08-todosvc/internal/graphql"
+	"github.com/fuzail/08-todosvc/internal/todo"
+	"gorm.io/gorm"
+)
+
+type gqlResponse struct {
+	Data   map[string]json.RawMessage `json:"data"`
+	Errors []struct {
+		Message    string         `json:"message"`
+		Path       []any          `json:"path"`
+		Extensions map[string]any `json:"extensions"`
+	} `json:"errors"`
+}
+
+type gqlServer struct {
+	t        *testing.T
+	url      string
+	svc      todo.Service
+	comments todo.CommentService
+	events   *todo.Broker
+}
+
+func newGraphQLServer(t *testing.T, db *gorm.DB, limits graphql.Limits) *gqlServer {
+	t.Helper()
+	events := todo.NewBroker()
+	repo := todo.PublishChanges(todo.NewGormRepository(db), events)
+	svc := todo.NewService(repo, todo.Limits{}, nil)
+	comments := todo.NewCommentService(todo.NewGormCommentRepository(db), repo, todo.Limits{})
+	srv := httptest.NewServer(graphql.NewHandler(svc, comments, events, limits))
+	t.Cleanup(srv.Close)
+	return &gqlServer{t: t, url: srv.URL, svc: svc, comments: comments, events: events}
+}
+
+// post sends a query and checks the status; data, when given, is decoded
+// from the response's data.
+func (s *gqlServer) post(wantStatus int, query string, vars map[string]any) gqlResponse {
+	s.t.Helper()
+	body, _ := json.Marshal(map[string]any{"query": query, "variables": vars})
+	resp, err := http.Post(s.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		s.t.Fatalf("post: %v", err)
+	}
+	var out gqlResponse
+	decodeJSON(s.t, resp, wantStatus, &out)
+	return out
+}
+
+// data posts a query that must succeed and decodes its data into v.
+func (s *gqlServer) data(query string, vars map[string]any, v any) {
+	s.t.Helper()
+	out := s.post(http.StatusOK, query, vars)
+	if len(out.Errors) > 0 {
+		s.t.Fatalf("unexpected errors: %+v", out.Errors)
+	}
+	raw, _ := json.Marshal(out.Data)
+	if err := json.Unmarshal(raw, v); err != nil {
+		s.t.Fatalf("decode data: %v", err)
+	}
+}
+
+// countQueries counts the SQL statements run on db.
+func countQueries(db *gorm.DB) *atomic.Int64 {
+	var n atomic.Int64
+	count := func(*gorm.DB) { n.Add(1) }
+	_ = db.Callback().Query().After("gorm:query").Register("test:count_query", count)
+	_ = db.Callback().Row().After("gorm:row").Register("test:count_row", count)
+	_ = db.Callback().Raw().After("gorm:raw").Register("test:count_raw", count)
+	return &n
+}
+
+func TestGraphQLBatchesNestedReads(t *testing.T) {
+	db := setupTestDB(t)
+	s := newGraphQLServer(t, db, graphql.Limits{})
+	ctx := context.Background()
+	queries := countQueries(db)
+
+	const query = `{
+		tasks(pageSize: 50) {
+			totalCount
+			items {
+				title
+				blockers { title }
+				comments(first: 2) { body task { title } }
+			}
+		}
+	}`
+	type result struct {
+		Tasks struct {
+			TotalCount int
+			Items      []struct {
+				Title    string
+				Blockers []struct{ Title string }
+				Comments []struct {
+					Body string
+					Task struct{ Title string }
+				}
+			}
+		}
+	}
+	blocker, _ := s.svc.CreateTask(ctx, "", "blocker", "", nil, "")
+	addTasks := func(n int) {
+		for i := 0; i < n; i++ {
+			task, err := s.svc.CreateTask(ctx, "", fmt.Sprintf("task %d", i), "", nil, "")
+			if err != nil {
+				t.Fatalf("create: %v", err)
+			}
+			if err := s.svc.AddDependency(ctx, task.ID, blocker.ID); err != nil {
+				t.Fatalf("add dependency: %v", err)
+			}
+			for _, body := range []string{"one", "two", "three"} {
+				if _, err := s.comments.AddComment(ctx, task.ID, "ann", body); err != nil {
+					t.Fatalf("comment: %v", err)
+				}
+			}
+		}
+	}
+	run := func() (result, int64) {
+		var r result
+		before := queries.Load()
+		s.data(query, nil, &r)
+		return r, queries.Load() - before
+	}
+
+	addTasks(3)
+	small, smallQueries := run()
+	addTasks(20)
+	large, largeQueries := run()
+
+	if smallQueries != largeQueries {
+		t.Fatalf("expected the same number of queries for 4 and 24 tasks, got %d and %d", smallQueries, largeQueries)
+	}
+	if small.Tasks.TotalCount != 4 || large.Tasks.TotalCount != 24 || len(large.Tasks.Items) != 24 {
+		t.Fatalf("unexpected pages: %d, %d with %d items", small.Tasks.TotalCount, large.Tasks.TotalCount, len(large.Tasks.Items))
+	}
+	for _, item := range large.Tasks.Items {
+		if item.Title == "blocker" {
+			if len(item.Blockers) != 0 || len(item.Comments) != 0 {
+				t.Fatalf("blocker has blockers or comments: %+v", item)
+			}
+			continue
+		}
+		if len(item.Blockers) != 1 || item.Blockers[0].Title != "blocker" {
+			t.Fatalf("expected %s to be blocked by blocker, got %+v", item.Title, item.Blockers)
+		}
+		if len(item.Comments) != 2 || item.Comments[0].Body != "one" || item.Comments[1].Body != "two" {
+			t.Fatalf("expected the first two comments of %s, got %+v", item.Title, item.Comments)
+		}
+		if item.Comments[0].Task.Title != item.Title {
+			t.Fatalf("expected comment task %s, got %s", item.Title, item.Comments[0].Task.Title)
+		}
+	}
+
+	// aliased lookups of single tasks share a query too
+	var byID map[string]*struct{ Title string }
+	s.data(`query($a: ID!, $b: ID!) { a: task(id: $a) { title } b: task(id: $b) { title } missing: task(id: "nope") { title } }`,
+		map[string]any{"a": blocker.ID, "b": strings.ToUpper(blocker.ID)}, &byID)
+	if byID["a"] == nil || byID["a"].Title != "blocker" || byID["b"] == nil || byID["missing"] != nil {
+		t.Fatalf("unexpected lookups: %+v", byID)
+	}
+}
+
+func TestGraphQLMutations(t *testing.T) {
+	db := setupTestDB(t)
+	s := newGraphQLServer(t, db, graphql.Limits{})
+
+	type task struct {
+		ID          string
+		Title       string
+		Description string
+		Completed   bool
+		DueAt       *time.Time
+		Blockers    []struct{ ID string }
+	}
+	var created struct{ CreateTask task }
+	s.data(`mutation($in: CreateTaskInput!) { createTask(input: $in) { id title description dueAt } }`,
+		map[string]any{"in": map[string]any{"title": "write report", "dueAt": "2030-01-02T15:04:05Z"}}, &created)
+	report := created.CreateTask
+	if report.Title != "write report" || report.DueAt == nil || !report.DueAt.Equal(time.Date(2030, 1, 2, 15, 4, 5, 0, time.UTC)) {
+		t.Fatalf("unexpected task: %+v", report)
+	}
+	s.data(`mutation { createTask(input: {title: "gather data"}) { id } }`, nil, &created)
+	data := created.CreateTask
+
+	var updated struct{ UpdateTask task }
+	s.data(`mutation($id: ID!) { updateTask(input: {id: $id, description: "q3"}) { title description } }`,
+		map[string]any{"id": report.ID}, &updated)
+	if updated.UpdateTask.Title != "write report" || updated.UpdateTask.Description != "q3" {
+		t.Fatalf("expected the title kept and the description changed, got %+v", updated.UpdateTask)
+	}
+
+	// the result of a mutation reads the state it left, not what an earlier
+	// field of the same operation loaded
+	var deps struct {
+		Before task
+		Add    task
+	}
+	s.data(`mutation($id: ID!, $by: ID!) {
+		before: updateTask(input: {id: $id}) { blockers { id } }
+		add: addDependency(id: $id, blockedById: $by) { blockers { id } }
+	}`, map[string]any{"id": report.ID, "by": data.ID}, &deps)
+	if len(deps.Before.Blockers) != 0 || len(deps.Add.Blockers) != 1 || deps.Add.Blockers[0].ID != data.ID {
+		t.Fatalf("unexpected blockers: %+v", deps)
+	}
+
+	out := s.post(http.StatusOK, `mutation($id: ID!) { completeTask(id: $id) { completed } }`, map[string]any{"id": report.ID})
+	if len(out.Errors) != 1 || out.Errors[0].Extensions["code"] != todo.ErrBlocked.Reason {
+		t.Fatalf("expected %s, got %+v", todo.ErrBlocked.Reason, out.Errors)
+	}
+	if string(out.Data["completeTask"]) != "" {
+		t.Fatalf("expected data to be null, got %s", out.Data)
+	}
+	var completed struct{ CompleteTask task }
+	s.data(`mutation($id: ID!) { completeTask(id: $id, force: true) { completed } }`, map[string]any{"id": report.ID}, &completed)
+	if !completed.CompleteTask.Completed {
+		t.Fatalf("expected the task to be completed")
+	}
+
+	var comment struct {
+		AddComment struct {
+			Author string
+			Body   string
+			Task   task
+		}
+	}
+	s.data(`mutation($id: ID!) { addComment(taskId: $id, author: "ann", body: "done") { author body task { id } } }`,
+		map[string]any{"id": report.ID}, &comment)
+	if comment.AddComment.Author != "ann" || comment.AddComment.Task.ID != report.ID {
+		t.Fatalf("unexpected comment: %+v", comment.AddComment)
+	}
+
+	var deleted struct {
+		DeleteTask string
+		Task       *task
+	}
+	s.data(`mutation($id: ID!) { deleteTask(id: $id) }`, map[string]any{"id": data.ID}, &deleted)
+	s.data(`query($id: ID!) { task(id: $id) { id } }`, map[string]any{"id": data.ID}, &deleted)
+	if deleted.Task != nil {
+		t.Fatalf("expected the deleted task to be null, got %+v", deleted.Task)
+	}
+
+	// service validation errors list the fields at fault
+	out = s.post(http.StatusOK, `mutation { createTask(input: {title: ""}) { id } }`, nil)
+	if len(out.Errors) != 1 || out.Errors[0].Extensions["code"] != "INVALID_ARGUMENT" {
+		t.Fatalf("expected INVALID_ARGUMENT, got %+v", out.Errors)
+	}
+	violations, _ := out.Errors[0].Extensions["violations"].([]any)
+	if len(violations) != 1 || violations[0].(map[string]any)["field"] != "title" {
+		t.Fatalf("expected a title violation, got %+v", out.Errors[0].Extensions)
+	}
+	if fmt.Sprint(out.Errors[0].Path) != "[createTask]" {
+		t.Fatalf("expected the path of the field, got %v", out.Errors[0].Path)
+	}
+
+	// mutations aren't accepted over GET
+	resp, err := http.Get(s.url + "?query=" + url.QueryEscape(`mutation { deleteTask(id: "x") }`))
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Fatalf("expected 405 for a mutation over GET, got %d", resp.StatusCode)
+	}
+}
+
+func TestGraphQLRequestErrors(t *testing.T) {
+	db := setupTestDB(t)
+	s := newGraphQLServer(t, db, graphql.Limits{MaxDepth: 4, MaxComplexity: 500})
+
+	cases := []struct {
+		name, query string
+		vars        map[string]any
+		code        string
+	}{
+		{"syntax", `{ tasks {`, nil, "GRAPHQL_PARSE_FAILED"},
+		{"unknown field", `{ tasks { nope } }`, nil, "GRAPHQL_VALIDATION_FAILED"},
+		{"missing argument", `{ task { id } }`, nil, "GRAPHQL_VALIDATION_FAILED"},
+		{"bad enum", `{ tasks(filter: SOON) { totalCount } }`, nil, "GRAPHQL_VALIDATION_FAILED"},
+		{"fragment cycle", `{ ...A } fragment A on Query { ...B } fragment B on Query { ...A }`, nil, "GRAPHQL_VALIDATION_FAILED"},
+		{"missing variable", `query($id: ID!) { task(id: $id) { id } }`, nil, "BAD_REQUEST"},
+		{"bad variable", `query($n: Int!) { tasks(pageSize: $n) { totalCount } }`, map[string]any{"n": "ten"}, "BAD_REQUEST"},
+		{"too deep", `{ tasks { items { blockers { blockers { id } } } } }`, nil, "QUERY_TOO_DEEP"},
+		{"too complex", `{ tasks(pageSize: 100) { items { comments(first: 10) { id } } } }`, nil, "QUERY_TOO_COMPLEX"},
+		{"complex through variables", `query($n: Int!) { tasks(pageSize: $n) { items { id title } } }`, map[string]any{"n": 300}, "QUERY_TOO_COMPLEX"},
+		{"subscription without a stream", `subscription { taskChanged { kind } }`, nil, "BAD_REQUEST"},
+		{"deep through inline fragments", `{ ... on Query { ... on Query { ... on Query { tasks { totalCount } } } } }`, nil, "QUERY_TOO_DEEP"},
+		{"deep through fragments", `{ ...A } fragment A on Query { ...B } fragment B on Query { tasks { items { id } } }`, nil, "QUERY_TOO_DEEP"},
+		{"nested too deep to parse", strings.Repeat("{ ... on Query ", 4000) + strings.Repeat("}", 4000), nil, "QUERY_TOO_DEEP"},
+		{"too many tokens", "{" + strings.Repeat(" id", 10001) + " }", nil, "QUERY_TOO_LARGE"},
+		{"too long", "{ tasks { totalCount } }" + strings.Repeat(" ", 64<<10), nil, "QUERY_TOO_LARGE"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			out := s.post(http.StatusBadRequest, tc.query, tc.vars)
+			if len(out.Errors) == 0 || out.Errors[0].Extensions["code"] != tc.code {
+				t.Fatalf("expected %s, got %+v", tc.code, out.Errors)
+			}
+			if out.Data != nil {
+				t.Fatalf("expected no data, got %s", out.Data)
+			}
+		})
+	}
+
+	// within the limits
+	var ok struct{ Tasks struct{ TotalCount int } }
+	s.data(`{ tasks(pageSize: 10) { totalCount items { blockers { id } } } }`, nil, &ok)
+}
+
+func TestGraphQLFragmentsMeasuredOnce(t *testing.T) {
+	s := newGraphQLServer(t, setupTestDB(t), graphql.Limits{MaxDepth: 100})
+
+	// every fragment spreads the next twice: 2^40 tasks fields, which must
+	// be measured without visiting each
+	var b strings.Builder
+	b.WriteString("{ ...F0 }\n")
+	for i := 0; i < 40; i++ {
+		fmt.Fprintf(&b, "fragment F%d on Query { ...F%d ...F%d }\n", i, i+1, i+1)
+	}
+	b.WriteString("fragment F40 on Query { tasks { totalCount } }\n")
+	out := s.post(http.StatusBadRequest, b.String(), nil)
+	if len(out.Errors) == 0 || out.Errors[0].Extensions["code"] != "QUERY_TOO_COMPLEX" {
+		t.Fatalf("expected QUERY_TOO_COMPLEX, got %+v", out.Errors)
+	}
+}
+
+func TestGraphQLIntrospection(t *testing.T) {
+	db := setupTestDB(t)
+	s := newGraphQLServer(t, db, graphql.Limits{})
+
+	var out struct {
+		Schema struct {
+			QueryType        struct{ Name string }
+			SubscriptionType struct{ Name string }
+			Types            []struct{ Name string }
+		} `json:"__schema"`
+		Type struct {
+			Fields []struct {
+				Name string
+				Args []struct {
+					Name         string
+					DefaultValue *string
+				}
+			}
+		} `json:"__type"`
+	}
+	s.data(`{
+		__schema { queryType { name } subscriptionType { name } types { name } }
+		__type(name: "Task") { fields { name args { name defaultValue } } }
+	}`, nil, &out)
+	if out.Schema.QueryType.Name != "Query" || out.Schema.SubscriptionType.Name != "Subscription" {
+		t.Fatalf("unexpected roots: %+v", out.Schema)
+	}
+	names := map[string]bool{}
+	for _, typ := range out.Schema.Types {
+		names[typ.Name] = true
+	}
+	for _, want := range []string{"Task", "Comment", "TaskPage", "TaskEvent", "DateTime", "CreateTaskInput", "__Schema"} {
+		if !names[want] {
+			t.Fatalf("expected type %s in %v", want, names)
+		}
+	}
+	for _, f := range out.Type.Fields {
+		if f.Name == "comments" {
+			if len(f.Args) != 1 || f.Args[0].DefaultValue == nil || *f.Args[0].DefaultValue != "10" {
+				t.Fatalf("unexpected comments args: %+v", f.Args)
+			}
+			return
+		}
+	}
+	t.Fatalf("Task has no comments field: %+v", out.Type.Fields)
+}
+
+func TestGraphQLSubscription(t *testing.T) {
+	db := setupTestDB(t)
+	s := newGraphQLServer(t, db, graphql.Limits{})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	body, _ := json.Marshal(map[string]any{"query": `subscription { taskChanged { kind task { title completed } } }`})
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("unexpected response: %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	lines := bufio.NewScanner(resp.Body)
+	next := func() (kind string, task *struct {
+		Title     string
+		Completed bool
+	}) {
+		t.Helper()
+		var event string
+		for lines.Scan() {
+			line := lines.Text()
+			if e, ok := strings.CutPrefix(line, "event: "); ok {
+				event = e
+			}
+			if data, ok := strings.CutPrefix(line, "data: "); ok && event == "next" {
+				var out struct {
+					Data struct {
+						TaskChanged struct {
+							Kind string
+							Task *struct {
+								Title     string
+								Completed bool
+							}
+						}
+					}
+				}
+				if err := json.Unmarshal([]byte(data), &out); err != nil {
+					t.Fatalf("decode event: %v", err)
+				}
+				return out.Data.TaskChanged.Kind, out.Data.TaskChanged.Task
+			}
+		}
+		t.Fatalf("stream ended: %v", lines.Err())
+		return "", nil
+	}
+
+	// the handler has subscribed once the headers are sent
+	task, err := s.svc.CreateTask(ctx, "", "ship it", "", nil, "")
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if kind, got := next(); kind != "CREATED" || got == nil || got.Title != "ship it" {
+		t.Fatalf("unexpected event: %s %+v", kind, got)
+	}
+	if _, err := s.svc.MarkComplete(ctx, task.ID, true, false); err != nil {
+		t.Fatalf("complete: %v", err)
+	}
+	if kind, got := next(); kind != "UPDATED" || got == nil || !got.Completed {
+		t.Fatalf("unexpected event: %s %+v", kind, got)
+	}
+	if err := s.svc.DeleteTask(ctx, task.ID); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if kind, got := next(); kind != "DELETED" || got != nil {
+		t.Fatalf("unexpected event: %s %+v", kind, got)
+	}
+}
+
+func TestBrokerDropsSlowSubscribers(t *testing.T) {
+	events := todo.NewBroker()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	slow := events.Subscribe(ctx)
+
+	// nobody reads, so the subscriber's buffer fills and it is dropped
+	for i := 0; i < 1000; i++ {
+		events.Publish(todo.TaskEvent{Kind: todo.EventUpdated, TaskID: fmt.Sprint(i)})
+	}
+	n := 0
+	for range slow {
+		n++
+	}
+	if n == 0 || n >= 1000 {
+		t.Fatalf("expected the subscriber to get some events and then be dropped, got %d", n)
+	}
+	if ctx.Err() != nil {
+		t.Fatalf("expected the channel to close while the context is live")
+	}
+}
@@ -0,0 +1,193 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	grpcapi "github.com/fuzail/08-todosvc/internal/grpc"
+	"github.com/fuzail/08-todosvc/internal/grpcweb"
+	"github.com/fuzail/08-todosvc/internal/rest"
+	"github.com/fuzail/08-todosvc/internal/todo"
+	pb "github.com/fuzail/08-todosvc/proto/todo/v1"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/proto"
+)
+
+// newSinglePortServer serves gRPC (h2c), gRPC-Web and REST on one listener,
+// the way the server does with SINGLE_PORT=true.
+func newSinglePortServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	db := setupTestDB(t)
+	repo := todo.NewGormRepository(db)
+	handler := grpcapi.NewHandler(todo.NewService(repo, todo.Limits{}, nil),
+		todo.NewCommentService(todo.NewGormCommentRepository(db), repo, todo.Limits{}), nil)
+	grpcServer := grpc.NewServer()
+	pb.RegisterTodoServiceServer(grpcServer, handler)
+	mux := http.NewServeMux()
+	if err := rest.RegisterHandlers(mux, handler, nil); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	web := grpcweb.NewHandler(grpcServer, []string{"https://app.example"})
+	srv := httptest.NewServer(h2c.NewHandler(grpcweb.Router(grpcServer, web, mux), &http2.Server{}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// grpcWebCall makes a unary gRPC-Web call and returns the response message
+// and trailers.
+func grpcWebCall(t *testing.T, url, contentType string, req proto.Message) ([]byte, http.Header) {
+	t.Helper()
+	msg, _ := proto.Marshal(req)
+	body := make([]byte, 5, 5+len(msg))
+	binary.BigEndian.PutUint32(body[1:], uint32(len(msg)))
+	body = append(body, msg...)
+	if strings.HasPrefix(contentType, "application/grpc-web-text") {
+		body = []byte(base64.StdEncoding.EncodeToString(body))
+	}
+	return grpcWebPost(t, url, contentType, body)
+}
+
+// grpcWebPost posts a gRPC-Web request body as it is, already encoded for
+// the text format, and returns the response message and trailers.
+func grpcWebPost(t *testing.T, url, contentType string, body []byte) ([]byte, http.Header) {
+	t.Helper()
+	text := strings.HasPrefix(contentType, "application/grpc-web-text")
+	httpReq, _ := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	httpReq.Header.Set("Content-Type", contentType)
+	httpReq.Header.Set("X-Grpc-Web", "1")
+	resp, err := http.DefaultClient.Do(httpReq)
+	if err != nil {
+		t.Fatalf("grpc-web call: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != contentType {
+		t.Fatalf("unexpected response %d %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	raw, _ := io.ReadAll(resp.Body)
+	if text {
+		// each chunk is padded base64 on its own
+		var decoded []byte
+		for len(raw) > 0 {
+			n := bytes.IndexByte(raw, '=')
+			end := len(raw)
+			if n >= 0 {
+				end = n
+				for end < len(raw) && raw[end] == '=' {
+					end++
+				}
+			}
+			chunk, err := base64.StdEncoding.DecodeString(string(raw[:end]))
+			if err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			decoded, raw = append(decoded, chunk...), raw[end:]
+		}
+		raw = decoded
+	}
+
+	var message []byte
+	trailers := http.Header{}
+	for len(raw) >= 5 {
+		flag, n := raw[0], binary.BigEndian.Uint32(raw[1:5])
+		frame := raw[5 : 5+n]
+		raw = raw[5+n:]
+		if flag&0x80 == 0 {
+			message = frame
+			continue
+		}
+		for _, line := range strings.Split(strings.TrimSpace(string(frame)), "\r\n") {
+			k, v, _ := strings.Cut(line, ": ")
+			trailers.Add(k, v)
+		}
+	}
+	return message, trailers
+}
+
+func TestSinglePortGRPCWeb(t *testing.T) {
+	srv := newSinglePortServer(t)
+
+	// native gRPC over cleartext HTTP/2
+	conn, err := grpc.NewClient(strings.TrimPrefix(srv.URL, "http://"), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	created, err := pb.NewTodoServiceClient(conn).CreateTask(context.Background(), &pb.CreateTaskRequest{Title: "one port"})
+	if err != nil {
+		t.Fatalf("grpc create: %v", err)
+	}
+
+	// gRPC-Web, binary and text
+	for _, ct := range []string{"application/grpc-web+proto", "application/grpc-web-text"} {
+		msg, trailers := grpcWebCall(t, srv.URL+pb.TodoService_GetTask_FullMethodName, ct, &pb.GetTaskRequest{Id: created.Task.Id})
+		var got pb.GetTaskResponse
+		if err := proto.Unmarshal(msg, &got); err != nil {
+			t.Fatalf("%s: unmarshal: %v", ct, err)
+		}
+		if got.Task.GetTitle() != "one port" || trailers.Get("grpc-status") != "0" {
+			t.Fatalf("%s: unexpected response %v trailers %v", ct, got.Task, trailers)
+		}
+	}
+	// text clients may encode the body in chunks, each padded on its own:
+	// here the frame header and the message
+	req, _ := proto.Marshal(&pb.GetTaskRequest{Id: created.Task.Id})
+	header := make([]byte, 5)
+	binary.BigEndian.PutUint32(header[1:], uint32(len(req)))
+	chunked := base64.StdEncoding.EncodeToString(header) + base64.StdEncoding.EncodeToString(req)
+	if strings.Count(chunked, "=") < 2 {
+		t.Fatalf("expected both chunks to be padded: %s", chunked)
+	}
+	msg, trailers := grpcWebPost(t, srv.URL+pb.TodoService_GetTask_FullMethodName, "application/grpc-web-text", []byte(chunked))
+	var got pb.GetTaskResponse
+	if err := proto.Unmarshal(msg, &got); err != nil || got.Task.GetTitle() != "one port" || trailers.Get("grpc-status") != "0" {
+		t.Fatalf("chunked text: unexpected response %v %v trailers %v", got.Task, err, trailers)
+	}
+
+	msg, trailers = grpcWebCall(t, srv.URL+pb.TodoService_GetTask_FullMethodName, "application/grpc-web",
+		&pb.GetTaskRequest{Id: "0198f0e4-0000-7000-8000-000000000000"})
+	if msg != nil || trailers.Get("grpc-status") != "5" || trailers.Get("grpc-message") != "task not found" {
+		t.Fatalf("expected NotFound trailers, got %v", trailers)
+	}
+
+	// REST on the same port
+	resp, err := http.Get(srv.URL + "/v1/tasks/" + created.Task.Id)
+	if err != nil {
+		t.Fatalf("rest get: %v", err)
+	}
+	decodeJSON(t, resp, http.StatusOK, &struct{}{})
+}
+
+func TestGRPCWebCORS(t *testing.T) {
+	srv := newSinglePortServer(t)
+	preflight := func(origin string) *http.Response {
+		req, _ := http.NewRequest(http.MethodOptions, srv.URL+pb.TodoService_ListTasks_FullMethodName, nil)
+		req.Header.Set("Origin", origin)
+		req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+		req.Header.Set("Access-Control-Request-Headers", "content-type,x-grpc-web,x-user-agent")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("preflight: %v", err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	resp := preflight("https://app.example")
+	if resp.StatusCode != http.StatusNoContent || resp.Header.Get("Access-Control-Allow-Origin") != "https://app.example" ||
+		resp.Header.Get("Access-Control-Allow-Headers") != "content-type,x-grpc-web,x-user-agent" {
+		t.Fatalf("unexpected preflight response %d %v", resp.StatusCode, resp.Header)
+	}
+	if resp := preflight("https://evil.example"); resp.Header.Get("Access-Control-Allow-Origin") != "" {
+		t.Fatalf("origin not on the list was allowed: %v", resp.Header)
+	}
+}
@@ -0,0 +1,92 @@
+package test
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/fuzail/08-todosvc/internal/health"
+	"github.com/fuzail/08-todosvc/internal/todo"
+	pb "github.com/fuzail/08-todosvc/proto/todo/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestHealthProbes(t *testing.T) {
+	db := setupTestDB(t)
+	models := []interface{}{&todo.Task{}, &todo.Dependency{}, &todo.Comment{}, &todo.Attachment{}}
+	checker := health.NewChecker(db, models, pb.TodoService_ServiceDesc.ServiceName)
+
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer()
+	checker.Register(srv)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	client := healthpb.NewHealthClient(conn)
+	grpcStatus := func() healthpb.HealthCheckResponse_ServingStatus {
+		resp, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{Service: pb.TodoService_ServiceDesc.ServiceName})
+		if err != nil {
+			t.Fatalf("health check: %v", err)
+		}
+		return resp.Status
+	}
+	ready := func() int {
+		rec := httptest.NewRecorder()
+		checker.ReadyHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		return rec.Code
+	}
+
+	// not serving until the first check has run
+	if st := grpcStatus(); st != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Fatalf("expected NOT_SERVING before the first check, got %s", st)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go checker.Watch(ctx, 10*time.Millisecond)
+	deadline := time.Now().Add(time.Second)
+	for grpcStatus() != healthpb.HealthCheckResponse_SERVING {
+		if time.Now().After(deadline) {
+			t.Fatalf("service never became SERVING")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if code := ready(); code != http.StatusOK {
+		t.Fatalf("expected /readyz 200, got %d", code)
+	}
+
+	// a missing table means migrations haven't been applied
+	if err := db.Migrator().DropTable(&todo.Comment{}); err != nil {
+		t.Fatalf("drop: %v", err)
+	}
+	if code := ready(); code != http.StatusServiceUnavailable {
+		t.Fatalf("expected /readyz 503 with a missing table, got %d", code)
+	}
+	if err := db.AutoMigrate(&todo.Comment{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	checker.Shutdown()
+	if st := grpcStatus(); st != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Fatalf("expected NOT_SERVING after shutdown, got %s", st)
+	}
+	if code := ready(); code != http.StatusServiceUnavailable {
+		t.Fatalf("expected /readyz 503 after shutdown, got %d", code)
+	}
+	rec := httptest.NewRecorder()
+	checker.LiveHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/livez", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected /livez 200 while draining, got %d", rec.Code)
+	}
+}
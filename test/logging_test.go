@@ -0,0 +1,67 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/fuzail/08-todosvc/internal/logging"
+	"github.com/fuzail/08-todosvc/internal/reqctx"
+)
+
+func TestAccessLogRequestID(t *testing.T) {
+	var buf bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(logging.New(&buf, slog.LevelInfo))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+
+	var inner string
+	h := logging.HTTPMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inner = reqctx.RequestID(r.Context())
+		slog.InfoContext(r.Context(), "handling")
+		w.WriteHeader(http.StatusTeapot)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/tasks", nil)
+	req.Header.Set("X-Request-ID", "req-123")
+	req.Header.Set("X-Tenant-ID", "acme")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if got := rec.Header().Get("X-Request-ID"); got != "req-123" || inner != "req-123" {
+		t.Fatalf("expected request ID to be echoed and propagated, got header=%q ctx=%q", got, inner)
+	}
+
+	var lines []map[string]interface{}
+	for dec := json.NewDecoder(&buf); dec.More(); {
+		var m map[string]interface{}
+		if err := dec.Decode(&m); err != nil {
+			t.Fatalf("decode log line: %v", err)
+		}
+		lines = append(lines, m)
+	}
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 log lines, got %d", len(lines))
+	}
+	for _, l := range lines {
+		if l["request_id"] != "req-123" {
+			t.Errorf("log line missing request context: %v", l)
+		}
+		// the tenant is up to auth.Policy, not the header
+		if l["tenant"] != nil {
+			t.Errorf("tenant taken from the header: %v", l)
+		}
+	}
+	if access := lines[1]; access["method"] != "GET" || access["status"] != float64(http.StatusTeapot) || access["duration"] == nil {
+		t.Errorf("unexpected access log: %v", access)
+	}
+
+	// without an incoming ID one is generated
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/tasks", nil))
+	if rec.Header().Get("X-Request-ID") == "" {
+		t.Fatalf("expected a generated request ID")
+	}
+}
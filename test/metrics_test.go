@@ -0,0 +1,103 @@
+package test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fuzail/08-todosvc/internal/grpc"
+	"github.com/fuzail/08-todosvc/internal/metrics"
+	"github.com/fuzail/08-todosvc/internal/rest"
+	"github.com/fuzail/08-todosvc/internal/todo"
+	"github.com/fuzail/08-todosvc/pkg/storage"
+)
+
+func TestMetricsEndpoint(t *testing.T) {
+	db := setupTestDB(t)
+	repo := metrics.InstrumentRepository(todo.NewGormRepository(db))
+	svc := todo.NewService(repo, todo.Limits{}, nil)
+	blobs, _ := storage.NewFSStore(t.TempDir())
+	task, _ := svc.CreateTask(context.Background(), "", "observe", "", nil, "")
+
+	atts := todo.NewAttachmentService(todo.NewGormAttachmentRepository(db), repo, blobs, 0, nil)
+	mux := http.NewServeMux()
+	err := rest.RegisterHandlers(mux, grpc.NewHandler(svc,
+		todo.NewCommentService(todo.NewGormCommentRepository(db), repo, todo.Limits{}), atts), atts)
+	if err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	mux.Handle("/metrics", metrics.Handler())
+	srv := httptest.NewServer(metrics.HTTPMiddleware(rest.RoutePattern, mux))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/v1/tasks/" + task.ID)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	resp.Body.Close()
+
+	resp, err = http.Get(srv.URL + "/metrics")
+	if err != nil {
+		t.Fatalf("metrics: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	for _, want := range []string{
+		`http_requests_total{code="200",method="GET",route="/v1/tasks/{id}"}`,
+		`todosvc_tasks_created_total`,
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("metrics output missing %s", want)
+		}
+	}
+}
+
+// counter returns the value of a counter without labels in metrics.Registry.
+func counter(t *testing.T, name string) float64 {
+	t.Helper()
+	families, err := metrics.Registry.Gather()
+	if err != nil {
+		t.Fatalf("gather: %v", err)
+	}
+	for _, f := range families {
+		if f.GetName() == name {
+			return f.GetMetric()[0].GetCounter().GetValue()
+		}
+	}
+	t.Fatalf("no metric %s", name)
+	return 0
+}
+
+func TestTaskCounters(t *testing.T) {
+	db := setupTestDB(t)
+	svc := todo.NewService(metrics.InstrumentRepository(todo.NewGormRepository(db)), todo.Limits{}, nil)
+	ctx := context.Background()
+	created, completed := counter(t, "todosvc_tasks_created_total"), counter(t, "todosvc_tasks_completed_total")
+
+	due := time.Date(2026, 1, 5, 9, 0, 0, 0, time.UTC)
+	task, _ := svc.CreateTask(ctx, "", "daily", "", &due, "FREQ=DAILY")
+	if _, err := svc.ImportTask(ctx, todo.Task{Title: "imported", Completed: true}, false); err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	synced := todo.Task{ID: "0190c2a4-8e5b-7c3a-9f1e-2b4d6a8c0e31", Title: "synced"}
+	if _, err := svc.SyncTasks(ctx, "", []todo.TaskChange{{Task: synced}}, 0); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	// the next occurrence is created too; completing again changes nothing
+	for i := 0; i < 2; i++ {
+		if _, err := svc.MarkComplete(ctx, task.ID, true, false); err != nil {
+			t.Fatalf("complete: %v", err)
+		}
+	}
+
+	if got := counter(t, "todosvc_tasks_created_total") - created; got != 4 {
+		t.Errorf("expected 4 tasks created, counted %v", got)
+	}
+	if got := counter(t, "todosvc_tasks_completed_total") - completed; got != 1 {
+		t.Errorf("expected 1 task completed, counted %v", got)
+	}
+}
@@ -0,0 +1,93 @@
+package test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/fuzail/08-todosvc/internal/protocheck"
+	pb "github.com/fuzail/08-todosvc/proto/todo/v1"
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// TestProtoBaseline runs the breaking-change check that `make breaking` runs,
+// so an incompatible edit to todo.proto fails the tests too.
+func TestProtoBaseline(t *testing.T) {
+	base, err := protocheck.Load("../proto/todo/v1/baseline.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if problems := protocheck.Breaking(base, protocheck.Describe(pb.File_todo_v1_todo_proto)); len(problems) > 0 {
+		t.Fatalf("breaking changes against the baseline:\n%s", strings.Join(problems, "\n"))
+	}
+}
+
+func TestProtoBreakingRules(t *testing.T) {
+	base := protocheck.Describe(pb.File_todo_v1_todo_proto)
+	message := func(fdp *descriptorpb.FileDescriptorProto, name string) *descriptorpb.DescriptorProto {
+		for _, m := range fdp.GetMessageType() {
+			if m.GetName() == name {
+				return m
+			}
+		}
+		t.Fatalf("no message %s", name)
+		return nil
+	}
+
+	for _, tc := range []struct {
+		name   string
+		change func(*descriptorpb.FileDescriptorProto)
+		want   string // substring of the only problem; empty for compatible changes
+	}{
+		{"add field", func(f *descriptorpb.FileDescriptorProto) {
+			m := message(f, "Task")
+			m.Field = append(m.Field, &descriptorpb.FieldDescriptorProto{
+				Name: proto.String("priority"), Number: proto.Int32(99),
+				Type: descriptorpb.FieldDescriptorProto_TYPE_INT32.Enum(),
+			})
+		}, ""},
+		{"delete reserved field", func(f *descriptorpb.FileDescriptorProto) {
+			m := message(f, "Task")
+			m.Field = m.Field[1:] // id = 1
+			m.ReservedRange = append(m.ReservedRange, &descriptorpb.DescriptorProto_ReservedRange{Start: proto.Int32(1), End: proto.Int32(2)})
+		}, ""},
+		{"delete field", func(f *descriptorpb.FileDescriptorProto) {
+			m := message(f, "Task")
+			m.Field = m.Field[1:]
+		}, "field todo.v1.Task.id (1) deleted"},
+		{"rename field", func(f *descriptorpb.FileDescriptorProto) {
+			message(f, "Task").Field[1].Name = proto.String("name")
+		}, "field todo.v1.Task.title (2) renamed to name"},
+		{"change type", func(f *descriptorpb.FileDescriptorProto) {
+			message(f, "Task").Field[3].Type = descriptorpb.FieldDescriptorProto_TYPE_INT32.Enum()
+		}, "field todo.v1.Task.completed changed type"},
+		{"delete message", func(f *descriptorpb.FileDescriptorProto) {
+			f.MessageType = f.MessageType[1:]
+		}, "message todo.v1.Task deleted"},
+		{"change http path", func(f *descriptorpb.FileDescriptorProto) {
+			m := f.Service[0].Method[0]
+			rule := proto.Clone(proto.GetExtension(m.Options, annotations.E_Http).(*annotations.HttpRule)).(*annotations.HttpRule)
+			rule.Pattern = &annotations.HttpRule_Post{Post: "/v1/todos"}
+			proto.SetExtension(m.Options, annotations.E_Http, rule)
+		}, "rpc todo.v1.TodoService.CreateTask changed its HTTP binding"},
+		{"delete rpc", func(f *descriptorpb.FileDescriptorProto) {
+			f.Service[0].Method = f.Service[0].Method[1:]
+		}, "rpc todo.v1.TodoService.CreateTask deleted"},
+		{"rename package", func(f *descriptorpb.FileDescriptorProto) {
+			f.Package = proto.String("todo.v2")
+		}, `package changed from "todo.v1" to "todo.v2"`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cur := proto.Clone(base).(*descriptorpb.FileDescriptorProto)
+			tc.change(cur)
+			problems := protocheck.Breaking(base, cur)
+			switch {
+			case tc.want == "" && len(problems) > 0:
+				t.Fatalf("unexpected problems %v", problems)
+			case tc.want != "" && (len(problems) == 0 || !strings.Contains(problems[0], tc.want)):
+				t.Fatalf("expected %q, got %v", tc.want, problems)
+			}
+		})
+	}
+}
@@ -0,0 +1,321 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fuzail/08-todosvc/internal/auth"
+	grpcapi "github.com/fuzail/08-todosvc/internal/grpc"
+	"github.com/fuzail/08-todosvc/internal/logging"
+	"github.com/fuzail/08-todosvc/internal/reqctx"
+	"github.com/fuzail/08-todosvc/internal/rest"
+	"github.com/fuzail/08-todosvc/internal/todo"
+	"github.com/fuzail/08-todosvc/pkg/storage"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+func newQuotaService(t *testing.T, db *gorm.DB, defaults todo.Quota) todo.QuotaService {
+	t.Helper()
+	if err := db.AutoMigrate(&todo.Quota{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return todo.NewQuotaService(todo.NewGormQuotaRepository(db), defaults)
+}
+
+func quotaViolation(t *testing.T, err error) string {
+	t.Helper()
+	var de *todo.Error
+	if !errors.Is(err, todo.ErrQuotaExceeded) || !errors.As(err, &de) || len(de.Violations) != 1 {
+		t.Fatalf("expected a quota error, got %v", err)
+	}
+	return de.Violations[0].Field
+}
+
+func TestQuotaOpenTasks(t *testing.T) {
+	db := setupTestDB(t)
+	quotas := newQuotaService(t, db, todo.Quota{MaxOpenTasks: 2})
+	svc := todo.NewService(todo.NewGormRepository(db), todo.Limits{}, quotas)
+	acme := reqctx.WithTenant(context.Background(), "acme")
+
+	first, err := svc.CreateTask(acme, "", "one", "", nil, "")
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if first.Tenant != "acme" {
+		t.Fatalf("task tenant %q", first.Tenant)
+	}
+	if _, err := svc.CreateTask(acme, "", "two", "", nil, ""); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	_, err = svc.CreateTask(acme, "", "three", "", nil, "")
+	if got := quotaViolation(t, err); got != "max_open_tasks" {
+		t.Fatalf("violated %q", got)
+	}
+
+	// other tenants have their own count, including the default tenant
+	if task, err := svc.CreateTask(context.Background(), "", "mine", "", nil, ""); err != nil || task.Tenant != todo.DefaultTenant {
+		t.Fatalf("default tenant create: %v %v", task, err)
+	}
+	// completing a task frees a slot
+	if _, err := svc.MarkComplete(acme, first.ID, true, false); err != nil {
+		t.Fatalf("complete: %v", err)
+	}
+	if _, err := svc.CreateTask(acme, "", "three", "", nil, ""); err != nil {
+		t.Fatalf("create after completing: %v", err)
+	}
+	// and reopening it takes one
+	_, err = svc.MarkComplete(acme, first.ID, false, false)
+	if got := quotaViolation(t, err); got != "max_open_tasks" {
+		t.Fatalf("violated %q", got)
+	}
+	if _, err := svc.ReplaceTask(acme, todo.Task{ID: first.ID, Title: "one"}); err == nil {
+		t.Fatal("expected reopening by replace to fail")
+	}
+
+	u, err := quotas.GetUsage(context.Background(), "acme")
+	if err != nil || u.OpenTasks != 2 || u.TasksToday != 3 {
+		t.Fatalf("unexpected usage %+v %v", u, err)
+	}
+}
+
+func TestQuotaTasksPerDay(t *testing.T) {
+	db := setupTestDB(t)
+	quotas := newQuotaService(t, db, todo.Quota{})
+	svc := todo.NewService(todo.NewGormRepository(db), todo.Limits{}, quotas)
+	ctx := reqctx.WithTenant(context.Background(), "junk")
+	if _, err := quotas.SetQuota(ctx, todo.Quota{Tenant: "junk", MaxTasksPerDay: 1}); err != nil {
+		t.Fatalf("set quota: %v", err)
+	}
+
+	task, err := svc.CreateTask(ctx, "", "one", "", nil, "")
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	// deleting doesn't give the day's quota back
+	if err := svc.DeleteTask(ctx, task.ID); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	_, err = svc.CreateTask(ctx, "", "two", "", nil, "")
+	if got := quotaViolation(t, err); got != "max_tasks_per_day" {
+		t.Fatalf("violated %q", got)
+	}
+	// sync creates count too
+	res, err := svc.SyncTasks(ctx, "", []todo.TaskChange{{Task: todo.Task{ID: "0190c2a4-8e5b-7c3a-9f1e-2b4d6a8c0e12", Title: "synced"}}}, 0)
+	if err != nil || res.Results[0].Status != todo.ChangeRejected || res.Results[0].Reason != todo.ErrQuotaExceeded.Reason {
+		t.Fatalf("expected a quota rejection, got %+v %v", res, err)
+	}
+}
+
+func TestQuotaNextOccurrence(t *testing.T) {
+	db := setupTestDB(t)
+	quotas := newQuotaService(t, db, todo.Quota{MaxTasksPerDay: 1})
+	svc := todo.NewService(todo.NewGormRepository(db), todo.Limits{}, quotas)
+	ctx := context.Background()
+
+	due := time.Date(2026, 1, 5, 9, 0, 0, 0, time.UTC)
+	task, err := svc.CreateTask(ctx, "", "backup", "", &due, "FREQ=DAILY")
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	// the next occurrence is a task created today
+	_, err = svc.MarkComplete(ctx, task.ID, true, false)
+	if got := quotaViolation(t, err); got != "max_tasks_per_day" {
+		t.Fatalf("violated %q", got)
+	}
+	if got, _ := svc.GetTask(ctx, task.ID); got.Completed || got.Recurrence == "" {
+		t.Fatalf("task changed by a refused completion: %+v", got)
+	}
+	// the last occurrence of a series has no next one to count
+	last, err := svc.ReplaceTask(ctx, todo.Task{ID: task.ID, Title: "backup", DueAt: &due})
+	if err != nil {
+		t.Fatalf("drop rule: %v", err)
+	}
+	if _, err := svc.MarkComplete(ctx, last.ID, true, false); err != nil {
+		t.Fatalf("complete: %v", err)
+	}
+}
+
+func TestQuotaSyncRestore(t *testing.T) {
+	db := setupTestDB(t)
+	quotas := newQuotaService(t, db, todo.Quota{MaxOpenTasks: 1})
+	svc := todo.NewService(todo.NewGormRepository(db), todo.Limits{}, quotas)
+	acme := reqctx.WithTenant(context.Background(), "acme")
+
+	gone, err := svc.CreateTask(acme, "", "gone", "", nil, "")
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if err := svc.DeleteTask(acme, gone.ID); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if _, err := svc.CreateTask(acme, "", "open", "", nil, ""); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	// restoring the deleted task would make a second open one; it is
+	// rejected on its own, and the change before it is still applied
+	restore := todo.Task{ID: gone.ID, Title: "back", UpdatedAt: time.Now().Add(time.Minute)}
+	done := todo.Task{ID: uuid.NewString(), Title: "done", Completed: true, UpdatedAt: time.Now()}
+	res, err := svc.SyncTasks(acme, "", []todo.TaskChange{{Task: done}, {Task: restore}}, 0)
+	if err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	if res.Results[0].Status != todo.ChangeApplied || res.Results[1].Status != todo.ChangeRejected ||
+		res.Results[1].Reason != todo.ErrQuotaExceeded.Reason || res.Watermark == "" {
+		t.Fatalf("unexpected results: %+v", res)
+	}
+	if got, err := svc.GetTask(acme, gone.ID); err == nil {
+		t.Fatalf("rejected restore was applied: %+v", got)
+	}
+	// restoring it completed doesn't
+	restore.Completed = true
+	res, err = svc.SyncTasks(acme, "", []todo.TaskChange{{Task: restore}}, 0)
+	if err != nil || res.Results[0].Status != todo.ChangeApplied {
+		t.Fatalf("restore completed: %+v %v", res, err)
+	}
+}
+
+func TestQuotaAttachmentBytes(t *testing.T) {
+	db := setupTestDB(t)
+	quotas := newQuotaService(t, db, todo.Quota{MaxAttachmentBytes: 10})
+	repo := todo.NewGormRepository(db)
+	svc := todo.NewService(repo, todo.Limits{}, quotas)
+	blobs, _ := storage.NewFSStore(t.TempDir())
+	atts := todo.NewAttachmentService(todo.NewGormAttachmentRepository(db), repo, blobs, 0, quotas)
+	ctx := context.Background()
+
+	task, err := svc.CreateTask(ctx, "", "files", "", nil, "")
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if _, err := atts.Upload(ctx, task.ID, "a.txt", "", strings.NewReader("12345678")); err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+	_, err = atts.Upload(ctx, task.ID, "b.txt", "", strings.NewReader("12345"))
+	if got := quotaViolation(t, err); got != "max_attachment_bytes" {
+		t.Fatalf("violated %q", got)
+	}
+	list, err := atts.ListAttachments(ctx, task.ID)
+	if err != nil || len(list) != 1 {
+		t.Fatalf("rejected upload was kept: %v %v", list, err)
+	}
+
+	// an upload over the room left is cut off right after it, not stored
+	// in full first
+	big := &io.LimitedReader{R: strings.NewReader(strings.Repeat("x", 1<<20)), N: 1 << 20}
+	_, err = atts.Upload(ctx, task.ID, "big.bin", "", big)
+	quotaViolation(t, err)
+	if read := 1<<20 - big.N; read > 3 {
+		t.Fatalf("read %d bytes with 2 left", read)
+	}
+
+	// a deleted task's attachments count until it is purged
+	if err := svc.DeleteTask(ctx, task.ID); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	other, err := svc.CreateTask(ctx, "", "more files", "", nil, "")
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	_, err = atts.Upload(ctx, other.ID, "c.txt", "", strings.NewReader("12345"))
+	quotaViolation(t, err)
+	if err := db.Unscoped().Model(&todo.Task{}).Where("id = ?", task.ID).
+		Update("deleted_at", time.Now().AddDate(0, 0, -2)).Error; err != nil {
+		t.Fatalf("age deletion: %v", err)
+	}
+	maint := todo.NewMaintenanceService(todo.NewGormMaintenanceRepository(db), blobs)
+	if res, err := maint.PurgeDeleted(ctx, time.Now()); err != nil || res.Attachments != 1 {
+		t.Fatalf("purge: %+v %v", res, err)
+	}
+	if _, err := atts.Upload(ctx, other.ID, "c.txt", "", strings.NewReader("12345")); err != nil {
+		t.Fatalf("upload after purge: %v", err)
+	}
+}
+
+func TestAdminQuotaREST(t *testing.T) {
+	db := setupTestDB(t)
+	quotas := newQuotaService(t, db, todo.Quota{MaxOpenTasks: 100})
+	repo := todo.NewGormRepository(db)
+	mux := http.NewServeMux()
+	if err := rest.RegisterHandlers(mux, grpcapi.NewHandler(todo.NewService(repo, todo.Limits{}, quotas),
+		todo.NewCommentService(todo.NewGormCommentRepository(db), repo, todo.Limits{}), nil), nil); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	if err := rest.RegisterAdminHandlers(mux, grpcapi.NewAdminHandler(quotas, nil)); err != nil {
+		t.Fatalf("register admin: %v", err)
+	}
+	// every request comes from the acme app's certificate
+	acmeApp := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(reqctx.WithClient(r.Context(), reqctx.Client{Names: []string{"acme-app"}})))
+		})
+	}
+	newServer := func(admins ...string) *httptest.Server {
+		policy := auth.NewPolicy(nil, admins)
+		policy.SetTenants(map[string][]string{"acme-app": {"acme"}})
+		srv := httptest.NewServer(acmeApp(logging.HTTPMiddleware(policy.HTTPMiddleware(rest.WriteError, mux))))
+		t.Cleanup(srv.Close)
+		return srv
+	}
+	srv := newServer("*")
+	do := func(method, path, tenant, body string) *http.Response {
+		req, _ := http.NewRequest(method, srv.URL+path, bytes.NewBufferString(body))
+		req.Header.Set(reqctx.TenantHeader, tenant)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s: %v", method, path, err)
+		}
+		return resp
+	}
+
+	var got struct {
+		Quota struct {
+			Tenant       string `json:"tenant"`
+			MaxOpenTasks string `json:"max_open_tasks"` // int64 is a JSON string
+		}
+		Usage struct {
+			OpenTasks string `json:"open_tasks"`
+		}
+	}
+	decodeJSON(t, do(http.MethodGet, "/v1/admin/tenants/acme/quota", "", ""), http.StatusOK, &got)
+	if got.Quota.Tenant != "acme" || got.Quota.MaxOpenTasks != "100" {
+		t.Fatalf("expected the default quota, got %+v", got.Quota)
+	}
+	decodeJSON(t, do(http.MethodPut, "/v1/admin/tenants/acme/quota", "", `{"max_open_tasks":1}`), http.StatusOK, &got)
+	decodeJSON(t, do(http.MethodPut, "/v1/admin/tenants/acme/quota", "", `{"max_open_tasks":-1}`), http.StatusBadRequest, &struct{}{})
+
+	decodeJSON(t, do(http.MethodPost, "/v1/tasks", "acme", `{"title":"only one"}`), http.StatusCreated, &struct{}{})
+	var problem rest.Problem
+	decodeJSON(t, do(http.MethodPost, "/v1/tasks", "acme", `{"title":"too many"}`), http.StatusForbidden, &problem)
+	if problem.Code != "quota_exceeded" || len(problem.Errors) != 1 || problem.Errors[0].Field != "max_open_tasks" {
+		t.Fatalf("unexpected problem %+v", problem)
+	}
+
+	decodeJSON(t, do(http.MethodGet, "/v1/admin/tenants/acme/usage", "", ""), http.StatusOK, &got)
+	if got.Quota.MaxOpenTasks != "1" || got.Usage.OpenTasks != "1" {
+		t.Fatalf("unexpected usage %+v", got)
+	}
+
+	// the client acts for its own tenant only
+	decodeJSON(t, do(http.MethodPost, "/v1/tasks", "", `{"title":"still acme"}`), http.StatusForbidden, &problem)
+	if problem.Code != "quota_exceeded" {
+		t.Fatalf("expected acme's quota without a header, got %+v", problem)
+	}
+	decodeJSON(t, do(http.MethodPost, "/v1/tasks", "other", `{"title":"not mine"}`), http.StatusForbidden, &problem)
+	if problem.Code != "permission_denied" {
+		t.Fatalf("expected another tenant to be refused, got %+v", problem)
+	}
+
+	// without admins the admin API is closed, the rest of the API isn't
+	srv = newServer()
+	decodeJSON(t, do(http.MethodGet, "/v1/admin/tenants/acme/usage", "", ""), http.StatusForbidden, &struct{}{})
+	decodeJSON(t, do(http.MethodGet, "/v1/tasks", "acme", ""), http.StatusOK, &struct{}{})
+}
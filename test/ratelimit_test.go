@@ -0,0 +1,246 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/fuzail/08-todosvc/internal/graphql"
+	grpcapi "github.com/fuzail/08-todosvc/internal/grpc"
+	"github.com/fuzail/08-todosvc/internal/ratelimit"
+	"github.com/fuzail/08-todosvc/internal/reqctx"
+	"github.com/fuzail/08-todosvc/internal/rest"
+	"github.com/fuzail/08-todosvc/internal/todo"
+	pb "github.com/fuzail/08-todosvc/proto/todo/v1"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestRateLimitStores(t *testing.T) {
+	db := setupTestDB(t)
+	if err := db.AutoMigrate(&ratelimit.Bucket{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	for name, store := range map[string]ratelimit.Store{
+		"memory":   ratelimit.NewMemoryStore(),
+		"postgres": ratelimit.NewGormStore(db),
+	} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			take := func(key string, l ratelimit.Limit) (bool, time.Duration) {
+				ok, retryAfter, err := store.Take(ctx, key, l)
+				if err != nil {
+					t.Fatalf("take: %v", err)
+				}
+				return ok, retryAfter
+			}
+
+			slow := ratelimit.Limit{Rate: 1, Burst: 2}
+			for i := 0; i < 2; i++ {
+				if ok, _ := take("a", slow); !ok {
+					t.Fatalf("take %d denied within the burst", i)
+				}
+			}
+			ok, retryAfter := take("a", slow)
+			if ok || retryAfter <= 0 || retryAfter > time.Second {
+				t.Fatalf("expected denial with retry within 1s, got ok=%v retry=%v", ok, retryAfter)
+			}
+			if ok, _ := take("b", slow); !ok {
+				t.Fatal("buckets are not separate")
+			}
+
+			fast := ratelimit.Limit{Rate: 100, Burst: 1}
+			take("c", fast)
+			if ok, _ := take("c", fast); ok {
+				t.Fatal("expected empty bucket")
+			}
+			time.Sleep(30 * time.Millisecond)
+			if ok, _ := take("c", fast); !ok {
+				t.Fatal("bucket did not refill")
+			}
+		})
+	}
+}
+
+func TestRateLimitREST(t *testing.T) {
+	db := setupTestDB(t)
+	repo := todo.NewGormRepository(db)
+	mux := http.NewServeMux()
+	if err := rest.RegisterHandlers(mux, grpcapi.NewHandler(todo.NewService(repo, todo.Limits{}, nil),
+		todo.NewCommentService(todo.NewGormCommentRepository(db), repo, todo.Limits{}), nil), nil); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	limiter := ratelimit.New(ratelimit.NewMemoryStore(), ratelimit.Config{
+		Write:   ratelimit.Limit{Rate: 0.5, Burst: 1},
+		APIKeys: []string{"alice", "bob", "carol"},
+	})
+	// a client certificate, as auth.HTTPMiddleware would set it
+	withClient := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if name := r.Header.Get("Test-Client"); name != "" {
+				r = r.WithContext(reqctx.WithClient(r.Context(), reqctx.Client{Names: []string{name}}))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+	srv := httptest.NewServer(withClient(limiter.HTTPMiddleware(rest.WriteError, mux)))
+	t.Cleanup(srv.Close)
+
+	createAs := func(client, apiKey string) *http.Response {
+		req, _ := http.NewRequest(http.MethodPost, srv.URL+"/v1/tasks", bytes.NewBufferString(`{"title":"flood"}`))
+		req.Header.Set(ratelimit.APIKeyHeader, apiKey)
+		req.Header.Set("Test-Client", client)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("post: %v", err)
+		}
+		return resp
+	}
+	create := func(apiKey string) *http.Response { return createAs("", apiKey) }
+	decodeJSON(t, create("alice"), http.StatusCreated, &struct{}{})
+	resp := create("alice")
+	if resp.Header.Get("Retry-After") != "2" {
+		t.Fatalf("expected Retry-After 2, got %q", resp.Header.Get("Retry-After"))
+	}
+	var problem rest.Problem
+	decodeJSON(t, resp, http.StatusTooManyRequests, &problem)
+	if problem.Code != "rate_limited" {
+		t.Fatalf("unexpected problem %+v", problem)
+	}
+
+	// another key has its own budget, and reads have theirs
+	decodeJSON(t, create("bob"), http.StatusCreated, &struct{}{})
+	resp, err := http.Get(srv.URL + "/v1/tasks")
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	decodeJSON(t, resp, http.StatusOK, &struct{}{})
+
+	// unknown keys don't get a bucket of their own: both share the IP's
+	decodeJSON(t, create("made-up-1"), http.StatusCreated, &struct{}{})
+	decodeJSON(t, create("made-up-2"), http.StatusTooManyRequests, &rest.Problem{})
+
+	// a verified client is limited by its certificate, whatever key it sends
+	decodeJSON(t, createAs("svc", "carol"), http.StatusCreated, &struct{}{})
+	decodeJSON(t, createAs("svc", "made-up-3"), http.StatusTooManyRequests, &rest.Problem{})
+	decodeJSON(t, create("carol"), http.StatusCreated, &struct{}{})
+}
+
+// GraphQL requests are charged by operation: a query sent by POST is still a
+// read. A sync is a write even when it only pulls, as over gRPC.
+func TestRateLimitGraphQLAndSync(t *testing.T) {
+	db := setupTestDB(t)
+	repo := todo.NewGormRepository(db)
+	svc := todo.NewService(repo, todo.Limits{}, nil)
+	comments := todo.NewCommentService(todo.NewGormCommentRepository(db), repo, todo.Limits{})
+	mux := http.NewServeMux()
+	if err := rest.RegisterHandlers(mux, grpcapi.NewHandler(svc, comments, nil), nil); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	mux.Handle(graphql.Path, graphql.NewHandler(svc, comments, todo.NewBroker(), graphql.Limits{}))
+	limiter := ratelimit.New(ratelimit.NewMemoryStore(), ratelimit.Config{
+		Read:  ratelimit.Limit{Rate: 0.5, Burst: 2},
+		Write: ratelimit.Limit{Rate: 0.5, Burst: 1},
+	})
+	srv := httptest.NewServer(limiter.HTTPMiddleware(rest.WriteError, mux))
+	t.Cleanup(srv.Close)
+
+	post := func(path, body string) *http.Response {
+		resp, err := http.Post(srv.URL+path, "application/json", bytes.NewBufferString(body))
+		if err != nil {
+			t.Fatalf("post: %v", err)
+		}
+		return resp
+	}
+	gql := func(query string) *http.Response {
+		body, _ := json.Marshal(map[string]string{"query": query})
+		return post(graphql.Path, string(body))
+	}
+	const mutation = `mutation { createTask(input: {title: "flood"}) { id } }`
+	const query = `{ tasks { totalCount } }`
+
+	decodeJSON(t, gql(mutation), http.StatusOK, &gqlResponse{})
+	resp := gql(mutation)
+	if resp.Header.Get("Retry-After") != "2" {
+		t.Fatalf("expected Retry-After 2, got %q", resp.Header.Get("Retry-After"))
+	}
+	var out gqlResponse
+	decodeJSON(t, resp, http.StatusTooManyRequests, &out)
+	if len(out.Errors) != 1 || out.Errors[0].Extensions["code"] != "RATE_LIMITED" {
+		t.Fatalf("unexpected errors %+v", out.Errors)
+	}
+
+	// the write budget is spent, but a query is a read whatever the method
+	out = gqlResponse{}
+	decodeJSON(t, gql(query), http.StatusOK, &out)
+	if len(out.Errors) > 0 {
+		t.Fatalf("unexpected errors %+v", out.Errors)
+	}
+
+	// a sync may push changes, so one that only pulls is a write too
+	decodeJSON(t, post("/v1/sync", `{}`), http.StatusTooManyRequests, &rest.Problem{})
+
+	// a request that doesn't parse costs a read
+	decodeJSON(t, gql(`{`), http.StatusBadRequest, &gqlResponse{})
+	decodeJSON(t, gql(query), http.StatusTooManyRequests, &gqlResponse{})
+}
+
+func TestRateLimitGRPC(t *testing.T) {
+	db := setupTestDB(t)
+	repo := todo.NewGormRepository(db)
+	limiter := ratelimit.New(ratelimit.NewMemoryStore(), ratelimit.Config{
+		Read:    ratelimit.Limit{Rate: 1, Burst: 1},
+		Write:   ratelimit.Limit{Rate: 1, Burst: 1},
+		APIKeys: []string{"script"},
+	})
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer(grpc.UnaryInterceptor(limiter.UnaryServerInterceptor()))
+	pb.RegisterTodoServiceServer(srv, grpcapi.NewHandler(todo.NewService(repo, todo.Limits{}, nil),
+		todo.NewCommentService(todo.NewGormCommentRepository(db), repo, todo.Limits{}), nil))
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	client := pb.NewTodoServiceClient(conn)
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "x-api-key", "script")
+
+	if _, err := client.CreateTask(ctx, &pb.CreateTaskRequest{Title: "one"}); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	_, err = client.CreateTask(ctx, &pb.CreateTaskRequest{Title: "two"})
+	st := status.Convert(err)
+	if st.Code() != codes.ResourceExhausted {
+		t.Fatalf("expected ResourceExhausted, got %v", err)
+	}
+	var retry *errdetails.RetryInfo
+	var reason string
+	for _, d := range st.Details() {
+		switch d := d.(type) {
+		case *errdetails.RetryInfo:
+			retry = d
+		case *errdetails.ErrorInfo:
+			reason = d.GetReason()
+		}
+	}
+	if retry == nil || retry.GetRetryDelay().AsDuration() <= 0 || reason != "RATE_LIMITED" {
+		t.Fatalf("unexpected details %v", st.Details())
+	}
+	if _, err := client.ListTasks(ctx, &pb.ListTasksRequest{}); err != nil {
+		t.Fatalf("reads should have their own budget: %v", err)
+	}
+}
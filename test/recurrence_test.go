@@ -0,0 +1,207 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fuzail/08-todosvc/internal/todo"
+)
+
+func date(y int, m time.Month, d int) time.Time {
+	return time.Date(y, m, d, 9, 0, 0, 0, time.UTC)
+}
+
+func TestRuleNext(t *testing.T) {
+	cases := []struct {
+		rule string
+		due  time.Time
+		n    int
+		want time.Time // zero means the series is over
+	}{
+		{"FREQ=DAILY", date(2026, 1, 1), 1, date(2026, 1, 2)},
+		{"FREQ=DAILY;INTERVAL=3", date(2026, 1, 1), 1, date(2026, 1, 4)},
+		{"FREQ=DAILY;BYDAY=MO,TU,WE,TH,FR", date(2026, 1, 2), 1, date(2026, 1, 5)}, // Fri -> Mon
+		{"FREQ=WEEKLY", date(2026, 1, 1), 1, date(2026, 1, 8)},
+		{"FREQ=WEEKLY;BYDAY=MO,TH", date(2026, 1, 5), 1, date(2026, 1, 8)},             // Mon -> Thu
+		{"FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,TH", date(2026, 1, 8), 2, date(2026, 1, 19)}, // skips a week
+		{"FREQ=MONTHLY", date(2026, 1, 15), 1, date(2026, 2, 15)},
+		{"FREQ=MONTHLY", date(2026, 1, 31), 1, date(2026, 3, 31)}, // no Feb 31st
+		{"FREQ=DAILY;COUNT=3", date(2026, 1, 2), 2, date(2026, 1, 3)},
+		{"FREQ=DAILY;COUNT=3", date(2026, 1, 3), 3, time.Time{}},
+		{"FREQ=DAILY;UNTIL=20260103", date(2026, 1, 3), 3, time.Time{}},
+		{"FREQ=DAILY;UNTIL=20260103", date(2026, 1, 2), 2, date(2026, 1, 3)},
+	}
+	for _, c := range cases {
+		r, err := todo.ParseRule(c.rule)
+		if err != nil {
+			t.Fatalf("%s: parse: %v", c.rule, err)
+		}
+		got, ok := r.Next(c.due, c.n)
+		if c.want.IsZero() {
+			if ok {
+				t.Errorf("%s from %s: expected end of series, got %s", c.rule, c.due, got)
+			}
+			continue
+		}
+		if !ok || !got.Equal(c.want) {
+			t.Errorf("%s from %s: want %s, got %s (ok=%v)", c.rule, c.due, c.want, got, ok)
+		}
+	}
+
+	for _, bad := range []string{"", "FREQ=YEARLY", "FREQ=DAILY;COUNT=0", "FREQ=MONTHLY;BYDAY=MO", "FREQ=DAILY;COUNT=2;UNTIL=20260101"} {
+		if _, err := todo.ParseRule(bad); !errors.Is(err, todo.ErrInvalidRecurrence) {
+			t.Errorf("%q: expected ErrInvalidRecurrence, got %v", bad, err)
+		}
+	}
+}
+
+func TestRecurringTaskCompletion(t *testing.T) {
+	db := setupTestDB(t)
+	svc := todo.NewService(todo.NewGormRepository(db), todo.Limits{}, nil)
+	ctx := context.Background()
+
+	if _, err := svc.CreateTask(ctx, "", "no due", "", nil, "FREQ=DAILY"); !errors.Is(err, todo.ErrInvalidRecurrence) {
+		t.Fatalf("expected ErrInvalidRecurrence without due date, got %v", err)
+	}
+
+	due := date(2026, 1, 5)
+	first, err := svc.CreateTask(ctx, "", "water plants", "", &due, "FREQ=WEEKLY;COUNT=2")
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if first.SeriesID != first.ID || first.Occurrence != 1 {
+		t.Fatalf("expected new series, got series=%s occurrence=%d", first.SeriesID, first.Occurrence)
+	}
+
+	if _, err := svc.MarkComplete(ctx, first.ID, true, false); err != nil {
+		t.Fatalf("complete: %v", err)
+	}
+	tasks, _, err := svc.ListTasks(ctx, 1, 10, todo.FilterAll)
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	var second *todo.Task
+	for i := range tasks {
+		if tasks[i].Occurrence == 2 {
+			second = &tasks[i]
+		}
+	}
+	if second == nil || second.DueAt == nil || !second.DueAt.Equal(date(2026, 1, 12)) {
+		t.Fatalf("expected second occurrence due 2026-01-12, got %+v", second)
+	}
+
+	// COUNT=2 reached: completing the last occurrence doesn't create another
+	if _, err := svc.MarkComplete(ctx, second.ID, true, false); err != nil {
+		t.Fatalf("complete: %v", err)
+	}
+	if _, total, _ := svc.ListTasks(ctx, 1, 10, todo.FilterAll); total != 2 {
+		t.Fatalf("expected 2 tasks, got %d", total)
+	}
+	if _, err := svc.SetRecurrence(ctx, first.ID, "FREQ=DAILY", nil); !errors.Is(err, todo.ErrSeriesEnded) {
+		t.Fatalf("expected ErrSeriesEnded, got %v", err)
+	}
+}
+
+func TestStopRecurrence(t *testing.T) {
+	db := setupTestDB(t)
+	svc := todo.NewService(todo.NewGormRepository(db), todo.Limits{}, nil)
+	ctx := context.Background()
+
+	due := date(2026, 1, 5)
+	task, _ := svc.CreateTask(ctx, "", "standup notes", "", &due, "")
+	task, err := svc.SetRecurrence(ctx, task.ID, "FREQ=DAILY", nil)
+	if err != nil {
+		t.Fatalf("set recurrence: %v", err)
+	}
+	if task.SeriesID != task.ID {
+		t.Fatalf("expected series to start at %s, got %s", task.ID, task.SeriesID)
+	}
+	if _, err := svc.StopRecurrence(ctx, task.ID); err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+	if _, err := svc.MarkComplete(ctx, task.ID, true, false); err != nil {
+		t.Fatalf("complete: %v", err)
+	}
+	if _, total, _ := svc.ListTasks(ctx, 1, 10, todo.FilterAll); total != 1 {
+		t.Fatalf("expected no new occurrence after stop, got %d tasks", total)
+	}
+}
+
+func TestConcurrentCompletion(t *testing.T) {
+	db := setupTestDB(t)
+	sqlDB, _ := db.DB()
+	// SQLite writes one at a time anyway; this keeps the in-memory database
+	// from reporting its tables as locked
+	sqlDB.SetMaxOpenConns(1)
+	svc := todo.NewService(todo.NewGormRepository(db), todo.Limits{}, nil)
+	ctx := context.Background()
+
+	due := date(2026, 1, 5)
+	task, err := svc.CreateTask(ctx, "", "backup", "", &due, "FREQ=DAILY")
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if got, err := svc.MarkComplete(ctx, task.ID, true, false); err != nil || !got.Completed {
+				t.Errorf("complete: %+v %v", got, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if _, total, _ := svc.ListTasks(ctx, 1, 10, todo.FilterAll); total != 2 {
+		t.Fatalf("expected one next occurrence, got %d tasks", total)
+	}
+
+	// a completion based on a stale read writes nothing
+	repo := todo.NewGormRepository(db)
+	stale := *task
+	if done, err := repo.Complete(ctx, &stale, &todo.Task{Title: "extra", SeriesID: task.SeriesID, Occurrence: 2}, 0); err != nil || done {
+		t.Fatalf("expected the stale completion to be refused, got %v %v", done, err)
+	}
+	if _, total, _ := svc.ListTasks(ctx, 1, 10, todo.FilterAll); total != 2 {
+		t.Fatalf("expected no extra occurrence, got %d tasks", total)
+	}
+}
+
+func TestSyncRecurringTask(t *testing.T) {
+	db := setupTestDB(t)
+	svc := todo.NewService(todo.NewGormRepository(db), todo.Limits{}, nil)
+	ctx := context.Background()
+
+	due := date(2026, 1, 5)
+	id := "0190c2a4-8e5b-7c3a-9f1e-2b4d6a8c0e21"
+	pushed := todo.Task{ID: id, Title: "laundry", DueAt: &due, Recurrence: "FREQ=WEEKLY", UpdatedAt: time.Now()}
+	if _, err := svc.SyncTasks(ctx, "", []todo.TaskChange{{Task: pushed}}, 0); err != nil {
+		t.Fatalf("sync create: %v", err)
+	}
+	created, err := svc.GetTask(ctx, id)
+	if err != nil || created.DueAt == nil || !created.DueAt.Equal(due) || created.Recurrence != "FREQ=WEEKLY" || created.SeriesID != id {
+		t.Fatalf("expected the due date and rule to be kept, got %+v %v", created, err)
+	}
+
+	// completing through sync creates the next occurrence
+	pushed.Completed = true
+	pushed.UpdatedAt = time.Now().Add(time.Minute)
+	if _, err := svc.SyncTasks(ctx, "", []todo.TaskChange{{Task: pushed}}, 0); err != nil {
+		t.Fatalf("sync complete: %v", err)
+	}
+	head, err := svc.SetRecurrence(ctx, id, "FREQ=WEEKLY", nil)
+	if err != nil || head.Occurrence != 2 || !head.DueAt.Equal(date(2026, 1, 12)) {
+		t.Fatalf("expected the second occurrence, got %+v %v", head, err)
+	}
+
+	// rules are checked before anything is applied
+	bad := todo.Task{ID: "0190c2a4-8e5b-7c3a-9f1e-2b4d6a8c0e22", Title: "no due", Recurrence: "FREQ=DAILY"}
+	_, err = svc.SyncTasks(ctx, "", []todo.TaskChange{{Task: bad}}, 0)
+	var de *todo.Error
+	if !errors.As(err, &de) || len(de.Violations) != 1 || de.Violations[0].Field != "changes[0].task.recurrence" {
+		t.Fatalf("expected a recurrence violation, got %v", err)
+	}
+}
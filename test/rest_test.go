@@ -0,0 +1,182 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/fuzail/08-todosvc/internal/grpc"
+	"github.com/fuzail/08-todosvc/internal/rest"
+	"github.com/fuzail/08-todosvc/internal/todo"
+	"github.com/fuzail/08-todosvc/pkg/storage"
+)
+
+// newRESTServer serves the REST gateway over the gRPC handler for svc.
+func newRESTServer(t *testing.T, svc todo.Service, comments todo.CommentService, atts todo.AttachmentService) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	if err := rest.RegisterHandlers(mux, grpc.NewHandler(svc, comments, atts), atts); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestRESTGateway(t *testing.T) {
+	db := setupTestDB(t)
+	repo := todo.NewGormRepository(db)
+	blobs, _ := storage.NewFSStore(t.TempDir())
+	srv := newRESTServer(t, todo.NewService(repo, todo.Limits{}, nil),
+		todo.NewCommentService(todo.NewGormCommentRepository(db), repo, todo.Limits{}),
+		todo.NewAttachmentService(todo.NewGormAttachmentRepository(db), repo, blobs, 0, nil))
+
+	post := func(path, body string) *http.Response {
+		resp, err := http.Post(srv.URL+path, "application/json", bytes.NewBufferString(body))
+		if err != nil {
+			t.Fatalf("post %s: %v", path, err)
+		}
+		return resp
+	}
+
+	// same validation as gRPC: InvalidArgument becomes a 400 problem
+	resp := post("/v1/tasks", `{"description":"no title"}`)
+	if ct := resp.Header.Get("Content-Type"); ct != "application/problem+json" {
+		t.Fatalf("unexpected error content type %q", ct)
+	}
+	var problem rest.Problem
+	decodeJSON(t, resp, http.StatusBadRequest, &problem)
+	if problem.Code != "invalid_argument" || problem.Type != "urn:todosvc:problem:invalid_argument" ||
+		problem.Status != http.StatusBadRequest || problem.Detail != "title is required" || problem.Instance != "/v1/tasks" ||
+		len(problem.Errors) != 1 || problem.Errors[0].Field != "title" {
+		t.Fatalf("unexpected problem %+v", problem)
+	}
+
+	var created struct {
+		Task map[string]interface{}
+	}
+	decodeJSON(t, post("/v1/tasks", `{"title":"gateway","due_at":"2026-01-05T09:00:00Z"}`), http.StatusCreated, &created)
+	id, _ := created.Task["id"].(string)
+	if id == "" || created.Task["due_at"] != "2026-01-05T09:00:00Z" {
+		t.Fatalf("unexpected task %v", created.Task)
+	}
+	if _, ok := created.Task["deleted_at"]; ok {
+		t.Fatalf("task JSON exposes deleted_at: %v", created.Task)
+	}
+
+	req, _ := http.NewRequest(http.MethodPatch, srv.URL+"/v1/tasks/"+id, bytes.NewBufferString(`{"completed":true}`))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("patch: %v", err)
+	}
+	var updated struct {
+		Task struct{ Completed bool }
+	}
+	decodeJSON(t, resp, http.StatusOK, &updated)
+	if !updated.Task.Completed {
+		t.Fatalf("expected completed task")
+	}
+
+	resp, err = http.Get(srv.URL + "/v1/tasks?filter=READY&page_size=5")
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	var list struct {
+		Tasks    []map[string]interface{}
+		PageSize int `json:"page_size"`
+	}
+	decodeJSON(t, resp, http.StatusOK, &list)
+	if list.PageSize != 5 || len(list.Tasks) != 0 {
+		t.Fatalf("expected no ready tasks with page_size 5, got %+v", list)
+	}
+
+	resp, err = http.Get(srv.URL + "/v1/tasks/" + "0198f0e4-0000-7000-8000-000000000000")
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	problem = rest.Problem{}
+	decodeJSON(t, resp, http.StatusNotFound, &problem)
+	if problem.Code != "task_not_found" || len(problem.Errors) != 0 {
+		t.Fatalf("unexpected problem %+v", problem)
+	}
+
+	req, _ = http.NewRequest(http.MethodPut, srv.URL+"/v1/tasks", nil)
+	if resp, err = http.DefaultClient.Do(req); err != nil {
+		t.Fatalf("put: %v", err)
+	}
+	decodeJSON(t, resp, http.StatusMethodNotAllowed, &problem)
+	if problem.Code != "method_not_allowed" {
+		t.Fatalf("unexpected problem %+v", problem)
+	}
+}
+
+// TestRESTTaskContract pins the public JSON shape of a task, so a change to
+// the proto that would break REST clients shows up here.
+func TestRESTTaskContract(t *testing.T) {
+	db := setupTestDB(t)
+	repo := todo.NewGormRepository(db)
+	blobs, _ := storage.NewFSStore(t.TempDir())
+	srv := newRESTServer(t, todo.NewService(repo, todo.Limits{}, nil),
+		todo.NewCommentService(todo.NewGormCommentRepository(db), repo, todo.Limits{}),
+		todo.NewAttachmentService(todo.NewGormAttachmentRepository(db), repo, blobs, 0, nil))
+
+	resp, err := http.Post(srv.URL+"/v1/tasks", "application/json", bytes.NewBufferString(`{"title":"contract"}`))
+	if err != nil {
+		t.Fatalf("post: %v", err)
+	}
+	var created map[string]map[string]json.RawMessage
+	decodeJSON(t, resp, http.StatusCreated, &created)
+	var got []string
+	for k := range created["task"] {
+		got = append(got, k)
+	}
+	sort.Strings(got)
+	want := []string{"completed", "created_at", "description", "due_at", "id", "occurrence",
+		"recurrence", "series_id", "tenant", "title", "updated_at"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("task fields changed:\n got %v\nwant %v", got, want)
+	}
+}
+
+func TestOpenAPIDocument(t *testing.T) {
+	spec, err := rest.OpenAPI()
+	if err != nil {
+		t.Fatalf("openapi: %v", err)
+	}
+	var doc struct {
+		OpenAPI    string
+		Paths      map[string]map[string]json.RawMessage
+		Components struct {
+			Schemas map[string]json.RawMessage
+		}
+	}
+	if err := json.Unmarshal(spec, &doc); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if doc.OpenAPI != "3.0.3" {
+		t.Fatalf("unexpected version %q", doc.OpenAPI)
+	}
+	for path, methods := range map[string][]string{
+		"/v1/tasks":                            {"get", "post"},
+		"/v1/tasks/{id}":                       {"get", "put", "patch", "delete"},
+		"/v1/tasks/{task_id}/comments/{id}":    {"patch", "delete"},
+		"/v1/tasks/{task_id}/attachments":      {"get", "post"},
+		"/v1/tasks/{task_id}/attachments/{id}": {"get", "delete"},
+		"/v1/sync":                             {"post"},
+	} {
+		for _, m := range methods {
+			if _, ok := doc.Paths[path][m]; !ok {
+				t.Errorf("missing %s %s", m, path)
+			}
+		}
+	}
+	for _, s := range []string{"Task", "SyncTasksRequest", "TaskChange", "Problem"} {
+		if _, ok := doc.Components.Schemas[s]; !ok {
+			t.Errorf("missing schema %s", s)
+		}
+	}
+}
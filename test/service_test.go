@@ -2,31 +2,101 @@ package test
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/fuzail/08-todosvc/internal/todo"
+	"github.com/google/uuid"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 func setupTestDB(t *testing.T) *gorm.DB {
-	db, err := gorm.Open(sqlite.Open("file::memory:?cache=shared"), &gorm.Config{})
+	// one named in-memory database per test so tests don't see each other's rows
+	dsn := "file:" + t.Name() + "?mode=memory&cache=shared"
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{TranslateError: true})
 	if err != nil {
 		t.Fatalf("open sqlite: %v", err)
 	}
-	if err := db.AutoMigrate(&todo.Task{}); err != nil {
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			_ = sqlDB.Close()
+		}
+	})
+	if err := db.AutoMigrate(&todo.Task{}, &todo.ChangeCounter{}, &todo.Dependency{}, &todo.Comment{}, &todo.Attachment{}); err != nil {
 		t.Fatalf("migrate: %v", err)
 	}
 	return db
 }
 
+// idComparison matches SQL that ends in a comparison of an id column, up to
+// its placeholder.
+var idComparison = regexp.MustCompile(`(?i)(^|[^\w])id\s*(=|<>|>=|<=|>|<|IN)\s*\(?\s*$`)
+
+// strictUUIDs makes queries on db fail when they compare an id column with
+// a value that isn't a uuid, as Postgres does for uuid columns and SQLite
+// doesn't.
+func strictUUIDs(db *gorm.DB) {
+	_ = db.Callback().Query().Before("gorm:query").Register("test:strict_uuids", func(tx *gorm.DB) {
+		c, ok := tx.Statement.Clauses["WHERE"]
+		if !ok {
+			return
+		}
+		where, _ := c.Expression.(clause.Where)
+		for _, e := range where.Exprs {
+			expr, ok := e.(clause.Expr)
+			if !ok {
+				continue
+			}
+			parts := strings.Split(expr.SQL, "?")
+			for i, v := range expr.Vars {
+				if i >= len(parts) || !idComparison.MatchString(parts[i]) {
+					continue
+				}
+				vals, _ := v.([]string)
+				if s, ok := v.(string); ok {
+					vals = []string{s}
+				}
+				for _, s := range vals {
+					if _, err := uuid.Parse(s); err != nil {
+						_ = tx.AddError(fmt.Errorf("invalid input syntax for type uuid: %q", s))
+						return
+					}
+				}
+			}
+		}
+	})
+}
+
+// decodeJSON checks the response status and decodes its JSON body into v.
+func decodeJSON(t *testing.T, resp *http.Response, wantStatus int, v interface{}) {
+	t.Helper()
+	defer resp.Body.Close()
+	if resp.StatusCode != wantStatus {
+		body, _ := io.ReadAll(resp.Body)
+		t.Fatalf("expected status %d, got %d: %s", wantStatus, resp.StatusCode, body)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+}
+
 func TestCreateAndGetTask(t *testing.T) {
 	db := setupTestDB(t)
 	repo := todo.NewGormRepository(db)
-	svc := todo.NewService(repo)
+	svc := todo.NewService(repo, todo.Limits{}, nil)
 
 	ctx := context.Background()
-	created, err := svc.CreateTask(ctx, "test title", "desc")
+	created, err := svc.CreateTask(ctx, "", "test title", "desc", nil, "")
 	if err != nil {
 		t.Fatalf("create: %v", err)
 	}
@@ -42,3 +112,100 @@ func TestCreateAndGetTask(t *testing.T) {
 		t.Fatalf("id mismatch: %s vs %s", got.ID, created.ID)
 	}
 }
+
+func TestCreateTaskWithClientID(t *testing.T) {
+	db := setupTestDB(t)
+	svc := todo.NewService(todo.NewGormRepository(db), todo.Limits{}, nil)
+	ctx := context.Background()
+
+	id := "0190c2a4-8e5b-7c3a-9f1e-2b4d6a8c0e11"
+	created, err := svc.CreateTask(ctx, strings.ToUpper(id), "offline", "", nil, "")
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if created.ID != id {
+		t.Fatalf("expected canonical id %s, got %s", id, created.ID)
+	}
+
+	if _, err := svc.CreateTask(ctx, id, "dup", "", nil, ""); !errors.Is(err, todo.ErrAlreadyExists) {
+		t.Fatalf("expected ErrAlreadyExists, got %v", err)
+	}
+	if _, err := svc.CreateTask(ctx, "not-a-uuid", "bad", "", nil, ""); !errors.Is(err, todo.ErrInvalidID) {
+		t.Fatalf("expected ErrInvalidID, got %v", err)
+	}
+}
+
+func TestSyncTasks(t *testing.T) {
+	db := setupTestDB(t)
+	svc := todo.NewService(todo.NewGormRepository(db), todo.Limits{}, nil)
+	ctx := context.Background()
+
+	a, _ := svc.CreateTask(ctx, "", "a", "", nil, "")
+	b, _ := svc.CreateTask(ctx, "", "b", "", nil, "")
+	if err := svc.DeleteTask(ctx, b.ID); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+
+	// first pull, one change per page
+	first, err := svc.SyncTasks(ctx, "", nil, 1)
+	if err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	if len(first.Changes) != 1 || !first.HasMore {
+		t.Fatalf("expected 1 change and more, got %d more=%v", len(first.Changes), first.HasMore)
+	}
+	second, err := svc.SyncTasks(ctx, first.Watermark, nil, 1)
+	if err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	if len(second.Changes) != 1 || second.HasMore {
+		t.Fatalf("expected last change, got %d more=%v", len(second.Changes), second.HasMore)
+	}
+	if second.Changes[0].Task.ID != b.ID || !second.Changes[0].Deleted {
+		t.Fatalf("expected tombstone for %s, got %+v", b.ID, second.Changes[0])
+	}
+
+	// a stale edit loses, a newer one wins
+	stale := todo.Task{ID: a.ID, Title: "stale", UpdatedAt: a.UpdatedAt.Add(-time.Minute)}
+	fresh := todo.Task{ID: b.ID, Title: "revived", UpdatedAt: time.Now().Add(time.Minute)}
+	res, err := svc.SyncTasks(ctx, second.Watermark, []todo.TaskChange{{Task: stale}, {Task: fresh}}, 0)
+	if err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	if res.Results[0].Status != todo.ChangeConflict || res.Results[1].Status != todo.ChangeApplied {
+		t.Fatalf("unexpected results: %+v", res.Results)
+	}
+	if len(res.Changes) != 1 || res.Changes[0].Task.Title != "revived" || res.Changes[0].Deleted {
+		t.Fatalf("expected revived task in changes, got %+v", res.Changes)
+	}
+	if got, _ := svc.GetTask(ctx, a.ID); got.Title != "a" {
+		t.Fatalf("stale change was applied: %s", got.Title)
+	}
+}
+
+func TestSyncFollowsWriteOrder(t *testing.T) {
+	db := setupTestDB(t)
+	svc := todo.NewService(todo.NewGormRepository(db), todo.Limits{}, nil)
+	ctx := context.Background()
+
+	a, _ := svc.CreateTask(ctx, "", "a", "", nil, "")
+	first, err := svc.SyncTasks(ctx, "", nil, 0)
+	if err != nil || len(first.Changes) != 1 {
+		t.Fatalf("sync: %v %+v", err, first)
+	}
+
+	// a write stamped by a slower clock, e.g. of another instance, is still
+	// pulled after the watermark
+	b, _ := svc.CreateTask(ctx, "", "b", "", nil, "")
+	if err := db.Model(&todo.Task{}).Where("id = ?", b.ID).UpdateColumn("updated_at", a.UpdatedAt.Add(-time.Hour)).Error; err != nil {
+		t.Fatal(err)
+	}
+	next, err := svc.SyncTasks(ctx, first.Watermark, nil, 0)
+	if err != nil || len(next.Changes) != 1 || next.Changes[0].Task.ID != b.ID {
+		t.Fatalf("expected the late write, got %+v %v", next, err)
+	}
+
+	if _, err := svc.SyncTasks(ctx, base64.RawURLEncoding.EncodeToString([]byte("x|y")), nil, 0); !errors.Is(err, todo.ErrInvalidWatermark) {
+		t.Fatalf("expected ErrInvalidWatermark, got %v", err)
+	}
+}
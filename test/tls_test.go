@@ -0,0 +1,304 @@
+package test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fuzail/08-todosvc/internal/auth"
+	grpcapi "github.com/fuzail/08-todosvc/internal/grpc"
+	"github.com/fuzail/08-todosvc/internal/reqctx"
+	"github.com/fuzail/08-todosvc/internal/rest"
+	"github.com/fuzail/08-todosvc/internal/tlsconfig"
+	"github.com/fuzail/08-todosvc/internal/todo"
+	pb "github.com/fuzail/08-todosvc/proto/todo/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+)
+
+// testCA issues certificates for the TLS tests.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pool *x509.CertPool
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("ca: %v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return &testCA{cert: cert, key: key, pool: pool,
+		pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue returns a PEM certificate and key for cn; server certificates are
+// valid for 127.0.0.1, client ones carry a SPIFFE-style URI SAN.
+func (ca *testCA) issue(t *testing.T, cn string, server bool) (certPEM, keyPEM []byte) {
+	t.Helper()
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	if server {
+		tmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+		tmpl.IPAddresses = []net.IP{net.ParseIP("127.0.0.1")}
+	} else {
+		tmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+		tmpl.URIs = []*url.URL{{Scheme: "spiffe", Host: "example.org", Path: "/" + cn}}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatalf("issue %s: %v", cn, err)
+	}
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func (ca *testCA) clientCert(t *testing.T, cn string) tls.Certificate {
+	t.Helper()
+	certPEM, keyPEM := ca.issue(t, cn, false)
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+// writeServerFiles writes a server key pair and the CA bundle into dir.
+func writeServerFiles(t *testing.T, ca *testCA, dir, cn string) tlsconfig.Config {
+	t.Helper()
+	certPEM, keyPEM := ca.issue(t, cn, true)
+	cfg := tlsconfig.Config{
+		CertFile:     filepath.Join(dir, "server.crt"),
+		KeyFile:      filepath.Join(dir, "server.key"),
+		ClientCAFile: filepath.Join(dir, "ca.crt"),
+	}
+	for path, b := range map[string][]byte{cfg.CertFile: certPEM, cfg.KeyFile: keyPEM, cfg.ClientCAFile: ca.pem} {
+		if err := os.WriteFile(path, b, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return cfg
+}
+
+func TestMutualTLSGRPC(t *testing.T) {
+	ca := newTestCA(t)
+	certs, err := tlsconfig.NewReloader(writeServerFiles(t, ca, t.TempDir(), "server"))
+	if err != nil {
+		t.Fatalf("reloader: %v", err)
+	}
+	db := setupTestDB(t)
+	repo := todo.NewGormRepository(db)
+	handler := grpcapi.NewHandler(todo.NewService(repo, todo.Limits{}, nil),
+		todo.NewCommentService(todo.NewGormCommentRepository(db), repo, todo.Limits{}), nil)
+
+	policy := auth.NewPolicy([]string{"spiffe://example.org/web"}, nil)
+	var seen reqctx.Client
+	record := func(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, next grpc.UnaryHandler) (interface{}, error) {
+		seen, _ = reqctx.ClientFrom(ctx)
+		return next(ctx, req)
+	}
+	srv := grpc.NewServer(grpc.Creds(credentials.NewTLS(certs.ServerConfig("h2"))),
+		grpc.ChainUnaryInterceptor(auth.UnaryServerInterceptor(), record, policy.UnaryServerInterceptor()))
+	pb.RegisterTodoServiceServer(srv, handler)
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	dial := func(certs ...tls.Certificate) pb.TodoServiceClient {
+		conn, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(
+			credentials.NewTLS(&tls.Config{RootCAs: ca.pool, Certificates: certs})))
+		if err != nil {
+			t.Fatalf("dial: %v", err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		return pb.NewTodoServiceClient(conn)
+	}
+	ctx := context.Background()
+
+	if _, err := dial(ca.clientCert(t, "web")).CreateTask(ctx, &pb.CreateTaskRequest{Title: "over mtls"}); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if seen.String() != "spiffe://example.org/web" || seen.Names[len(seen.Names)-1] != "web" {
+		t.Fatalf("unexpected client identity %v", seen.Names)
+	}
+
+	// verified, but not on the allowlist
+	_, err = dial(ca.clientCert(t, "batch")).ListTasks(ctx, &pb.ListTasksRequest{})
+	if status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("expected PermissionDenied, got %v", err)
+	}
+
+	// no certificate fails the handshake
+	if _, err := dial().ListTasks(ctx, &pb.ListTasksRequest{}); status.Code(err) != codes.Unavailable {
+		t.Fatalf("expected handshake failure, got %v", err)
+	}
+
+	// a certificate from another CA fails too
+	if _, err := dial(newTestCA(t).clientCert(t, "web")).ListTasks(ctx, &pb.ListTasksRequest{}); err == nil {
+		t.Fatal("expected a client from an unknown CA to be rejected")
+	}
+}
+
+func TestMutualTLSRESTAndReload(t *testing.T) {
+	ca := newTestCA(t)
+	dir := t.TempDir()
+	cfg := writeServerFiles(t, ca, dir, "first")
+	cfg.ClientCertOptional = true
+	certs, err := tlsconfig.NewReloader(cfg)
+	if err != nil {
+		t.Fatalf("reloader: %v", err)
+	}
+	db := setupTestDB(t)
+	repo := todo.NewGormRepository(db)
+	mux := http.NewServeMux()
+	if err := rest.RegisterHandlers(mux, grpcapi.NewHandler(todo.NewService(repo, todo.Limits{}, nil),
+		todo.NewCommentService(todo.NewGormCommentRepository(db), repo, todo.Limits{}), nil), nil); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	policy := auth.NewPolicy([]string{"web"}, nil)
+	srv := httptest.NewUnstartedServer(auth.HTTPMiddleware(policy.HTTPMiddleware(rest.WriteError, mux)))
+	srv.TLS = certs.ServerConfig("h2", "http/1.1")
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+
+	var served string
+	client := func(certs ...tls.Certificate) *http.Client {
+		return &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+			RootCAs:      ca.pool,
+			Certificates: certs,
+			VerifyConnection: func(cs tls.ConnectionState) error {
+				served = cs.PeerCertificates[0].Subject.CommonName
+				return nil
+			},
+		}}}
+	}
+
+	resp, err := client(ca.clientCert(t, "web")).Get(srv.URL + "/v1/tasks")
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	decodeJSON(t, resp, http.StatusOK, &struct{}{})
+	if served != "first" {
+		t.Fatalf("served certificate %q", served)
+	}
+
+	// optional client auth: anonymous callers reach the probes but not the API
+	anonymous := client()
+	resp, err = anonymous.Get(srv.URL + "/healthz")
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("healthz: %v %v", resp, err)
+	}
+	resp.Body.Close()
+	resp, err = anonymous.Get(srv.URL + "/v1/tasks")
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	var problem rest.Problem
+	decodeJSON(t, resp, http.StatusForbidden, &problem)
+	if problem.Code != "permission_denied" {
+		t.Fatalf("unexpected problem %+v", problem)
+	}
+
+	// rotate the files; new connections get the new certificate
+	writeServerFiles(t, ca, dir, "second")
+	if err := certs.Reload(); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	resp, err = client(ca.clientCert(t, "web")).Get(srv.URL + "/v1/tasks")
+	if err != nil {
+		t.Fatalf("get after reload: %v", err)
+	}
+	resp.Body.Close()
+	if served != "second" {
+		t.Fatalf("served certificate %q after reload", served)
+	}
+
+	// a broken rotation keeps the old material
+	os.WriteFile(cfg.KeyFile, []byte("garbage"), 0o600)
+	if err := certs.Reload(); err == nil {
+		t.Fatal("expected reload of a bad key to fail")
+	}
+	resp, err = client(ca.clientCert(t, "web")).Get(srv.URL + "/v1/tasks")
+	if err != nil {
+		t.Fatalf("get after failed reload: %v", err)
+	}
+	resp.Body.Close()
+}
+
+func TestPolicyTenant(t *testing.T) {
+	policy := auth.NewPolicy(nil, nil)
+	policy.SetTenants(map[string][]string{"spiffe://example.org/web": {"acme", "globex"}})
+	web := reqctx.WithClient(context.Background(), reqctx.Client{Names: []string{"spiffe://example.org/web", "web"}})
+	other := reqctx.WithClient(context.Background(), reqctx.Client{Names: []string{"batch"}})
+
+	for _, tc := range []struct {
+		name      string
+		ctx       context.Context
+		requested string
+		want      string // "" for denied
+	}{
+		{"first tenant by default", web, "", "acme"},
+		{"another of its tenants", web, "globex", "globex"},
+		{"not its tenant", web, "initech", ""},
+		{"unmapped client", other, "", todo.DefaultTenant},
+		{"unmapped client asking", other, "acme", ""},
+		{"no certificate", context.Background(), "", todo.DefaultTenant},
+		{"no certificate asking", context.Background(), "acme", ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := policy.Tenant(tc.ctx, tc.requested)
+			if tc.want == "" {
+				if !errors.Is(err, todo.ErrPermissionDenied) {
+					t.Fatalf("expected permission denied, got %q %v", got, err)
+				}
+				return
+			}
+			if err != nil || got != tc.want {
+				t.Fatalf("got %q %v, want %q", got, err, tc.want)
+			}
+		})
+	}
+}
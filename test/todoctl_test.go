@@ -0,0 +1,341 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	grpcapi "github.com/fuzail/08-todosvc/internal/grpc"
+	"github.com/fuzail/08-todosvc/internal/todo"
+	"github.com/fuzail/08-todosvc/internal/todoctl"
+	"github.com/fuzail/08-todosvc/pkg/storage"
+	pb "github.com/fuzail/08-todosvc/proto/todo/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+	"gorm.io/gorm"
+)
+
+type ctlEnv struct {
+	db    *gorm.DB
+	svc   todo.Service
+	atts  todo.AttachmentService
+	blobs storage.BlobStore
+	maint todo.MaintenanceService
+}
+
+func newCtlEnv(t *testing.T) *ctlEnv {
+	t.Helper()
+	db := setupTestDB(t)
+	repo := todo.NewGormRepository(db)
+	blobs, err := storage.NewFSStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("blob store: %v", err)
+	}
+	return &ctlEnv{
+		db:    db,
+		svc:   todo.NewService(repo, todo.Limits{}, nil),
+		atts:  todo.NewAttachmentService(todo.NewGormAttachmentRepository(db), repo, blobs, 0, nil),
+		blobs: blobs,
+		maint: todo.NewMaintenanceService(todo.NewGormMaintenanceRepository(db), blobs),
+	}
+}
+
+// run runs one todoctl command line and returns its stdout.
+func runCtl(t *testing.T, b todoctl.Backend, in string, args ...string) (string, error) {
+	t.Helper()
+	var out, errOut bytes.Buffer
+	app := &todoctl.App{
+		Backend: b,
+		Format:  todoctl.FormatJSON,
+		In:      strings.NewReader(in),
+		Out:     &out,
+		Err:     &errOut,
+	}
+	if len(args) > 1 && args[0] == "-o" {
+		app.Format, args = args[1], args[2:]
+	}
+	err := app.Run(context.Background(), args)
+	return out.String(), err
+}
+
+func mustCtl(t *testing.T, b todoctl.Backend, args ...string) string {
+	t.Helper()
+	out, err := runCtl(t, b, "", args...)
+	if err != nil {
+		t.Fatalf("todoctl %s: %v", strings.Join(args, " "), err)
+	}
+	return out
+}
+
+// ctlRows decodes todoctl's JSON output, one object per line.
+func ctlRows[T any](t *testing.T, out string) []T {
+	t.Helper()
+	var rows []T
+	dec := json.NewDecoder(strings.NewReader(out))
+	for {
+		var r T
+		if err := dec.Decode(&r); errors.Is(err, io.EOF) {
+			return rows
+		} else if err != nil {
+			t.Fatalf("decode %q: %v", out, err)
+		}
+		rows = append(rows, r)
+	}
+}
+
+type ctlTask struct {
+	ID          string     `json:"id"`
+	Title       string     `json:"title"`
+	Description string     `json:"description"`
+	Completed   bool       `json:"completed"`
+	DueAt       *time.Time `json:"due_at"`
+}
+
+func TestTodoctlTasks(t *testing.T) {
+	env := newCtlEnv(t)
+	b := todoctl.NewLocalBackend(env.svc, env.maint)
+
+	created := ctlRows[ctlTask](t, mustCtl(t, b, "create", "-description", "by hand", "-due", "2030-01-02", "fix", "the", "build"))
+	if len(created) != 1 || created[0].Title != "fix the build" || created[0].DueAt == nil || !created[0].DueAt.Equal(time.Date(2030, 1, 2, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected create output %+v", created)
+	}
+	id := created[0].ID
+	mustCtl(t, b, "create", "second")
+
+	if got := ctlRows[ctlTask](t, mustCtl(t, b, "list", "-all")); len(got) != 2 {
+		t.Fatalf("list -all returned %d tasks", len(got))
+	}
+	// update keeps the field not given
+	updated := ctlRows[ctlTask](t, mustCtl(t, b, "update", "-title", "fix CI", id))
+	if updated[0].Title != "fix CI" || updated[0].Description != "by hand" {
+		t.Fatalf("unexpected update output %+v", updated[0])
+	}
+	if got := ctlRows[ctlTask](t, mustCtl(t, b, "complete", id)); !got[0].Completed {
+		t.Fatalf("task not completed: %+v", got[0])
+	}
+	mustCtl(t, b, "delete", id)
+	if _, err := runCtl(t, b, "", "get", id); !errors.Is(err, todo.ErrNotFound) {
+		t.Fatalf("expected not found after delete, got %v", err)
+	}
+
+	table := mustCtl(t, b, "-o", "table", "list")
+	if !strings.HasPrefix(table, "ID ") || !strings.Contains(table, "second") {
+		t.Fatalf("unexpected table:\n%s", table)
+	}
+	if _, err := runCtl(t, b, "", "frobnicate"); !errors.Is(err, todoctl.ErrUsage) {
+		t.Fatalf("expected a usage error, got %v", err)
+	}
+	if _, err := runCtl(t, b, "", "update", id); err == nil {
+		t.Fatal("update without fields succeeded")
+	}
+}
+
+func TestTodoctlExportImport(t *testing.T) {
+	src := newCtlEnv(t)
+	from := todoctl.NewLocalBackend(src.svc, src.maint)
+	mustCtl(t, from, "create", "-description", "with, comma\nand newline", "plain")
+	done := ctlRows[ctlTask](t, mustCtl(t, from, "create", "-due", "2031-05-06T07:08:09Z", "done"))[0]
+	mustCtl(t, from, "complete", done.ID)
+
+	for _, format := range []string{"json", "csv"} {
+		t.Run(format, func(t *testing.T) {
+			exported := mustCtl(t, from, "export", "-format", format)
+			dst := newCtlEnv(t)
+			to := todoctl.NewLocalBackend(dst.svc, dst.maint)
+
+			if _, err := runCtl(t, to, exported, "import", "-format", format, "-dry-run", "-"); err != nil {
+				t.Fatalf("dry run: %v", err)
+			}
+			if got := ctlRows[ctlTask](t, mustCtl(t, to, "list", "-all")); len(got) != 0 {
+				t.Fatalf("dry run created %d tasks", len(got))
+			}
+			if _, err := runCtl(t, to, exported, "import", "-format", format, "-"); err != nil {
+				t.Fatalf("import: %v", err)
+			}
+			got := ctlRows[ctlTask](t, mustCtl(t, to, "get", done.ID))[0]
+			if !got.Completed || got.DueAt == nil || !got.DueAt.Equal(*done.DueAt) {
+				t.Fatalf("imported task lost fields: %+v", got)
+			}
+			if all := ctlRows[ctlTask](t, mustCtl(t, to, "list", "-all")); len(all) != 2 {
+				t.Fatalf("imported %d tasks, want 2", len(all))
+			} else if round := mustCtl(t, to, "export", "-format", format); len(strings.Split(round, "\n")) != len(strings.Split(exported, "\n")) {
+				t.Fatalf("export after import differs:\n%s\n%s", exported, round)
+			}
+
+			// importing again reports the tasks as existing, not failed
+			out, err := runCtl(t, to, exported, "import", "-format", format, "-")
+			if err != nil {
+				t.Fatalf("re-import: %v", err)
+			}
+			for _, r := range ctlRows[struct{ Result string }](t, out) {
+				if r.Result != "exists" {
+					t.Fatalf("unexpected re-import row %+v", r)
+				}
+			}
+		})
+	}
+}
+
+func TestTodoctlImportRowErrors(t *testing.T) {
+	env := newCtlEnv(t)
+	b := todoctl.NewLocalBackend(env.svc, env.maint)
+	in := "title,completed,due_at\n" +
+		"good,false,\n" +
+		",false,\n" +
+		"bad flag,maybe,\n" +
+		"bad date,false,tomorrow\n" +
+		"also good,true,2030-01-01\n"
+	out, err := runCtl(t, b, in, "import", "-format", "csv", "-")
+	if err == nil {
+		t.Fatal("import with bad rows succeeded")
+	}
+	rows := ctlRows[struct {
+		Line   int
+		Result string
+		Error  string
+	}](t, out)
+	if len(rows) != 3 || rows[0].Line != 3 || rows[1].Line != 4 || rows[2].Line != 5 {
+		t.Fatalf("unexpected failures %+v", rows)
+	}
+	if got := ctlRows[ctlTask](t, mustCtl(t, b, "list", "-all")); len(got) != 2 {
+		t.Fatalf("good rows not imported: %+v", got)
+	}
+
+	if _, err := runCtl(t, b, "name,notes\n1,2\n", "import", "-format", "csv", "-"); err == nil || !strings.Contains(err.Error(), "title") {
+		t.Fatalf("expected a header error, got %v", err)
+	}
+	out, err = runCtl(t, b, "{\"title\":\"ok\"}\nnot json\n", "import", "-")
+	if err == nil || !strings.Contains(out, "invalid JSON") {
+		t.Fatalf("expected a JSON row error, got %v %q", err, out)
+	}
+}
+
+type ctlStats struct {
+	OpenTasks       int64 `json:"open_tasks"`
+	CompletedTasks  int64 `json:"completed_tasks"`
+	OverdueTasks    int64 `json:"overdue_tasks"`
+	DeletedTasks    int64 `json:"deleted_tasks"`
+	AttachmentBytes int64 `json:"attachment_bytes"`
+}
+
+type ctlPurge struct {
+	Tasks       int64 `json:"tasks"`
+	Comments    int64 `json:"comments"`
+	Attachments int64 `json:"attachments"`
+}
+
+// testPurge deletes a task with a comment and an attachment, ages the
+// deletion, and purges it through b.
+func testPurge(t *testing.T, env *ctlEnv, b todoctl.Backend) {
+	ctx := context.Background()
+	past := time.Now().Add(-time.Hour)
+	old, err := env.svc.CreateTask(ctx, "", "old", "", &past, "")
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if _, err := env.svc.CreateTask(ctx, "", "overdue", "", &past, ""); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	recent, _ := env.svc.CreateTask(ctx, "", "recent", "", nil, "")
+	comments := todo.NewCommentService(todo.NewGormCommentRepository(env.db), todo.NewGormRepository(env.db), todo.Limits{})
+	if _, err := comments.AddComment(ctx, old.ID, "me", "note"); err != nil {
+		t.Fatalf("comment: %v", err)
+	}
+	att, err := env.atts.Upload(ctx, old.ID, "a.txt", "text/plain", strings.NewReader("hello"))
+	if err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+	for _, id := range []string{old.ID, recent.ID} {
+		if err := env.svc.DeleteTask(ctx, id); err != nil {
+			t.Fatalf("delete: %v", err)
+		}
+	}
+	if err := env.db.Unscoped().Model(&todo.Task{}).Where("id = ?", old.ID).
+		Update("deleted_at", time.Now().AddDate(0, 0, -40)).Error; err != nil {
+		t.Fatalf("age deletion: %v", err)
+	}
+
+	st := ctlRows[ctlStats](t, mustCtl(t, b, "stats"))[0]
+	if st != (ctlStats{OpenTasks: 1, OverdueTasks: 1, DeletedTasks: 2, AttachmentBytes: 5}) {
+		t.Fatalf("unexpected stats %+v", st)
+	}
+
+	if _, err := runCtl(t, b, "", "purge"); err == nil {
+		t.Fatal("purge without -yes succeeded")
+	}
+	// the cutoff is capped at the start of the day, so a task deleted just
+	// now stays even with -older-than 0
+	got := ctlRows[ctlPurge](t, mustCtl(t, b, "purge", "-older-than", "0", "-yes"))[0]
+	if got != (ctlPurge{Tasks: 1, Comments: 1, Attachments: 1}) {
+		t.Fatalf("unexpected purge result %+v", got)
+	}
+	var n int64
+	env.db.Unscoped().Model(&todo.Task{}).Where("id = ?", recent.ID).Count(&n)
+	if n != 1 {
+		t.Fatal("purged a task deleted today")
+	}
+	env.db.Model(&todo.Comment{}).Where("task_id = ?", old.ID).Count(&n)
+	if n != 0 {
+		t.Fatal("comments of purged task left behind")
+	}
+	if _, err := env.blobs.Get(ctx, att.StorageKey, 0, -1); err == nil {
+		t.Fatal("attachment content left behind")
+	}
+	if st := ctlRows[ctlStats](t, mustCtl(t, b, "stats"))[0]; st.DeletedTasks != 1 || st.AttachmentBytes != 0 {
+		t.Fatalf("unexpected stats after purge %+v", st)
+	}
+}
+
+func TestTodoctlPurgeLocal(t *testing.T) {
+	env := newCtlEnv(t)
+	testPurge(t, env, todoctl.NewLocalBackend(env.svc, env.maint))
+}
+
+func TestTodoctlGRPC(t *testing.T) {
+	env := newCtlEnv(t)
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer()
+	pb.RegisterTodoServiceServer(srv, grpcapi.NewHandler(env.svc,
+		todo.NewCommentService(todo.NewGormCommentRepository(env.db), todo.NewGormRepository(env.db), todo.Limits{}), env.atts))
+	pb.RegisterAdminServiceServer(srv, grpcapi.NewAdminHandler(nil, env.maint))
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	b := todoctl.NewGRPCBackend(conn)
+	testPurge(t, env, b)
+
+	id := ctlRows[ctlTask](t, mustCtl(t, b, "create", "-description", "remote", "over grpc"))[0].ID
+	if got := ctlRows[ctlTask](t, mustCtl(t, b, "update", "-title", "renamed", id))[0]; got.Description != "remote" {
+		t.Fatalf("update dropped the description: %+v", got)
+	}
+	mustCtl(t, b, "delete", id)
+	_, err = runCtl(t, b, "", "get", id)
+	if err == nil || !strings.Contains(err.Error(), "(NotFound)") || strings.Contains(err.Error(), "rpc error") {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if _, err := runCtl(t, b, "", "purge", "-older-than", "1h"); err == nil {
+		t.Fatal("purge without -yes succeeded")
+	}
+
+	exported := `{"id":"0190c2a4-8e5b-7c3a-9f1e-2b4d6a8c0e12","title":"imported","completed":true}`
+	if _, err := runCtl(t, b, exported, "import", "-"); err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	out, err := runCtl(t, b, exported, "import", "-")
+	if err != nil || !strings.Contains(out, `"exists"`) {
+		t.Fatalf("re-import over gRPC: %v %q", err, out)
+	}
+}
@@ -0,0 +1,58 @@
+package test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/fuzail/08-todosvc/internal/todo"
+	"github.com/fuzail/08-todosvc/pkg/db"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracingSpans(t *testing.T) {
+	rec := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec))
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(tp)
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+
+	gormDB := setupTestDB(t)
+	if err := db.RegisterTracing(gormDB); err != nil {
+		t.Fatalf("register tracing: %v", err)
+	}
+	svc := todo.NewService(todo.NewGormRepository(gormDB), todo.Limits{}, nil)
+	if _, _, err := svc.ListTasks(context.Background(), 1, 10, todo.FilterAll); err != nil {
+		t.Fatalf("list: %v", err)
+	}
+
+	var parent sdktrace.ReadOnlySpan
+	var queries []sdktrace.ReadOnlySpan
+	for _, s := range rec.Ended() {
+		switch s.Name() {
+		case "todo.Service/ListTasks":
+			parent = s
+		case "gorm.query":
+			queries = append(queries, s)
+		}
+	}
+	if parent == nil || len(queries) != 2 {
+		t.Fatalf("expected a service span and 2 query spans, got %d spans", len(rec.Ended()))
+	}
+	for _, q := range queries {
+		if q.Parent().SpanID() != parent.SpanContext().SpanID() {
+			t.Errorf("query span %s is not a child of the service span", q.Name())
+		}
+	}
+	var sawCount bool
+	for _, attr := range queries[0].Attributes() {
+		if attr.Key == "db.statement" && strings.Contains(attr.Value.AsString(), "count(*)") {
+			sawCount = true
+		}
+	}
+	if !sawCount {
+		t.Errorf("expected the first query span to be the count")
+	}
+}
@@ -0,0 +1,372 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	grpcapi "github.com/fuzail/08-todosvc/internal/grpc"
+	"github.com/fuzail/08-todosvc/internal/rest"
+	"github.com/fuzail/08-todosvc/internal/taskio"
+	"github.com/fuzail/08-todosvc/internal/todo"
+	pb "github.com/fuzail/08-todosvc/proto/todo/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// importAll imports data and returns the results by line.
+func importAll(t *testing.T, svc todo.Service, data string, f taskio.Format, dryRun bool) (map[int]taskio.Result, taskio.Summary) {
+	t.Helper()
+	results := map[int]taskio.Result{}
+	sum, err := taskio.Import(context.Background(), svc, strings.NewReader(data), f, dryRun, func(r taskio.Result) error {
+		results[r.Line] = r
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	return results, sum
+}
+
+func TestExportImportRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	db := setupTestDB(t)
+	// exports page through the tasks by id, which is a uuid column on Postgres
+	strictUUIDs(db)
+	src := todo.NewService(todo.NewGormRepository(db), todo.Limits{}, nil)
+	due := time.Date(2030, 3, 4, 9, 30, 0, 0, time.UTC)
+	long := strings.Repeat("ünïcödé, with; punctuation\\ ", 8) + "\nand a second line"
+	var want []*todo.Task
+	for _, in := range []struct {
+		title, description, recurrence string
+		due                            *time.Time
+		completed                      bool
+	}{
+		{title: "plain"},
+		{title: "long text", description: long},
+		{title: "weekly", due: &due, recurrence: "FREQ=WEEKLY;BYDAY=MO"},
+		{title: "done", due: &due, completed: true},
+	} {
+		task, err := src.CreateTask(ctx, "", in.title, in.description, in.due, in.recurrence)
+		if err != nil {
+			t.Fatalf("create: %v", err)
+		}
+		if in.completed {
+			if task, err = src.MarkComplete(ctx, task.ID, true, false); err != nil {
+				t.Fatalf("complete: %v", err)
+			}
+		}
+		want = append(want, task)
+	}
+
+	for _, f := range []taskio.Format{taskio.NDJSON, taskio.CSV, taskio.ICalendar} {
+		t.Run(string(f), func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := taskio.Export(ctx, src, &buf, f); err != nil {
+				t.Fatalf("export: %v", err)
+			}
+			if f == taskio.ICalendar {
+				for _, l := range strings.Split(buf.String(), "\r\n") {
+					if len(l) > 75 {
+						t.Fatalf("unfolded line %q", l)
+					}
+				}
+			}
+			dst := todo.NewService(todo.NewGormRepository(setupTestDB(t)), todo.Limits{}, nil)
+			results, sum := importAll(t, dst, buf.String(), f, false)
+			if sum.Created != int64(len(want)) || sum.Failed != 0 {
+				t.Fatalf("unexpected summary %+v: %+v", sum, results)
+			}
+			for _, w := range want {
+				got, err := dst.GetTask(ctx, w.ID)
+				if err != nil {
+					t.Fatalf("%s not imported: %v", w.Title, err)
+				}
+				if got.Title != w.Title || got.Description != w.Description || got.Completed != w.Completed ||
+					got.Recurrence != w.Recurrence || (got.DueAt == nil) != (w.DueAt == nil) || (got.DueAt != nil && !got.DueAt.Equal(*w.DueAt)) {
+					t.Fatalf("imported %+v, want %+v", got, w)
+				}
+			}
+			// importing again finds every task
+			_, sum = importAll(t, dst, buf.String(), f, false)
+			if sum.Existing != int64(len(want)) {
+				t.Fatalf("re-import summary %+v", sum)
+			}
+		})
+	}
+}
+
+// a VTODO export from another tool
+const otherToolCalendar = "BEGIN:VCALENDAR\r\n" +
+	"VERSION:2.0\r\n" +
+	"PRODID:-//Example//Tasks//EN\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:event-1@example.com\r\n" +
+	"SUMMARY:not a task\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VTODO\r\n" +
+	"UID:todo-1@example.com\r\n" +
+	"SUMMARY:Buy milk\\, eggs\r\n" +
+	"DESCRIPTION:first line\\nsecond line that is long enough to be folded by t\r\n" +
+	" he exporting tool\r\n" +
+	"DUE;TZID=Europe/Berlin:20300102T100000\r\n" +
+	"BEGIN:VALARM\r\n" +
+	"ACTION:DISPLAY\r\n" +
+	"SUMMARY:alarm, not the title\r\n" +
+	"END:VALARM\r\n" +
+	"END:VTODO\r\n" +
+	"BEGIN:VTODO\r\n" +
+	"UID:todo-2@example.com\r\n" +
+	"SUMMARY:Pay rent\r\n" +
+	"DUE;VALUE=DATE:20300201\r\n" +
+	"RRULE:FREQ=MONTHLY\r\n" +
+	"STATUS:COMPLETED\r\n" +
+	"END:VTODO\r\n" +
+	"BEGIN:VTODO\r\n" +
+	"UID:todo-3@example.com\r\n" +
+	"SUMMARY:Bad due\r\n" +
+	"DUE:tomorrow\r\n" +
+	"END:VTODO\r\n" +
+	"BEGIN:VTODO\r\n" +
+	"UID:todo-4@example.com\r\n" +
+	"END:VTODO\r\n" +
+	"END:VCALENDAR\r\n"
+
+func TestImportICalendarFromOtherTool(t *testing.T) {
+	ctx := context.Background()
+	svc := todo.NewService(todo.NewGormRepository(setupTestDB(t)), todo.Limits{}, nil)
+
+	results, sum := importAll(t, svc, otherToolCalendar, taskio.ICalendar, false)
+	if sum.Created != 2 || sum.Failed != 2 {
+		t.Fatalf("unexpected summary %+v: %+v", sum, results)
+	}
+	if r := results[26]; r.Status != taskio.Failed || r.Reason() != taskio.ReasonInvalidRow || !strings.Contains(r.Err.Error(), "DUE") {
+		t.Fatalf("bad DUE row: %+v", r)
+	}
+	if r := results[31]; r.Status != taskio.Failed || r.Reason() != "INVALID_ARGUMENT" {
+		t.Fatalf("row without a summary: %+v", r)
+	}
+
+	milk, err := svc.GetTask(ctx, taskio.TaskID("todo-1@example.com"))
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	wantDue := time.Date(2030, 1, 2, 9, 0, 0, 0, time.UTC) // 10:00 in Berlin
+	if milk.Title != "Buy milk, eggs" || milk.Description != "first line\nsecond line that is long enough to be folded by the exporting tool" ||
+		milk.DueAt == nil || !milk.DueAt.Equal(wantDue) || milk.Completed {
+		t.Fatalf("unexpected task %+v", milk)
+	}
+	rent, err := svc.GetTask(ctx, results[19].ID)
+	if err != nil || !rent.Completed || rent.Recurrence != "" || !rent.DueAt.Equal(time.Date(2030, 2, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected completed task %+v %v", rent, err)
+	}
+
+	// UIDs map to the same ids every time
+	_, sum = importAll(t, svc, otherToolCalendar, taskio.ICalendar, true)
+	if sum.Existing != 2 || sum.Created != 0 || !sum.DryRun {
+		t.Fatalf("dry run summary %+v", sum)
+	}
+}
+
+func TestImportFatalErrors(t *testing.T) {
+	svc := todo.NewService(todo.NewGormRepository(setupTestDB(t)), todo.Limits{}, nil)
+	report := func(taskio.Result) error { return nil }
+	_, err := taskio.Import(context.Background(), svc, strings.NewReader("name,notes\nx,y\n"), taskio.CSV, false, report)
+	if !errors.Is(err, taskio.ErrCSVHeader) {
+		t.Fatalf("expected a header error, got %v", err)
+	}
+	long := `{"title":"` + strings.Repeat("x", 2<<20) + `"}` + "\n"
+	_, err = taskio.Import(context.Background(), svc, strings.NewReader(long), taskio.NDJSON, false, report)
+	if !errors.Is(err, taskio.ErrLineTooLong) {
+		t.Fatalf("expected a line length error, got %v", err)
+	}
+}
+
+type importLine struct {
+	Row *struct {
+		Line   string `json:"line"` // int64 is a JSON string
+		ID     string `json:"id"`
+		Status string `json:"status"`
+		Reason string `json:"reason"`
+	} `json:"row"`
+	Summary *struct {
+		Created string `json:"created"`
+		Failed  string `json:"failed"`
+		DryRun  bool   `json:"dry_run"`
+	} `json:"summary"`
+	Error *rest.Problem `json:"error"`
+}
+
+func TestImportExportREST(t *testing.T) {
+	db := setupTestDB(t)
+	repo := todo.NewGormRepository(db)
+	svc := todo.NewService(repo, todo.Limits{}, nil)
+	mux := http.NewServeMux()
+	if err := rest.RegisterHandlers(mux, grpcapi.NewHandler(svc, todo.NewCommentService(todo.NewGormCommentRepository(db), repo, todo.Limits{}), nil), nil); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	post := func(query, contentType, body string) *http.Response {
+		resp, err := http.Post(srv.URL+"/v1/tasks:import"+query, contentType, strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("import: %v", err)
+		}
+		return resp
+	}
+	lines := func(resp *http.Response) []importLine {
+		t.Helper()
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "application/x-ndjson" {
+			body, _ := io.ReadAll(resp.Body)
+			t.Fatalf("import: %d %s", resp.StatusCode, body)
+		}
+		var out []importLine
+		dec := json.NewDecoder(resp.Body)
+		for {
+			var l importLine
+			if err := dec.Decode(&l); errors.Is(err, io.EOF) {
+				return out
+			} else if err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			out = append(out, l)
+		}
+	}
+	csv := "title,due_at\nfirst,2030-01-01\n,\nthird,never\n"
+
+	got := lines(post("?dry_run=true", "text/csv", csv))
+	if len(got) != 4 || got[0].Row.Status != "VALID" || got[1].Row.Reason != "INVALID_ARGUMENT" ||
+		got[2].Row.Reason != "INVALID_ROW" || got[2].Row.Line != "4" || got[3].Summary == nil || !got[3].Summary.DryRun {
+		t.Fatalf("unexpected dry run %+v", got)
+	}
+	if _, total, _ := svc.ListTasks(context.Background(), 1, 10, todo.FilterAll); total != 0 {
+		t.Fatalf("dry run created %d tasks", total)
+	}
+	got = lines(post("?format=csv", "application/octet-stream", csv))
+	if got[0].Row.Status != "CREATED" || got[0].Row.ID == "" || got[3].Summary.Created != "1" || got[3].Summary.Failed != "2" {
+		t.Fatalf("unexpected import %+v", got)
+	}
+
+	var problem rest.Problem
+	decodeJSON(t, post("?format=xml", "text/csv", ""), http.StatusBadRequest, &problem)
+	decodeJSON(t, post("", "text/csv", "name\nx\n"), http.StatusBadRequest, &problem)
+	if problem.Code != "invalid_csv_header" {
+		t.Fatalf("unexpected problem %+v", problem)
+	}
+
+	resp, err := http.Get(srv.URL + "/v1/tasks:export?format=ics")
+	if err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/calendar") ||
+		!strings.Contains(resp.Header.Get("Content-Disposition"), "tasks.ics") || strings.Count(string(body), "BEGIN:VTODO") != 1 {
+		t.Fatalf("unexpected export %d %v:\n%s", resp.StatusCode, resp.Header, body)
+	}
+	// an empty NDJSON export is an empty body, not an error
+	resp, err = http.Get(srv.URL + "/v1/tasks:export?format=ndjson")
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("export: %v %v", resp, err)
+	}
+	resp.Body.Close()
+	decodeJSON(t, must(http.Get(srv.URL+"/v1/tasks:export?format=pdf")), http.StatusBadRequest, &problem)
+}
+
+func must(resp *http.Response, err error) *http.Response {
+	if err != nil {
+		panic(err)
+	}
+	return resp
+}
+
+func TestExportImportGRPC(t *testing.T) {
+	db := setupTestDB(t)
+	repo := todo.NewGormRepository(db)
+	svc := todo.NewService(repo, todo.Limits{}, nil)
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer()
+	pb.RegisterTodoServiceServer(srv, grpcapi.NewHandler(svc, todo.NewCommentService(todo.NewGormCommentRepository(db), repo, todo.Limits{}), nil))
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	client := pb.NewTodoServiceClient(conn)
+	ctx := context.Background()
+
+	// more tasks than one repository batch, as one import
+	var file strings.Builder
+	const n = 1200
+	for i := 0; i < n; i++ {
+		file.WriteString(`{"title":"task"}` + "\n")
+	}
+	stream, err := client.ImportTasks(ctx)
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	stream.Send(&pb.ImportTasksRequest{Data: &pb.ImportTasksRequest_Options{Options: &pb.ImportOptions{}}})
+	stream.Send(&pb.ImportTasksRequest{Data: &pb.ImportTasksRequest_Chunk{Chunk: []byte(file.String())}})
+	stream.CloseSend()
+	rows := 0
+	for {
+		msg, err := stream.Recv()
+		if err != nil {
+			t.Fatalf("recv: %v", err)
+		}
+		if s := msg.GetSummary(); s != nil {
+			if s.Created != n || rows != n {
+				t.Fatalf("summary %+v after %d rows", s, rows)
+			}
+			break
+		}
+		rows++
+	}
+
+	export, err := client.ExportTasks(ctx, &pb.ExportTasksRequest{Format: pb.TaskFormat_TASK_FORMAT_CSV})
+	if err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	var out bytes.Buffer
+	for {
+		msg, err := export.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("recv: %v", err)
+		}
+		out.Write(msg.Chunk)
+	}
+	ids := map[string]bool{}
+	for _, l := range strings.Split(strings.TrimSpace(out.String()), "\n")[1:] {
+		ids[strings.SplitN(l, ",", 2)[0]] = true
+	}
+	if len(ids) != n {
+		t.Fatalf("exported %d distinct tasks, want %d", len(ids), n)
+	}
+
+	// the options must come first
+	stream, _ = client.ImportTasks(ctx)
+	stream.Send(&pb.ImportTasksRequest{Data: &pb.ImportTasksRequest_Chunk{Chunk: []byte("{}")}})
+	stream.CloseSend()
+	if _, err := stream.Recv(); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected InvalidArgument, got %v", err)
+	}
+}
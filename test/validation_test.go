@@ -0,0 +1,154 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/fuzail/08-todosvc/internal/todo"
+)
+
+// violations returns the field violations of a validation error, or fails.
+func violations(t *testing.T, err error) map[string]string {
+	t.Helper()
+	var de *todo.Error
+	if !errors.As(err, &de) || de.Kind != todo.KindInvalid {
+		t.Fatalf("expected validation error, got %v", err)
+	}
+	out := map[string]string{}
+	for _, v := range de.Violations {
+		out[v.Field] = v.Description
+	}
+	return out
+}
+
+func newLimitedService(t *testing.T, limits todo.Limits) (todo.Service, todo.CommentService) {
+	t.Helper()
+	db := setupTestDB(t)
+	repo := todo.NewGormRepository(db)
+	return todo.NewService(repo, limits, nil), todo.NewCommentService(todo.NewGormCommentRepository(db), repo, limits)
+}
+
+func TestValidationTitleRequired(t *testing.T) {
+	svc, _ := newLimitedService(t, todo.Limits{})
+	ctx := context.Background()
+	for _, title := range []string{"", "   ", "\t\n"} {
+		_, err := svc.CreateTask(ctx, "", title, "", nil, "")
+		if got := violations(t, err)["title"]; got != "is required" {
+			t.Fatalf("title %q: unexpected violation %q", title, got)
+		}
+	}
+	task, _ := svc.CreateTask(ctx, "", "keep", "", nil, "")
+	if _, err := svc.UpdateTask(ctx, task.ID, " ", "desc"); violations(t, err)["title"] == "" {
+		t.Fatal("expected update to require a title")
+	}
+}
+
+func TestValidationLengths(t *testing.T) {
+	svc, comments := newLimitedService(t, todo.Limits{MaxTitleLength: 5, MaxDescriptionLength: 8, MaxCommentLength: 3})
+	ctx := context.Background()
+
+	// lengths count characters, not bytes
+	if _, err := svc.CreateTask(ctx, "", "héllo", "ünïcödé!", nil, ""); err != nil {
+		t.Fatalf("expected limits to count runes: %v", err)
+	}
+	_, err := svc.CreateTask(ctx, "", "toolong", "way too long", nil, "")
+	v := violations(t, err)
+	if v["title"] != "must be at most 5 characters" || v["description"] != "must be at most 8 characters" {
+		t.Fatalf("unexpected violations %v", v)
+	}
+
+	task, _ := svc.CreateTask(ctx, "", "ok", "", nil, "")
+	if _, err := comments.AddComment(ctx, task.ID, "ann", "long"); violations(t, err)["body"] == "" {
+		t.Fatal("expected comment length violation")
+	}
+}
+
+func TestValidationTrimsWhitespace(t *testing.T) {
+	svc, comments := newLimitedService(t, todo.Limits{MaxTitleLength: 4})
+	ctx := context.Background()
+
+	// trimming happens before the length check
+	task, err := svc.CreateTask(ctx, "", "  milk \n", "\n 2 liters\n", nil, "")
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	got, _ := svc.GetTask(ctx, task.ID)
+	if got.Title != "milk" || got.Description != "2 liters" {
+		t.Fatalf("expected trimmed fields, got %q %q", got.Title, got.Description)
+	}
+	c, err := comments.AddComment(ctx, task.ID, "ann", "  hi  ")
+	if err != nil || c.Body != "hi" {
+		t.Fatalf("expected trimmed comment, got %v %v", c, err)
+	}
+	if _, err := comments.AddComment(ctx, task.ID, "ann", "   "); !errors.Is(err, todo.ErrEmptyComment) {
+		t.Fatalf("expected ErrEmptyComment, got %v", err)
+	}
+}
+
+func TestValidationUTF8AndControlCharacters(t *testing.T) {
+	svc, _ := newLimitedService(t, todo.Limits{})
+	ctx := context.Background()
+
+	_, err := svc.CreateTask(ctx, "", "bad \xff byte", "", nil, "")
+	if got := violations(t, err)["title"]; got != "must be valid UTF-8" {
+		t.Fatalf("unexpected violation %q", got)
+	}
+	_, err = svc.CreateTask(ctx, "", "bell\a", "nul\x00", nil, "")
+	v := violations(t, err)
+	if v["title"] != "must not contain control characters" || v["description"] != "must not contain control characters" {
+		t.Fatalf("unexpected violations %v", v)
+	}
+	// line breaks and tabs are fine in descriptions, not in titles
+	if _, err := svc.CreateTask(ctx, "", "ok", "line one\n\tline two", nil, ""); err != nil {
+		t.Fatalf("multi-line description rejected: %v", err)
+	}
+	_, err = svc.CreateTask(ctx, "", "two\nlines", "", nil, "")
+	if violations(t, err)["title"] == "" {
+		t.Fatal("expected newline in title to be rejected")
+	}
+}
+
+func TestValidationPageSize(t *testing.T) {
+	svc, comments := newLimitedService(t, todo.Limits{MaxPageSize: 50})
+	ctx := context.Background()
+
+	if _, _, err := svc.ListTasks(ctx, 1, 50, todo.FilterAll); err != nil {
+		t.Fatalf("max page size rejected: %v", err)
+	}
+	for _, size := range []int{0, -1, 51, 1000000} {
+		_, _, err := svc.ListTasks(ctx, 1, size, todo.FilterAll)
+		if got := violations(t, err)["page_size"]; got != "must be between 1 and 50" {
+			t.Fatalf("page_size %d: unexpected violation %q", size, got)
+		}
+	}
+	if _, _, err := svc.ListTasks(ctx, 0, 10, todo.FilterAll); violations(t, err)["page"] == "" {
+		t.Fatal("expected page violation")
+	}
+	task, _ := svc.CreateTask(ctx, "", "t", "", nil, "")
+	if _, _, err := comments.ListComments(ctx, task.ID, 1, 51); violations(t, err)["page_size"] == "" {
+		t.Fatal("expected comment page_size violation")
+	}
+}
+
+func TestValidationSyncChanges(t *testing.T) {
+	svc, _ := newLimitedService(t, todo.Limits{})
+	ctx := context.Background()
+
+	changes := []todo.TaskChange{
+		{Task: todo.Task{ID: "0190c2a4-8e5b-7c3a-9f1e-2b4d6a8c0e11", Title: "fine"}},
+		{Task: todo.Task{ID: "0190c2a4-8e5b-7c3a-9f1e-2b4d6a8c0e12", Title: strings.Repeat("x", todo.DefaultMaxTitleLength+1)}},
+		// tombstones carry no content
+		{Task: todo.Task{ID: "0190c2a4-8e5b-7c3a-9f1e-2b4d6a8c0e13"}, Deleted: true},
+	}
+	_, err := svc.SyncTasks(ctx, "", changes, 0)
+	v := violations(t, err)
+	if len(v) != 1 || v["changes[1].task.title"] == "" {
+		t.Fatalf("unexpected violations %v", v)
+	}
+	// nothing was applied
+	if _, total, _ := svc.ListTasks(ctx, 1, 10, todo.FilterAll); total != 0 {
+		t.Fatalf("expected no tasks after rejected sync, got %d", total)
+	}
+}
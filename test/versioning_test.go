@@ -0,0 +1,97 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+
+	grpcapi "github.com/fuzail/08-todosvc/internal/grpc"
+	"github.com/fuzail/08-todosvc/internal/rest"
+	"github.com/fuzail/08-todosvc/internal/todo"
+	"github.com/fuzail/08-todosvc/pkg/storage"
+	pb "github.com/fuzail/08-todosvc/proto/todo/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestRESTLegacyPaths(t *testing.T) {
+	db := setupTestDB(t)
+	repo := todo.NewGormRepository(db)
+	blobs, _ := storage.NewFSStore(t.TempDir())
+	srv := newRESTServer(t, todo.NewService(repo, todo.Limits{}, nil),
+		todo.NewCommentService(todo.NewGormCommentRepository(db), repo, todo.Limits{}),
+		todo.NewAttachmentService(todo.NewGormAttachmentRepository(db), repo, blobs, 0, nil))
+
+	// the unversioned path still works, but says it is deprecated
+	resp, err := http.Post(srv.URL+"/tasks", "application/json", bytes.NewBufferString(`{"title":"old client"}`))
+	if err != nil {
+		t.Fatalf("post: %v", err)
+	}
+	if resp.Header.Get("Deprecation") == "" || resp.Header.Get("Sunset") == "" ||
+		resp.Header.Get("Link") != `</v1/tasks>; rel="successor-version"` {
+		t.Fatalf("missing deprecation headers: %v", resp.Header)
+	}
+	var created struct {
+		Task struct{ ID string }
+	}
+	decodeJSON(t, resp, http.StatusCreated, &created)
+
+	resp, err = http.Get(srv.URL + "/v1/tasks/" + created.Task.ID)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if resp.Header.Get("Deprecation") != "" {
+		t.Fatalf("versioned path marked deprecated")
+	}
+	decodeJSON(t, resp, http.StatusOK, &struct{}{})
+
+	req, _ := http.NewRequest(http.MethodGet, "/tasks/"+created.Task.ID, nil)
+	if got := rest.RoutePattern(req); got != "/tasks/{id}" {
+		t.Fatalf("legacy route pattern %q", got)
+	}
+	req, _ = http.NewRequest(http.MethodGet, "/v1/tasks/"+created.Task.ID+"/comments", nil)
+	if got := rest.RoutePattern(req); got != "/v1/tasks/{id}/comments" {
+		t.Fatalf("route pattern %q", got)
+	}
+}
+
+func TestGRPCLegacyServiceName(t *testing.T) {
+	db := setupTestDB(t)
+	repo := todo.NewGormRepository(db)
+	svc := todo.NewService(repo, todo.Limits{}, nil)
+	handler := grpcapi.NewHandler(svc, todo.NewCommentService(todo.NewGormCommentRepository(db), repo, todo.Limits{}), nil)
+
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer()
+	pb.RegisterTodoServiceServer(srv, handler)
+	grpcapi.RegisterLegacyService(srv, handler)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	if !strings.HasPrefix(pb.TodoService_CreateTask_FullMethodName, "/todo.v1.") {
+		t.Fatalf("unexpected method name %s", pb.TodoService_CreateTask_FullMethodName)
+	}
+	created, err := pb.NewTodoServiceClient(conn).CreateTask(context.Background(), &pb.CreateTaskRequest{Title: "v1"})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	// a client generated from the old package calls the old method name
+	var got pb.GetTaskResponse
+	if err := conn.Invoke(context.Background(), "/todo.TodoService/GetTask", &pb.GetTaskRequest{Id: created.Task.Id}, &got); err != nil {
+		t.Fatalf("legacy get: %v", err)
+	}
+	if got.Task.GetTitle() != "v1" {
+		t.Fatalf("unexpected task %v", got.Task)
+	}
+}